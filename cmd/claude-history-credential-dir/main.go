@@ -0,0 +1,40 @@
+// claude-history-credential-dir is the reference credential helper for
+// claude-history-sync. It keeps tokens as plain JSON files in a directory,
+// to try the helper protocol out or to test against; use a helper for a
+// real password manager otherwise.
+//
+//	claude-history-sync config set token_store helper
+//	claude-history-sync config set credential_helper "claude-history-credential-dir --dir /tmp/creds"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/credhelper"
+)
+
+func main() {
+	fs := flag.NewFlagSet("claude-history-credential-dir", flag.ContinueOnError)
+	dir := fs.String("dir", filepath.Join(config.DefaultConfigDir(), "credentials"), "directory to keep tokens in")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claude-history-credential-dir [--dir <dir>] get|store|erase|get-secret|store-secret|erase-secret\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	helper := &credhelper.DirHelper{Dir: *dir}
+	if err := helper.Serve(fs.Arg(0), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "claude-history-credential-dir: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/martinjt/claude-history-cli/internal/auth"
+	"github.com/martinjt/claude-history-cli/internal/config"
+)
+
+func runAuth(args []string) error {
+	if len(args) == 0 || args[0] != "store" {
+		return fmt.Errorf("usage: claude-history-sync auth store [migrate --to <store>]")
+	}
+	args = args[1:]
+
+	if len(args) == 0 {
+		return runAuthStore()
+	}
+	switch args[0] {
+	case "migrate":
+		return runAuthStoreMigrate(args[1:])
+	default:
+		return fmt.Errorf("unknown auth store command %q (expected migrate)", args[0])
+	}
+}
+
+// storeOptions opens the profile's tokens in the given store.
+func storeOptions(p *config.Profile, backend string) auth.StoreOptions {
+	return auth.StoreOptions{
+		Backend:        backend,
+		Namespace:      p.TokenNamespace(),
+		FileEncryption: p.TokenFileEncryption,
+		Helper:         p.CredentialHelper,
+	}
+}
+
+// runAuthStore shows where each profile's tokens are kept.
+func runAuthStore() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	fmt.Printf("token_store: %s\n", cfg.TokenStore)
+	for _, name := range cfg.ProfileNames() {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+		store, err := auth.NewTokenStore(storeOptions(p, cfg.TokenStore))
+		if err != nil {
+			return err
+		}
+
+		state := "tokens stored"
+		if _, err := store.GetAccessToken(); errors.Is(err, auth.ErrNoTokens) {
+			state = "no tokens"
+		} else if err != nil {
+			state = err.Error()
+		}
+		fmt.Printf("  %-12s %s, %s\n", name+":", auth.StoreName(store), state)
+	}
+	return nil
+}
+
+// runAuthStoreMigrate moves every profile's tokens to another store and
+// points token_store at it, so switching stores doesn't mean logging in
+// again or leaving tokens behind in the old one.
+func runAuthStoreMigrate(args []string) error {
+	fs := flag.NewFlagSet("auth store migrate", flag.ContinueOnError)
+	to := fs.String("to", "", "store to move tokens to: keychain, file, helper or auto")
+	from := fs.String("from", "", "store to move tokens from (default: token_store)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if *from == "" {
+		*from = cfg.TokenStore
+	}
+	if *to == "" {
+		return fmt.Errorf("--to is required (keychain, file, helper or auto)")
+	}
+	// Tokens in memory die with the process, so there's nothing to move
+	// out of it and no point moving into it
+	if *to == config.TokenStoreMemory || *from == config.TokenStoreMemory {
+		return fmt.Errorf("the memory store only lasts as long as one command")
+	}
+
+	for _, name := range cfg.ProfileNames() {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+		src, err := auth.NewTokenStore(storeOptions(p, *from))
+		if err != nil {
+			return err
+		}
+		dst, err := auth.NewTokenStore(storeOptions(p, *to))
+		if err != nil {
+			return err
+		}
+		if auth.StoreName(src) == auth.StoreName(dst) {
+			fmt.Printf("%s: already in %s\n", name, auth.StoreName(dst))
+			continue
+		}
+
+		moved, err := auth.MoveTokens(src, dst)
+		if err != nil {
+			return fmt.Errorf("moving %s tokens from %s to %s: %w", name, auth.StoreName(src), auth.StoreName(dst), err)
+		}
+		if moved {
+			fmt.Printf("%s: moved from %s to %s\n", name, auth.StoreName(src), auth.StoreName(dst))
+		} else {
+			fmt.Printf("%s: no tokens in %s\n", name, auth.StoreName(src))
+		}
+
+		// The content keys go with the tokens, or encrypted uploads stop
+		secrets, err := auth.MoveSecrets(src, dst, []string{contentKeysSecret})
+		if err != nil {
+			return fmt.Errorf("moving %s secrets from %s to %s: %w", name, auth.StoreName(src), auth.StoreName(dst), err)
+		}
+		if secrets > 0 {
+			fmt.Printf("%s: moved content keys from %s to %s\n", name, auth.StoreName(src), auth.StoreName(dst))
+		}
+	}
+
+	path := config.DefaultConfigPath()
+	if err := config.SetInFile(path, "token_store", *to); err != nil {
+		return err
+	}
+	fmt.Printf("Set token_store = %s\n", *to)
+
+	// A higher layer would hide the new value
+	if effective, err := loadConfig(); err == nil {
+		if source := effective.Source("token_store"); source.Layer == config.LayerEnv || source.Layer == config.LayerFlag {
+			fmt.Fprintf(os.Stderr, "Warning: token_store is overridden by %s\n", source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/redact"
+)
+
+// configFlags holds the global --set overrides, which take precedence over
+// every other configuration layer.
+var configFlags []string
+
+// loadConfig loads the layered config, including --set overrides.
+func loadConfig() (*config.Config, error) {
+	opts := config.DefaultLoadOptions()
+	opts.Flags = configFlags
+	return config.LoadWith(opts)
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claude-history-sync config get|set|unset|list|path|edit|validate|explain")
+	}
+
+	path := config.DefaultConfigPath()
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: claude-history-sync config get <key>")
+		}
+		return configGet(args[1])
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: claude-history-sync config set <key> <value...>")
+		}
+		return configSet(path, args[1], args[2:])
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: claude-history-sync config unset <key>")
+		}
+		return configUnset(path, args[1])
+	case "list":
+		return configList()
+	case "path":
+		fmt.Println(path)
+		return nil
+	case "edit":
+		return configEdit(path)
+	case "validate":
+		return configValidate()
+	case "explain":
+		return configExplain(args[1:])
+	default:
+		return fmt.Errorf("unknown config command %q (expected get, set, unset, list, path, edit, validate or explain)", args[0])
+	}
+}
+
+// effectiveConfig loads the config as a session in the current directory
+// would see it.
+func effectiveConfig() (*config.Config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return cfg, nil
+	}
+	return cfg.ForDir(cwd)
+}
+
+func configGet(key string) error {
+	cfg, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+	value, err := cfg.Get(key)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case []string:
+		for _, s := range v {
+			fmt.Println(s)
+		}
+	case []redact.Rule:
+		for _, r := range v {
+			fmt.Println(r.Pattern)
+		}
+	case []config.Route:
+		for _, r := range v {
+			fmt.Printf("%s -> %s\n", r.Path, r.Profile)
+		}
+	case map[string]config.Profile:
+		for _, name := range cfg.ProfileNames()[1:] {
+			fmt.Printf("%s: %s\n", name, v[name].APIEndpoint)
+		}
+	default:
+		fmt.Println(config.FormatValue(value))
+	}
+	return nil
+}
+
+func configSet(path, key string, args []string) error {
+	field, err := config.LookupField(key)
+	if err != nil {
+		return err
+	}
+	value, err := field.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Check the value before writing it, so a bad value never reaches the
+	// file. Problems with other settings aren't this command's concern,
+	// and set may well be how they get fixed.
+	cfg := config.DefaultConfig()
+	if err := cfg.Set(key, value); err != nil {
+		return err
+	}
+	for _, p := range cfg.Validate() {
+		if p.Key != key {
+			continue
+		}
+		if !p.Warning {
+			return fmt.Errorf("%s", p)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", p)
+	}
+
+	if err := config.SetInFile(path, key, value); err != nil {
+		return err
+	}
+	fmt.Printf("Set %s = %s\n", key, config.FormatValue(value))
+
+	// A higher layer would hide the new value
+	if effective, err := loadConfig(); err == nil {
+		if source := effective.Source(key); source.Layer == config.LayerEnv || source.Layer == config.LayerFlag {
+			fmt.Fprintf(os.Stderr, "Warning: %s is overridden by %s\n", key, source)
+		}
+	}
+	return nil
+}
+
+func configUnset(path, key string) error {
+	if _, err := config.LookupField(key); err != nil {
+		return err
+	}
+
+	removed, err := config.UnsetInFile(path, key)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		fmt.Printf("%s is not set in %s\n", key, path)
+		return nil
+	}
+
+	value, _ := config.DefaultConfig().Get(key)
+	if def := formatSetting(value); def != "" {
+		fmt.Printf("Unset %s (default: %s)\n", key, def)
+	} else {
+		fmt.Printf("Unset %s\n", key)
+	}
+	return nil
+}
+
+func configList() error {
+	cfg, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+
+	fields := config.Fields()
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f.Key))
+	}
+	for _, f := range fields {
+		value, _ := cfg.Get(f.Key)
+		fmt.Printf("%-*s  %s  [%s]\n", width, f.Key, formatSetting(value), cfg.Source(f.Key).Layer)
+	}
+	return nil
+}
+
+func configExplain(keys []string) error {
+	cfg, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Layers, lowest precedence first:")
+	fmt.Println("  default")
+	for _, source := range cfg.Layers() {
+		// The env and flag layers are there even when nothing is set
+		if (source.Layer == config.LayerEnv || source.Layer == config.LayerFlag) && !layerUsed(cfg, source.Layer) {
+			continue
+		}
+		fmt.Printf("  %s\n", source)
+	}
+
+	if len(keys) == 0 {
+		for _, f := range config.Fields() {
+			keys = append(keys, f.Key)
+		}
+	}
+
+	for _, key := range keys {
+		settings, err := cfg.Explain(key)
+		if err != nil {
+			return err
+		}
+		value, _ := cfg.Get(key)
+		fmt.Printf("\n%s = %s\n", key, formatSetting(value))
+		for i, s := range settings {
+			marker := " "
+			if i == len(settings)-1 {
+				marker = "*"
+			}
+			value := formatSetting(s.Value)
+			if value == "" {
+				value = "(empty)"
+			}
+			fmt.Printf("  %s %s: %s\n", marker, s.Source, value)
+		}
+	}
+	return nil
+}
+
+func layerUsed(cfg *config.Config, layer string) bool {
+	for _, f := range config.Fields() {
+		if cfg.Source(f.Key).Layer == layer {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSetting renders a value for display, showing redact rules by
+// their patterns, profiles by name and routes as path->profile.
+func formatSetting(value interface{}) string {
+	var parts []string
+	switch v := value.(type) {
+	case []redact.Rule:
+		for _, r := range v {
+			parts = append(parts, r.Pattern)
+		}
+	case map[string]config.Profile:
+		for name := range v {
+			parts = append(parts, name)
+		}
+		sort.Strings(parts)
+	case []config.Route:
+		for _, r := range v {
+			parts = append(parts, r.Path+"->"+r.Profile)
+		}
+	default:
+		return config.FormatValue(value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func configEdit(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := config.DefaultConfig().SaveTo(path); err != nil {
+			return err
+		}
+	}
+
+	editor := strings.Fields(os.Getenv("VISUAL"))
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running editor: %w", err)
+	}
+
+	return configValidate()
+}
+
+// configValidate checks each config file strictly, then the effective
+// values, saying which layer each problem came from.
+func configValidate() error {
+	type file struct{ path, layer string }
+	files := []file{
+		{config.SystemConfigPath, config.LayerSystem},
+		{config.DefaultConfigPath(), config.LayerUser},
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if path := config.FindProjectConfig(cwd); path != "" {
+			files = append(files, file{path, config.LayerProject})
+		}
+	}
+
+	var problems []config.Problem
+	for _, f := range files {
+		fileProblems, err := config.Check(f.path, f.layer)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		problems = append(problems, fileProblems...)
+	}
+
+	cfg, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+	problems = append(problems, cfg.Validate()...)
+
+	errorCount := 0
+	for _, p := range problems {
+		level := "warning"
+		if !p.Warning {
+			level = "error"
+			errorCount++
+		}
+		fmt.Printf("%s: %s (from %s)\n", level, p, p.Source)
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("config has %d error(s)", errorCount)
+	}
+	fmt.Println("Config is valid")
+	return nil
+}
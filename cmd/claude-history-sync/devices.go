@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/auth"
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+)
+
+// registerDevice records this machine in the account's device list. Older
+// servers have no device list, which is fine.
+func registerDevice(ctx context.Context, p *config.Profile, authManager *auth.Manager) {
+	hostname, _ := os.Hostname()
+	client := newAPIClient(p, authManager)
+	err := client.RegisterDevice(ctx, &api.Device{
+		MachineID:  p.MachineID,
+		Hostname:   hostname,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		LoggedInAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil && !errors.Is(err, api.ErrNotSupported) {
+		slog.Warn("failed to register this machine", logging.KeyProfile, p.Name, logging.KeyError, err)
+	}
+}
+
+// runDevices lists the machines logged in to the active profile's account.
+func runDevices() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
+
+	authManager := newAuthManager(p)
+	if _, err := authManager.GetValidToken(ctx); err != nil {
+		return fmt.Errorf("not authenticated. Run 'claude-history-sync %slogin' first: %w", profileArg(p), err)
+	}
+
+	devices, err := newAPIClient(p, authManager).ListDevices(ctx)
+	if errors.Is(err, api.ErrNotSupported) {
+		return fmt.Errorf("%s doesn't keep a device list", p.APIEndpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("listing devices: %w", err)
+	}
+
+	if len(devices) == 0 {
+		fmt.Println("No devices registered.")
+		return nil
+	}
+	for _, d := range devices {
+		marker := " "
+		if d.MachineID == p.MachineID {
+			marker = "*"
+		}
+		fmt.Printf("%s %-24s %-20s %-14s logged in %s", marker, d.MachineID, d.Hostname, d.Platform, d.LoggedInAt)
+		if d.LastSeenAt != "" {
+			fmt.Printf(", last seen %s", d.LastSeenAt)
+		}
+		fmt.Println()
+	}
+	fmt.Println("\n* this machine. Sign another out with 'claude-history-sync logout --device <machine-id>'.")
+	return nil
+}
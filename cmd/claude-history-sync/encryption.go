@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/auth"
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+	"golang.org/x/term"
+)
+
+// contentKeysSecret is the name a profile's content keys are kept under
+// in its token store.
+const contentKeysSecret = "content-keys"
+
+func runEncryption(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claude-history-sync encryption init|recover|rotate|status")
+	}
+
+	switch args[0] {
+	case "init":
+		return runEncryptionInit()
+	case "recover":
+		return runEncryptionRecover()
+	case "rotate":
+		return runEncryptionRotate()
+	case "status":
+		return runEncryptionStatus()
+	default:
+		return fmt.Errorf("unknown encryption command %q (expected init, recover, rotate or status)", args[0])
+	}
+}
+
+// loadContentKeys reads the profile's content keys from its token store.
+// Without any stored there, the key comes from the recovery phrase in
+// RecoveryPhraseEnv, for CI and other machines that don't keep keys.
+func loadContentKeys(authManager *auth.Manager) (*e2ee.Keyring, error) {
+	var data []byte
+	secrets, err := authManager.Secrets()
+	if err == nil {
+		data, err = secrets.GetSecret(contentKeysSecret)
+	}
+	if err == nil {
+		return e2ee.ParseKeyring(data)
+	}
+
+	if phrase := os.Getenv(e2ee.RecoveryPhraseEnv); phrase != "" {
+		key, err := e2ee.KeyFromPhrase(phrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e2ee.RecoveryPhraseEnv, err)
+		}
+		keyring := e2ee.NewKeyring()
+		keyring.Add(key, true)
+		return keyring, nil
+	}
+	return nil, err
+}
+
+// saveContentKeys keeps the keyring in the profile's token store.
+func saveContentKeys(authManager *auth.Manager, keyring *e2ee.Keyring) error {
+	secrets, err := authManager.Secrets()
+	if err != nil {
+		return fmt.Errorf("content keys are kept in the token store: %w", err)
+	}
+	data, err := keyring.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := secrets.SaveSecret(contentKeysSecret, data); err != nil {
+		return fmt.Errorf("saving content keys: %w", err)
+	}
+	return nil
+}
+
+// uploadKey is the key to seal the profile's uploads with, or nil when
+// encrypt_content is off. With it on, a missing key is an error rather
+// than a reason to upload in the clear.
+func uploadKey(p *config.Profile, authManager *auth.Manager) (*e2ee.Key, error) {
+	if !p.EncryptsContent() {
+		return nil, nil
+	}
+	keyring, err := loadContentKeys(authManager)
+	if errors.Is(err, auth.ErrNoSecret) {
+		return nil, fmt.Errorf("encrypt_content is on but there is no content key here; run 'claude-history-sync %sencryption recover' with the recovery phrase, or 'encryption init' to make one", profileArg(p))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading content key (or set %s): %w", e2ee.RecoveryPhraseEnv, err)
+	}
+	return keyring.Current(), nil
+}
+
+// readingKeys are the keys to open what the server sends back with, or nil
+// if there are none here. Sealed values then fail to open with a hint to
+// recover the key, so a missing key only matters with encrypt_content on.
+func readingKeys(p *config.Profile, authManager *auth.Manager) (*e2ee.Keyring, error) {
+	keyring, err := loadContentKeys(authManager)
+	if err != nil && (errors.Is(err, auth.ErrNoSecret) || !p.EncryptsContent()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading content keys: %w", err)
+	}
+	return keyring, nil
+}
+
+// sealMetadata seals the metadata that names the project, its paths and
+// git remote. Branches, commits and versions stay readable for the server
+// to index.
+func sealMetadata(key *e2ee.Key, sessionID string, meta *api.SessionMetadata) *api.SessionMetadata {
+	if meta == nil {
+		return nil
+	}
+	meta.CWD = key.Seal(sessionID, e2ee.FieldCWD, meta.CWD)
+	meta.SourceDir = key.Seal(sessionID, e2ee.FieldSourceDir, meta.SourceDir)
+	meta.GitRemote = key.Seal(sessionID, e2ee.FieldGitRemote, meta.GitRemote)
+	return meta
+}
+
+// encryptionProfile loads the active profile and its auth manager.
+func encryptionProfile() (*config.Profile, *auth.Manager, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, newAuthManager(p), nil
+}
+
+// newContentKey makes a key from a new recovery phrase and shows the
+// phrase, which is the only way to get the key back.
+func newContentKey() (*e2ee.Key, error) {
+	phrase, err := e2ee.NewRecoveryPhrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := e2ee.KeyFromPhrase(phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("\nRecovery phrase for content key %s:\n\n    %s\n\n", key.ID, phrase)
+	fmt.Println("Write it down and keep it safe. It's needed to read your synced history")
+	fmt.Println("on another machine or after losing this one, and it can't be recovered:")
+	fmt.Println("the server never sees the key.")
+	return key, nil
+}
+
+// enableEncryption turns encrypt_content on for the profile in the config
+// file. Keys are per profile, so with other profiles about it goes under
+// the profile's own settings, where the others won't inherit it and stop
+// for want of a key.
+func enableEncryption(p *config.Profile) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	path := config.DefaultConfigPath()
+	if len(cfg.ProfileNames()) == 1 {
+		err = config.SetInFile(path, "encrypt_content", true)
+	} else {
+		err = config.SetProfileInFile(path, p.Name, "encrypt_content", true)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nSet encrypt_content = true for profile %s\n", p.Name)
+
+	if effective, err := loadConfig(); err == nil {
+		if ep, err := effective.Profile(p.Name); err == nil && !ep.EncryptsContent() {
+			fmt.Fprintf(os.Stderr, "Warning: encrypt_content is overridden by %s\n", effective.Source("encrypt_content"))
+		}
+	}
+	return nil
+}
+
+func runEncryptionInit() error {
+	p, authManager, err := encryptionProfile()
+	if err != nil {
+		return err
+	}
+	if keyring, err := loadContentKeys(authManager); err == nil {
+		return fmt.Errorf("profile %s already has content key %s; use 'encryption rotate' to replace it", p.Name, keyring.Current().ID)
+	} else if !errors.Is(err, auth.ErrNoSecret) {
+		return err
+	}
+
+	key, err := newContentKey()
+	if err != nil {
+		return err
+	}
+	keyring := e2ee.NewKeyring()
+	keyring.Add(key, true)
+	if err := saveContentKeys(authManager, keyring); err != nil {
+		return err
+	}
+	return enableEncryption(p)
+}
+
+// readRecoveryPhrase takes the phrase from RecoveryPhraseEnv, or asks for
+// it on the terminal, or reads a line of stdin.
+func readRecoveryPhrase() (string, error) {
+	if phrase := os.Getenv(e2ee.RecoveryPhraseEnv); phrase != "" {
+		return phrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading recovery phrase: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Recovery phrase: ")
+	phrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading recovery phrase: %w", err)
+	}
+	return string(phrase), nil
+}
+
+// runEncryptionRecover adds the key for a recovery phrase and makes it
+// current. To read everything after rotations, recover each phrase, the
+// newest last.
+func runEncryptionRecover() error {
+	p, authManager, err := encryptionProfile()
+	if err != nil {
+		return err
+	}
+	phrase, err := readRecoveryPhrase()
+	if err != nil {
+		return err
+	}
+	key, err := e2ee.KeyFromPhrase(phrase)
+	if err != nil {
+		return err
+	}
+
+	keyring, err := loadContentKeys(authManager)
+	if errors.Is(err, auth.ErrNoSecret) {
+		keyring = e2ee.NewKeyring()
+	} else if err != nil {
+		return err
+	}
+	keyring.Add(key, true)
+	if err := saveContentKeys(authManager, keyring); err != nil {
+		return err
+	}
+
+	fmt.Printf("Recovered content key %s for profile %s; it seals new uploads.\n", key.ID, p.Name)
+	return enableEncryption(p)
+}
+
+// runEncryptionRotate replaces the current key with a new one. The old
+// keys stay, to read what they sealed, and every session is uploaded again
+// under the new key on the next sync.
+func runEncryptionRotate() error {
+	p, authManager, err := encryptionProfile()
+	if err != nil {
+		return err
+	}
+	keyring, err := loadContentKeys(authManager)
+	if errors.Is(err, auth.ErrNoSecret) {
+		return fmt.Errorf("profile %s has no content key to rotate; use 'encryption init'", p.Name)
+	} else if err != nil {
+		return err
+	}
+	old := keyring.Current().ID
+
+	key, err := newContentKey()
+	if err != nil {
+		return err
+	}
+	keyring.Add(key, true)
+	if err := saveContentKeys(authManager, keyring); err != nil {
+		return err
+	}
+
+	statePath := sync.ProfileStatePath(p.Name)
+	release, err := sync.LockState(context.Background(), statePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+	state, err := sync.LoadState(statePath)
+	if err != nil {
+		return fmt.Errorf("loading sync state: %w", err)
+	}
+	state.ResetProgress()
+	if err := state.Save(statePath); err != nil {
+		return fmt.Errorf("saving sync state: %w", err)
+	}
+
+	fmt.Printf("\nRotated content key %s to %s. The next sync uploads every session again\n", old, key.ID)
+	fmt.Println("under the new key. Run 'encryption recover' with the new phrase on your")
+	fmt.Println("other machines; the old phrase still opens anything the old key sealed.")
+	return nil
+}
+
+func runEncryptionStatus() error {
+	p, authManager, err := encryptionProfile()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Profile %s:\n", p.Name)
+	printEncryption(p, authManager)
+	return nil
+}
+
+// printEncryption shows whether uploads are sealed and with which key.
+func printEncryption(p *config.Profile, authManager *auth.Manager) {
+	state := "off"
+	if p.EncryptsContent() {
+		state = "on"
+	}
+	keyring, err := loadContentKeys(authManager)
+	switch {
+	case err == nil:
+		fmt.Printf("  Encryption:   %s (key %s, %d in keyring)\n", state, keyring.Current().ID, keyring.Len())
+	case errors.Is(err, auth.ErrNoSecret) && p.EncryptsContent():
+		fmt.Printf("  Encryption:   on, but no content key here (run encryption recover)\n")
+	case errors.Is(err, auth.ErrNoSecret):
+		fmt.Printf("  Encryption:   off\n")
+	default:
+		fmt.Printf("  Encryption:   %s (%v)\n", state, err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/export"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", export.FormatMarkdown, "output format: md, html or json")
+	project := fs.String("project", "", "only sessions whose project path contains this text")
+	sessions := fs.String("session", "", "comma-separated session IDs or ID prefixes")
+	since := fs.String("since", "", "only sessions active at or after this time (YYYY-MM-DD, RFC 3339 or age like 7d)")
+	until := fs.String("until", "", "only sessions active before this time")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	outDir := fs.String("out-dir", "", "write one file per session into this directory")
+	remote := fs.Bool("remote", false, "export the sessions stored on the server, from every machine (requires login)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != "" && *outDir != "" {
+		return fmt.Errorf("--output and --out-dir can't be used together")
+	}
+
+	now := time.Now()
+	sinceTime, err := parseTimeFlag(*since, now)
+	if err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	untilTime, err := parseTimeFlag(*until, now)
+	if err != nil {
+		return fmt.Errorf("--until: %w", err)
+	}
+
+	// Session IDs may also be given as arguments
+	prefixes := append(splitList(*sessions), fs.Args()...)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	var found []*export.Transcript
+	if *remote {
+		found, err = remoteTranscripts(cfg, prefixes)
+	} else {
+		found, err = localTranscripts(cfg, prefixes)
+	}
+	if err != nil {
+		return err
+	}
+
+	var transcripts []*export.Transcript
+	for _, t := range found {
+		if *project != "" && !strings.Contains(strings.ToLower(t.Project), strings.ToLower(*project)) {
+			continue
+		}
+		if !activeWithin(t, sinceTime, untilTime) || len(t.Entries) == 0 {
+			continue
+		}
+		transcripts = append(transcripts, t)
+	}
+
+	if len(transcripts) == 0 {
+		return fmt.Errorf("no sessions matched")
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		for _, t := range transcripts {
+			path := filepath.Join(*outDir, t.SessionID+export.Extension(*format))
+			if err := writeExportFile(path, *format, []*export.Transcript{t}); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d sessions to %s\n", len(transcripts), *outDir)
+		return nil
+	}
+
+	if *output != "" {
+		return writeExportFile(*output, *format, transcripts)
+	}
+
+	return export.Write(os.Stdout, *format, transcripts)
+}
+
+// localTranscripts reads the session files on this machine.
+func localTranscripts(cfg *config.Config, prefixes []string) ([]*export.Transcript, error) {
+	files, err := sync.ScanDirs(cfg.DataDirs(), cfg.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("scanning files: %w", err)
+	}
+
+	var transcripts []*export.Transcript
+	for _, file := range files {
+		if len(prefixes) > 0 && !hasAnyPrefix(file.SessionID, prefixes) {
+			continue
+		}
+
+		session, err := sync.ReadSession(file)
+		if err != nil {
+			slog.Warn("error reading session", logging.KeySession, file.SessionID, "path", file.Path, logging.KeyError, err)
+			continue
+		}
+		transcripts = append(transcripts, export.Normalize(session))
+	}
+	return transcripts, nil
+}
+
+// remoteTranscripts fetches the sessions the active profile's server holds,
+// opening any that encrypt_content sealed.
+func remoteTranscripts(cfg *config.Config, prefixes []string) ([]*export.Transcript, error) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	authManager := newAuthManager(p)
+	if _, err := authManager.GetValidToken(ctx); err != nil {
+		return nil, fmt.Errorf("not authenticated. Run 'claude-history-sync %slogin' first: %w", profileArg(p), err)
+	}
+	keys, err := readingKeys(p, authManager)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newAPIClient(p, authManager)
+	list, err := client.GetConversations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing remote conversations: %w", err)
+	}
+
+	var transcripts []*export.Transcript
+	for _, conv := range list.Conversations {
+		if len(prefixes) > 0 && !hasAnyPrefix(conv.SessionID, prefixes) {
+			continue
+		}
+
+		full, err := client.GetConversation(ctx, conv.SessionID)
+		if err == nil {
+			var t *export.Transcript
+			if t, err = export.NormalizeRemote(full, keys); err == nil {
+				transcripts = append(transcripts, t)
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		slog.Warn("error fetching session", logging.KeySession, conv.SessionID, logging.KeyError, err)
+	}
+	return transcripts, nil
+}
+
+func writeExportFile(path, format string, transcripts []*export.Transcript) error {
+	// Transcripts are as private as the sessions they come from
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+
+	if err := export.Write(f, format, transcripts); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return f.Close()
+}
+
+func hasAnyPrefix(sessionID string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(sessionID, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeWithin reports whether a transcript has activity inside the window.
+func activeWithin(t *export.Transcript, since, until time.Time) bool {
+	if since.IsZero() && until.IsZero() {
+		return true
+	}
+
+	started, err1 := time.Parse(time.RFC3339Nano, t.StartedAt)
+	ended, err2 := time.Parse(time.RFC3339Nano, t.EndedAt)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	if !since.IsZero() && ended.Before(since) {
+		return false
+	}
+	if !until.IsZero() && !started.Before(until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
+)
+
+// parseTimeFlag parses the values accepted by --since and --until: a date
+// (2006-01-02, local time), an RFC 3339 timestamp, or a relative age such as
+// 90m, 36h, 7d or 2w counted back from now.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	unit := value[len(value)-1]
+	if n, err := strconv.Atoi(value[:len(value)-1]); err == nil && n >= 0 {
+		switch unit {
+		case 'd':
+			return now.AddDate(0, 0, -n), nil
+		case 'w':
+			return now.AddDate(0, 0, -7*n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q (use YYYY-MM-DD, RFC 3339, or an age like 7d)", value)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// logOptions are the global --log-* flags.
+var logOptions logging.Options
+
+// parseGlobalFlags consumes the flags that come before the command and
+// returns the remaining arguments, starting with the command.
+func parseGlobalFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("claude-history-sync", flag.ContinueOnError)
+	fs.Usage = printUsage
+	var overrides stringList
+	fs.Var(&overrides, "set", "override a setting for this run, as key=value (repeatable)")
+	fs.StringVar(&profileFlag, "profile", "", "use this profile instead of the default")
+	fs.StringVar(&logOptions.Level, "log-level", "", "log records at this level and above: debug, info, warn or error")
+	fs.StringVar(&logOptions.Format, "log-format", "", "write log records as text or json")
+	fs.StringVar(&logOptions.File, "log-file", "", "write log records to this file, rotating it when it grows large")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	configFlags = overrides
+	return fs.Args(), nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/hooks"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// defaultHookBudget is how long a hook run may take before it gives up and
+// leaves the session to the next scheduled sync.
+const defaultHookBudget = 10 * time.Second
+
+func runHook(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "install":
+			return runHookInstall(args[1:])
+		case "uninstall":
+			return runHookUninstall(args[1:])
+		}
+	}
+
+	fs := flag.NewFlagSet("hook", flag.ContinueOnError)
+	budget := fs.Duration("timeout", defaultHookBudget, "give up after this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// A hook must never disturb the Claude Code session: failures are
+	// logged, to stderr unless --log-file says otherwise, which Claude Code
+	// only shows in debug mode, and the exit status is always 0 (2 would
+	// block the session).
+	if err := syncFromHook(*budget); err != nil {
+		slog.Error("hook sync failed", logging.KeyError, err)
+	}
+	return nil
+}
+
+// syncFromHook syncs the one transcript named in the hook event on stdin.
+func syncFromHook(budget time.Duration) error {
+	in, err := hooks.ReadInput(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	file, err := sync.FileInfoFor(cfg.DataDirs(), in.TranscriptPath)
+	if err != nil {
+		return err
+	}
+	if sync.IsExcluded(file.Path, cfg.ExcludePatterns) {
+		return nil
+	}
+	active, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
+	t, err := resolveSession(cfg, active, file)
+	if err != nil {
+		return err
+	}
+	if !t.cfg.SyncEnabled || t.skipped(active) {
+		return nil
+	}
+	p, err := cfg.Profile(t.profile)
+	if err != nil {
+		return err
+	}
+
+	authManager := newAuthManager(p)
+	if _, err := authManager.GetValidToken(ctx); err != nil {
+		return fmt.Errorf("not authenticated: %w", err)
+	}
+
+	contentKey, err := uploadKey(p, authManager)
+	if err != nil {
+		return err
+	}
+	apiClient := newAPIClient(p, authManager)
+
+	statePath := sync.ProfileStatePath(p.Name)
+	release, err := sync.LockState(ctx, statePath)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s: out of time waiting for another sync, leaving it for the next sync", in.HookEventName)
+		}
+		return err
+	}
+	defer release()
+	state, err := sync.LoadState(statePath)
+	if err != nil {
+		return fmt.Errorf("loading sync state: %w", err)
+	}
+	state.TrackFile(file)
+
+	start := time.Now()
+	processed, ok, err := syncSession(ctx, apiClient, p, t.cfg, state, file, contentKey)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s: out of time after %s, leaving it for the next sync", in.HookEventName, budget)
+		}
+		return err
+	}
+	if ok {
+		sessionLogger(p, file).Info("session synced", "event", in.HookEventName,
+			logging.KeyMessages, processed, logging.KeyDuration, time.Since(start))
+	}
+
+	if err := state.Save(statePath); err != nil {
+		return fmt.Errorf("saving sync state: %w", err)
+	}
+	return nil
+}
+
+func runHookInstall(args []string) error {
+	fs := flag.NewFlagSet("hook install", flag.ContinueOnError)
+	settingsPath := fs.String("settings", hooks.SettingsPath(), "Claude Code settings file to add the hook to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	changed, err := hooks.Install(*settingsPath, hooks.Command(exe))
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		fmt.Printf("Sync hook already installed in %s\n", *settingsPath)
+		return nil
+	}
+	fmt.Printf("Installed sync hook for %s in %s\n", strings.Join(hooks.Events, ", "), *settingsPath)
+	fmt.Println("Restart running Claude Code sessions to pick it up.")
+	return nil
+}
+
+func runHookUninstall(args []string) error {
+	fs := flag.NewFlagSet("hook uninstall", flag.ContinueOnError)
+	settingsPath := fs.String("settings", hooks.SettingsPath(), "Claude Code settings file to remove the hook from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	changed, err := hooks.Uninstall(*settingsPath, hooks.Command(exe))
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		fmt.Printf("No sync hook found in %s\n", *settingsPath)
+		return nil
+	}
+	fmt.Printf("Removed sync hook from %s\n", *settingsPath)
+	return nil
+}
@@ -2,44 +2,110 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/martinjt/claude-history-cli/internal/api"
 	"github.com/martinjt/claude-history-cli/internal/auth"
 	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/logfile"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+	"github.com/martinjt/claude-history-cli/internal/redact"
+	"github.com/martinjt/claude-history-cli/internal/schedule"
 	"github.com/martinjt/claude-history-cli/internal/sync"
 )
 
 const version = "dev"
 
 func main() {
-	if len(os.Args) < 2 {
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if err := logging.Setup(logOptions); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
+	os.Args = append(os.Args[:1], args...)
 
 	switch os.Args[1] {
 	case "sync":
-		if err := runSync(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runSync(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
 		}
 	case "login":
-		if err := runLogin(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runLogin(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
 		}
 	case "logout":
-		if err := runLogout(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runLogout(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
 		}
 	case "status":
 		runStatus()
+	case "devices":
+		if err := runDevices(); err != nil {
+			fail(err)
+		}
+	case "auth":
+		if err := runAuth(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "encryption":
+		if err := runEncryption(os.Args[2:]); err != nil {
+			fail(err)
+		}
+	case "whoami":
+		if err := runWhoami(); err != nil {
+			fail(err)
+		}
+	case "export":
+		if err := runExport(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "show":
+		if err := runShow(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "search":
+		if err := runSearch(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "stats":
+		if err := runStats(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "schedule":
+		if err := runSchedule(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "config":
+		if err := runConfig(os.Args[2:]); err != nil {
+			fail(err)
+		}
+	case "hook":
+		if err := runHook(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
+	case "mcp":
+		if err := runMCP(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fail(err)
+		}
 	case "version":
 		fmt.Printf("claude-history-sync %s\n", version)
 	case "help", "--help", "-h":
@@ -51,61 +117,358 @@ func main() {
 	}
 }
 
+// fail reports the error a command returned and exits. A log file of its
+// own gets the error too, so it shows why the run stopped.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if logOptions.File != "" {
+		slog.Error("command failed", "command", os.Args[1], logging.KeyError, err)
+	}
+	os.Exit(1)
+}
+
 func printUsage() {
-	fmt.Println(`Usage: claude-history-sync <command> [flags]
+	fmt.Println(`Usage: claude-history-sync [--profile name] [--set key=value...] [--log-* ...] <command> [flags]
+
+Global flags:
+  --set key=value  Override a setting for this run; repeatable. Settings are
+                   layered: defaults, /etc/claude-history-sync/config.yaml,
+                   ~/.claude-history-sync/config.yaml, a project's
+                   .claude-history-sync.yaml, CLAUDE_HISTORY_SYNC_<KEY>
+                   environment variables, then --set
+  --profile name   Use a named profile instead of default_profile. sync then
+                   only syncs sessions routed to that profile
+  --log-level lvl  Log records at debug, info, warn or error and above.
+                   Default: info when logging to a file or when stderr
+                   isn't a terminal (cron, systemd), warn otherwise
+  --log-format f   Write log records as text (default) or json
+  --log-file file  Write log records to a file instead of stderr, rotating it
+                   when it grows past 5MB. Records carry profile, session_id,
+                   project, messages, bytes and duration fields where known
+
+Profiles are separate accounts, each with its own endpoint, login and sync
+state. Settings a profile leaves out come from the top level. Routes send
+sessions run under a directory to a profile; the rest go to the active one:
+  profiles:
+    work:
+      api_endpoint: https://history.example.com
+      oidc_issuer: https://sso.example.com/realms/dev
+      oidc_client_id: claude-history
+  routes:
+    - path: ~/src/work
+      profile: work
+
+Service accounts, for CI and shared machines, need no login and keep no
+tokens. Set auth_mode (per profile, or CLAUDE_HISTORY_SYNC_AUTH_MODE) to:
+  client_credentials  Fetch tokens for service_client_id (and service_scopes)
+                      with its secret from CLAUDE_HISTORY_SYNC_CLIENT_SECRET
+                      or the file client_secret_file names
+  api_key             Send a static API key as the bearer token, from
+                      CLAUDE_HISTORY_SYNC_API_KEY or api_key_file
 
 Commands:
   sync      Sync Claude conversation history
-  login     Authenticate with OAuth
+            Flags:
+              --log-file <file>  Append output to a rotating log file (used by scheduled runs)
+  login     Authenticate with OAuth, against Cognito or any OIDC provider
+            set with oidc_issuer and oidc_client_id (endpoints are discovered)
             Flags:
               --force    Force re-authentication even if already authenticated
-  logout    Clear stored credentials
-  status    Show sync and auth status
+              --device   Sign in on another device (phone, laptop) with a code;
+                         chosen automatically over SSH or without a display
+              --no-browser  Print the sign-in URL and paste back the URL the
+                         browser ends up on, for providers without device login
+            The callback listens on localhost only, on the first free port
+            in redirect_ports (empty: any port)
+  logout    Revoke the refresh token and clear stored credentials
+            Flags:
+              --all-devices      Sign out every machine on the account (e.g. a
+                                 lost laptop), then this one
+                                 With Cognito the app client must allow the
+                                 aws.cognito.signin.user.admin scope
+              --device <id>      Sign out one other machine by machine ID
+  devices   List the machines logged in to the account
+  auth      Manage where login tokens are kept (token_store: auto, keychain,
+            file, memory or helper; auto uses the keychain when reachable)
+            helper runs credential_helper, e.g. for a password manager; see
+            docs/credential-helpers.md
+            The file store encrypts with a random key in tokens.key, or with
+            token_file_encryption: passphrase, a passphrase asked for when
+            needed (or set in CLAUDE_HISTORY_SYNC_TOKEN_PASSPHRASE)
+            Usage: auth store              Show each profile's token store
+                   auth store migrate --to <store> [--from <store>]
+                                          Move tokens to another store and
+                                          set token_store to it
+  encryption Seal message content and project paths with a key only you
+            hold before upload (encrypt_content), so the server can't read
+            them; timestamps, roles, models and branches stay readable.
+            The key lives in the token store; CI can set
+            CLAUDE_HISTORY_SYNC_RECOVERY_PHRASE instead; see docs/encryption.md
+            Usage: encryption init     Make a key and show its recovery phrase
+                   encryption recover  Add the key for a recovery phrase, e.g.
+                                       on another machine
+                   encryption rotate   Switch to a new key and upload
+                                       everything again under it
+                   encryption status   Show the key in use
+  status    Show sync and auth status for each profile
+  whoami    Show the account you're logged in as, after checking the ID
+            token's signature against the issuer's keys
+  export    Export sessions as Markdown, HTML or JSON
+            Usage: export [flags] [session-id...]
+            Flags:
+              --format <fmt>     md, html or json (default: md)
+              --session <ids>    Comma-separated session IDs or prefixes
+              --project <text>   Only sessions whose project path contains text
+              --since <time>     Only sessions active since a date or age, e.g. 2025-01-06 or 7d
+              --until <time>     Only sessions active before a date or age
+              --output <file>    Write to a file instead of stdout
+              --out-dir <dir>    Write one file per session
+              --remote           Export the sessions on the server, from every machine,
+                                 opening any sealed with encrypt_content
+  show      Print a session in the terminal
+            Usage: show [flags] <session-id>   (a unique prefix of the ID is enough)
+            Flags:
+              --follow           Keep printing new messages as the session continues
+              --expand           Show tool inputs and results in full
+              --no-pager         Don't page long output through $PAGER
+              --no-color         Disable colours (also honours NO_COLOR)
+  search    Search local conversation history
+            Usage: search [flags] <query>   (use "quotes" for phrases)
+            Flags:
+              --project <text>   Only sessions whose project path contains text
+              --role <role>      Only user or assistant messages
+              --model <text>     Only messages from models whose name contains text
+              --since <time>     Only messages since a date or age, e.g. 2025-01-06 or 7d
+              --until <time>     Only messages before a date or age
+              --limit <n>        Maximum results (default: 20)
+              --reindex          Rebuild the index from scratch first
+  stats     Show local usage statistics
+            Flags:
+              --group-by <list>  Group by day, week, project, model and/or machine (default: project)
+                                 machine is machine_id for claude_data_dir, and the
+                                 directory for other data directories
+              --format <fmt>     Output as table, csv or json (default: table)
+              --since <time>     Only count messages since a date or age, e.g. 2025-01-06 or 7d
+              --until <time>     Only count messages before a date or age
+  schedule  Manage periodic syncs (systemd user timer, or cron as a fallback)
+            Usage: schedule install|uninstall|status
+            Flags (install):
+              --scheduler <name> auto, systemd or cron (default: auto)
+              --log-file <file>  Log file for scheduled runs (default: ~/.claude-history-sync/sync.log)
+  config    View and change settings in ~/.claude-history-sync/config.yaml
+            Usage: config get <key> | set <key> <value...> | unset <key>
+                   config list | path | edit | validate | explain [key...]
+            List settings take one value per entry, e.g.
+              config set exclude_patterns '*scratch*' '*tmp*'
+            get, list, validate and explain include the project file for
+            the current directory; explain shows every layer that set a value.
+            A project's .claude-history-sync.yaml may only set sync_enabled
+            (false opts the repo out) and add redact rules:
+              redact:
+                - pattern: 'sk-[A-Za-z0-9]+'
+                  replacement: '[api key]'
+  hook      Sync one session from a Claude Code hook (reads the hook event on stdin)
+            Flags:
+              --timeout <dur>    Give up after this long (default: 10s)
+            Subcommands:
+              hook install       Add the hook to Claude Code's settings.json
+              hook uninstall     Remove it again
+              (both accept --settings <file>; default: $CLAUDE_CONFIG_DIR or ~/.claude)
+  mcp       Serve history to Claude over the Model Context Protocol (stdio)
+            Register with: claude mcp add claude-history -- claude-history-sync mcp
+            Flags:
+              --remote           Also list and open sessions synced from other machines
   version   Print version information
   help      Show this help message`)
 }
 
-func runSync() error {
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	logFile := fs.String("log-file", "", "append output to this file, rotating it when it grows large, and record the outcome for 'schedule status'")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *logFile == "" {
+		return syncAll()
+	}
+
+	f, err := logfile.Open(*logFile, logfile.DefaultMaxSize, logfile.DefaultKeep)
+	if err != nil {
+		return err
+	}
+	// The log stays open until the process exits, so the error main
+	// reports lands in it too
+	os.Stdout = f
+	os.Stderr = f
+	if logOptions.File == "" {
+		// The log follows stderr into the file, at info unless
+		// --log-level says otherwise
+		if err := logging.Setup(logOptions); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	fmt.Printf("\n=== Sync started %s ===\n", start.Format(time.RFC3339))
+
+	err = syncAll()
+	if recErr := schedule.RecordRun(schedule.DefaultStatusPath(), start, err); recErr != nil {
+		slog.Warn("failed to record run status", logging.KeyError, recErr)
+	}
+	return err
+}
+
+// syncAll scans every data directory and syncs each changed session to the
+// profile it routes to.
+func syncAll() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
+	active, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Scan for JSONL files
+	dataDirs := cfg.DataDirs()
+	fmt.Printf("Scanning %s for conversations...\n", strings.Join(dataDirs, ", "))
+	files, err := sync.ScanDirs(dataDirs, cfg.ExcludePatterns)
+	if err != nil {
+		return fmt.Errorf("scanning files: %w", err)
+	}
+	fmt.Printf("Found %d conversation files\n", len(files))
+
+	if cfg.SearchIndex {
+		if err := updateSearchIndex(files); err != nil {
+			slog.Warn("failed to update search index", logging.KeyError, err)
+		}
+	}
+
+	// Group sessions by profile. The active profile always runs, so its
+	// vanished sessions are pruned even when none are left.
+	var total syncCounts
+	byProfile := map[string][]sessionTarget{active.Name: nil}
+	for _, file := range files {
+		t, err := resolveSession(cfg, active, file)
+		if err != nil {
+			slog.Warn("resolving session", logging.KeySession, file.SessionID, logging.KeyProject, file.ProjectPath, logging.KeyError, err)
+			total.errors++
+			continue
+		}
+		if t.skipped(active) {
+			continue
+		}
+		byProfile[t.profile] = append(byProfile[t.profile], t)
+	}
+
+	names := make([]string, 0, len(byProfile))
+	for _, name := range cfg.ProfileNames() {
+		if _, ok := byProfile[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+		if len(names) > 1 {
+			fmt.Printf("\n[%s] %s\n", p.Name, p.APIEndpoint)
+		}
+
+		counts, err := syncProfile(ctx, cfg, p, byProfile[name])
+		if err != nil {
+			// One profile's backend being unreachable shouldn't hold up
+			// the others
+			if len(names) == 1 {
+				return err
+			}
+			slog.Warn("profile sync failed", logging.KeyProfile, name, logging.KeyError, err)
+			total.errors++
+			continue
+		}
+		total.add(counts)
+	}
+
+	fmt.Printf("\nSync complete: %d sessions synced, %d skipped (unchanged)", total.synced, total.skipped)
+	if total.pruned > 0 {
+		fmt.Printf(", %d pruned", total.pruned)
+	}
+	if total.optedOut > 0 {
+		fmt.Printf(", %d opted out", total.optedOut)
+	}
+	if total.errors > 0 {
+		fmt.Printf(", %d errors", total.errors)
+	}
+	fmt.Println()
+	slog.Info("sync complete", "synced", total.synced, "skipped", total.skipped, "pruned", total.pruned,
+		"opted_out", total.optedOut, "errors", total.errors)
+
+	return nil
+}
+
+// syncCounts tallies what a sync run did.
+type syncCounts struct {
+	synced, skipped, pruned, optedOut, errors int
+}
+
+func (c *syncCounts) add(o syncCounts) {
+	c.synced += o.synced
+	c.skipped += o.skipped
+	c.pruned += o.pruned
+	c.optedOut += o.optedOut
+	c.errors += o.errors
+}
+
+// syncProfile syncs the sessions routed to one profile, using that
+// profile's login, endpoint and state file.
+func syncProfile(ctx context.Context, cfg *config.Config, p *config.Profile, targets []sessionTarget) (syncCounts, error) {
+	var counts syncCounts
 
 	// Setup auth
-	authConfig := auth.NewConfig(cfg.CognitoRegion, cfg.CognitoPoolID, cfg.CognitoClientID, cfg.CognitoDomain)
-	authManager := auth.NewManager(authConfig)
+	authManager := newAuthManager(p)
 
 	// Validate we can get a token (refreshes automatically if access token expired)
 	if _, err := authManager.GetValidToken(ctx); err != nil {
-		return fmt.Errorf("not authenticated. Run 'claude-history-sync login' first: %w", err)
+		return counts, fmt.Errorf("not authenticated. Run 'claude-history-sync %slogin' first: %w", profileArg(p), err)
+	}
+
+	contentKey, err := uploadKey(p, authManager)
+	if err != nil {
+		return counts, err
 	}
 
 	// Setup API client
-	apiClient := api.NewClient(cfg.APIEndpoint, cfg.MachineID, authManager.GetValidToken)
+	apiClient := newAPIClient(p, authManager)
 
-	// Load sync state
-	statePath := sync.DefaultStatePath()
+	// Load sync state, holding it until it's saved so a hook syncing at
+	// the same time doesn't undo this run's progress or the other way round
+	statePath := sync.ProfileStatePath(p.Name)
+	release, err := sync.LockState(ctx, statePath)
+	if err != nil {
+		return counts, err
+	}
+	defer release()
 	state, err := sync.LoadState(statePath)
 	if err != nil {
-		return fmt.Errorf("loading sync state: %w", err)
+		return counts, fmt.Errorf("loading sync state: %w", err)
 	}
 
-	// Scan for JSONL files
-	fmt.Printf("Scanning %s for conversations...\n", cfg.ClaudeDataDir)
-	files, err := sync.ScanForJSONL(cfg.ClaudeDataDir, cfg.ExcludePatterns)
-	if err != nil {
-		return fmt.Errorf("scanning files: %w", err)
+	for _, t := range targets {
+		state.TrackFile(t.file)
 	}
-	fmt.Printf("Found %d conversation files\n", len(files))
 
 	// Fetch existing conversations with hashes from server
 	fmt.Println("Fetching conversation list from server...")
 	conversationsList, err := apiClient.GetConversations(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to fetch conversations list: %v\n", err)
+		slog.Warn("failed to fetch conversations list", logging.KeyProfile, p.Name, logging.KeyError, err)
 		fmt.Println("Continuing with UUID-based sync (may re-process unchanged conversations)")
 		conversationsList = &api.ConversationsListResponse{Conversations: []api.Conversation{}}
 	} else {
@@ -119,155 +482,383 @@ func runSync() error {
 	}
 
 	// Calculate and sync deltas
-	synced := 0
-	skipped := 0
-	errors := 0
-	for _, file := range files {
+	for _, t := range targets {
+		file := t.file
+		log := sessionLogger(p, file)
+		if !t.cfg.SyncEnabled {
+			log.Debug("session opted out")
+			counts.optedOut++
+			continue
+		}
+		redactor, err := redact.New(t.cfg.Redact)
+		if err != nil {
+			log.Warn("invalid redaction rules", logging.KeyError, err)
+			counts.errors++
+			continue
+		}
+
 		// Calculate local hash
-		localHash, err := sync.CalculateFileHash(file)
+		localHash, err := sync.CalculateFileHash(file, redactor, contentKey)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: error calculating hash for %s: %v\n", file.Path, err)
-			errors++
+			log.Warn("error calculating hash", "path", file.Path, logging.KeyError, err)
+			counts.errors++
 			continue
 		}
 
 		// Check if conversation needs sync based on hash comparison
 		remoteHash := remoteHashes[file.SessionID]
 		if !sync.ConversationNeedsSync(localHash, remoteHash) {
-			skipped++
+			log.Debug("session unchanged")
+			counts.skipped++
 			continue // Skip unchanged conversations
 		}
-		lastUUID := state.GetLastSyncedUUID(file.SessionID)
-		delta, err := sync.CalculateDelta(file, lastUUID)
+		start := time.Now()
+		processed, ok, err := syncSession(ctx, apiClient, p, t.cfg, state, file, contentKey)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: error processing %s: %v\n", file.Path, err)
-			errors++
+			log.Error("session sync failed", logging.KeyDuration, time.Since(start), logging.KeyError, err)
+			counts.errors++
 			continue
 		}
 
-		if delta == nil {
-			continue // No new messages
+		if ok {
+			counts.synced++
+			log.Info("session synced", logging.KeyMessages, processed, logging.KeyDuration, time.Since(start))
+			fmt.Printf("  Synced %d messages from %s\n", processed, file.SessionID)
 		}
+	}
 
-		// Convert messages for API
-		apiMessages := make([]api.Message, len(delta.Messages))
-		for i, m := range delta.Messages {
-			apiMessages[i] = api.Message{
-				UUID:      m.UUID,
-				Timestamp: m.Timestamp,
-				Role:      m.Role,
-				Content:   m.Content,
-				Model:     m.Model,
-				Tokens:    0, // Not available in conversation format
+	// Prune state for session files that no longer exist on disk
+	retention := time.Duration(cfg.CleanupPeriodDays) * 24 * time.Hour
+	for _, v := range state.FindVanished(time.Now(), retention) {
+		if v.Reason == sync.VanishDeleted && cfg.DeletionPolicy == config.DeletionPolicyPropagate {
+			if err := apiClient.DeleteConversation(ctx, v.SessionID); err != nil {
+				slog.Warn("failed to delete session from server", logging.KeyProfile, p.Name, logging.KeySession, v.SessionID, logging.KeyError, err)
+				counts.errors++
+				continue // Keep state so the deletion is retried next run
 			}
+			slog.Info("deleted session from server", logging.KeyProfile, p.Name, logging.KeySession, v.SessionID)
+			fmt.Printf("  Deleted %s from server (removed locally)\n", v.SessionID)
 		}
+		state.RemoveSession(v.SessionID)
+		counts.pruned++
+	}
 
-		resp, err := apiClient.Sync(ctx, &api.SyncRequest{
-			MachineID:   cfg.MachineID,
-			SessionID:   delta.SessionID,
-			ProjectPath: delta.ProjectPath,
-			Messages:    apiMessages,
-			Timestamp:   time.Now().UTC().Format(time.RFC3339),
-		})
+	// Save state
+	if err := state.Save(statePath); err != nil {
+		return counts, fmt.Errorf("saving sync state: %w", err)
+	}
+	return counts, nil
+}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: sync failed for %s: %v\n", file.SessionID, err)
-			errors++
-			continue
-		}
+// sessionLogger is the logger for records about syncing a session file to
+// a profile. The file's size stands in for bytes read; the upload's own
+// size is logged with the request.
+func sessionLogger(p *config.Profile, file sync.FileInfo) *slog.Logger {
+	return slog.With(logging.KeyProfile, p.Name, logging.KeySession, file.SessionID,
+		logging.KeyProject, file.ProjectPath, logging.KeyBytes, file.Size)
+}
 
-		if resp.Success {
-			state.UpdateSession(file.SessionID, delta.NewLastUUID, resp.Processed)
-			synced++
-			fmt.Printf("  Synced %d messages from %s\n", resp.Processed, file.SessionID)
+// syncSession uploads the messages of a session file that haven't been
+// synced yet and records the progress in state. It reports how many
+// messages the server processed and whether anything was synced. cfg
+// should already include the session's project file, for its redaction
+// rules; p is the profile the session syncs to. With a content key, the
+// content and project paths are sealed with it after redaction.
+func syncSession(ctx context.Context, apiClient *api.Client, p *config.Profile, cfg *config.Config, state *sync.SyncState, file sync.FileInfo, key *e2ee.Key) (int, bool, error) {
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", file.SessionID, err)
+	}
+
+	lastUUID := state.GetLastSyncedUUID(file.SessionID)
+	delta, err := sync.CalculateDelta(file, lastUUID)
+	if err != nil {
+		return 0, false, fmt.Errorf("error processing %s: %w", file.Path, err)
+	}
+
+	if delta == nil {
+		return 0, false, nil // No new messages
+	}
+
+	// Convert messages for API
+	apiMessages := make([]api.Message, len(delta.Messages))
+	for i, m := range delta.Messages {
+		apiMessages[i] = api.Message{
+			UUID:      m.UUID,
+			Timestamp: m.Timestamp,
+			Role:      m.Role,
+			Content:   key.Seal(delta.SessionID, e2ee.MessageField(m.UUID), redactor.String(m.Content)),
+			Model:     m.Model,
+			Tokens:    0, // Not available in conversation format
 		}
 	}
 
-	// Save state
-	if err := state.Save(statePath); err != nil {
-		return fmt.Errorf("saving sync state: %w", err)
+	if cfg.ResolveGitInfo {
+		delta.Metadata.ResolveGit(ctx)
 	}
 
-	fmt.Printf("\nSync complete: %d sessions synced, %d skipped (unchanged)", synced, skipped)
-	if errors > 0 {
-		fmt.Printf(", %d errors", errors)
+	resp, err := apiClient.Sync(ctx, &api.SyncRequest{
+		MachineID:   p.MachineID,
+		SessionID:   delta.SessionID,
+		ProjectPath: key.Seal(delta.SessionID, e2ee.FieldProjectPath, delta.ProjectPath),
+		Messages:    apiMessages,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Metadata:    sealMetadata(key, delta.SessionID, toAPIMetadata(delta.Metadata)),
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("sync failed for %s: %w", file.SessionID, err)
 	}
-	fmt.Println()
 
-	return nil
+	if !resp.Success {
+		return 0, false, nil
+	}
+
+	state.UpdateSession(file.SessionID, delta.NewLastUUID, resp.Processed)
+	return resp.Processed, true, nil
 }
 
-func runLogin() error {
+// toAPIMetadata converts session metadata into its wire format.
+func toAPIMetadata(meta *sync.SessionMetadata) *api.SessionMetadata {
+	if meta == nil {
+		return nil
+	}
+
+	branches := make([]api.BranchSpan, len(meta.Branches))
+	for i, b := range meta.Branches {
+		branches[i] = api.BranchSpan{
+			Branch:    b.Branch,
+			FirstSeen: b.FirstSeen,
+			LastSeen:  b.LastSeen,
+		}
+	}
+
+	return &api.SessionMetadata{
+		SourceDir:         meta.SourceDir,
+		CWD:               meta.CWD,
+		ClaudeCodeVersion: meta.Version,
+		UserType:          meta.UserType,
+		GitBranches:       branches,
+		GitRemote:         meta.GitRemote,
+		GitCommit:         meta.GitCommit,
+	}
+}
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	var opts auth.LoginOptions
+	fs.BoolVar(&opts.Force, "force", false, "re-authenticate even if already authenticated")
+	fs.BoolVar(&opts.Force, "f", false, "shorthand for --force")
+	fs.BoolVar(&opts.Device, "device", false, "sign in on another device with a code, instead of a browser here")
+	fs.BoolVar(&opts.NoBrowser, "no-browser", false, "print the sign-in URL and paste back the URL the browser is redirected to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
 
-	// Check for --force flag
-	force := false
-	for _, arg := range os.Args[2:] {
-		if arg == "--force" || arg == "-f" {
-			force = true
-			break
-		}
+	authManager := newAuthManager(p)
+	// Service accounts don't log in; Login says so
+	if authManager.Mode() != config.AuthModeUser {
+		return authManager.Login(ctx, opts)
 	}
 
-	authConfig := auth.NewConfig(cfg.CognitoRegion, cfg.CognitoPoolID, cfg.CognitoClientID, cfg.CognitoDomain)
-	manager := auth.NewManager(authConfig)
+	if !opts.Device && !opts.NoBrowser && !auth.BrowserAvailable() {
+		fmt.Println("No browser available here, signing in with a device code instead.")
+		opts.Device = true
+	}
 
-	return manager.Login(ctx, force)
+	if err := authManager.Login(ctx, opts); err != nil {
+		return err
+	}
+	registerDevice(ctx, p, authManager)
+	return nil
 }
 
-func runLogout() error {
-	cfg, err := config.Load()
+func runLogout(args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	allDevices := fs.Bool("all-devices", false, "sign out every machine logged in to the account, then this one")
+	device := fs.String("device", "", "sign out another machine, by machine ID, and stay logged in here")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *allDevices && *device != "" {
+		return fmt.Errorf("--all-devices and --device can't be used together")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
 
-	authConfig := auth.NewConfig(cfg.CognitoRegion, cfg.CognitoPoolID, cfg.CognitoClientID, cfg.CognitoDomain)
-	manager := auth.NewManager(authConfig)
+	authManager := newAuthManager(p)
+	client := newAPIClient(p, authManager)
 
-	if err := manager.Logout(); err != nil {
-		return fmt.Errorf("logout failed: %w", err)
+	if *device != "" {
+		if err := client.RevokeDevice(ctx, *device); err != nil {
+			if errors.Is(err, api.ErrNotSupported) {
+				return fmt.Errorf("%s can't sign out other machines; use --all-devices instead", p.APIEndpoint)
+			}
+			return fmt.Errorf("signing out %s: %w", *device, err)
+		}
+		fmt.Printf("Signed out %s.\n", *device)
+		return nil
+	}
+
+	// Service accounts have no login here to end; Logout says so
+	if authManager.Mode() != config.AuthModeUser {
+		return authManager.Logout(ctx)
+	}
+
+	if *allDevices {
+		if err := signOutEverywhere(ctx, authManager, client); err != nil {
+			return err
+		}
+	} else if err := client.RevokeDevice(ctx, p.MachineID); err != nil && !errors.Is(err, api.ErrNotSupported) {
+		slog.Warn("failed to remove this machine from the device list", logging.KeyProfile, p.Name, logging.KeyError, err)
+	}
+
+	if err := authManager.Logout(ctx); err != nil {
+		if !errors.Is(err, auth.ErrRevocationFailed) {
+			return fmt.Errorf("logout failed: %w", err)
+		}
+		// After a global sign-out the token is already dead
+		if !*allDevices {
+			slog.Warn("revoking token", logging.KeyProfile, p.Name, logging.KeyError, err)
+		}
 	}
 
 	fmt.Println("Successfully logged out.")
 	return nil
 }
 
+// signOutEverywhere ends the account's sessions on every machine: through
+// the server, which can sign out the devices it knows of, and through the
+// provider's global sign-out where there is one. Either is enough.
+func signOutEverywhere(ctx context.Context, authManager *auth.Manager, client *api.Client) error {
+	serverErr := client.RevokeAllDevices(ctx)
+	if serverErr == nil {
+		fmt.Println("Server signed out all devices.")
+	}
+
+	providerErr := authManager.GlobalSignOut(ctx)
+	if providerErr == nil {
+		fmt.Println("Identity provider signed out all sessions.")
+	}
+
+	if serverErr != nil && providerErr != nil {
+		return fmt.Errorf("could not sign out other devices: server: %v; identity provider: %v", serverErr, providerErr)
+	}
+	return nil
+}
+
+// printAuthMode shows how the profile authenticates: where a user's
+// tokens are kept, or which service credentials are used and where the
+// secret comes from.
+func printAuthMode(p *config.Profile, authManager *auth.Manager) {
+	switch authManager.Mode() {
+	case config.AuthModeUser:
+		fmt.Printf("  Auth Mode:    user login\n")
+		fmt.Printf("  Token Store:  %s\n", authManager.TokenStoreName())
+		return
+	case config.AuthModeClientCredentials:
+		fmt.Printf("  Auth Mode:    service account (client credentials)\n")
+		fmt.Printf("  Client ID:    %s\n", p.ServiceClientID)
+	case config.AuthModeAPIKey:
+		fmt.Printf("  Auth Mode:    service account (API key)\n")
+	}
+	if source, err := authManager.CredentialSource(); err == nil {
+		fmt.Printf("  Secret From:  %s\n", source)
+	} else {
+		fmt.Printf("  Secret From:  none (%v)\n", err)
+	}
+}
+
 func runStatus() {
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Config: error loading (%v)\n", err)
 		return
 	}
+	active, err := activeProfile(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config: %v\n", err)
+		return
+	}
 
 	fmt.Printf("Config:\n")
-	fmt.Printf("  API Endpoint: %s\n", cfg.APIEndpoint)
-	fmt.Printf("  Machine ID:   %s\n", cfg.MachineID)
-	fmt.Printf("  Data Dir:     %s\n", cfg.ClaudeDataDir)
+	for i, dir := range cfg.DataDirs() {
+		label := ""
+		if i == 0 {
+			label = "Data Dirs:"
+		}
+		fmt.Printf("  %-13s %s\n", label, dir)
+	}
+	fmt.Printf("  Deletions:    %s\n", cfg.DeletionPolicy)
 
-	authConfig := auth.NewConfig(cfg.CognitoRegion, cfg.CognitoPoolID, cfg.CognitoClientID, cfg.CognitoDomain)
-	manager := auth.NewManager(authConfig)
+	// With --profile, show just that one
+	names := cfg.ProfileNames()
+	if profileFlag != "" {
+		names = []string{active.Name}
+	}
 
-	fmt.Printf("\nAuth:\n")
 	ctx := context.Background()
-	if _, err := manager.GetValidToken(ctx); err == nil {
-		fmt.Printf("  Status: authenticated\n")
-	} else {
-		fmt.Printf("  Status: not authenticated (%v)\n", err)
-	}
+	for _, name := range names {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			fmt.Printf("\nProfile %s: %v\n", name, err)
+			continue
+		}
 
-	state, err := sync.LoadState(sync.DefaultStatePath())
-	if err != nil {
-		fmt.Printf("\nSync State: error loading (%v)\n", err)
-		return
+		title := "Profile " + p.Name
+		if p.Name == active.Name {
+			title += " (active)"
+		}
+		fmt.Printf("\n%s:\n", title)
+		fmt.Printf("  API Endpoint: %s\n", p.APIEndpoint)
+		fmt.Printf("  Machine ID:   %s\n", p.MachineID)
+		if p.OIDCIssuer != "" {
+			fmt.Printf("  OIDC Issuer:  %s\n", p.OIDCIssuer)
+		}
+
+		authManager := newAuthManager(p)
+		printAuthMode(p, authManager)
+		if _, err := authManager.GetValidToken(ctx); err == nil {
+			fmt.Printf("  Auth:         authenticated\n")
+		} else {
+			fmt.Printf("  Auth:         not authenticated (%v)\n", err)
+		}
+		printEncryption(p, authManager)
+
+		state, err := sync.LoadState(sync.ProfileStatePath(p.Name))
+		if err != nil {
+			fmt.Printf("  Sync State:   error loading (%v)\n", err)
+			continue
+		}
+		fmt.Printf("  Last Sync:    %s\n", state.LastSyncAt)
+		fmt.Printf("  Sessions:     %d\n", len(state.Sessions))
 	}
 
-	fmt.Printf("\nSync State:\n")
-	fmt.Printf("  Last Sync:    %s\n", state.LastSyncAt)
-	fmt.Printf("  Sessions:     %d\n", len(state.Sessions))
+	if len(cfg.Routes) > 0 {
+		fmt.Printf("\nRoutes:\n")
+		for _, r := range cfg.Routes {
+			fmt.Printf("  %s -> %s\n", r.Path, r.Profile)
+		}
+	}
 }
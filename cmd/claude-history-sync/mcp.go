@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/martinjt/claude-history-cli/internal/mcp"
+	"github.com/martinjt/claude-history-cli/internal/search"
+)
+
+// runMCP serves conversation history over the Model Context Protocol on
+// stdin and stdout. Stdout carries the protocol, so anything else goes to
+// stderr.
+func runMCP(args []string) error {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	remote := fs.Bool("remote", false, "also list and open sessions synced from other machines (requires login)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	backend := &mcp.LocalBackend{
+		DataDirs:        cfg.DataDirs(),
+		ExcludePatterns: cfg.ExcludePatterns,
+		IndexPath:       search.DefaultIndexPath(),
+	}
+
+	if *remote {
+		p, err := activeProfile(cfg)
+		if err != nil {
+			return err
+		}
+		authManager := newAuthManager(p)
+		if _, err := authManager.GetValidToken(ctx); err != nil {
+			return fmt.Errorf("not authenticated. Run 'claude-history-sync %slogin' first: %w", profileArg(p), err)
+		}
+		backend.Remote = newAPIClient(p, authManager)
+		if backend.Keys, err = readingKeys(p, authManager); err != nil {
+			return err
+		}
+	}
+
+	err = mcp.NewServer(backend, version).Serve(ctx, os.Stdin, os.Stdout)
+	if ctx.Err() != nil {
+		return nil // Interrupted
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/auth"
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// profileFlag holds the global --profile flag.
+var profileFlag string
+
+// activeProfile returns the profile chosen with --profile, or the default
+// one.
+func activeProfile(cfg *config.Config) (*config.Profile, error) {
+	return cfg.Profile(profileFlag)
+}
+
+// newAuthManager logs in to the profile's OIDC issuer if it has one, and
+// to its Cognito user pool otherwise.
+func newAuthManager(p *config.Profile) *auth.Manager {
+	authConfig := auth.NewConfig(p.CognitoRegion, p.CognitoPoolID, p.CognitoClientID, p.CognitoDomain)
+	if p.OIDCIssuer != "" {
+		authConfig = auth.NewOIDCConfig(p.OIDCIssuer, p.OIDCClientID)
+	}
+	authConfig.RedirectPorts = p.RedirectPorts
+	authConfig.TokenNamespace = p.TokenNamespace()
+	authConfig.TokenStore = p.TokenStore
+	authConfig.TokenFileEncryption = p.TokenFileEncryption
+	authConfig.CredentialHelper = p.CredentialHelper
+	authConfig.AuthMode = p.AuthMode
+	authConfig.ServiceClientID = p.ServiceClientID
+	authConfig.ServiceScopes = p.ServiceScopes
+	authConfig.ClientSecretFile = p.ClientSecretFile
+	authConfig.APIKeyFile = p.APIKeyFile
+	return auth.NewManager(authConfig)
+}
+
+// newAPIClient talks to the profile's API as the user authManager holds
+// tokens for, renewing them once if the server rejects them.
+func newAPIClient(p *config.Profile, authManager *auth.Manager) *api.Client {
+	client := api.NewClient(p.APIEndpoint, p.MachineID, authManager.GetValidToken)
+	client.SetTokenRenewal(authManager.ForceRefresh)
+	return client
+}
+
+// profileArg is the --profile flag that selects p, for messages telling
+// the user what to run.
+func profileArg(p *config.Profile) string {
+	if p.Name == config.DefaultProfileName {
+		return ""
+	}
+	return "--profile " + p.Name + " "
+}
+
+// sessionTarget is a session file with the config that applies to it and
+// the profile it syncs to.
+type sessionTarget struct {
+	file    sync.FileInfo
+	cfg     *config.Config
+	profile string
+}
+
+// resolveSession layers in the project file for the directory the session
+// ran in and picks its profile: the first matching route, otherwise the
+// active profile.
+func resolveSession(cfg *config.Config, active *config.Profile, file sync.FileInfo) (sessionTarget, error) {
+	t := sessionTarget{file: file, cfg: cfg, profile: active.Name}
+
+	cwd := sync.SessionCWD(file.Path)
+	if cwd == "" {
+		return t, nil
+	}
+
+	sessionCfg, err := cfg.ForDir(cwd)
+	if err != nil {
+		return t, err
+	}
+	t.cfg = sessionCfg
+	if routed := cfg.RouteProfile(cwd); routed != "" {
+		t.profile = routed
+	}
+	return t, nil
+}
+
+// skipped reports whether --profile limits this run to another profile.
+func (t sessionTarget) skipped(active *config.Profile) bool {
+	return profileFlag != "" && t.profile != active.Name
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/logfile"
+	"github.com/martinjt/claude-history-cli/internal/schedule"
+)
+
+func runSchedule(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claude-history-sync schedule install|uninstall|status")
+	}
+
+	switch args[0] {
+	case "install":
+		return runScheduleInstall(args[1:])
+	case "uninstall":
+		return runScheduleUninstall()
+	case "status":
+		return runScheduleStatus()
+	default:
+		return fmt.Errorf("unknown schedule command %q (expected install, uninstall or status)", args[0])
+	}
+}
+
+func runScheduleInstall(args []string) error {
+	fs := flag.NewFlagSet("schedule install", flag.ContinueOnError)
+	scheduler := fs.String("scheduler", schedule.BackendAuto, "auto, systemd or cron")
+	logFile := fs.String("log-file", logfile.DefaultPath(), "log file for scheduled runs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if cfg.SyncInterval <= 0 {
+		return fmt.Errorf("sync_interval_minutes must be positive, got %d", cfg.SyncInterval)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	logPath, err := filepath.Abs(*logFile)
+	if err != nil {
+		return fmt.Errorf("resolving log file path: %w", err)
+	}
+
+	manager := schedule.NewManager()
+	backend, err := manager.Resolve(*scheduler)
+	if err != nil {
+		return err
+	}
+
+	opts := schedule.Options{
+		Executable: exe,
+		Interval:   time.Duration(cfg.SyncInterval) * time.Minute,
+		LogFile:    logPath,
+		Path:       os.Getenv("PATH"),
+	}
+	if err := manager.Install(backend, opts); err != nil {
+		return fmt.Errorf("installing %s schedule: %w", backend, err)
+	}
+
+	fmt.Printf("Scheduled sync every %d minutes using %s\n", cfg.SyncInterval, backend)
+	fmt.Printf("Logs: %s\n", logPath)
+	if backend == schedule.BackendCron {
+		fmt.Println("Note: cron doesn't catch up on runs missed while the machine is off.")
+	}
+	return nil
+}
+
+func runScheduleUninstall() error {
+	removed, err := schedule.NewManager().Uninstall()
+	if err != nil {
+		return fmt.Errorf("removing schedule: %w", err)
+	}
+
+	if !removed {
+		fmt.Println("No scheduled sync found.")
+		return nil
+	}
+	fmt.Println("Scheduled sync removed.")
+	return nil
+}
+
+func runScheduleStatus() error {
+	status, err := schedule.NewManager().Status()
+	if err != nil {
+		return fmt.Errorf("reading schedule: %w", err)
+	}
+
+	if status.Backend == "" {
+		fmt.Println("Scheduler: not installed (run 'claude-history-sync schedule install')")
+	} else {
+		state := "inactive"
+		if status.Active {
+			state = "active"
+		}
+		fmt.Printf("Scheduler:  %s (%s)\n", status.Backend, state)
+		fmt.Printf("Schedule:   %s\n", status.Schedule)
+		if status.NextRun != "" {
+			fmt.Printf("Next Run:   %s\n", status.NextRun)
+		}
+		if status.LastRun != "" {
+			fmt.Printf("Last Run:   %s\n", status.LastRun)
+		}
+	}
+
+	// The scheduler's own record wins; cron has none, so fall back to the
+	// status scheduled runs record themselves
+	if status.LastExit != nil {
+		fmt.Printf("Last Exit:  %d", *status.LastExit)
+		if status.LastError != "" {
+			fmt.Printf(" (%s)", status.LastError)
+		}
+		fmt.Println()
+		return nil
+	}
+
+	last, err := schedule.LastRun(schedule.DefaultStatusPath())
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		fmt.Println("Last Exit:  no runs recorded yet")
+		return nil
+	}
+	if status.LastRun == "" {
+		fmt.Printf("Last Run:   %s\n", last.FinishedAt)
+	}
+	fmt.Printf("Last Exit:  %d", last.ExitCode)
+	if last.Error != "" {
+		fmt.Printf(" (%s)", last.Error)
+	}
+	fmt.Println()
+	return nil
+}
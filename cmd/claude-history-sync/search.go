@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
+	"github.com/martinjt/claude-history-cli/internal/search"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	project := fs.String("project", "", "only sessions whose project path contains this text")
+	role := fs.String("role", "", "only messages with this role (user or assistant)")
+	model := fs.String("model", "", "only messages from models whose name contains this text")
+	since := fs.String("since", "", "only messages at or after this time (YYYY-MM-DD, RFC 3339 or age like 7d)")
+	until := fs.String("until", "", "only messages before this time")
+	limit := fs.Int("limit", 20, "maximum number of results")
+	reindex := fs.Bool("reindex", false, "rebuild the index from scratch before searching")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := search.ParseQuery(strings.Join(fs.Args(), " "))
+	if len(query.Terms) == 0 && len(query.Phrases) == 0 {
+		return fmt.Errorf("no search terms given")
+	}
+
+	now := time.Now()
+	var err error
+	if query.Since, err = parseTimeFlag(*since, now); err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	if query.Until, err = parseTimeFlag(*until, now); err != nil {
+		return fmt.Errorf("--until: %w", err)
+	}
+	query.Project = *project
+	query.Role = *role
+	query.Model = *model
+	query.Limit = *limit
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	files, err := sync.ScanDirs(cfg.DataDirs(), cfg.ExcludePatterns)
+	if err != nil {
+		return fmt.Errorf("scanning files: %w", err)
+	}
+
+	indexPath := search.DefaultIndexPath()
+	idx := search.New()
+	if !*reindex {
+		if idx, err = search.Load(indexPath); err != nil {
+			return err
+		}
+	}
+
+	// Catch up with anything written since the last sync
+	result := idx.Update(files)
+	for _, err := range result.Failed {
+		slog.Warn("indexing session", logging.KeyError, err)
+	}
+	if result.Changed() || *reindex {
+		if err := idx.Save(indexPath); err != nil {
+			slog.Warn("failed to save search index", logging.KeyError, err)
+		}
+	}
+
+	hits := idx.Search(query)
+	if len(hits) == 0 {
+		fmt.Println("No matches found.")
+		return nil
+	}
+
+	for _, hit := range hits {
+		doc := hit.Doc
+		label := doc.Role
+		if doc.Model != "" {
+			label += " (" + doc.Model + ")"
+		}
+		fmt.Printf("%s  %s  %s  %s\n", doc.SessionID, doc.UUID, doc.Timestamp, label)
+		fmt.Printf("  %s\n", doc.Project)
+		fmt.Printf("  %s\n\n", hit.Snippet)
+	}
+
+	return nil
+}
+
+// updateSearchIndex incrementally updates the on-disk search index with the
+// files found by a sync scan.
+func updateSearchIndex(files []sync.FileInfo) error {
+	indexPath := search.DefaultIndexPath()
+	idx, err := search.Load(indexPath)
+	if err != nil {
+		idx = search.New() // Rebuild a corrupt index rather than failing
+	}
+
+	result := idx.Update(files)
+	for _, err := range result.Failed {
+		slog.Warn("indexing session", logging.KeyError, err)
+	}
+	if !result.Changed() {
+		return nil
+	}
+
+	return idx.Save(indexPath)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/martinjt/claude-history-cli/internal/export"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// followInterval is how often --follow checks the session file for new
+// lines.
+const followInterval = 500 * time.Millisecond
+
+func runShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	follow := fs.Bool("follow", false, "keep running and print new messages as they are written")
+	expand := fs.Bool("expand", false, "show tool inputs and results in full")
+	noPager := fs.Bool("no-pager", false, "don't page long output")
+	noColor := fs.Bool("no-color", false, "disable colours")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: claude-history-sync show [flags] <session-id>")
+	}
+
+	// Allow flags after the session ID as well as before it
+	id := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("expected a single session ID, got %d arguments", fs.NArg()+1)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	files, err := sync.ScanDirs(cfg.DataDirs(), cfg.ExcludePatterns)
+	if err != nil {
+		return fmt.Errorf("scanning files: %w", err)
+	}
+
+	file, err := sync.FindSession(files, id)
+	if err != nil {
+		return err
+	}
+
+	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
+	opts := export.TerminalOptions{
+		Color:  isTTY && !*noColor && os.Getenv("NO_COLOR") == "",
+		Expand: *expand,
+	}
+	height := 0
+	if isTTY {
+		if width, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			opts.Width = width
+			height = h
+		}
+	}
+
+	follower := sync.NewFollower(file)
+	messages, _, err := follower.Next()
+	if err != nil {
+		return err
+	}
+
+	session := &sync.Session{File: file, Messages: messages, Metadata: follower.Metadata()}
+	var buf bytes.Buffer
+	if err := export.WriteTerminal(&buf, []*export.Transcript{export.Normalize(session)}, opts); err != nil {
+		return err
+	}
+
+	if *follow {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		return followSession(follower, file, opts)
+	}
+
+	if isTTY && !*noPager && height > 0 && bytes.Count(buf.Bytes(), []byte("\n")) >= height {
+		return page(buf.Bytes())
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// followSession prints messages appended to the session until interrupted.
+func followSession(follower *sync.Follower, file sync.FileInfo, opts export.TerminalOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		messages, reset, err := follower.Next()
+		if err != nil {
+			return err
+		}
+		if reset {
+			fmt.Fprintln(os.Stderr, "Session file was truncated; reading from the start")
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		session := &sync.Session{File: file, Messages: messages}
+		if err := export.WriteTerminalEntries(os.Stdout, export.Normalize(session).Entries, opts); err != nil {
+			return err
+		}
+	}
+}
+
+// page sends output through $PAGER, or less, falling back to writing it
+// directly when no pager can be started.
+func page(output []byte) error {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less", "-R"}
+	}
+
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if os.Getenv("LESS") == "" {
+		// Quit if the output fits after all, keep colours, don't clear the screen
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+
+	if err := cmd.Start(); err != nil {
+		_, err = os.Stdout.Write(output)
+		return err
+	}
+
+	// The user quitting the pager early isn't an error
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("running pager: %w", err)
+		}
+	}
+	return nil
+}
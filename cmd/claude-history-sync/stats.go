@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
+	"github.com/martinjt/claude-history-cli/internal/stats"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	groupBy := fs.String("group-by", "project", "comma-separated groups: day, week, project, model, machine")
+	format := fs.String("format", "table", "output format: table, csv or json")
+	since := fs.String("since", "", "only count messages at or after this time (YYYY-MM-DD, RFC 3339 or age like 7d)")
+	until := fs.String("until", "", "only count messages before this time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	now := time.Now()
+	sinceTime, err := parseTimeFlag(*since, now)
+	if err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	untilTime, err := parseTimeFlag(*until, now)
+	if err != nil {
+		return fmt.Errorf("--until: %w", err)
+	}
+
+	// Sessions in claude_data_dir ran here; the extra data directories
+	// can hold other machines' and containers' sessions
+	machines := map[string]string{}
+	if cfg.ClaudeDataDir != "" {
+		machines[filepath.Clean(cfg.ClaudeDataDir)] = cfg.MachineID
+	}
+
+	groups := splitList(*groupBy)
+	agg, err := stats.New(stats.Options{
+		GroupBy:   groups,
+		Since:     sinceTime,
+		Until:     untilTime,
+		MachineID: cfg.MachineID,
+		Machines:  machines,
+	})
+	if err != nil {
+		return err
+	}
+
+	files, err := sync.ScanDirs(cfg.DataDirs(), cfg.ExcludePatterns)
+	if err != nil {
+		return fmt.Errorf("scanning files: %w", err)
+	}
+
+	for _, file := range files {
+		// Skip files that can't have been written to inside the window
+		if !sinceTime.IsZero() && file.ModTime < sinceTime.Unix() {
+			continue
+		}
+
+		session, err := sync.ReadSession(file)
+		if err != nil {
+			slog.Warn("error reading session", logging.KeySession, file.SessionID, "path", file.Path, logging.KeyError, err)
+			continue
+		}
+		agg.Add(session)
+	}
+
+	return stats.Write(os.Stdout, *format, groups, agg.Rows())
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runWhoami shows which account the active profile is logged in as, from
+// its ID token once the token's signature and claims check out.
+func runWhoami() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	p, err := activeProfile(cfg)
+	if err != nil {
+		return err
+	}
+
+	identity, err := newAuthManager(p).WhoAmI(ctx)
+	if err != nil {
+		return fmt.Errorf("not logged in as anyone verifiable. Run 'claude-history-sync %slogin': %w", profileArg(p), err)
+	}
+	claims := identity.Claims
+
+	fmt.Printf("Profile:        %s\n", p.Name)
+	fmt.Printf("Issuer:         %s\n", claims.Issuer)
+	fmt.Printf("Subject:        %s\n", claims.Subject)
+	if name := claims.DisplayName(); name != "" {
+		fmt.Printf("Name:           %s\n", name)
+	}
+	if claims.Email != "" {
+		verified := ""
+		if !claims.EmailVerified {
+			verified = " (unverified)"
+		}
+		fmt.Printf("Email:          %s%s\n", claims.Email, verified)
+	}
+	if groups := claims.AllGroups(); len(groups) > 0 {
+		fmt.Printf("Groups:         %s\n", strings.Join(groups, ", "))
+	}
+	fmt.Printf("ID Token:       expires %s\n", formatExpiry(claims.ExpiresAt()))
+	fmt.Printf("Access Token:   expires %s\n", formatExpiry(identity.AccessTokenExpiresAt))
+	return nil
+}
+
+// formatExpiry shows a time with how far away it is.
+func formatExpiry(t time.Time) string {
+	d := time.Until(t).Round(time.Second)
+	if d < 0 {
+		return fmt.Sprintf("%s (%s ago)", t.Local().Format(time.RFC3339), -d)
+	}
+	return fmt.Sprintf("%s (in %s)", t.Local().Format(time.RFC3339), d)
+}
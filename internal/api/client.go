@@ -6,17 +6,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
 )
 
 type SyncRequest struct {
-	MachineID   string    `json:"machineId"`
-	SessionID   string    `json:"sessionId"`
-	ProjectPath string    `json:"projectPath"`
-	Messages    []Message `json:"messages"`
-	Timestamp   string    `json:"timestamp"`
+	MachineID   string           `json:"machineId"`
+	SessionID   string           `json:"sessionId"`
+	ProjectPath string           `json:"projectPath"`
+	Messages    []Message        `json:"messages"`
+	Timestamp   string           `json:"timestamp"`
+	Metadata    *SessionMetadata `json:"metadata,omitempty"`
+}
+
+// SessionMetadata carries session-level context captured from Claude Code
+// records: where the session ran and which branches it touched.
+type SessionMetadata struct {
+	SourceDir         string       `json:"sourceDir,omitempty"`
+	CWD               string       `json:"cwd,omitempty"`
+	ClaudeCodeVersion string       `json:"claudeCodeVersion,omitempty"`
+	UserType          string       `json:"userType,omitempty"`
+	GitBranches       []BranchSpan `json:"gitBranches,omitempty"`
+	GitRemote         string       `json:"gitRemote,omitempty"`
+	GitCommit         string       `json:"gitCommit,omitempty"`
+}
+
+type BranchSpan struct {
+	Branch    string `json:"branch"`
+	FirstSeen string `json:"firstSeen,omitempty"`
+	LastSeen  string `json:"lastSeen,omitempty"`
 }
 
 type Message struct {
@@ -45,11 +68,23 @@ type ConversationsListResponse struct {
 	Total         int            `json:"total"`
 }
 
+// ConversationResponse is a conversation as the server stores it: the
+// messages synced from every machine, with the latest metadata.
+type ConversationResponse struct {
+	SessionID   string           `json:"sessionId"`
+	ProjectPath string           `json:"projectPath"`
+	Messages    []Message        `json:"messages"`
+	Metadata    *SessionMetadata `json:"metadata,omitempty"`
+}
+
 type Client struct {
 	endpoint   string
 	machineID  string
 	httpClient *http.Client
 	getToken   func(ctx context.Context) (string, error)
+	// renewToken, if set, replaces a token the server rejected, see
+	// SetTokenRenewal
+	renewToken func(ctx context.Context, rejected string) (string, error)
 }
 
 func NewClient(endpoint, machineID string, tokenFunc func(ctx context.Context) (string, error)) *Client {
@@ -63,6 +98,14 @@ func NewClient(endpoint, machineID string, tokenFunc func(ctx context.Context) (
 	}
 }
 
+// SetTokenRenewal makes a request that fails with 401 Unauthorized get a
+// new token from renew and try once more. renew is given the token that
+// was rejected, so concurrent requests that all hit the 401 can share one
+// renewal.
+func (c *Client) SetTokenRenewal(renew func(ctx context.Context, rejected string) (string, error)) {
+	c.renewToken = renew
+}
+
 func (c *Client) Sync(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -88,6 +131,30 @@ func (c *Client) GetConversations(ctx context.Context) (*ConversationsListRespon
 	return resp, nil
 }
 
+// GetConversation fetches one conversation, with its messages, from the
+// server.
+func (c *Client) GetConversation(ctx context.Context, sessionID string) (*ConversationResponse, error) {
+	var resp *ConversationResponse
+	err := c.doWithRetry(ctx, "GET", "/conversations/"+url.PathEscape(sessionID), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("server returned no conversation %s", sessionID)
+	}
+	return resp, nil
+}
+
+// DeleteConversation removes a conversation from the server. A conversation
+// that is already gone is not treated as an error.
+func (c *Client) DeleteConversation(ctx context.Context, sessionID string) error {
+	err := c.doWithRetry(ctx, "DELETE", "/conversations/"+url.PathEscape(sessionID), nil, nil)
+	if httpErr, ok := err.(*HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
 func (c *Client) doWithRetry(ctx context.Context, method, path string, body []byte, result interface{}) error {
 	maxRetries := 3
 	var lastErr error
@@ -113,6 +180,10 @@ func (c *Client) doWithRetry(ctx context.Context, method, path string, body []by
 		// Only retry on 429 and 5xx
 		if httpErr, ok := err.(*HTTPError); ok {
 			if httpErr.StatusCode == 429 || httpErr.StatusCode >= 500 {
+				if attempt < maxRetries {
+					slog.Warn("retrying API request", "method", method, "path", path,
+						"status", httpErr.StatusCode, "attempt", attempt+1)
+				}
 				continue
 			}
 			return err // Non-retryable error
@@ -125,25 +196,39 @@ func (c *Client) doWithRetry(ctx context.Context, method, path string, body []by
 }
 
 func (c *Client) doRequest(ctx context.Context, method, path string, body []byte, result interface{}) error {
-	url := c.endpoint + path
-
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	// Get OAuth token
+	token, err := c.getToken(ctx)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return fmt.Errorf("getting auth token: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	err = c.send(ctx, method, path, body, token, result)
+	if httpErr, ok := err.(*HTTPError); ok && httpErr.StatusCode == http.StatusUnauthorized && c.renewToken != nil {
+		slog.Info("API rejected auth token, renewing it", "method", method, "path", path)
+		token, err = c.renewToken(ctx, token)
+		if err != nil {
+			return fmt.Errorf("renewing rejected auth token: %w", err)
+		}
+		err = c.send(ctx, method, path, body, token, result)
+	}
+	return err
+}
 
-	// Get OAuth token
-	token, err := c.getToken(ctx)
+func (c *Client) send(ctx context.Context, method, path string, body []byte, token string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("getting auth token: %w", err)
+		return fmt.Errorf("creating request: %w", err)
 	}
+
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("X-Machine-ID", c.machineID)
 
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		slog.Debug("API request failed", "method", method, "path", path, logging.KeyBytes, len(body),
+			logging.KeyDuration, time.Since(start), logging.KeyError, err)
 		return fmt.Errorf("executing request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -152,6 +237,8 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body []byte
 	if err != nil {
 		return fmt.Errorf("reading response: %w", err)
 	}
+	slog.Debug("API request", "method", method, "path", path, "status", resp.StatusCode,
+		logging.KeyBytes, len(body), "response_bytes", len(respBody), logging.KeyDuration, time.Since(start))
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return &HTTPError{
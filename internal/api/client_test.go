@@ -69,6 +69,48 @@ func TestSync_Success(t *testing.T) {
 	}
 }
 
+func TestSync_SendsMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var raw map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Fatalf("decoding request: %v", err)
+		}
+
+		var meta SessionMetadata
+		if err := json.Unmarshal(raw["metadata"], &meta); err != nil {
+			t.Fatalf("decoding metadata: %v", err)
+		}
+		if meta.CWD != "/work/app" {
+			t.Errorf("expected cwd /work/app, got %s", meta.CWD)
+		}
+		if len(meta.GitBranches) != 1 || meta.GitBranches[0].Branch != "main" {
+			t.Errorf("unexpected branches: %+v", meta.GitBranches)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SyncResponse{Success: true})
+	}))
+	defer server.Close()
+
+	tokenFunc := func(ctx context.Context) (string, error) {
+		return "test-token", nil
+	}
+
+	client := NewClient(server.URL, "test-machine", tokenFunc)
+
+	_, err := client.Sync(context.Background(), &SyncRequest{
+		SessionID: "session-1",
+		Metadata: &SessionMetadata{
+			CWD:               "/work/app",
+			ClaudeCodeVersion: "1.0.50",
+			GitBranches:       []BranchSpan{{Branch: "main"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestSync_ServerError_Retries(t *testing.T) {
 	callCount := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -145,3 +187,105 @@ func TestSync_ClientError_NoRetry(t *testing.T) {
 		t.Errorf("expected status 400, got %d", httpErr.StatusCode)
 	}
 }
+
+func TestDeleteConversation(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("expected DELETE, got %s", r.Method)
+		}
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tokenFunc := func(ctx context.Context) (string, error) {
+		return "test-token", nil
+	}
+
+	client := NewClient(server.URL, "test-machine", tokenFunc)
+	if err := client.DeleteConversation(context.Background(), "session-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotPath != "/conversations/session-1" {
+		t.Errorf("expected /conversations/session-1, got %s", gotPath)
+	}
+}
+
+func TestDeleteConversation_NotFoundIsSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tokenFunc := func(ctx context.Context) (string, error) {
+		return "test-token", nil
+	}
+
+	client := NewClient(server.URL, "test-machine", tokenFunc)
+	if err := client.DeleteConversation(context.Background(), "gone"); err != nil {
+		t.Fatalf("expected 404 to be treated as success, got %v", err)
+	}
+}
+
+func TestClient_RenewsRejectedToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer renewed-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(ConversationsListResponse{Total: 1})
+	}))
+	defer server.Close()
+
+	tokenFunc := func(ctx context.Context) (string, error) {
+		return "stale-token", nil
+	}
+
+	client := NewClient(server.URL, "test-machine", tokenFunc)
+	if _, err := client.GetConversations(context.Background()); err == nil {
+		t.Fatal("expected 401 without token renewal")
+	}
+
+	var rejected []string
+	client.SetTokenRenewal(func(ctx context.Context, token string) (string, error) {
+		rejected = append(rejected, token)
+		return "renewed-token", nil
+	})
+	resp, err := client.GetConversations(context.Background())
+	if err != nil {
+		t.Fatalf("GetConversations: %v", err)
+	}
+	if resp.Total != 1 {
+		t.Errorf("expected the retried response, got %+v", resp)
+	}
+	if len(rejected) != 1 || rejected[0] != "stale-token" {
+		t.Errorf("expected one renewal of stale-token, got %v", rejected)
+	}
+}
+
+func TestClient_RetriesRenewalOnlyOnce(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tokenFunc := func(ctx context.Context) (string, error) {
+		return "test-token", nil
+	}
+
+	client := NewClient(server.URL, "test-machine", tokenFunc)
+	client.SetTokenRenewal(func(ctx context.Context, token string) (string, error) {
+		return "still-rejected", nil
+	})
+	_, err := client.GetConversations(context.Background())
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the request and one retry, got %d requests", requests)
+	}
+}
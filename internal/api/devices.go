@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrNotSupported means the server doesn't have the endpoint, as older
+// deployments don't.
+var ErrNotSupported = errors.New("not supported by this server")
+
+// Device is a machine that has logged in to the account.
+type Device struct {
+	MachineID  string `json:"machineId"`
+	Hostname   string `json:"hostname,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+	LoggedInAt string `json:"loggedInAt,omitempty"`
+	LastSeenAt string `json:"lastSeenAt,omitempty"`
+}
+
+type DevicesListResponse struct {
+	Devices []Device `json:"devices"`
+}
+
+// RegisterDevice records that this machine holds a session, so it can be
+// seen and signed out from other machines.
+func (c *Client) RegisterDevice(ctx context.Context, device *Device) error {
+	body, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("marshaling device: %w", err)
+	}
+	return notSupported(c.doWithRetry(ctx, "POST", "/devices", body, nil))
+}
+
+// ListDevices returns the machines that hold sessions for the account.
+func (c *Client) ListDevices(ctx context.Context) ([]Device, error) {
+	var resp *DevicesListResponse
+	if err := c.doWithRetry(ctx, "GET", "/devices", nil, &resp); err != nil {
+		return nil, notSupported(err)
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	return resp.Devices, nil
+}
+
+// RevokeDevice has the server sign out one machine's sessions and forget
+// it. A machine that is already gone is not treated as an error.
+func (c *Client) RevokeDevice(ctx context.Context, machineID string) error {
+	err := c.doWithRetry(ctx, "DELETE", "/devices/"+url.PathEscape(machineID), nil, nil)
+	if httpErr, ok := err.(*HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
+		// Without the devices endpoints at all, the server couldn't have
+		// signed it out
+		if _, listErr := c.ListDevices(ctx); errors.Is(listErr, ErrNotSupported) {
+			return ErrNotSupported
+		}
+		return nil
+	}
+	return err
+}
+
+// RevokeAllDevices has the server sign out every session of the account.
+func (c *Client) RevokeAllDevices(ctx context.Context) error {
+	return notSupported(c.doWithRetry(ctx, "DELETE", "/devices", nil, nil))
+}
+
+// notSupported turns the responses of a server without an endpoint into
+// ErrNotSupported.
+func notSupported(err error) error {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusNotFound || httpErr.StatusCode == http.StatusMethodNotAllowed) {
+		return ErrNotSupported
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testTokenFunc(ctx context.Context) (string, error) {
+	return "test-token", nil
+}
+
+func TestDevices(t *testing.T) {
+	devices := map[string]Device{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/devices":
+			var d Device
+			json.NewDecoder(r.Body).Decode(&d)
+			devices[d.MachineID] = d
+		case r.Method == http.MethodGet && r.URL.Path == "/devices":
+			resp := DevicesListResponse{}
+			for _, d := range devices {
+				resp.Devices = append(resp.Devices, d)
+			}
+			json.NewEncoder(w).Encode(resp)
+		case r.Method == http.MethodDelete && r.URL.Path == "/devices/laptop":
+			delete(devices, "laptop")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "laptop", testTokenFunc)
+	ctx := context.Background()
+
+	if err := client.RegisterDevice(ctx, &Device{MachineID: "laptop", Hostname: "laptop.local"}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+	list, err := client.ListDevices(ctx)
+	if err != nil {
+		t.Fatalf("ListDevices: %v", err)
+	}
+	if len(list) != 1 || list[0].Hostname != "laptop.local" {
+		t.Errorf("ListDevices = %+v", list)
+	}
+
+	if err := client.RevokeDevice(ctx, "laptop"); err != nil {
+		t.Fatalf("RevokeDevice: %v", err)
+	}
+	// Signing out a machine that's already gone is fine
+	if err := client.RevokeDevice(ctx, "unknown"); err != nil {
+		t.Fatalf("RevokeDevice of an unknown machine: %v", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("devices left after revoking: %+v", devices)
+	}
+}
+
+func TestDevices_NotSupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := NewClient(server.URL, "laptop", testTokenFunc)
+	ctx := context.Background()
+
+	if err := client.RegisterDevice(ctx, &Device{MachineID: "laptop"}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RegisterDevice error = %v, want ErrNotSupported", err)
+	}
+	if _, err := client.ListDevices(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ListDevices error = %v, want ErrNotSupported", err)
+	}
+	if err := client.RevokeDevice(ctx, "laptop"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RevokeDevice error = %v, want ErrNotSupported", err)
+	}
+	if err := client.RevokeAllDevices(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RevokeAllDevices error = %v, want ErrNotSupported", err)
+	}
+}
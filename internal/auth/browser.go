@@ -2,12 +2,37 @@ package auth
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 )
 
-// openBrowser opens the default browser to the given URL
-func openBrowser(url string) error {
+// BrowserAvailable reports whether openBrowser can show a page to the user.
+// Over SSH, or on Linux without a display, a browser would open somewhere
+// the user can't see it, if at all.
+func BrowserAvailable() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return true
+	case "linux":
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return false
+		}
+		_, err := exec.LookPath("xdg-open")
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// openBrowser opens the default browser to the given URL. Tests replace it.
+var openBrowser = launchBrowser
+
+func launchBrowser(url string) error {
 	var cmdName string
 	var cmdArgs []string
 
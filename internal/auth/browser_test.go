@@ -0,0 +1,10 @@
+package auth
+
+import "testing"
+
+func TestBrowserAvailable_SSH(t *testing.T) {
+	t.Setenv("SSH_CONNECTION", "10.0.0.1 50000 10.0.0.2 22")
+	if BrowserAvailable() {
+		t.Error("expected no browser over SSH")
+	}
+}
@@ -6,13 +6,48 @@ import (
 )
 
 type Config struct {
-	CognitoRegion   string
-	UserPoolID      string
-	ClientID        string
-	Domain          string
-	Scopes          []string
-	DeviceFlowURL   string
-	TokenURL        string
+	CognitoRegion string
+	UserPoolID    string
+	ClientID      string
+	Domain        string
+	Scopes        []string
+	DeviceFlowURL string
+	TokenURL      string
+
+	// Issuer is the OpenID Provider. Endpoints left empty are resolved
+	// from its discovery document, see Resolve.
+	Issuer           string
+	AuthorizationURL string
+	RevocationURL    string
+	JWKSURL          string
+
+	// RedirectPorts are the loopback ports registered for the login
+	// callback; the first free one is used. Empty means any port, which
+	// providers following RFC 8252 allow.
+	RedirectPorts []int
+
+	// TokenNamespace keeps a profile's stored tokens apart from other
+	// profiles'. Empty for the default profile.
+	TokenNamespace string
+	// TokenStore is the token_store setting naming where tokens are kept;
+	// empty means auto
+	TokenStore string
+	// TokenFileEncryption is the token_file_encryption setting for the
+	// file store; empty means keyfile
+	TokenFileEncryption string
+	// CredentialHelper is the command the helper store runs
+	CredentialHelper string
+
+	// AuthMode is the auth_mode setting; empty means user. The service
+	// modes don't use the token store, see service.go.
+	AuthMode string
+	// ServiceClientID and ServiceScopes are the client_credentials client,
+	// whose secret is in ClientSecretEnv or ClientSecretFile
+	ServiceClientID  string
+	ServiceScopes    []string
+	ClientSecretFile string
+	// APIKeyFile holds the api_key mode's key when APIKeyEnv isn't set
+	APIKeyFile string
 }
 
 func NewConfigFromEnv() (*Config, error) {
@@ -31,26 +66,41 @@ func NewConfigFromEnv() (*Config, error) {
 		return nil, fmt.Errorf("COGNITO_DOMAIN environment variable is required")
 	}
 
-	return &Config{
-		CognitoRegion: region,
-		UserPoolID:    userPoolID,
-		ClientID:      clientID,
-		Domain:        domain,
-		Scopes:        []string{"openid", "email", "profile"},
-		DeviceFlowURL: fmt.Sprintf("https://%s/oauth2/device_authorization", domain),
-		TokenURL:      fmt.Sprintf("https://%s/oauth2/token", domain),
-	}, nil
+	return NewConfig(region, userPoolID, clientID, domain), nil
 }
 
+// cognitoAdminScope lets an access token call the user pool API for its
+// own user, which GlobalSignOut needs. The app client must allow it under
+// its OpenID Connect scopes, or Cognito rejects the login.
+const cognitoAdminScope = "aws.cognito.signin.user.admin"
+
+// NewConfig returns the config for a Cognito user pool. Cognito's hosted UI
+// endpoints are known, so no discovery is needed.
 func NewConfig(region, userPoolID, clientID, domain string) *Config {
+	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+	return &Config{
+		CognitoRegion:    region,
+		UserPoolID:       userPoolID,
+		ClientID:         clientID,
+		Domain:           domain,
+		Scopes:           []string{"openid", "email", "profile", cognitoAdminScope},
+		DeviceFlowURL:    fmt.Sprintf("https://%s/oauth2/device_authorization", domain),
+		TokenURL:         fmt.Sprintf("https://%s/oauth2/token", domain),
+		Issuer:           issuer,
+		AuthorizationURL: fmt.Sprintf("https://%s/oauth2/authorize", domain),
+		RevocationURL:    fmt.Sprintf("https://%s/oauth2/revoke", domain),
+		JWKSURL:          issuer + "/.well-known/jwks.json",
+		RedirectPorts:    []int{3000},
+	}
+}
+
+// NewOIDCConfig returns the config for any OpenID Connect provider, such
+// as Keycloak or Okta. Its endpoints are discovered from the issuer.
+func NewOIDCConfig(issuer, clientID string) *Config {
 	return &Config{
-		CognitoRegion: region,
-		UserPoolID:    userPoolID,
-		ClientID:      clientID,
-		Domain:        domain,
-		Scopes:        []string{"openid", "email", "profile"},
-		DeviceFlowURL: fmt.Sprintf("https://%s/oauth2/device_authorization", domain),
-		TokenURL:      fmt.Sprintf("https://%s/oauth2/token", domain),
+		ClientID: clientID,
+		Scopes:   []string{"openid", "email", "profile"},
+		Issuer:   issuer,
 	}
 }
 
@@ -28,6 +28,9 @@ type TokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	Error        string `json:"error,omitempty"`
 	ErrorDesc    string `json:"error_description,omitempty"`
+
+	// Nonce is the nonce the login sent, which the ID token must carry
+	Nonce string `json:"-"`
 }
 
 type DeviceFlow struct {
@@ -43,6 +46,13 @@ func NewDeviceFlow(config *Config) *DeviceFlow {
 }
 
 func (df *DeviceFlow) RequestDeviceCode(ctx context.Context) (*DeviceFlowResponse, error) {
+	if err := df.config.Resolve(ctx, df.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	if df.config.DeviceFlowURL == "" {
+		return nil, fmt.Errorf("%s doesn't support the device authorization flow", df.config.Issuer)
+	}
+
 	data := url.Values{
 		"client_id": {df.config.ClientID},
 		"scope":     {strings.Join(df.config.Scopes, " ")},
@@ -151,6 +161,10 @@ func (df *DeviceFlow) exchangeDeviceCode(ctx context.Context, deviceCode string)
 }
 
 func (df *DeviceFlow) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	if err := df.config.Resolve(ctx, df.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+
 	data := url.Values{
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {refreshToken},
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ProviderMetadata is the part of an OpenID Provider's discovery document
+// the CLI uses.
+type ProviderMetadata struct {
+	Issuer                      string   `json:"issuer"`
+	AuthorizationEndpoint       string   `json:"authorization_endpoint"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint,omitempty"`
+	RevocationEndpoint          string   `json:"revocation_endpoint,omitempty"`
+	JWKSURI                     string   `json:"jwks_uri"`
+	ScopesSupported             []string `json:"scopes_supported,omitempty"`
+}
+
+// Discover fetches the issuer's .well-known/openid-configuration.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*ProviderMetadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	discoveryURL := issuer + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating discovery request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading discovery document: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var meta ProviderMetadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return nil, fmt.Errorf("parsing discovery document: %w", err)
+	}
+
+	// The issuer must match exactly, or a document served from one
+	// issuer's URL could claim to speak for another (OIDC Discovery 4.3)
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document for %s has no authorization or token endpoint", issuer)
+	}
+
+	return &meta, nil
+}
+
+// Resolve fills in endpoints from the issuer's discovery document. It does
+// nothing if there is no issuer or the endpoints are already known, as they
+// are for Cognito. Endpoints set explicitly are kept.
+func (c *Config) Resolve(ctx context.Context, client *http.Client) error {
+	if c.Issuer == "" || (c.AuthorizationURL != "" && c.TokenURL != "") {
+		return nil
+	}
+
+	meta, err := Discover(ctx, client, c.Issuer)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		value      *string
+		discovered string
+	}{
+		{&c.AuthorizationURL, meta.AuthorizationEndpoint},
+		{&c.TokenURL, meta.TokenEndpoint},
+		{&c.DeviceFlowURL, meta.DeviceAuthorizationEndpoint},
+		{&c.RevocationURL, meta.RevocationEndpoint},
+		{&c.JWKSURL, meta.JWKSURI},
+	} {
+		if *f.value == "" {
+			*f.value = f.discovered
+		}
+	}
+
+	// Most providers only issue refresh tokens when asked for
+	// offline_access
+	if contains(meta.ScopesSupported, "offline_access") && !contains(c.Scopes, "offline_access") {
+		c.Scopes = append(c.Scopes, "offline_access")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
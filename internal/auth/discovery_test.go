@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestIdP serves a discovery document and a token endpoint, standing in
+// for a provider such as Keycloak. The issuer is the server's own URL plus
+// path, as Keycloak's realms are.
+func newTestIdP(t *testing.T, path string, meta func(issuer string) ProviderMetadata) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc(path+"/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(meta(server.URL + path))
+	})
+	mux.HandleFunc(path+"/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("parsing form: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TokenResponse{
+			AccessToken: "access-" + r.Form.Get("grant_type"),
+			TokenType:   "Bearer",
+			ExpiresIn:   300,
+		})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func standardMetadata(issuer string) ProviderMetadata {
+	return ProviderMetadata{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       issuer + "/auth",
+		TokenEndpoint:               issuer + "/token",
+		DeviceAuthorizationEndpoint: issuer + "/device",
+		RevocationEndpoint:          issuer + "/revoke",
+		JWKSURI:                     issuer + "/certs",
+		ScopesSupported:             []string{"openid", "email", "offline_access"},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	server := newTestIdP(t, "/realms/dev", standardMetadata)
+	issuer := server.URL + "/realms/dev"
+
+	config := NewOIDCConfig(issuer+"/", "cli")
+	config.RevocationURL = "https://override.example.com/revoke"
+	if err := config.Resolve(context.Background(), server.Client()); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	if config.AuthorizationURL != issuer+"/auth" {
+		t.Errorf("AuthorizationURL = %q", config.AuthorizationURL)
+	}
+	if config.TokenURL != issuer+"/token" {
+		t.Errorf("TokenURL = %q", config.TokenURL)
+	}
+	if config.DeviceFlowURL != issuer+"/device" {
+		t.Errorf("DeviceFlowURL = %q", config.DeviceFlowURL)
+	}
+	if config.JWKSURL != issuer+"/certs" {
+		t.Errorf("JWKSURL = %q", config.JWKSURL)
+	}
+	// Explicit endpoints are kept
+	if config.RevocationURL != "https://override.example.com/revoke" {
+		t.Errorf("RevocationURL = %q, want the override kept", config.RevocationURL)
+	}
+	if got := strings.Join(config.Scopes, " "); got != "openid email profile offline_access" {
+		t.Errorf("Scopes = %q, want offline_access added", got)
+	}
+}
+
+func TestResolve_SkipsKnownEndpoints(t *testing.T) {
+	// Cognito configs need no discovery, so no request may be made
+	config := NewConfig("eu-west-1", "eu-west-1_abc", "client", "auth.example.com")
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request to %s", r.URL)
+		return nil, context.Canceled
+	})}
+	if err := config.Resolve(context.Background(), client); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if config.AuthorizationURL != "https://auth.example.com/oauth2/authorize" {
+		t.Errorf("AuthorizationURL = %q", config.AuthorizationURL)
+	}
+	if config.JWKSURL != "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_abc/.well-known/jwks.json" {
+		t.Errorf("JWKSURL = %q", config.JWKSURL)
+	}
+}
+
+func TestDiscover_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		meta func(issuer string) ProviderMetadata
+		want string
+	}{
+		{
+			name: "issuer mismatch",
+			meta: func(issuer string) ProviderMetadata {
+				m := standardMetadata(issuer)
+				m.Issuer = "https://evil.example.com"
+				return m
+			},
+			want: "expected",
+		},
+		{
+			name: "missing token endpoint",
+			meta: func(issuer string) ProviderMetadata {
+				m := standardMetadata(issuer)
+				m.TokenEndpoint = ""
+				return m
+			},
+			want: "no authorization or token endpoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestIdP(t, "", tt.meta)
+			_, err := Discover(context.Background(), server.Client(), server.URL)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Discover error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		if _, err := Discover(context.Background(), server.Client(), server.URL); err == nil {
+			t.Error("Discover succeeded against a server without a discovery document")
+		}
+	})
+}
+
+func TestPKCEFlow_DiscoveredEndpoints(t *testing.T) {
+	server := newTestIdP(t, "/oauth2/default", standardMetadata)
+	flow := NewPKCEFlow(NewOIDCConfig(server.URL+"/oauth2/default", "cli"))
+
+	resp, err := flow.ExchangeCode(context.Background(), "code", "verifier", "http://localhost:3000/callback")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if resp.AccessToken != "access-authorization_code" {
+		t.Errorf("AccessToken = %q", resp.AccessToken)
+	}
+
+	resp, err = flow.RefreshToken(context.Background(), "refresh")
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if resp.AccessToken != "access-refresh_token" {
+		t.Errorf("AccessToken = %q", resp.AccessToken)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
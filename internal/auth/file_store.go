@@ -1,24 +1,43 @@
 package auth
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/martinjt/claude-history-cli/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
 )
 
-// FileStore stores tokens in an encrypted file when keychain is unavailable
+// FileStore stores tokens in an encrypted file when keychain is unavailable.
+// The key is either random, kept in a separate key file, or stretched from
+// a passphrase with Argon2id; the token_file_encryption setting chooses.
 type FileStore struct {
-	filePath string
+	filePath   string
+	keyPath    string
+	encryption string
+
+	// passphrase asks for the passphrase, twice if confirm is set so a
+	// new one isn't mistyped
+	passphrase func(confirm bool) ([]byte, error)
+
+	mu         sync.Mutex
+	cachedPass []byte
+	derived    map[string][]byte // passphrase keys by KDF parameters
 }
 
 type fileTokenData struct {
@@ -29,75 +48,299 @@ type fileTokenData struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-func NewFileStore() *FileStore {
-	configDir := config.DefaultConfigDir()
+// Token files start with a header giving the format version and how the
+// key was made, which is authenticated along with the tokens. Files from
+// before there was a header are base64 text, encrypted with a key anyone
+// holding the file can recompute from the hostname and path; they are
+// rewritten in the current format the first time they are read.
+const (
+	fileMagic   = "CHST"
+	fileVersion = 2
+
+	kdfKeyfile  byte = 1
+	kdfArgon2id byte = 2
+)
+
+// Argon2id parameters for new files: the second recommended option of
+// RFC 9106 with three passes. Each file records its own, so these can be
+// raised without breaking older files.
+const (
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024 // KiB
+	argonThreads uint8  = 4
+	saltSize            = 16
+
+	// argonParamsSize is the time, memory, threads and salt in a header
+	argonParamsSize = 4 + 4 + 1 + saltSize
+
+	// Limits on the parameters a file can ask for, so a damaged or
+	// tampered header can't make deriving the key hang or use gigabytes
+	maxArgonTime   uint32 = 64
+	maxArgonMemory uint32 = 1024 * 1024 // KiB
+)
+
+// PassphraseEnv supplies the token file passphrase without a prompt, for
+// scheduled runs and hooks.
+const PassphraseEnv = "CLAUDE_HISTORY_SYNC_TOKEN_PASSPHRASE"
+
+// NewFileStore stores tokens in tokens.enc, or tokens-<namespace>.enc for
+// a named profile, encrypted as token_file_encryption says. Every profile
+// shares the key file.
+func NewFileStore(namespace, encryption string) *FileStore {
+	name := "tokens.enc"
+	if namespace != "" {
+		name = "tokens-" + namespace + ".enc"
+	}
+	if encryption == "" {
+		encryption = config.TokenFileEncryptionKeyfile
+	}
+	dir := config.DefaultConfigDir()
 	return &FileStore{
-		filePath: filepath.Join(configDir, "tokens.enc"),
+		filePath:   filepath.Join(dir, name),
+		keyPath:    filepath.Join(dir, "tokens.key"),
+		encryption: encryption,
+		passphrase: readPassphrase,
+		derived:    make(map[string][]byte),
 	}
 }
 
-// deriveKey creates a key from machine-specific data
-func (fs *FileStore) deriveKey() ([]byte, error) {
-	// Use machine hostname + config dir as key material
-	hostname, err := os.Hostname()
+// readPassphrase takes the passphrase from PassphraseEnv, or asks for it
+// on the terminal.
+func readPassphrase(confirm bool) ([]byte, error) {
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("the token file is passphrase protected; set %s when not running in a terminal", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Token file passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
 	if err != nil {
-		hostname = "default-host"
+		return nil, fmt.Errorf("reading passphrase: %w", err)
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("reading passphrase: %w", err)
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, fmt.Errorf("passphrases don't match")
+		}
+	}
+	return pass, nil
+}
+
+// keyfileKey reads the random key from the key file, creating it first if
+// create is set and there isn't one.
+func (fs *FileStore) keyfileKey(create bool) ([]byte, error) {
+	key, err := os.ReadFile(fs.keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key file %s is not a 256-bit key", fs.keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("key file %s is missing, so the stored tokens can't be decrypted; please login again", fs.keyPath)
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fs.keyPath), 0700); err != nil {
+		return nil, fmt.Errorf("creating config directory: %w", err)
+	}
+	// Another process may be creating it at the same moment; whichever
+	// key lands first is the one both use
+	f, err := os.OpenFile(fs.keyPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fs.keyfileKey(false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating key file: %w", err)
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(fs.keyPath)
+		return nil, fmt.Errorf("writing key file: %w", err)
 	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("writing key file: %w", err)
+	}
+	return key, nil
+}
 
-	// Combine with config dir for uniqueness
-	keyMaterial := hostname + fs.filePath
+// passphraseKey stretches the passphrase with the Argon2id parameters and
+// salt from a file header.
+func (fs *FileStore) passphraseKey(params []byte, confirm bool) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if key, ok := fs.derived[string(params)]; ok {
+		return key, nil
+	}
+	if fs.cachedPass == nil {
+		pass, err := fs.passphrase(confirm)
+		if err != nil {
+			return nil, err
+		}
+		fs.cachedPass = pass
+	}
 
-	// Derive 32-byte key using SHA256
-	hash := sha256.Sum256([]byte(keyMaterial))
-	return hash[:], nil
+	passes := binary.BigEndian.Uint32(params[0:4])
+	memory := binary.BigEndian.Uint32(params[4:8])
+	threads := params[8]
+	salt := params[9:]
+	key := argon2.IDKey(fs.cachedPass, salt, passes, memory, threads, 32)
+	fs.derived[string(params)] = key
+	return key, nil
 }
 
-func (fs *FileStore) encrypt(data []byte) (string, error) {
-	key, err := fs.deriveKey()
-	if err != nil {
-		return "", fmt.Errorf("deriving encryption key: %w", err)
+// checkArgonParams rejects Argon2id parameters from a file header that
+// argon2 would panic on or that are beyond what this program writes.
+func checkArgonParams(params []byte) error {
+	passes := binary.BigEndian.Uint32(params[0:4])
+	memory := binary.BigEndian.Uint32(params[4:8])
+	threads := params[8]
+	if passes < 1 || passes > maxArgonTime || threads < 1 || memory < 8*uint32(threads) || memory > maxArgonMemory {
+		return fmt.Errorf("token file header has invalid key parameters (time %d, memory %d KiB, threads %d)", passes, memory, threads)
 	}
+	return nil
+}
 
-	block, err := aes.NewCipher(key)
+// forgetPassphrase drops a passphrase that didn't decrypt the file, so
+// the next attempt asks again.
+func (fs *FileStore) forgetPassphrase() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.cachedPass = nil
+	fs.derived = make(map[string][]byte)
+}
+
+// seal encrypts data in the current format with the configured key.
+func (fs *FileStore) seal(data []byte, newPassphrase bool) ([]byte, error) {
+	header := append([]byte(fileMagic), fileVersion)
+
+	var key []byte
+	var err error
+	switch fs.encryption {
+	case config.TokenFileEncryptionKeyfile:
+		header = append(header, kdfKeyfile)
+		key, err = fs.keyfileKey(true)
+	case config.TokenFileEncryptionPassphrase:
+		params := binary.BigEndian.AppendUint32(nil, argonTime)
+		params = binary.BigEndian.AppendUint32(params, argonMemory)
+		params = append(params, argonThreads)
+		salt := make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, fmt.Errorf("generating salt: %w", err)
+		}
+		params = append(params, salt...)
+		header = append(append(header, kdfArgon2id), params...)
+		key, err = fs.passphraseKey(params, newPassphrase)
+	default:
+		return nil, fmt.Errorf("unknown token file encryption %q", fs.encryption)
+	}
 	if err != nil {
-		return "", fmt.Errorf("creating cipher: %w", err)
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("creating GCM: %w", err)
+		return nil, err
 	}
-
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("generating nonce: %w", err)
+		return nil, fmt.Errorf("generating nonce: %w", err)
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, data, header), nil
 }
 
-func (fs *FileStore) decrypt(encoded string) ([]byte, error) {
-	key, err := fs.deriveKey()
-	if err != nil {
-		return nil, fmt.Errorf("deriving encryption key: %w", err)
+// open decrypts a token file in any format, reporting whether it should
+// be rewritten because it isn't in the current format or isn't encrypted
+// the way the settings now say.
+func (fs *FileStore) open(file []byte) (data []byte, stale bool, err error) {
+	if !bytes.HasPrefix(file, []byte(fileMagic)) {
+		data, err := fs.openLegacy(string(file))
+		return data, true, err
+	}
+	if len(file) < len(fileMagic)+2 {
+		return nil, false, fmt.Errorf("token file header is truncated")
+	}
+	if version := file[len(fileMagic)]; version != fileVersion {
+		return nil, false, fmt.Errorf("token file format version %d isn't one this version understands", version)
 	}
 
-	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	kdf := file[len(fileMagic)+1]
+	rest := file[len(fileMagic)+2:]
+	var key []byte
+	switch kdf {
+	case kdfKeyfile:
+		stale = fs.encryption != config.TokenFileEncryptionKeyfile
+		key, err = fs.keyfileKey(false)
+	case kdfArgon2id:
+		if len(rest) < argonParamsSize {
+			return nil, false, fmt.Errorf("token file header is truncated")
+		}
+		params := rest[:argonParamsSize]
+		rest = rest[argonParamsSize:]
+		if err := checkArgonParams(params); err != nil {
+			return nil, false, err
+		}
+		stale = fs.encryption != config.TokenFileEncryptionPassphrase
+		key, err = fs.passphraseKey(params, false)
+	default:
+		return nil, false, fmt.Errorf("token file uses unknown key type %d", kdf)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("decoding base64: %w", err)
+		return nil, false, err
 	}
+	header := file[:len(file)-len(rest)]
 
-	block, err := aes.NewCipher(key)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+		return nil, false, err
 	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, false, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	data, err = gcm.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		if kdf == kdfArgon2id {
+			fs.forgetPassphrase()
+			return nil, false, fmt.Errorf("wrong passphrase or damaged token file")
+		}
+		return nil, false, fmt.Errorf("key file doesn't match or damaged token file")
+	}
+	return data, stale, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// openLegacy decrypts a file written before the header was added.
+func (fs *FileStore) openLegacy(encoded string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return nil, fmt.Errorf("creating GCM: %w", err)
+		return nil, fmt.Errorf("decoding base64: %w", err)
 	}
 
+	gcm, err := newGCM(fs.legacyKey())
+	if err != nil {
+		return nil, err
+	}
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
 		return nil, fmt.Errorf("ciphertext too short")
@@ -108,10 +351,32 @@ func (fs *FileStore) decrypt(encoded string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("decrypting: %w", err)
 	}
-
 	return plaintext, nil
 }
 
+// legacyKey is the key files without a header were encrypted with: the
+// hostname and file path, hashed.
+func (fs *FileStore) legacyKey() []byte {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "default-host"
+	}
+	hash := sha256.Sum256([]byte(hostname + fs.filePath))
+	return hash[:]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+	return gcm, nil
+}
+
 func (fs *FileStore) SaveTokens(accessToken string, resp *TokenResponse) error {
 	data := fileTokenData{
 		AccessToken:  accessToken,
@@ -120,26 +385,45 @@ func (fs *FileStore) SaveTokens(accessToken string, resp *TokenResponse) error {
 		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).Unix(),
 		UpdatedAt:    time.Now(),
 	}
+	return fs.write(&data)
+}
 
+// write encrypts the token data and replaces the token file with it.
+func (fs *FileStore) write(data *fileTokenData) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("marshaling token data: %w", err)
 	}
+	return fs.writeFile(fs.filePath, jsonData)
+}
+
+// writeFile encrypts data and replaces the file at path with it.
+func (fs *FileStore) writeFile(path string, data []byte) error {
+	// A passphrase is new unless it already protects the file
+	newPassphrase := true
+	if existing, err := os.ReadFile(path); err == nil && len(existing) > len(fileMagic)+1 &&
+		bytes.HasPrefix(existing, []byte(fileMagic)) && existing[len(fileMagic)+1] == kdfArgon2id {
+		newPassphrase = false
+	}
 
-	encrypted, err := fs.encrypt(jsonData)
+	encrypted, err := fs.seal(data, newPassphrase)
 	if err != nil {
-		return fmt.Errorf("encrypting tokens: %w", err)
+		return fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
 	}
 
 	// Ensure directory exists
-	dir := filepath.Dir(fs.filePath)
+	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return fmt.Errorf("creating config directory: %w", err)
 	}
 
-	// Write with restricted permissions
-	if err := os.WriteFile(fs.filePath, []byte(encrypted), 0600); err != nil {
-		return fmt.Errorf("writing token file: %w", err)
+	// Write with restricted permissions, replacing the file in one step
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encrypted, 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
 	}
 
 	return nil
@@ -149,12 +433,12 @@ func (fs *FileStore) loadTokens() (*fileTokenData, error) {
 	encryptedData, err := os.ReadFile(fs.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("no tokens stored")
+			return nil, ErrNoTokens
 		}
 		return nil, fmt.Errorf("reading token file: %w", err)
 	}
 
-	decrypted, err := fs.decrypt(string(encryptedData))
+	decrypted, stale, err := fs.open(encryptedData)
 	if err != nil {
 		return nil, fmt.Errorf("decrypting tokens: %w", err)
 	}
@@ -164,6 +448,12 @@ func (fs *FileStore) loadTokens() (*fileTokenData, error) {
 		return nil, fmt.Errorf("parsing token data: %w", err)
 	}
 
+	// Best effort: a file that can't be rewritten now, like without a
+	// passphrase to hand, is still readable and is tried again next time
+	if stale {
+		_ = fs.write(&data)
+	}
+
 	return &data, nil
 }
 
@@ -183,6 +473,7 @@ func (fs *FileStore) GetTokenMeta() (*TokenMeta, error) {
 
 	return &TokenMeta{
 		ExpiresAt:    data.ExpiresAt,
+		IssuedAt:     data.UpdatedAt.Unix(),
 		RefreshToken: data.RefreshToken,
 		IDToken:      data.IDToken,
 	}, nil
@@ -208,9 +499,49 @@ func (fs *FileStore) GetRefreshToken() (string, error) {
 	return data.RefreshToken, nil
 }
 
+// Clear removes the token file. The key file stays, as other profiles'
+// token files use it too.
 func (fs *FileStore) Clear() error {
 	if err := os.Remove(fs.filePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("removing token file: %w", err)
 	}
 	return nil
 }
+
+// secretPath is the file a secret is kept in, beside the token file:
+// tokens.<name>.enc, or tokens-<namespace>.<name>.enc. Profile names
+// can't contain dots, so these never clash with another profile's files.
+func (fs *FileStore) secretPath(name string) string {
+	return strings.TrimSuffix(fs.filePath, ".enc") + "." + name + ".enc"
+}
+
+func (fs *FileStore) SaveSecret(name string, data []byte) error {
+	return fs.writeFile(fs.secretPath(name), data)
+}
+
+func (fs *FileStore) GetSecret(name string) ([]byte, error) {
+	path := fs.secretPath(name)
+	encrypted, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSecret
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+
+	data, stale, err := fs.open(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", name, err)
+	}
+	if stale {
+		_ = fs.writeFile(path, data)
+	}
+	return data, nil
+}
+
+func (fs *FileStore) DeleteSecret(name string) error {
+	if err := os.Remove(fs.secretPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing %s: %w", name, err)
+	}
+	return nil
+}
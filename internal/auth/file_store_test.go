@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFileStore(t *testing.T, encryption string) *FileStore {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	fs := NewFileStore("", encryption)
+	fs.passphrase = func(bool) ([]byte, error) { return []byte("correct horse"), nil }
+	return fs
+}
+
+func TestFileStore_Keyfile(t *testing.T) {
+	fs := testFileStore(t, "keyfile")
+	if err := fs.SaveTokens("secret-access", &TokenResponse{RefreshToken: "secret-refresh", ExpiresIn: 3600}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, _ := os.ReadFile(fs.filePath)
+	if !bytes.HasPrefix(file, []byte{'C', 'H', 'S', 'T', fileVersion, kdfKeyfile}) {
+		t.Errorf("unexpected header % x", file[:6])
+	}
+	if bytes.Contains(file, []byte("secret")) {
+		t.Error("token file contains the tokens in the clear")
+	}
+
+	info, err := os.Stat(fs.keyPath)
+	if err != nil {
+		t.Fatalf("key file: %v", err)
+	}
+	if info.Size() != 32 || info.Mode().Perm() != 0600 {
+		t.Errorf("key file is %d bytes with mode %v", info.Size(), info.Mode().Perm())
+	}
+
+	// Another profile's store shares the key
+	if token, err := NewFileStore("", "keyfile").GetAccessToken(); err != nil || token != "secret-access" {
+		t.Errorf("GetAccessToken = %q, %v", token, err)
+	}
+
+	// Without the key file, the token file is useless
+	os.Remove(fs.keyPath)
+	if _, err := fs.GetAccessToken(); err == nil || !strings.Contains(err.Error(), "key file") {
+		t.Errorf("expected a missing key file error, got %v", err)
+	}
+}
+
+func TestFileStore_Passphrase(t *testing.T) {
+	fs := testFileStore(t, "passphrase")
+	if err := fs.SaveTokens("access", &TokenResponse{ExpiresIn: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fs.keyPath); !os.IsNotExist(err) {
+		t.Errorf("expected no key file with a passphrase, got %v", err)
+	}
+
+	wrong := NewFileStore("", "passphrase")
+	wrong.passphrase = func(bool) ([]byte, error) { return []byte("battery staple"), nil }
+	if _, err := wrong.GetAccessToken(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected a wrong passphrase error, got %v", err)
+	}
+
+	right := NewFileStore("", "passphrase")
+	asked := 0
+	right.passphrase = func(bool) ([]byte, error) {
+		asked++
+		return []byte("correct horse"), nil
+	}
+	for i := 0; i < 3; i++ {
+		if token, err := right.GetAccessToken(); err != nil || token != "access" {
+			t.Fatalf("GetAccessToken = %q, %v", token, err)
+		}
+	}
+	if asked != 1 {
+		t.Errorf("expected to be asked for the passphrase once, got %d", asked)
+	}
+}
+
+func TestFileStore_PassphraseFromEnv(t *testing.T) {
+	t.Setenv(PassphraseEnv, "from env")
+	pass, err := readPassphrase(true)
+	if err != nil || string(pass) != "from env" {
+		t.Errorf("readPassphrase = %q, %v", pass, err)
+	}
+}
+
+func TestFileStore_MigratesLegacyFile(t *testing.T) {
+	fs := testFileStore(t, "keyfile")
+
+	// Write a token file the way versions before the header did
+	plaintext, _ := json.Marshal(fileTokenData{AccessToken: "legacy-access", RefreshToken: "legacy-refresh", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	gcm, err := newGCM(fs.legacyKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	legacy := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil))
+	os.MkdirAll(filepath.Dir(fs.filePath), 0700)
+	os.WriteFile(fs.filePath, []byte(legacy), 0600)
+
+	if token, err := fs.GetRefreshToken(); err != nil || token != "legacy-refresh" {
+		t.Fatalf("GetRefreshToken = %q, %v", token, err)
+	}
+	file, _ := os.ReadFile(fs.filePath)
+	if !bytes.HasPrefix(file, []byte(fileMagic)) {
+		t.Errorf("expected the legacy file to be rewritten, got %q", file)
+	}
+	if token, err := fs.GetAccessToken(); err != nil || token != "legacy-access" {
+		t.Errorf("GetAccessToken after migrating = %q, %v", token, err)
+	}
+}
+
+func TestFileStore_ReencryptsWhenSettingChanges(t *testing.T) {
+	fs := testFileStore(t, "keyfile")
+	fs.SaveTokens("access", &TokenResponse{ExpiresIn: 3600})
+
+	protected := NewFileStore("", "passphrase")
+	protected.passphrase = fs.passphrase
+	if token, err := protected.GetAccessToken(); err != nil || token != "access" {
+		t.Fatalf("GetAccessToken = %q, %v", token, err)
+	}
+	file, _ := os.ReadFile(fs.filePath)
+	if file[len(fileMagic)+1] != kdfArgon2id {
+		t.Errorf("expected the file to be re-encrypted with the passphrase")
+	}
+}
+
+func TestFileStore_RejectsUnknownVersion(t *testing.T) {
+	fs := testFileStore(t, "keyfile")
+	fs.SaveTokens("access", &TokenResponse{ExpiresIn: 3600})
+
+	file, _ := os.ReadFile(fs.filePath)
+	file[len(fileMagic)] = 9
+	os.WriteFile(fs.filePath, file, 0600)
+	if _, err := fs.GetAccessToken(); err == nil || !strings.Contains(err.Error(), "version 9") {
+		t.Errorf("expected an unknown version error, got %v", err)
+	}
+}
+
+func TestFileStore_RejectsBadKeyParams(t *testing.T) {
+	fs := testFileStore(t, "passphrase")
+	fs.SaveTokens("access", &TokenResponse{ExpiresIn: 3600})
+	saved, _ := os.ReadFile(fs.filePath)
+	params := len(fileMagic) + 2
+
+	for name, change := range map[string]func([]byte){
+		"no passes":  func(f []byte) { binary.BigEndian.PutUint32(f[params:], 0) },
+		"no threads": func(f []byte) { f[params+8] = 0 },
+		"huge memory": func(f []byte) {
+			binary.BigEndian.PutUint32(f[params+4:], 0xffffffff)
+		},
+	} {
+		file := bytes.Clone(saved)
+		change(file)
+		os.WriteFile(fs.filePath, file, 0600)
+
+		store := NewFileStore("", "passphrase")
+		store.passphrase = fs.passphrase
+		if _, err := store.GetAccessToken(); err == nil || !strings.Contains(err.Error(), "invalid key parameters") {
+			t.Errorf("%s: expected an invalid parameters error, got %v", name, err)
+		}
+	}
+}
+
+func TestFileStore_Secrets(t *testing.T) {
+	fs := testFileStore(t, "keyfile")
+	if _, err := fs.GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("GetSecret error = %v, want ErrNoSecret", err)
+	}
+
+	if err := fs.SaveSecret("content-keys", []byte("top secret")); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := os.ReadFile(fs.secretPath("content-keys")); bytes.Contains(file, []byte("top secret")) {
+		t.Error("secret file contains the secret in the clear")
+	}
+	if data, err := fs.GetSecret("content-keys"); err != nil || string(data) != "top secret" {
+		t.Errorf("GetSecret = %q, %v", data, err)
+	}
+
+	// Logging out keeps secrets
+	if err := fs.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetSecret("content-keys"); err != nil {
+		t.Errorf("secret lost on Clear: %v", err)
+	}
+	if other, err := NewFileStore("work", "keyfile").GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("another profile got secret %q, %v", other, err)
+	}
+
+	if err := fs.DeleteSecret("content-keys"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("GetSecret after delete = %v, want ErrNoSecret", err)
+	}
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/credhelper"
+)
+
+// helperTimeout bounds one run of a credential helper. It's generous
+// because helpers for password managers may wait for the user to unlock
+// them.
+const helperTimeout = 2 * time.Minute
+
+// HelperStore keeps tokens with an external credential helper, like one
+// for 1Password, Vault or pass, using the protocol in package credhelper.
+type HelperStore struct {
+	command string
+	account string
+
+	// The tokens from the last get, so each use of the store doesn't run
+	// the helper again; stores and erases keep it up to date
+	mu     sync.Mutex
+	cached *credhelper.Tokens
+	loaded bool
+}
+
+// NewHelperStore runs command through the shell with the operation
+// appended, as git runs its credential helpers, so a helper path with
+// spaces in it can be quoted. On Windows, which has no sh, command is
+// split into words instead. The namespace becomes the account, "default"
+// for the default profile.
+func NewHelperStore(command, namespace string) (*HelperStore, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil, fmt.Errorf("token_store is helper but credential_helper isn't set")
+	}
+	account := namespace
+	if account == "" {
+		account = "default"
+	}
+	return &HelperStore{command: command, account: account}, nil
+}
+
+// The exit statuses sh gives when it can't run a command, because it
+// isn't executable or can't be found.
+const (
+	helperNotExecutable = 126
+	helperNotFound      = 127
+)
+
+// commandFor returns the helper's command for op.
+func (hs *HelperStore) commandFor(ctx context.Context, op string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		args := strings.Fields(hs.command)
+		return exec.CommandContext(ctx, args[0], append(args[1:], op)...)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", hs.command+` "$@"`, hs.command, op)
+}
+
+// run runs the helper for one operation and returns what it wrote to
+// stdout. req only needs the tokens or secret for op. A helper that can't
+// be started makes the store unavailable.
+func (hs *HelperStore) run(op string, r credhelper.Request) ([]byte, error) {
+	r.Version = credhelper.ProtocolVersion
+	r.Service = credhelper.Service
+	r.Account = hs.account
+	req, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling helper request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), helperTimeout)
+	defer cancel()
+
+	cmd := hs.commandFor(ctx, op)
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.Bytes(), nil
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("%w: credential helper %s timed out after %s", ErrStoreUnavailable, op, helperTimeout)
+	case errors.As(err, &exitErr):
+		if runtime.GOOS != "windows" && (exitErr.ExitCode() == helperNotFound || exitErr.ExitCode() == helperNotExecutable) {
+			return nil, fmt.Errorf("%w: running credential helper: %s", ErrStoreUnavailable, strings.TrimSpace(stderr.String()))
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("credential helper %s failed: %s", op, msg)
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %w", op, err)
+	}
+	return nil, fmt.Errorf("%w: running credential helper: %w", ErrStoreUnavailable, err)
+}
+
+func (hs *HelperStore) load() (*credhelper.Tokens, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.loaded {
+		if hs.cached == nil {
+			return nil, ErrNoTokens
+		}
+		return hs.cached, nil
+	}
+
+	out, err := hs.run(credhelper.OpGet, credhelper.Request{})
+	if err != nil {
+		return nil, err
+	}
+	var resp credhelper.Response
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, fmt.Errorf("parsing credential helper response: %w", err)
+		}
+	}
+	if resp.Tokens != nil && resp.Tokens.AccessToken == "" {
+		resp.Tokens = nil
+	}
+
+	hs.cached, hs.loaded = resp.Tokens, true
+	if hs.cached == nil {
+		return nil, ErrNoTokens
+	}
+	return hs.cached, nil
+}
+
+// Invalidate drops the cached tokens, so the next use runs the helper
+// again and sees tokens another process has stored since.
+func (hs *HelperStore) Invalidate() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.cached, hs.loaded = nil, false
+}
+
+func (hs *HelperStore) SaveTokens(accessToken string, resp *TokenResponse) error {
+	tokens := &credhelper.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: resp.RefreshToken,
+		IDToken:      resp.IDToken,
+		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).Unix(),
+		IssuedAt:     time.Now().Unix(),
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if _, err := hs.run(credhelper.OpStore, credhelper.Request{Tokens: tokens}); err != nil {
+		return err
+	}
+	hs.cached, hs.loaded = tokens, true
+	return nil
+}
+
+func (hs *HelperStore) GetAccessToken() (string, error) {
+	tokens, err := hs.load()
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
+
+func (hs *HelperStore) GetTokenMeta() (*TokenMeta, error) {
+	tokens, err := hs.load()
+	if err != nil {
+		return nil, err
+	}
+	return &TokenMeta{
+		ExpiresAt:    tokens.ExpiresAt,
+		IssuedAt:     tokens.IssuedAt,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+	}, nil
+}
+
+func (hs *HelperStore) IsTokenExpired() bool {
+	tokens, err := hs.load()
+	if err != nil {
+		return true
+	}
+	// Consider expired if within 60 seconds of expiry
+	return time.Now().Unix() >= tokens.ExpiresAt-60
+}
+
+func (hs *HelperStore) GetRefreshToken() (string, error) {
+	tokens, err := hs.load()
+	if err != nil {
+		return "", err
+	}
+	if tokens.RefreshToken == "" {
+		return "", fmt.Errorf("no refresh token stored")
+	}
+	return tokens.RefreshToken, nil
+}
+
+func (hs *HelperStore) Clear() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if _, err := hs.run(credhelper.OpErase, credhelper.Request{}); err != nil {
+		return err
+	}
+	hs.cached, hs.loaded = nil, true
+	return nil
+}
+
+func (hs *HelperStore) SaveSecret(name string, data []byte) error {
+	_, err := hs.run(credhelper.OpStoreSecret, credhelper.Request{Secret: &credhelper.Secret{Name: name, Data: data}})
+	return err
+}
+
+func (hs *HelperStore) GetSecret(name string) ([]byte, error) {
+	out, err := hs.run(credhelper.OpGetSecret, credhelper.Request{Secret: &credhelper.Secret{Name: name}})
+	if err != nil {
+		return nil, err
+	}
+	var resp credhelper.Response
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, fmt.Errorf("parsing credential helper response: %w", err)
+		}
+	}
+	if resp.Secret == nil || len(resp.Secret.Data) == 0 {
+		return nil, ErrNoSecret
+	}
+	return resp.Secret.Data, nil
+}
+
+func (hs *HelperStore) DeleteSecret(name string) error {
+	_, err := hs.run(credhelper.OpEraseSecret, credhelper.Request{Secret: &credhelper.Secret{Name: name}})
+	return err
+}
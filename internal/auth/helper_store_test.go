@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/martinjt/claude-history-cli/internal/credhelper"
+)
+
+// The test binary stands in for a credential helper: with helperDirEnv set
+// it serves one request with the reference helper instead of running the
+// tests, and with helperFailEnv set it fails like a locked vault would.
+const (
+	helperDirEnv  = "CLAUDE_HISTORY_TEST_HELPER_DIR"
+	helperFailEnv = "CLAUDE_HISTORY_TEST_HELPER_FAIL"
+)
+
+func TestMain(m *testing.M) {
+	if msg := os.Getenv(helperFailEnv); msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(1)
+	}
+	if dir := os.Getenv(helperDirEnv); dir != "" {
+		helper := &credhelper.DirHelper{Dir: dir}
+		if err := helper.Serve(os.Args[len(os.Args)-1], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testHelperStore(t *testing.T, namespace string) *HelperStore {
+	t.Helper()
+	if strings.ContainsAny(os.Args[0], " \t") {
+		t.Skip("test binary path has spaces")
+	}
+	t.Setenv(helperDirEnv, t.TempDir())
+	store, err := NewHelperStore(os.Args[0], namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestHelperStore(t *testing.T) {
+	store := testHelperStore(t, "")
+
+	if _, err := store.GetAccessToken(); !errors.Is(err, ErrNoTokens) {
+		t.Fatalf("expected ErrNoTokens before login, got %v", err)
+	}
+	if err := store.SaveTokens("access", &TokenResponse{RefreshToken: "refresh", IDToken: "id", ExpiresIn: 3600}); err != nil {
+		t.Fatalf("SaveTokens: %v", err)
+	}
+
+	// A fresh store has nothing cached, so this reads back through the helper
+	again, _ := NewHelperStore(os.Args[0], "")
+	meta, err := again.GetTokenMeta()
+	if err != nil {
+		t.Fatalf("GetTokenMeta: %v", err)
+	}
+	if meta.RefreshToken != "refresh" || meta.IDToken != "id" || meta.IssuedAt == 0 {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+	if again.IsTokenExpired() {
+		t.Error("expected the stored token to be valid")
+	}
+
+	if err := again.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	fresh, _ := NewHelperStore(os.Args[0], "")
+	if _, err := fresh.GetAccessToken(); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("expected ErrNoTokens after Clear, got %v", err)
+	}
+}
+
+func TestHelperStore_Errors(t *testing.T) {
+	if _, err := NewHelperStore("  ", ""); err == nil {
+		t.Error("expected an empty command to be rejected")
+	}
+
+	missing, _ := NewHelperStore("claude-history-no-such-helper", "")
+	if _, err := missing.GetAccessToken(); !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("expected a missing helper to be unavailable, got %v", err)
+	}
+
+	store := testHelperStore(t, "work")
+	t.Setenv(helperFailEnv, "vault is sealed")
+	_, err := store.GetAccessToken()
+	if err == nil || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("expected the helper's message, got %v", err)
+	}
+}
+
+func TestHelperStore_PathWithSpaces(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is split into words on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "1Password CLI")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	helper := filepath.Join(dir, "helper")
+	if err := os.Symlink(os.Args[0], helper); err != nil {
+		t.Skipf("can't link the test binary: %v", err)
+	}
+	t.Setenv(helperDirEnv, t.TempDir())
+
+	// The operation still comes last, after the helper's own arguments
+	store, err := NewHelperStore(fmt.Sprintf("'%s' --vault claude", helper), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveTokens("access", &TokenResponse{ExpiresIn: 3600}); err != nil {
+		t.Fatalf("SaveTokens: %v", err)
+	}
+	store.Invalidate()
+	if token, err := store.GetAccessToken(); err != nil || token != "access" {
+		t.Errorf("expected the stored token, got %q, %v", token, err)
+	}
+}
+
+func TestHelperStore_RefreshSeesOtherProcess(t *testing.T) {
+	// Two stores on the same helper directory stand in for two processes
+	ours := testHelperStore(t, "")
+	theirs, _ := NewHelperStore(os.Args[0], "")
+
+	if err := ours.SaveTokens("stale", &TokenResponse{RefreshToken: "refresh", ExpiresIn: -60}); err != nil {
+		t.Fatal(err)
+	}
+	if !ours.IsTokenExpired() {
+		t.Fatal("expected the stale token to be expired")
+	}
+	// The other process refreshes first, rotating the refresh token
+	if err := theirs.SaveTokens("fresh", &TokenResponse{RefreshToken: "rotated", ExpiresIn: 3600}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refreshing again would spend the old refresh token, so the flow fails
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{shouldFail: true}, ours)
+	manager.lockPath = filepath.Join(t.TempDir(), "refresh.lock")
+	token, err := manager.GetValidToken(context.Background())
+	if err != nil || token != "fresh" {
+		t.Errorf("expected the other process's token, got %q, %v", token, err)
+	}
+}
+
+func TestHelperStore_Secrets(t *testing.T) {
+	store := testHelperStore(t, "work")
+
+	if _, err := store.GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("expected ErrNoSecret before saving, got %v", err)
+	}
+	if err := store.SaveSecret("content-keys", []byte("keyring")); err != nil {
+		t.Fatalf("SaveSecret: %v", err)
+	}
+	if data, err := store.GetSecret("content-keys"); err != nil || string(data) != "keyring" {
+		t.Errorf("GetSecret = %q, %v", data, err)
+	}
+
+	// Logging out leaves secrets alone
+	store.SaveTokens("access", &TokenResponse{ExpiresIn: 3600})
+	store.Clear()
+	if _, err := store.GetSecret("content-keys"); err != nil {
+		t.Errorf("expected the secret to survive Clear, got %v", err)
+	}
+
+	if err := store.DeleteSecret("content-keys"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, err := store.GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("expected ErrNoSecret after deleting, got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew allows for the provider's clock being a little ahead or behind.
+const clockSkew = time.Minute
+
+// audience is the aud claim, which may be a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// Claims are the ID token claims the CLI reads.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	Expiry          int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	EmailVerified   bool     `json:"email_verified,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	Username        string   `json:"preferred_username,omitempty"`
+	Groups          []string `json:"groups,omitempty"`
+	CognitoGroups   []string `json:"cognito:groups,omitempty"`
+	CognitoUsername string   `json:"cognito:username,omitempty"`
+}
+
+// ExpiresAt is when the token stops being valid.
+func (c *Claims) ExpiresAt() time.Time {
+	return time.Unix(c.Expiry, 0)
+}
+
+// AllGroups returns the user's groups, from the standard claim or
+// Cognito's.
+func (c *Claims) AllGroups() []string {
+	if len(c.Groups) > 0 {
+		return c.Groups
+	}
+	return c.CognitoGroups
+}
+
+// DisplayName is the best name the token gives for the user.
+func (c *Claims) DisplayName() string {
+	for _, name := range []string{c.Name, c.Username, c.CognitoUsername} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// IDTokenVerifier checks ID tokens were signed by the issuer, for this
+// client, and are still valid.
+type IDTokenVerifier struct {
+	issuer   string
+	clientID string
+	keys     *JWKSCache
+	now      func() time.Time
+}
+
+func NewIDTokenVerifier(issuer, clientID string, keys *JWKSCache) *IDTokenVerifier {
+	return &IDTokenVerifier{
+		issuer:   issuer,
+		clientID: clientID,
+		keys:     keys,
+		now:      time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token's signature against the issuer's keys, then its
+// issuer, audience and expiry. If nonce isn't empty the token must carry
+// it, which ties the token to the login that asked for it.
+func (v *IDTokenVerifier) Verify(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("ID token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID token signature: %w", err)
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	// Only trust the claims once the signature checks out
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("ID token claims: %w", err)
+	}
+	if err := v.checkClaims(&claims, nonce); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (v *IDTokenVerifier) checkClaims(claims *Claims, nonce string) error {
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(v.issuer, "/") {
+		return fmt.Errorf("ID token is from issuer %q, expected %q", claims.Issuer, v.issuer)
+	}
+
+	found := false
+	for _, aud := range claims.Audience {
+		if aud == v.clientID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("ID token is for audience %v, not this client (%s)", []string(claims.Audience), v.clientID)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != v.clientID {
+		return fmt.Errorf("ID token was issued to %q, not this client (%s)", claims.AuthorizedParty, v.clientID)
+	}
+
+	now := v.now()
+	if claims.Expiry == 0 {
+		return fmt.Errorf("ID token has no expiry")
+	}
+	if now.After(claims.ExpiresAt().Add(clockSkew)) {
+		return fmt.Errorf("ID token expired at %s", claims.ExpiresAt().Format(time.RFC3339))
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("ID token was issued in the future")
+	}
+
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("ID token nonce doesn't match the login")
+	}
+	return nil
+}
+
+// verifySignature checks a JWS signature. Only the asymmetric algorithms
+// OIDC providers sign ID tokens with are accepted; in particular "none"
+// and the HMAC algorithms, which could be forged with a public key, are
+// refused.
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("ID token is signed with RS256 but the key isn't RSA")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature); err != nil {
+			return fmt.Errorf("ID token signature is invalid")
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("ID token is signed with ES256 but the key isn't EC")
+		}
+		// JWS uses the fixed-size r || s encoding, not ASN.1
+		if len(signature) != 64 {
+			return fmt.Errorf("ID token signature is invalid")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("ID token signature is invalid")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://idp.example.com/realms/dev"
+
+// testKeys signs tokens with an RSA and an EC key and serves both as a JWKS.
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	server  *httptest.Server
+	fetches atomic.Int32
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &testKeys{rsa: rsaKey, ec: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	doc := jwksDocument{Keys: []jwk{
+		{Kty: "RSA", Kid: "rsa-1", Use: "sig", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: b64(ecKey.X.FillBytes(make([]byte, 32))), Y: b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	k.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k.fetches.Add(1)
+		json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(k.server.Close)
+	return k
+}
+
+func (k *testKeys) cache(t *testing.T, path string) *JWKSCache {
+	return &JWKSCache{url: k.server.URL, path: path, client: k.server.Client(), now: time.Now}
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            testIssuer,
+		"sub":            "user-123",
+		"aud":            "cli",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "n-0",
+		"email":          "dev@example.com",
+		"email_verified": true,
+		"cognito:groups": []string{"admins"},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	v := NewIDTokenVerifier(testIssuer, "cli", keys.cache(t, filepath.Join(t.TempDir(), "jwks.json")))
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+		claims, err := v.Verify(context.Background(), keys.sign(t, alg, kid, validClaims()), "n-0")
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", alg, err)
+		}
+		if claims.Subject != "user-123" || claims.Email != "dev@example.com" {
+			t.Errorf("%s: claims = %+v", alg, claims)
+		}
+		if got := strings.Join(claims.AllGroups(), ","); got != "admins" {
+			t.Errorf("%s: groups = %q", alg, got)
+		}
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	keys := newTestKeys(t)
+	v := NewIDTokenVerifier(testIssuer, "cli", keys.cache(t, filepath.Join(t.TempDir(), "jwks.json")))
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := validClaims()
+		c[key] = value
+		return c
+	}
+
+	tampered := keys.sign(t, "RS256", "rsa-1", validClaims())
+	parts := strings.Split(tampered, ".")
+	forged, _ := json.Marshal(with("sub", "someone-else"))
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	tampered = strings.Join(parts, ".")
+
+	unsigned := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa-1"}`)),
+		parts[1],
+		"",
+	}, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"tampered claims", tampered, "signature is invalid"},
+		{"alg none", unsigned, "unsupported ID token algorithm"},
+		{"wrong key type", keys.sign(t, "ES256", "rsa-1", validClaims()), "isn't EC"},
+		{"unknown key", keys.sign(t, "RS256", "rsa-2", validClaims()), "no signing key"},
+		{"wrong issuer", keys.sign(t, "RS256", "rsa-1", with("iss", "https://evil.example.com")), "issuer"},
+		{"wrong audience", keys.sign(t, "RS256", "rsa-1", with("aud", []string{"other"})), "audience"},
+		{"expired", keys.sign(t, "RS256", "rsa-1", with("exp", time.Now().Add(-time.Hour).Unix())), "expired"},
+		{"wrong nonce", keys.sign(t, "RS256", "rsa-1", with("nonce", "replayed")), "nonce"},
+		{"malformed", "not-a-jwt", "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token, "n-0")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKSCache(t *testing.T) {
+	keys := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	if _, err := keys.cache(t, path).Key(context.Background(), "rsa-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	// A later run reads the keys from disk
+	cache := keys.cache(t, path)
+	if _, err := cache.Key(context.Background(), "ec-1"); err != nil {
+		t.Fatalf("Key from cache: %v", err)
+	}
+	if n := keys.fetches.Load(); n != 1 {
+		t.Errorf("fetched JWKS %d times, want 1", n)
+	}
+
+	// An unknown key ID right after a fetch doesn't fetch again...
+	if _, err := cache.Key(context.Background(), "rotated"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if n := keys.fetches.Load(); n != 1 {
+		t.Errorf("fetched JWKS %d times, want 1", n)
+	}
+
+	// ...but does once the set is a little older, in case keys rotated,
+	// and a stale set is always refreshed
+	cache.now = func() time.Time { return time.Now().Add(2 * jwksMinRefresh) }
+	cache.Key(context.Background(), "rotated")
+	cache.now = func() time.Time { return time.Now().Add(2 * jwksMaxAge) }
+	cache.Key(context.Background(), "rsa-1")
+	if n := keys.fetches.Load(); n != 3 {
+		t.Errorf("fetched JWKS %d times, want 3", n)
+	}
+}
+
+func TestVerifier_Concurrent(t *testing.T) {
+	// API calls share one Manager, so checks can race to build the
+	// verifier and fill its key cache
+	t.Setenv("HOME", t.TempDir())
+	keys := newTestKeys(t)
+	config := &Config{ClientID: "cli", Issuer: testIssuer, AuthorizationURL: "https://sso.example.com/authorize", TokenURL: "https://sso.example.com/token", JWKSURL: keys.server.URL}
+	manager := NewManagerWithDeps(config, &MockPKCEFlow{}, &MockTokenStore{})
+	token := keys.sign(t, "RS256", "rsa-1", validClaims())
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := manager.verifyIDToken(context.Background(), token, "")
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("verifyIDToken: %v", err)
+		}
+	}
+	if n := keys.fetches.Load(); n != 1 {
+		t.Errorf("fetched JWKS %d times, want 1", n)
+	}
+}
+
+// idTokenFlow returns a fixed ID token from login.
+type idTokenFlow struct {
+	MockPKCEFlow
+	idToken string
+	nonce   string
+}
+
+func (f *idTokenFlow) StartAuthFlow(ctx context.Context, opts LoginOptions) (*TokenResponse, error) {
+	return &TokenResponse{AccessToken: "access", IDToken: f.idToken, Nonce: f.nonce, ExpiresIn: 3600}, nil
+}
+
+func TestLogin_VerifiesIDToken(t *testing.T) {
+	keys := newTestKeys(t)
+	verifier := NewIDTokenVerifier(testIssuer, "cli", keys.cache(t, filepath.Join(t.TempDir(), "jwks.json")))
+
+	tests := []struct {
+		name    string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", "n-0", false},
+		{"nonce from another login", "n-1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &MockTokenStore{}
+			flow := &idTokenFlow{idToken: keys.sign(t, "RS256", "rsa-1", validClaims()), nonce: tt.nonce}
+			manager := NewManagerWithDeps(&Config{}, flow, store)
+			manager.idVerifier = verifier
+
+			err := manager.Login(context.Background(), LoginOptions{Force: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && store.hasTokens {
+				t.Error("tokens were stored despite a rejected ID token")
+			}
+			if !tt.wantErr {
+				identity, err := manager.WhoAmI(context.Background())
+				if err != nil {
+					t.Fatalf("WhoAmI: %v", err)
+				}
+				if identity.Claims.Email != "dev@example.com" {
+					t.Errorf("WhoAmI email = %q", identity.Claims.Email)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+)
+
+const (
+	// jwksMaxAge is how long a cached key set is trusted before it's
+	// fetched again.
+	jwksMaxAge = 24 * time.Hour
+
+	// jwksMinRefresh stops an unknown key ID from triggering a fetch on
+	// every call; providers rotate keys far less often than this.
+	jwksMinRefresh = time.Minute
+)
+
+// jwk is one key of a JSON Web Key Set (RFC 7517). Only the signing key
+// types the verifier supports are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwksDocument struct {
+	Keys []jwk `json:"keys"`
+}
+
+// cachedJWKS is the key set as saved on disk.
+type cachedJWKS struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Keys      []jwk     `json:"keys"`
+}
+
+// JWKSCache fetches an issuer's signing keys and keeps them on disk, so
+// checking a token doesn't need the network every time.
+type JWKSCache struct {
+	url    string
+	path   string
+	client *http.Client
+	now    func() time.Time
+
+	// mu guards cached, which concurrent API calls may all check tokens
+	// against
+	mu     sync.Mutex
+	cached *cachedJWKS
+}
+
+// NewJWKSCache caches the key set at url under the config directory.
+func NewJWKSCache(url string) *JWKSCache {
+	sum := sha256.Sum256([]byte(url))
+	return &JWKSCache{
+		url:    url,
+		path:   filepath.Join(config.DefaultConfigDir(), "jwks", hex.EncodeToString(sum[:8])+".json"),
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Key returns the public key with the given key ID. The cached set is used
+// while it's fresh; an unknown key ID means the provider may have rotated
+// its keys, so the set is fetched again.
+func (c *JWKSCache) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached == nil {
+		c.cached = c.load()
+	}
+
+	if c.cached != nil && c.now().Sub(c.cached.FetchedAt) < jwksMaxAge {
+		if key, ok := findKey(c.cached.Keys, kid); ok {
+			return key.publicKey()
+		}
+		if c.now().Sub(c.cached.FetchedAt) < jwksMinRefresh {
+			return nil, fmt.Errorf("no signing key with ID %q", kid)
+		}
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		return nil, err
+	}
+	key, ok := findKey(c.cached.Keys, kid)
+	if !ok {
+		return nil, fmt.Errorf("no signing key with ID %q", kid)
+	}
+	return key.publicKey()
+}
+
+func findKey(keys []jwk, kid string) (jwk, bool) {
+	for _, k := range keys {
+		if k.Kid == kid && (k.Use == "" || k.Use == "sig") {
+			return k, true
+		}
+	}
+	return jwk{}, false
+}
+
+// load reads the cached key set, or returns nil if there isn't a usable one.
+func (c *JWKSCache) load() *cachedJWKS {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil
+	}
+	var cached cachedJWKS
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != c.url {
+		return nil
+	}
+	return &cached
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("creating JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading JWKS: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS request failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var doc jwksDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	c.cached = &cachedJWKS{URL: c.url, FetchedAt: c.now(), Keys: doc.Keys}
+	if err := c.save(); err != nil {
+		// The keys are still good for this run
+		slog.Warn("caching JWKS", "url", c.url, logging.KeyError, err)
+	}
+	return nil
+}
+
+func (c *JWKSCache) save() error {
+	data, err := json.MarshalIndent(c.cached, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: modulus: %w", k.Kid, err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: exponent: %w", k.Kid, err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %s: exponent too large", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("key %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: x: %w", k.Kid, err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: y: %w", k.Kid, err)
+		}
+		// ecdh checks the point is on the curve
+		point := make([]byte, 65)
+		point[0] = 4 // uncompressed
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return nil, fmt.Errorf("key %s: coordinates too large", k.Kid)
+		}
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %q", k.Kid, k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
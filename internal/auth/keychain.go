@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,6 +19,7 @@ const (
 
 type TokenMeta struct {
 	ExpiresAt    int64  `json:"expires_at"`
+	IssuedAt     int64  `json:"issued_at,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IDToken      string `json:"id_token,omitempty"`
 }
@@ -25,19 +28,26 @@ type KeychainStore struct {
 	serviceName string
 }
 
-func NewKeychainStore() *KeychainStore {
+// NewKeychainStore stores tokens under the keychain service for the given
+// profile namespace, or the original service name for "".
+func NewKeychainStore(namespace string) *KeychainStore {
+	serviceName := keychainService
+	if namespace != "" {
+		serviceName += ":" + namespace
+	}
 	return &KeychainStore{
-		serviceName: keychainService,
+		serviceName: serviceName,
 	}
 }
 
 func (ks *KeychainStore) SaveTokens(accessToken string, resp *TokenResponse) error {
 	if err := keyring.Set(ks.serviceName, accessTokenKey, accessToken); err != nil {
-		return fmt.Errorf("saving access token to keychain: %w", err)
+		return keychainError("saving access token to keychain", err)
 	}
 
 	meta := TokenMeta{
 		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).Unix(),
+		IssuedAt:     time.Now().Unix(),
 		RefreshToken: resp.RefreshToken,
 		IDToken:      resp.IDToken,
 	}
@@ -48,7 +58,7 @@ func (ks *KeychainStore) SaveTokens(accessToken string, resp *TokenResponse) err
 	}
 
 	if err := keyring.Set(ks.serviceName, tokenMetaKey, string(metaJSON)); err != nil {
-		return fmt.Errorf("saving token meta to keychain: %w", err)
+		return keychainError("saving token meta to keychain", err)
 	}
 
 	return nil
@@ -57,7 +67,7 @@ func (ks *KeychainStore) SaveTokens(accessToken string, resp *TokenResponse) err
 func (ks *KeychainStore) GetAccessToken() (string, error) {
 	token, err := keyring.Get(ks.serviceName, accessTokenKey)
 	if err != nil {
-		return "", fmt.Errorf("getting access token from keychain: %w", err)
+		return "", keychainError("getting access token from keychain", err)
 	}
 	return token, nil
 }
@@ -65,7 +75,7 @@ func (ks *KeychainStore) GetAccessToken() (string, error) {
 func (ks *KeychainStore) GetTokenMeta() (*TokenMeta, error) {
 	metaStr, err := keyring.Get(ks.serviceName, tokenMetaKey)
 	if err != nil {
-		return nil, fmt.Errorf("getting token meta from keychain: %w", err)
+		return nil, keychainError("getting token meta from keychain", err)
 	}
 
 	var meta TokenMeta
@@ -97,7 +107,59 @@ func (ks *KeychainStore) GetRefreshToken() (string, error) {
 }
 
 func (ks *KeychainStore) Clear() error {
-	_ = keyring.Delete(ks.serviceName, accessTokenKey)
-	_ = keyring.Delete(ks.serviceName, tokenMetaKey)
+	for _, key := range []string{accessTokenKey, tokenMetaKey} {
+		if err := keyring.Delete(ks.serviceName, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return keychainError("removing tokens from keychain", err)
+		}
+	}
+	return nil
+}
+
+// secretKey is the keychain entry a secret is kept under, apart from the
+// token entries.
+func secretKey(name string) string {
+	return "secret:" + name
+}
+
+func (ks *KeychainStore) SaveSecret(name string, data []byte) error {
+	if err := keyring.Set(ks.serviceName, secretKey(name), base64.StdEncoding.EncodeToString(data)); err != nil {
+		return keychainError("saving "+name+" to keychain", err)
+	}
+	return nil
+}
+
+func (ks *KeychainStore) GetSecret(name string) ([]byte, error) {
+	encoded, err := keyring.Get(ks.serviceName, secretKey(name))
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrNoSecret
+	}
+	if err != nil {
+		return nil, keychainError("getting "+name+" from keychain", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s from keychain: %w", name, err)
+	}
+	return data, nil
+}
+
+func (ks *KeychainStore) DeleteSecret(name string) error {
+	if err := keyring.Delete(ks.serviceName, secretKey(name)); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return keychainError("removing "+name+" from keychain", err)
+	}
 	return nil
 }
+
+// keychainError classifies an error from the keyring: a missing entry
+// means nothing is stored, and anything else from the platform's keychain
+// service (no D-Bus session, no Secret Service, access refused) means the
+// keychain can't be used right now.
+func keychainError(doing string, err error) error {
+	switch {
+	case errors.Is(err, keyring.ErrNotFound):
+		return fmt.Errorf("%s: %w", doing, ErrNoTokens)
+	case errors.Is(err, keyring.ErrSetDataTooBig):
+		return fmt.Errorf("%s: %w", doing, err)
+	}
+	return fmt.Errorf("%s: %w: %w", doing, ErrStoreUnavailable, err)
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/filelock"
+)
+
+const (
+	// staleLockAge is how old a lock file must be before it's assumed to be
+	// left over from a process that crashed mid-refresh. A refresh is one
+	// HTTP request with a 30 second timeout, so a live holder never gets
+	// near it.
+	staleLockAge = 2 * time.Minute
+)
+
+// refreshLockPath is the lock file that serialises token refreshes for a
+// token namespace across processes, next to where the tokens are stored.
+func refreshLockPath(dir, namespace string) string {
+	name := "refresh.lock"
+	if namespace != "" {
+		name = "refresh-" + namespace + ".lock"
+	}
+	return filepath.Join(dir, name)
+}
+
+// acquireLock takes the refresh lock at path, waiting for another holder
+// to release it until ctx is done. The returned function releases it.
+func acquireLock(ctx context.Context, path string) (func(), error) {
+	return filelock.Acquire(ctx, path, staleLockAge)
+}
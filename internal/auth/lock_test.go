@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "refresh.lock")
+
+	release, err := acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatalf("acquireLock: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := acquireLock(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a held lock to block, got %v", err)
+	}
+
+	release()
+	release, err = acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatalf("acquireLock after release: %v", err)
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected release to remove the lock file, got %v", err)
+	}
+}
+
+func TestAcquireLock_BreaksStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "refresh.lock")
+	os.WriteFile(path, []byte("12345\n"), 0600)
+	old := time.Now().Add(-2 * staleLockAge)
+	os.Chtimes(path, old, old)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := acquireLock(ctx, path)
+	if err != nil {
+		t.Fatalf("expected a stale lock to be taken over, got %v", err)
+	}
+	release()
+}
+
+func TestRefreshLockPath(t *testing.T) {
+	if got := refreshLockPath("/cfg", ""); got != filepath.Join("/cfg", "refresh.lock") {
+		t.Errorf("default namespace: %s", got)
+	}
+	if got := refreshLockPath("/cfg", "work"); got != filepath.Join("/cfg", "refresh-work.lock") {
+		t.Errorf("work namespace: %s", got)
+	}
+}
@@ -2,27 +2,99 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	appconfig "github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/logging"
 )
 
 // AuthFlow interface for OAuth flows (to allow mocking in tests)
 type AuthFlow interface {
-	StartAuthFlow(ctx context.Context) (*TokenResponse, error)
+	StartAuthFlow(ctx context.Context, opts LoginOptions) (*TokenResponse, error)
 	RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error)
 }
 
+// DeviceAuthorizer runs the OAuth device authorization grant (RFC 8628)
+type DeviceAuthorizer interface {
+	RequestDeviceCode(ctx context.Context) (*DeviceFlowResponse, error)
+	PollForToken(ctx context.Context, deviceCode string, interval int) (*TokenResponse, error)
+}
+
 type Manager struct {
 	config     *Config
 	pkceFlow   AuthFlow
+	deviceFlow DeviceAuthorizer
 	tokenStore TokenStore
+	client     *http.Client
+
+	// idVerifier is built on first use, see verifier
+	verifierMu sync.Mutex
+	idVerifier *IDTokenVerifier
+
+	// refreshMu and the file at lockPath make refreshes one at a time,
+	// see refresh. Without a lockPath only this process is covered.
+	refreshMu sync.Mutex
+	lockPath  string
+
+	// service is the client credentials token, see serviceAccessToken
+	service serviceToken
+
+	// globalSignOutURL overrides Cognito's regional endpoint (for testing)
+	globalSignOutURL string
 }
 
 func NewManager(config *Config) *Manager {
 	return &Manager{
 		config:     config,
 		pkceFlow:   NewPKCEFlow(config),
-		tokenStore: NewTokenStore(), // Auto-detects tokenStore availability
+		deviceFlow: NewDeviceFlow(config),
+		tokenStore: openTokenStore(config),
+		client:     &http.Client{Timeout: 30 * time.Second},
+		lockPath:   refreshLockPath(appconfig.DefaultConfigDir(), config.TokenNamespace),
+	}
+}
+
+// openTokenStore opens the configured token store. A store that can't be
+// opened, from a bad token_store setting, fails on first use instead. The
+// service modes don't open one at all, so CI runners never touch a
+// keychain or prompt for a passphrase.
+func openTokenStore(config *Config) TokenStore {
+	if config.AuthMode != "" && config.AuthMode != appconfig.AuthModeUser {
+		return unavailableStore{err: fmt.Errorf("%w: auth_mode %s keeps no tokens", ErrStoreUnavailable, config.AuthMode)}
+	}
+	store, err := NewTokenStore(StoreOptions{
+		Backend:        config.TokenStore,
+		Namespace:      config.TokenNamespace,
+		FileEncryption: config.TokenFileEncryption,
+		Helper:         config.CredentialHelper,
+	})
+	if err != nil {
+		return unavailableStore{err: fmt.Errorf("%w: %w", ErrStoreUnavailable, err)}
+	}
+	return store
+}
+
+// Secrets is where the profile's other secrets, like its content keys,
+// are kept: the token store, if it can hold them.
+func (m *Manager) Secrets() (SecretStore, error) {
+	switch store := m.tokenStore.(type) {
+	case SecretStore:
+		return store, nil
+	case unavailableStore:
+		return nil, store.err
 	}
+	return nil, fmt.Errorf("the %s token store can't keep secrets other than tokens", StoreName(m.tokenStore))
+}
+
+// TokenStoreName names the backend holding the tokens, like keychain.
+func (m *Manager) TokenStoreName() string {
+	return StoreName(m.tokenStore)
 }
 
 // NewManagerWithDeps creates a manager with injected dependencies (for testing)
@@ -30,16 +102,37 @@ func NewManagerWithDeps(config *Config, flow AuthFlow, store TokenStore) *Manage
 	return &Manager{
 		config:     config,
 		pkceFlow:   flow,
+		deviceFlow: NewDeviceFlow(config),
 		tokenStore: store,
+		client:     &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
-// Login performs the OAuth PKCE flow login.
-// It opens a browser for user authorization and starts a local callback server.
-// If force is false, it will check for valid tokens first and skip re-authentication if they exist.
-func (m *Manager) Login(ctx context.Context, force bool) error {
+// LoginOptions choose how Login authenticates.
+type LoginOptions struct {
+	// Force re-authenticates even if the stored tokens are still valid
+	Force bool
+	// Device uses the device authorization grant instead of a browser on
+	// this machine, for SSH sessions and containers
+	Device bool
+	// NoBrowser prints the sign-in URL and reads the redirected URL back
+	// from the terminal, instead of opening a browser and listening for it
+	NoBrowser bool
+}
+
+// Login authenticates the user and stores the tokens.
+// By default it runs the PKCE flow, opening a browser for user authorization
+// and starting a local callback server. With opts.Device it prints a code to
+// enter on another device instead.
+// Unless opts.Force is set, it checks for valid tokens first and skips
+// re-authentication if they exist.
+func (m *Manager) Login(ctx context.Context, opts LoginOptions) error {
+	if m.serviceMode() {
+		return m.notForService("needs no login")
+	}
+
 	// If not forcing re-authentication, check if we already have valid tokens
-	if !force {
+	if !opts.Force {
 		if m.IsAuthenticated() {
 			// Try to validate the token with a simple check
 			_, err := m.GetValidToken(ctx)
@@ -53,34 +146,176 @@ func (m *Manager) Login(ctx context.Context, force bool) error {
 		}
 	}
 
-	tokenResp, err := m.pkceFlow.StartAuthFlow(ctx)
+	var tokenResp *TokenResponse
+	var err error
+	if opts.Device {
+		tokenResp, err = m.loginDevice(ctx)
+	} else {
+		tokenResp, err = m.pkceFlow.StartAuthFlow(ctx, opts)
+	}
 	if err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
+	// Don't keep tokens from a login that can't prove who it's for
+	var claims *Claims
+	if tokenResp.IDToken != "" {
+		claims, err = m.verifyIDToken(ctx, tokenResp.IDToken, tokenResp.Nonce)
+		if err != nil {
+			return fmt.Errorf("rejecting ID token: %w", err)
+		}
+	}
+
 	if err := m.tokenStore.SaveTokens(tokenResp.AccessToken, tokenResp); err != nil {
 		return fmt.Errorf("saving tokens: %w", err)
 	}
 
-	fmt.Println("\n✅ Successfully authenticated!")
+	if claims != nil && claims.Email != "" {
+		fmt.Printf("\n✅ Successfully authenticated as %s!\n", claims.Email)
+	} else {
+		fmt.Println("\n✅ Successfully authenticated!")
+	}
 	return nil
 }
 
+// loginDevice shows the verification URI and user code, as text and as a QR
+// code for phones, then waits for the user to approve the login.
+func (m *Manager) loginDevice(ctx context.Context) (*TokenResponse, error) {
+	code, err := m.deviceFlow.RequestDeviceCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("\n🔐 To sign in, visit %s and enter the code:\n\n    %s\n\n", code.VerificationURI, code.UserCode)
+
+	// The complete URI carries the code, so scanning it skips typing
+	link := code.VerificationURIComplete
+	if link == "" {
+		link = code.VerificationURI
+	}
+	fmt.Println("📱 Or scan this QR code:")
+	fmt.Println()
+	if err := writeQR(os.Stdout, link); err != nil {
+		fmt.Printf("⚠️  Could not draw QR code: %v\n", err)
+	}
+	fmt.Println("\nWaiting for authorization...")
+
+	if code.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	token, err := m.deviceFlow.PollForToken(ctx, code.DeviceCode, code.Interval)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("device code expired, please try again")
+	}
+	return token, err
+}
+
+// renewBefore is how long before expiry GetValidToken renews the access
+// token, so a request started just before it expires doesn't carry a token
+// that expires in flight or by the server's slightly faster clock. Short
+// lived tokens are renewed in the last quarter of their lifetime instead,
+// so they aren't refreshed on every call.
+const renewBefore = 5 * time.Minute
+
 // GetValidToken returns a valid access token, refreshing if necessary.
+// Tokens close to expiry are renewed early; if that fails while the current
+// token still has time left, the current token is returned instead.
+// In a service mode the token comes from the service credentials instead.
 func (m *Manager) GetValidToken(ctx context.Context) (string, error) {
+	if m.serviceMode() {
+		return m.serviceAccessToken(ctx, "")
+	}
 	if !m.tokenStore.IsTokenExpired() {
 		token, err := m.tokenStore.GetAccessToken()
 		if err == nil {
+			if !m.dueForRenewal() {
+				return token, nil
+			}
+			renewed, err := m.refresh(ctx, token)
+			if err == nil {
+				return renewed, nil
+			}
+			slog.Warn("renewing access token early failed, using the current one", logging.KeyError, err)
 			return token, nil
 		}
 	}
 
-	// Try refresh
+	token, _ := m.tokenStore.GetAccessToken()
+	return m.refresh(ctx, token)
+}
+
+// ForceRefresh renews the tokens after the API rejected the access token,
+// for example because it was revoked or the clocks disagree about its
+// expiry. If another request or process has already replaced the rejected
+// token, the replacement is returned without refreshing again.
+func (m *Manager) ForceRefresh(ctx context.Context, rejected string) (string, error) {
+	if m.serviceMode() {
+		return m.serviceAccessToken(ctx, rejected)
+	}
+	return m.refresh(ctx, rejected)
+}
+
+// dueForRenewal reports whether the stored access token is close enough to
+// expiry to renew. If the expiry isn't known, the store's own expiry check
+// is all there is.
+func (m *Manager) dueForRenewal() bool {
+	meta, err := m.tokenStore.GetTokenMeta()
+	if err != nil || meta == nil || meta.ExpiresAt == 0 {
+		return false
+	}
+	return renewalDue(meta.IssuedAt, meta.ExpiresAt)
+}
+
+// renewalDue reports whether a token issued and expiring at the given Unix
+// times is within renewBefore of expiry, or in the last quarter of its
+// lifetime if that is shorter. An unknown issue time is taken as 0.
+func renewalDue(issuedAt, expiresAt int64) bool {
+	window := renewBefore
+	if issuedAt > 0 && issuedAt < expiresAt {
+		if quarter := time.Duration(expiresAt-issuedAt) * time.Second / 4; quarter < window {
+			window = quarter
+		}
+	}
+	return time.Now().Add(window).Unix() >= expiresAt
+}
+
+// refresh replaces the stale access token using the refresh token. Only
+// one refresh runs at a time: within this process refreshMu holds the
+// others back, and across processes the lock file does. Whoever waited
+// then finds the stale token already replaced and uses the new one, rather
+// than spending the refresh token again, which providers that rotate
+// refresh tokens treat as reuse.
+func (m *Manager) refresh(ctx context.Context, stale string) (string, error) {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	if m.lockPath != "" {
+		release, err := acquireLock(ctx, m.lockPath)
+		if err != nil {
+			return "", fmt.Errorf("waiting for another token refresh: %w", err)
+		}
+		defer release()
+	}
+
+	// Whoever held the lock may have refreshed already; make sure the
+	// store isn't answering from what it read before
+	if c, ok := m.tokenStore.(cachingStore); ok {
+		c.Invalidate()
+	}
+	if token, err := m.tokenStore.GetAccessToken(); err == nil && token != stale && !m.tokenStore.IsTokenExpired() {
+		slog.Debug("access token already refreshed by another request")
+		return token, nil
+	}
+
 	refreshToken, err := m.tokenStore.GetRefreshToken()
 	if err != nil {
 		return "", fmt.Errorf("no valid token or refresh token available, please login again: %w", err)
 	}
 
+	start := time.Now()
 	tokenResp, err := m.pkceFlow.RefreshToken(ctx, refreshToken)
 	if err != nil {
 		// Refresh failed, need to re-login
@@ -92,21 +327,151 @@ func (m *Manager) GetValidToken(ctx context.Context) (string, error) {
 	if tokenResp.RefreshToken == "" {
 		tokenResp.RefreshToken = refreshToken
 	}
+	// Some providers don't return a new ID token either
+	if tokenResp.IDToken == "" {
+		if meta, err := m.tokenStore.GetTokenMeta(); err == nil {
+			tokenResp.IDToken = meta.IDToken
+		}
+	}
 
 	if err := m.tokenStore.SaveTokens(tokenResp.AccessToken, tokenResp); err != nil {
 		return "", fmt.Errorf("saving refreshed tokens: %w", err)
 	}
+	slog.Info("refreshed access token", "expires_in", tokenResp.ExpiresIn, logging.KeyDuration, time.Since(start))
 
 	return tokenResp.AccessToken, nil
 }
 
-// Logout clears stored tokens.
-func (m *Manager) Logout() error {
-	return m.tokenStore.Clear()
+// Identity is who the stored tokens belong to.
+type Identity struct {
+	Claims               *Claims
+	AccessTokenExpiresAt time.Time
+}
+
+// WhoAmI validates the stored ID token and returns its claims, refreshing
+// the tokens first if they have expired.
+func (m *Manager) WhoAmI(ctx context.Context) (*Identity, error) {
+	if m.serviceMode() {
+		return nil, m.notForService("has no user logged in")
+	}
+	if _, err := m.GetValidToken(ctx); err != nil {
+		return nil, err
+	}
+
+	meta, err := m.tokenStore.GetTokenMeta()
+	if err != nil {
+		return nil, err
+	}
+	if meta.IDToken == "" {
+		return nil, fmt.Errorf("no ID token stored, please login again")
+	}
+
+	claims, err := m.verifyIDToken(ctx, meta.IDToken, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Claims: claims, AccessTokenExpiresAt: time.Unix(meta.ExpiresAt, 0)}, nil
+}
+
+func (m *Manager) verifyIDToken(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	v, err := m.verifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return v.Verify(ctx, idToken, nonce)
+}
+
+// verifier checks ID tokens against the issuer's published keys, which
+// may first need discovering.
+func (m *Manager) verifier(ctx context.Context) (*IDTokenVerifier, error) {
+	// Not refreshMu, which a refresh holds while it checks the new token
+	m.verifierMu.Lock()
+	defer m.verifierMu.Unlock()
+	if m.idVerifier != nil {
+		return m.idVerifier, nil
+	}
+
+	if err := m.config.Resolve(ctx, m.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	if m.config.Issuer == "" || m.config.JWKSURL == "" {
+		return nil, fmt.Errorf("no issuer or JWKS URL configured to check ID tokens against")
+	}
+
+	m.idVerifier = NewIDTokenVerifier(m.config.Issuer, m.config.ClientID, NewJWKSCache(m.config.JWKSURL))
+	return m.idVerifier, nil
+}
+
+// Logout revokes the refresh token at the provider, so no copy of it can be
+// used again, then clears the stored tokens. The tokens are cleared even if
+// revocation fails, in which case the error wraps ErrRevocationFailed.
+func (m *Manager) Logout(ctx context.Context) error {
+	if m.serviceMode() {
+		return m.notForService("keeps no tokens to log out of")
+	}
+	revokeErr := m.revoke(ctx)
+
+	if err := m.tokenStore.Clear(); err != nil {
+		return err
+	}
+
+	if revokeErr != nil {
+		return fmt.Errorf("%w: %w", ErrRevocationFailed, revokeErr)
+	}
+	return nil
+}
+
+func (m *Manager) revoke(ctx context.Context) error {
+	token, hint := "", "refresh_token"
+	if refreshToken, err := m.tokenStore.GetRefreshToken(); err == nil {
+		token = refreshToken
+	} else if accessToken, err := m.tokenStore.GetAccessToken(); err == nil {
+		token, hint = accessToken, "access_token"
+	}
+	if token == "" {
+		return nil // Nothing to revoke
+	}
+
+	if err := m.config.Resolve(ctx, m.client); err != nil {
+		return fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	if m.config.RevocationURL == "" {
+		return fmt.Errorf("%s has no revocation endpoint", m.config.Issuer)
+	}
+	return revokeToken(ctx, m.client, m.config, token, hint)
+}
+
+// GlobalSignOut ends the user's sessions on every device, so refresh tokens
+// held anywhere, like on a lost laptop, stop working. This machine's tokens
+// stop working too; Logout should follow. Only Cognito supports it; for
+// other providers it returns ErrGlobalSignOutUnsupported.
+func (m *Manager) GlobalSignOut(ctx context.Context) error {
+	if m.serviceMode() {
+		return m.notForService("has no user sessions")
+	}
+	if m.config.CognitoRegion == "" {
+		return ErrGlobalSignOutUnsupported
+	}
+
+	accessToken, err := m.GetValidToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := m.globalSignOutURL
+	if endpoint == "" {
+		endpoint = cognitoEndpoint(m.config.CognitoRegion)
+	}
+	return cognitoGlobalSignOut(ctx, m.client, endpoint, accessToken)
 }
 
-// IsAuthenticated checks if there are stored, non-expired tokens.
+// IsAuthenticated checks if there are stored, non-expired tokens, or in a
+// service mode whether the secret can be read.
 func (m *Manager) IsAuthenticated() bool {
+	if m.serviceMode() {
+		_, _, err := m.serviceSecret()
+		return err == nil
+	}
 	_, err := m.tokenStore.GetAccessToken()
 	if err != nil {
 		return false
@@ -3,6 +3,11 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -23,6 +28,7 @@ func (m *MockTokenStore) SaveTokens(accessToken string, resp *TokenResponse) err
 	m.isExpired = false
 	m.tokenMeta = &TokenMeta{
 		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		IDToken:   resp.IDToken,
 	}
 	return nil
 }
@@ -66,7 +72,7 @@ type MockPKCEFlow struct {
 	callCount  int
 }
 
-func (m *MockPKCEFlow) StartAuthFlow(ctx context.Context) (*TokenResponse, error) {
+func (m *MockPKCEFlow) StartAuthFlow(ctx context.Context, opts LoginOptions) (*TokenResponse, error) {
 	m.callCount++
 	if m.shouldFail {
 		return nil, errors.New("auth flow failed")
@@ -104,7 +110,7 @@ func TestLogin_WithValidTokens_SkipsReauth(t *testing.T) {
 	manager := NewManagerWithDeps(&Config{}, mockFlow, mockStore)
 
 	// Login without force - should skip re-auth
-	err := manager.Login(context.Background(), false)
+	err := manager.Login(context.Background(), LoginOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -130,7 +136,7 @@ func TestLogin_WithForceFlag_AlwaysReauths(t *testing.T) {
 	manager := NewManagerWithDeps(&Config{}, mockFlow, mockStore)
 
 	// Login with force - should always re-auth
-	err := manager.Login(context.Background(), true)
+	err := manager.Login(context.Background(), LoginOptions{Force: true})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -161,7 +167,7 @@ func TestLogin_WithExpiredTokens_Reauths(t *testing.T) {
 	manager := NewManagerWithDeps(&Config{}, mockFlow, mockStore)
 
 	// Login without force - should re-auth because tokens are expired
-	err := manager.Login(context.Background(), false)
+	err := manager.Login(context.Background(), LoginOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -181,7 +187,7 @@ func TestLogin_WithNoTokens_Reauths(t *testing.T) {
 	manager := NewManagerWithDeps(&Config{}, mockFlow, mockStore)
 
 	// Login without force - should re-auth because no tokens exist
-	err := manager.Login(context.Background(), false)
+	err := manager.Login(context.Background(), LoginOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -231,3 +237,231 @@ func TestIsAuthenticated_WithNoTokens_ReturnsFalse(t *testing.T) {
 		t.Error("expected IsAuthenticated to return false with no tokens")
 	}
 }
+
+// MockDeviceFlow for testing
+type MockDeviceFlow struct {
+	polledCode string
+	pollErr    error
+}
+
+func (m *MockDeviceFlow) RequestDeviceCode(ctx context.Context) (*DeviceFlowResponse, error) {
+	return &DeviceFlowResponse{
+		DeviceCode:              "device-code",
+		UserCode:                "ABCD-1234",
+		VerificationURI:         "https://example.com/device",
+		VerificationURIComplete: "https://example.com/device?user_code=ABCD-1234",
+		ExpiresIn:               600,
+		Interval:                5,
+	}, nil
+}
+
+func (m *MockDeviceFlow) PollForToken(ctx context.Context, deviceCode string, interval int) (*TokenResponse, error) {
+	m.polledCode = deviceCode
+	if m.pollErr != nil {
+		return nil, m.pollErr
+	}
+	return &TokenResponse{
+		AccessToken:  "device-access-token",
+		RefreshToken: "device-refresh-token",
+		ExpiresIn:    3600,
+	}, nil
+}
+
+func TestLogin_Device_UsesDeviceFlow(t *testing.T) {
+	mockStore := &MockTokenStore{}
+	mockFlow := &MockPKCEFlow{}
+	mockDevice := &MockDeviceFlow{}
+
+	manager := NewManagerWithDeps(&Config{}, mockFlow, mockStore)
+	manager.deviceFlow = mockDevice
+
+	if err := manager.Login(context.Background(), LoginOptions{Device: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mockFlow.callCount != 0 {
+		t.Errorf("expected browser flow not to be called, but was called %d times", mockFlow.callCount)
+	}
+	if mockDevice.polledCode != "device-code" {
+		t.Errorf("expected to poll for device-code, got %q", mockDevice.polledCode)
+	}
+	if mockStore.accessToken != "device-access-token" {
+		t.Errorf("expected device token to be stored, got %q", mockStore.accessToken)
+	}
+}
+
+func TestLogin_Device_Expired(t *testing.T) {
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{}, &MockTokenStore{})
+	manager.deviceFlow = &MockDeviceFlow{pollErr: context.DeadlineExceeded}
+
+	err := manager.Login(context.Background(), LoginOptions{Device: true})
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected expiry error, got %v", err)
+	}
+}
+
+// syncedStore guards a MockTokenStore so concurrent refreshes can share it,
+// like processes sharing the keychain.
+type syncedStore struct {
+	mu sync.Mutex
+	MockTokenStore
+}
+
+func (s *syncedStore) SaveTokens(accessToken string, resp *TokenResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MockTokenStore.SaveTokens(accessToken, resp)
+}
+
+func (s *syncedStore) GetAccessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MockTokenStore.GetAccessToken()
+}
+
+func (s *syncedStore) GetTokenMeta() (*TokenMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MockTokenStore.GetTokenMeta()
+}
+
+func (s *syncedStore) IsTokenExpired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MockTokenStore.IsTokenExpired()
+}
+
+func (s *syncedStore) GetRefreshToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MockTokenStore.GetRefreshToken()
+}
+
+// slowRefreshFlow counts refreshes, taking long enough that concurrent
+// callers overlap.
+type slowRefreshFlow struct {
+	MockPKCEFlow
+	refreshes atomic.Int32
+}
+
+func (f *slowRefreshFlow) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	n := f.refreshes.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return &TokenResponse{AccessToken: fmt.Sprintf("refreshed-%d", n), ExpiresIn: 3600}, nil
+}
+
+func expiredStore() *syncedStore {
+	return &syncedStore{MockTokenStore: MockTokenStore{
+		hasTokens:    true,
+		accessToken:  "expired-token",
+		refreshToken: "refresh",
+		isExpired:    true,
+		tokenMeta:    &TokenMeta{ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+	}}
+}
+
+func TestGetValidToken_RefreshesOnce(t *testing.T) {
+	store := expiredStore()
+	flow := &slowRefreshFlow{}
+	lockPath := filepath.Join(t.TempDir(), "refresh.lock")
+
+	// Two managers with the same lock file stand in for two processes
+	managers := []*Manager{
+		NewManagerWithDeps(&Config{}, flow, store),
+		NewManagerWithDeps(&Config{}, flow, store),
+	}
+	for _, m := range managers {
+		m.lockPath = lockPath
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := managers[i%2].GetValidToken(context.Background())
+			if err != nil {
+				t.Errorf("GetValidToken: %v", err)
+			}
+			tokens[i] = token
+		}(i)
+	}
+	wg.Wait()
+
+	if n := flow.refreshes.Load(); n != 1 {
+		t.Errorf("expected one refresh, got %d", n)
+	}
+	for _, token := range tokens {
+		if token != "refreshed-1" {
+			t.Errorf("expected every caller to get the refreshed token, got %v", tokens)
+			break
+		}
+	}
+}
+
+func TestGetValidToken_RenewsBeforeExpiry(t *testing.T) {
+	store := &MockTokenStore{
+		hasTokens:    true,
+		accessToken:  "expiring-token",
+		refreshToken: "refresh",
+		tokenMeta: &TokenMeta{
+			ExpiresAt: time.Now().Add(2 * time.Minute).Unix(),
+			IssuedAt:  time.Now().Add(-58 * time.Minute).Unix(),
+		},
+	}
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{}, store)
+
+	token, err := manager.GetValidToken(context.Background())
+	if err != nil || token != "refreshed-access-token" {
+		t.Errorf("expected early renewal, got %q, %v", token, err)
+	}
+
+	// A failed early renewal falls back to the token that's still valid
+	store.accessToken = "expiring-token"
+	store.tokenMeta.ExpiresAt = time.Now().Add(2 * time.Minute).Unix()
+	manager = NewManagerWithDeps(&Config{}, &MockPKCEFlow{shouldFail: true}, store)
+	token, err = manager.GetValidToken(context.Background())
+	if err != nil || token != "expiring-token" {
+		t.Errorf("expected the current token after a failed renewal, got %q, %v", token, err)
+	}
+}
+
+func TestGetValidToken_ShortLivedTokensNotRenewedEveryCall(t *testing.T) {
+	// A five minute token is inside renewBefore from the start, but isn't
+	// due until its last quarter
+	store := &MockTokenStore{
+		hasTokens:   true,
+		accessToken: "short-token",
+		tokenMeta: &TokenMeta{
+			ExpiresAt: time.Now().Add(4 * time.Minute).Unix(),
+			IssuedAt:  time.Now().Add(-time.Minute).Unix(),
+		},
+	}
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{shouldFail: true}, store)
+	if token, err := manager.GetValidToken(context.Background()); err != nil || token != "short-token" {
+		t.Errorf("expected the current token, got %q, %v", token, err)
+	}
+}
+
+func TestForceRefresh(t *testing.T) {
+	store := &MockTokenStore{
+		hasTokens:    true,
+		accessToken:  "rejected-token",
+		refreshToken: "refresh",
+		tokenMeta:    &TokenMeta{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{}, store)
+
+	token, err := manager.ForceRefresh(context.Background(), "rejected-token")
+	if err != nil || token != "refreshed-access-token" {
+		t.Fatalf("expected a refresh despite the unexpired token, got %q, %v", token, err)
+	}
+
+	// Someone else has already replaced the rejected token
+	manager = NewManagerWithDeps(&Config{}, &MockPKCEFlow{shouldFail: true}, store)
+	token, err = manager.ForceRefresh(context.Background(), "rejected-token")
+	if err != nil || token != "refreshed-access-token" {
+		t.Errorf("expected the replacement token, got %q, %v", token, err)
+	}
+}
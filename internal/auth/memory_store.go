@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps tokens for the life of the process only, for CI jobs
+// and containers that log in each run and shouldn't leave tokens behind.
+type MemoryStore struct {
+	mu          sync.Mutex
+	accessToken string
+	meta        *TokenMeta
+	secrets     map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (ms *MemoryStore) SaveTokens(accessToken string, resp *TokenResponse) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.accessToken = accessToken
+	ms.meta = &TokenMeta{
+		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).Unix(),
+		IssuedAt:     time.Now().Unix(),
+		RefreshToken: resp.RefreshToken,
+		IDToken:      resp.IDToken,
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetAccessToken() (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.meta == nil {
+		return "", ErrNoTokens
+	}
+	return ms.accessToken, nil
+}
+
+func (ms *MemoryStore) GetTokenMeta() (*TokenMeta, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.meta == nil {
+		return nil, ErrNoTokens
+	}
+	meta := *ms.meta
+	return &meta, nil
+}
+
+func (ms *MemoryStore) IsTokenExpired() bool {
+	meta, err := ms.GetTokenMeta()
+	if err != nil {
+		return true
+	}
+	// Consider expired if within 60 seconds of expiry
+	return time.Now().Unix() >= meta.ExpiresAt-60
+}
+
+func (ms *MemoryStore) GetRefreshToken() (string, error) {
+	meta, err := ms.GetTokenMeta()
+	if err != nil {
+		return "", err
+	}
+	if meta.RefreshToken == "" {
+		return "", fmt.Errorf("no refresh token stored")
+	}
+	return meta.RefreshToken, nil
+}
+
+func (ms *MemoryStore) Clear() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.accessToken = ""
+	ms.meta = nil
+	return nil
+}
+
+func (ms *MemoryStore) SaveSecret(name string, data []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.secrets == nil {
+		ms.secrets = make(map[string][]byte)
+	}
+	ms.secrets[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (ms *MemoryStore) GetSecret(name string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	data, ok := ms.secrets[name]
+	if !ok {
+		return nil, ErrNoSecret
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (ms *MemoryStore) DeleteSecret(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.secrets, name)
+	return nil
+}
@@ -1,43 +1,55 @@
 package auth
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// defaultRedirectPort is used for --no-browser logins when the config
+// doesn't list any ports; nothing listens on it, so it needn't be free.
+const defaultRedirectPort = 3000
+
 // PKCEFlow implements OAuth 2.0 Authorization Code flow with PKCE
 type PKCEFlow struct {
 	config *Config
 	client *http.Client
+	input  io.Reader // where --no-browser reads the pasted URL from
+	output io.Writer
 }
 
 func NewPKCEFlow(config *Config) *PKCEFlow {
 	return &PKCEFlow{
 		config: config,
 		client: &http.Client{Timeout: 30 * time.Second},
+		input:  os.Stdin,
+		output: os.Stdout,
 	}
 }
 
 // generatePKCE creates code verifier and challenge for PKCE
 func generatePKCE() (verifier, challenge string, err error) {
 	// Generate random 32-byte verifier
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", "", fmt.Errorf("generating random bytes: %w", err)
+	verifier, err = randomString()
+	if err != nil {
+		return "", "", err
 	}
 
-	// Base64 URL encode without padding
-	verifier = base64.RawURLEncoding.EncodeToString(b)
-
 	// SHA256 hash and base64 URL encode
 	h := sha256.Sum256([]byte(verifier))
 	challenge = base64.RawURLEncoding.EncodeToString(h[:])
@@ -45,124 +57,288 @@ func generatePKCE() (verifier, challenge string, err error) {
 	return verifier, challenge, nil
 }
 
-// StartAuthFlow initiates the PKCE flow and opens browser
-func (pf *PKCEFlow) StartAuthFlow(ctx context.Context) (*TokenResponse, error) {
+// randomString returns 32 random bytes, base64 URL encoded without padding
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// callbackResult is what the authorization server sent back to the
+// redirect URI
+type callbackResult struct {
+	code  string
+	state string
+	err   error
+}
+
+// parseCallback reads the authorization response from the redirect URI's
+// query.
+func parseCallback(query url.Values) callbackResult {
+	if errorMsg := query.Get("error"); errorMsg != "" {
+		return callbackResult{
+			state: query.Get("state"),
+			err:   fmt.Errorf("authentication error: %s - %s", errorMsg, query.Get("error_description")),
+		}
+	}
+	if query.Get("code") == "" {
+		return callbackResult{err: fmt.Errorf("no authorization code in the callback")}
+	}
+	return callbackResult{code: query.Get("code"), state: query.Get("state")}
+}
+
+// stateMatches guards against login CSRF: a callback whose state isn't the
+// one this login sent didn't come from our authorization request.
+func (r callbackResult) stateMatches(want string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.state), []byte(want)) == 1
+}
+
+// checkState returns the callback's error, or an error if its state doesn't
+// match.
+func (r callbackResult) checkState(want string) error {
+	if !r.stateMatches(want) {
+		return fmt.Errorf("state mismatch in callback, the login may have been tampered with")
+	}
+	return r.err
+}
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+	<h1>{{.Title}}</h1>
+	{{range .Lines}}<p>{{.}}</p>
+	{{end}}
+</body>
+</html>`))
+
+func writeCallbackPage(w http.ResponseWriter, status int, title string, lines ...string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	callbackPage.Execute(w, struct {
+		Title string
+		Lines []string
+	}{title, lines})
+}
+
+// StartAuthFlow initiates the PKCE flow and opens browser. With
+// opts.NoBrowser it prints the URL and asks for the redirected URL to be
+// pasted back instead of listening for the callback.
+func (pf *PKCEFlow) StartAuthFlow(ctx context.Context, opts LoginOptions) (*TokenResponse, error) {
+	if err := pf.config.Resolve(ctx, pf.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+
 	// Generate PKCE codes
 	verifier, challenge, err := generatePKCE()
 	if err != nil {
 		return nil, fmt.Errorf("generating PKCE: %w", err)
 	}
+	state, err := randomString()
+	if err != nil {
+		return nil, fmt.Errorf("generating state: %w", err)
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	var listeners []net.Listener
+	port := defaultRedirectPort
+	if len(pf.config.RedirectPorts) > 0 {
+		port = pf.config.RedirectPorts[0]
+	}
+	if !opts.NoBrowser {
+		listeners, err = listenLoopback(pf.config.RedirectPorts)
+		if err != nil {
+			return nil, err
+		}
+		port = listeners[0].Addr().(*net.TCPAddr).Port
+	}
+	redirectURI := fmt.Sprintf("http://localhost:%d/callback", port)
 
 	// Build authorization URL
-	authURL := fmt.Sprintf("https://%s/oauth2/authorize", pf.config.Domain)
 	params := url.Values{
 		"client_id":             {pf.config.ClientID},
 		"response_type":         {"code"},
-		"redirect_uri":          {"http://localhost:3000/callback"},
+		"redirect_uri":          {redirectURI},
 		"scope":                 {strings.Join(pf.config.Scopes, " ")},
 		"code_challenge":        {challenge},
 		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		"nonce":                 {nonce},
 	}
 
-	fullAuthURL := fmt.Sprintf("%s?%s", authURL, params.Encode())
-
-	// Start local callback server
-	codeChan := make(chan string, 1)
-	errChan := make(chan error, 1)
+	fullAuthURL := fmt.Sprintf("%s?%s", pf.config.AuthorizationURL, params.Encode())
 
-	server := &http.Server{
-		Addr: ":3000",
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			code := r.URL.Query().Get("code")
-			if code == "" {
-				errorMsg := r.URL.Query().Get("error")
-				errorDesc := r.URL.Query().Get("error_description")
+	var result callbackResult
+	if opts.NoBrowser {
+		result, err = pf.readPastedCallback(ctx, fullAuthURL)
+	} else {
+		result, err = pf.awaitCallback(ctx, listeners, fullAuthURL, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := result.checkState(state); err != nil {
+		return nil, err
+	}
 
-				w.Header().Set("Content-Type", "text/html")
-				fmt.Fprintf(w, `
-<!DOCTYPE html>
-<html>
-<head><title>Authentication Failed</title></head>
-<body>
-	<h1>Authentication Failed</h1>
-	<p>Error: %s</p>
-	<p>%s</p>
-	<p>You can close this window.</p>
-</body>
-</html>`, errorMsg, errorDesc)
+	// Exchange authorization code for tokens
+	tokens, err := pf.ExchangeCode(ctx, result.code, verifier, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	tokens.Nonce = nonce
+	return tokens, nil
+}
 
-				errChan <- fmt.Errorf("authentication error: %s - %s", errorMsg, errorDesc)
-				return
-			}
+// listenLoopback listens for the callback on the loopback interfaces only,
+// so nothing else on the network can deliver a code. It takes the first
+// free port from ports, or any free port if the list is empty. The redirect
+// URI says localhost, which browsers may resolve to either address, so ::1
+// is listened on too where it's available.
+func listenLoopback(ports []int) ([]net.Listener, error) {
+	candidates := ports
+	if len(candidates) == 0 {
+		candidates = []int{0}
+	}
 
-			w.Header().Set("Content-Type", "text/html")
-			fmt.Fprintf(w, `
-<!DOCTYPE html>
-<html>
-<head><title>Authentication Successful</title></head>
-<body>
-	<h1>✅ Authentication Successful!</h1>
-	<p>You can close this window and return to the terminal.</p>
-</body>
-</html>`)
+	var lastErr error
+	for _, port := range candidates {
+		l4, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		listeners := []net.Listener{l4}
+		port = l4.Addr().(*net.TCPAddr).Port
+		if l6, err := net.Listen("tcp", net.JoinHostPort("::1", strconv.Itoa(port))); err == nil {
+			listeners = append(listeners, l6)
+		}
+		return listeners, nil
+	}
 
-			codeChan <- code
-		}),
+	if len(ports) > 1 {
+		return nil, fmt.Errorf("no free callback port among %v: %w", ports, lastErr)
 	}
+	return nil, fmt.Errorf("starting callback server: %w", lastErr)
+}
 
-	// Start server in background
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errChan <- fmt.Errorf("callback server error: %w", err)
+// awaitCallback opens the browser and serves the redirect URI until the
+// authorization server sends the user back.
+func (pf *PKCEFlow) awaitCallback(ctx context.Context, listeners []net.Listener, fullAuthURL, state string) (callbackResult, error) {
+	resultChan := make(chan callbackResult, 1)
+	errChan := make(chan error, len(listeners))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		result := parseCallback(r.URL.Query())
+		// Ignore stray requests that aren't from this login, rather than
+		// letting them end it
+		if !result.stateMatches(state) {
+			writeCallbackPage(w, http.StatusBadRequest, "Authentication Failed",
+				"This sign-in link doesn't match the login in progress.", "You can close this window.")
+			return
 		}
-	}()
 
-	// Give server a moment to start
-	time.Sleep(100 * time.Millisecond)
+		if result.err != nil {
+			writeCallbackPage(w, http.StatusOK, "Authentication Failed", result.err.Error(), "You can close this window.")
+		} else {
+			writeCallbackPage(w, http.StatusOK, "✅ Authentication Successful!", "You can close this window and return to the terminal.")
+		}
+
+		select {
+		case resultChan <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	// Start server in background
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errChan <- fmt.Errorf("callback server error: %w", err)
+			}
+		}(l)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 
 	// Open browser
-	fmt.Println("\n🔐 Opening browser for authentication...")
-	fmt.Printf("📱 If browser doesn't open, visit: %s\n\n", fullAuthURL)
+	fmt.Fprintln(pf.output, "\n🔐 Opening browser for authentication...")
+	fmt.Fprintf(pf.output, "📱 If browser doesn't open, visit: %s\n\n", fullAuthURL)
 
 	if err := openBrowser(fullAuthURL); err != nil {
-		fmt.Printf("⚠️  Could not open browser automatically: %v\n", err)
-		fmt.Printf("Please open this URL manually: %s\n\n", fullAuthURL)
+		fmt.Fprintf(pf.output, "⚠️  Could not open browser automatically: %v\n", err)
+		fmt.Fprintf(pf.output, "Please open this URL manually: %s\n\n", fullAuthURL)
 	}
 
 	// Wait for callback or error
-	var authCode string
 	select {
 	case <-ctx.Done():
-		server.Shutdown(context.Background())
-		return nil, fmt.Errorf("authentication cancelled")
+		return callbackResult{}, fmt.Errorf("authentication cancelled")
 	case err := <-errChan:
-		server.Shutdown(context.Background())
-		return nil, err
-	case authCode = <-codeChan:
-		// Got the code, proceed to exchange
+		return callbackResult{}, err
+	case result := <-resultChan:
+		return result, nil
 	case <-time.After(5 * time.Minute):
-		server.Shutdown(context.Background())
-		return nil, fmt.Errorf("authentication timeout after 5 minutes")
+		return callbackResult{}, fmt.Errorf("authentication timeout after 5 minutes")
 	}
+}
 
-	// Shutdown callback server
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	server.Shutdown(shutdownCtx)
+// readPastedCallback has the user open the URL wherever they have a
+// browser and paste back the URL it was redirected to. That page won't
+// load, since nothing is listening, but its address holds the code.
+func (pf *PKCEFlow) readPastedCallback(ctx context.Context, fullAuthURL string) (callbackResult, error) {
+	fmt.Fprintln(pf.output, "\n🔐 Open this URL in a browser to sign in:")
+	fmt.Fprintf(pf.output, "\n%s\n\n", fullAuthURL)
+	fmt.Fprintln(pf.output, "After signing in, the browser is sent to a localhost page that won't load.")
+	fmt.Fprint(pf.output, "Copy that page's full URL from the address bar and paste it here: ")
 
-	// Exchange authorization code for tokens
-	return pf.ExchangeCode(ctx, authCode, verifier)
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(pf.input).ReadString('\n')
+		lines <- line
+	}()
+
+	var line string
+	select {
+	case <-ctx.Done():
+		return callbackResult{}, fmt.Errorf("authentication cancelled")
+	case line = <-lines:
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return callbackResult{}, fmt.Errorf("no URL pasted")
+	}
+	u, err := url.Parse(line)
+	if err != nil {
+		return callbackResult{}, fmt.Errorf("parsing pasted URL: %w", err)
+	}
+	return parseCallback(u.Query()), nil
 }
 
-// ExchangeCode exchanges authorization code for access/refresh tokens
-func (pf *PKCEFlow) ExchangeCode(ctx context.Context, code, verifier string) (*TokenResponse, error) {
-	tokenURL := fmt.Sprintf("https://%s/oauth2/token", pf.config.Domain)
+// ExchangeCode exchanges authorization code for access/refresh tokens.
+// redirectURI must be the one the authorization request used.
+func (pf *PKCEFlow) ExchangeCode(ctx context.Context, code, verifier, redirectURI string) (*TokenResponse, error) {
+	if err := pf.config.Resolve(ctx, pf.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	tokenURL := pf.config.TokenURL
 
 	data := url.Values{
 		"grant_type":    {"authorization_code"},
 		"client_id":     {pf.config.ClientID},
 		"code":          {code},
-		"redirect_uri":  {"http://localhost:3000/callback"},
+		"redirect_uri":  {redirectURI},
 		"code_verifier": {verifier},
 	}
 
@@ -197,7 +373,10 @@ func (pf *PKCEFlow) ExchangeCode(ctx context.Context, code, verifier string) (*T
 
 // RefreshToken refreshes an expired access token
 func (pf *PKCEFlow) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
-	tokenURL := fmt.Sprintf("https://%s/oauth2/token", pf.config.Domain)
+	if err := pf.config.Resolve(ctx, pf.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	tokenURL := pf.config.TokenURL
 
 	data := url.Values{
 		"grant_type":    {"refresh_token"},
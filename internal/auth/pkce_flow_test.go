@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTokenServer accepts the authorization code "good-code" and records the
+// redirect URI it was exchanged with.
+func newTokenServer(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var redirectURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		redirectURI = r.Form.Get("redirect_uri")
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 300})
+	}))
+	t.Cleanup(server.Close)
+	return server, &redirectURI
+}
+
+func testPKCEFlow(tokenURL string, ports []int) *PKCEFlow {
+	flow := NewPKCEFlow(&Config{
+		ClientID:         "cli",
+		Scopes:           []string{"openid"},
+		AuthorizationURL: "https://idp.example.com/authorize",
+		TokenURL:         tokenURL,
+		RedirectPorts:    ports,
+	})
+	flow.output = io.Discard
+	return flow
+}
+
+func TestStartAuthFlow_Callback(t *testing.T) {
+	tokenServer, exchangedRedirect := newTokenServer(t)
+	flow := testPKCEFlow(tokenServer.URL, nil)
+
+	var authURL *url.URL
+	openBrowser = func(rawURL string) error {
+		authURL, _ = url.Parse(rawURL)
+		query := authURL.Query()
+		redirect := query.Get("redirect_uri")
+
+		// The user's browser follows the redirect. A request with the
+		// wrong state must not end the login.
+		go func() {
+			resp, err := http.Get(redirect + "?code=evil-code&state=forged")
+			if err != nil {
+				t.Errorf("forged callback: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("forged callback status = %d, want 400", resp.StatusCode)
+			}
+
+			resp, err = http.Get(redirect + "?code=good-code&state=" + url.QueryEscape(query.Get("state")))
+			if err != nil {
+				t.Errorf("callback: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+		return nil
+	}
+	defer func() { openBrowser = launchBrowser }()
+
+	tokens, err := flow.StartAuthFlow(context.Background(), LoginOptions{})
+	if err != nil {
+		t.Fatalf("StartAuthFlow: %v", err)
+	}
+
+	query := authURL.Query()
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(param) == "" {
+			t.Errorf("authorization request has no %s", param)
+		}
+	}
+	if tokens.Nonce != query.Get("nonce") {
+		t.Errorf("Nonce = %q, want the one sent, %q", tokens.Nonce, query.Get("nonce"))
+	}
+
+	// Any port was allowed, so one was picked, and the code was exchanged
+	// with the same redirect URI
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	if redirect.Hostname() != "localhost" || redirect.Port() == "" || redirect.Path != "/callback" {
+		t.Errorf("redirect_uri = %q", redirect)
+	}
+	if *exchangedRedirect != redirect.String() {
+		t.Errorf("code exchanged with redirect_uri %q, want %q", *exchangedRedirect, redirect)
+	}
+}
+
+func TestStartAuthFlow_CallbackErrorIsEscaped(t *testing.T) {
+	flow := testPKCEFlow("http://127.0.0.1:0/token", nil)
+
+	bodies := make(chan string, 1)
+	openBrowser = func(rawURL string) error {
+		authURL, _ := url.Parse(rawURL)
+		query := authURL.Query()
+		go func() {
+			callback := fmt.Sprintf("%s?error=access_denied&error_description=%s&state=%s",
+				query.Get("redirect_uri"), url.QueryEscape("<script>alert(1)</script>"), url.QueryEscape(query.Get("state")))
+			resp, err := http.Get(callback)
+			if err != nil {
+				t.Errorf("callback: %v", err)
+				bodies <- ""
+				return
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			bodies <- string(b)
+		}()
+		return nil
+	}
+	defer func() { openBrowser = launchBrowser }()
+
+	_, err := flow.StartAuthFlow(context.Background(), LoginOptions{})
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("expected access_denied error, got %v", err)
+	}
+	body := <-bodies
+	if !strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("error description was not escaped:\n%s", body)
+	}
+}
+
+// pasteReader waits for the flow to print the authorization URL, then
+// "pastes" the redirect the browser would end up on.
+type pasteReader struct {
+	out     *syncBuffer
+	respond func(authURL *url.URL) string
+	done    bool
+}
+
+func (p *pasteReader) Read(b []byte) (int, error) {
+	if p.done {
+		return 0, io.EOF
+	}
+	p.done = true
+	for {
+		for _, field := range strings.Fields(p.out.String()) {
+			if strings.HasPrefix(field, "https://idp.example.com/authorize?") {
+				u, _ := url.Parse(field)
+				return copy(b, p.respond(u)+"\n"), nil
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestStartAuthFlow_NoBrowser(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   func(sent string) string
+		wantErr string
+	}{
+		{name: "matching state", state: func(sent string) string { return sent }},
+		{name: "forged state", state: func(string) string { return "forged" }, wantErr: "state mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenServer, exchangedRedirect := newTokenServer(t)
+			flow := testPKCEFlow(tokenServer.URL, []int{8400, 8401})
+			out := &syncBuffer{}
+			flow.output = out
+			flow.input = &pasteReader{out: out, respond: func(authURL *url.URL) string {
+				q := authURL.Query()
+				return q.Get("redirect_uri") + "?code=good-code&state=" + url.QueryEscape(tt.state(q.Get("state")))
+			}}
+
+			_, err := flow.StartAuthFlow(context.Background(), LoginOptions{NoBrowser: true})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StartAuthFlow: %v", err)
+			}
+			// Nothing listens, so the first allowed port is used as is
+			if *exchangedRedirect != "http://localhost:8400/callback" {
+				t.Errorf("redirect_uri = %q", *exchangedRedirect)
+			}
+		})
+	}
+}
+
+func TestListenLoopback(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freePort := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	listeners, err := listenLoopback([]int{busyPort, freePort})
+	if err != nil {
+		t.Fatalf("listenLoopback: %v", err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for _, l := range listeners {
+		addr := l.Addr().(*net.TCPAddr)
+		if !addr.IP.IsLoopback() {
+			t.Errorf("listening on %s, want loopback only", addr)
+		}
+		if addr.Port != freePort {
+			t.Errorf("listening on port %d, want the free one, %d", addr.Port, freePort)
+		}
+	}
+
+	if _, err := listenLoopback([]int{busyPort}); err == nil {
+		t.Error("expected an error when every allowed port is taken")
+	}
+}
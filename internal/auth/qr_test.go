@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWriteQR(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeQR(&buf, "https://example.com/device?user_code=ABCD-1234"); err != nil {
+		t.Fatalf("writeQR: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	width := utf8.RuneCountInString(lines[0])
+	// Two rows per line, so the drawing is about half as tall as wide
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Errorf("got %d lines for width %d, want %d", len(lines), width, want)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Errorf("line %d has width %d, want %d", i, n, width)
+		}
+	}
+
+	// The quiet zone is light, so the first line is solid
+	if strings.Trim(lines[0], "█") != "" {
+		t.Errorf("first line should be all light, got %q", lines[0])
+	}
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrRevocationFailed means the tokens were cleared locally but the
+	// provider may still accept the refresh token.
+	ErrRevocationFailed = errors.New("could not revoke the refresh token at the provider")
+
+	// ErrGlobalSignOutUnsupported means the provider has no way for a user
+	// to end their own sessions everywhere.
+	ErrGlobalSignOutUnsupported = errors.New("the provider doesn't support signing out everywhere")
+	// ErrMissingScope means the access token wasn't granted a scope the
+	// call needs, so the user must log in again to get one that is.
+	ErrMissingScope = errors.New("the access token lacks a required scope")
+)
+
+// revokeToken revokes a token at the revocation endpoint (RFC 7009).
+// Revoking a refresh token also ends the access tokens issued from it.
+func revokeToken(ctx context.Context, client *http.Client, config *Config, token, hint string) error {
+	data := url.Values{
+		"token":           {token},
+		"token_type_hint": {hint},
+		"client_id":       {config.ClientID},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.RevocationURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("creating revocation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoking token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("token revocation failed (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// cognitoEndpoint is the Cognito user pool API for a region.
+func cognitoEndpoint(region string) string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/", region)
+}
+
+// cognitoGlobalSignOut ends every session of the access token's user, on
+// all devices. Cognito only allows it for access tokens with the
+// aws.cognito.signin.user.admin scope.
+func cognitoGlobalSignOut(ctx context.Context, client *http.Client, endpoint, accessToken string) error {
+	body, err := json.Marshal(map[string]string{"AccessToken": accessToken})
+	if err != nil {
+		return fmt.Errorf("marshaling sign-out request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating sign-out request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSCognitoIdentityProviderService.GlobalSignOut")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("signing out: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		// Tokens from before the scope was requested, or from an app client
+		// that doesn't allow it, get NotAuthorizedException
+		if strings.Contains(string(respBody), "does not have required scopes") {
+			return fmt.Errorf("%w %s: allow it for the app client in Cognito, then log in again", ErrMissingScope, cognitoAdminScope)
+		}
+		return fmt.Errorf("global sign-out failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
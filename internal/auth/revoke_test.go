@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogout_RevokesRefreshToken(t *testing.T) {
+	var revoked, hint string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		revoked, hint = r.Form.Get("token"), r.Form.Get("token_type_hint")
+		if r.Form.Get("client_id") != "cli" {
+			t.Errorf("client_id = %q", r.Form.Get("client_id"))
+		}
+	}))
+	defer server.Close()
+
+	store := &MockTokenStore{hasTokens: true, accessToken: "access", refreshToken: "refresh"}
+	config := &Config{ClientID: "cli", AuthorizationURL: "x", TokenURL: "x", RevocationURL: server.URL}
+	manager := NewManagerWithDeps(config, &MockPKCEFlow{}, store)
+
+	if err := manager.Logout(context.Background()); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if revoked != "refresh" || hint != "refresh_token" {
+		t.Errorf("revoked %q (%s), want the refresh token", revoked, hint)
+	}
+	if store.hasTokens {
+		t.Error("tokens not cleared")
+	}
+}
+
+func TestLogout_ClearsEvenIfRevocationFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"unsupported_token_type"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	store := &MockTokenStore{hasTokens: true, accessToken: "access", refreshToken: "refresh"}
+	config := &Config{ClientID: "cli", AuthorizationURL: "x", TokenURL: "x", RevocationURL: server.URL}
+	manager := NewManagerWithDeps(config, &MockPKCEFlow{}, store)
+
+	err := manager.Logout(context.Background())
+	if !errors.Is(err, ErrRevocationFailed) {
+		t.Errorf("Logout error = %v, want ErrRevocationFailed", err)
+	}
+	if store.hasTokens {
+		t.Error("tokens not cleared")
+	}
+}
+
+func TestLogout_NothingStored(t *testing.T) {
+	manager := NewManagerWithDeps(&Config{}, &MockPKCEFlow{}, &MockTokenStore{})
+	if err := manager.Logout(context.Background()); err != nil {
+		t.Errorf("Logout with no tokens: %v", err)
+	}
+}
+
+func TestGlobalSignOut(t *testing.T) {
+	var target, accessToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		accessToken = body["AccessToken"]
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	store := &MockTokenStore{hasTokens: true, accessToken: "access", refreshToken: "refresh"}
+	manager := NewManagerWithDeps(NewConfig("eu-west-1", "eu-west-1_abc", "cli", "auth.example.com"), &MockPKCEFlow{}, store)
+	manager.globalSignOutURL = server.URL
+
+	if err := manager.GlobalSignOut(context.Background()); err != nil {
+		t.Fatalf("GlobalSignOut: %v", err)
+	}
+	if target != "AWSCognitoIdentityProviderService.GlobalSignOut" || accessToken != "access" {
+		t.Errorf("sign-out request: target %q, token %q", target, accessToken)
+	}
+
+	oidc := NewManagerWithDeps(NewOIDCConfig("https://sso.example.com", "cli"), &MockPKCEFlow{}, store)
+	if err := oidc.GlobalSignOut(context.Background()); !errors.Is(err, ErrGlobalSignOutUnsupported) {
+		t.Errorf("GlobalSignOut for OIDC = %v, want ErrGlobalSignOutUnsupported", err)
+	}
+}
+
+func TestGlobalSignOut_MissingScope(t *testing.T) {
+	// Sign-out needs the admin scope, so logins must ask for it
+	config := NewConfig("eu-west-1", "eu-west-1_abc", "cli", "auth.example.com")
+	if !contains(config.Scopes, "aws.cognito.signin.user.admin") {
+		t.Errorf("Scopes = %v, want aws.cognito.signin.user.admin requested", config.Scopes)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"NotAuthorizedException","message":"Access Token does not have required scopes"}`))
+	}))
+	defer server.Close()
+
+	store := &MockTokenStore{hasTokens: true, accessToken: "access", refreshToken: "refresh"}
+	manager := NewManagerWithDeps(config, &MockPKCEFlow{}, store)
+	manager.globalSignOutURL = server.URL
+
+	err := manager.GlobalSignOut(context.Background())
+	if !errors.Is(err, ErrMissingScope) || !strings.Contains(err.Error(), "log in again") {
+		t.Errorf("GlobalSignOut = %v, want ErrMissingScope saying what to do", err)
+	}
+}
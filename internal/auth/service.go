@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	appconfig "github.com/martinjt/claude-history-cli/internal/config"
+	"github.com/martinjt/claude-history-cli/internal/logging"
+)
+
+// Environment variables holding the service modes' secrets, as CI systems
+// usually inject them. When they aren't set, the secrets are read from the
+// files the client_secret_file and api_key_file settings name.
+const (
+	ClientSecretEnv = "CLAUDE_HISTORY_SYNC_CLIENT_SECRET"
+	APIKeyEnv       = "CLAUDE_HISTORY_SYNC_API_KEY"
+)
+
+// ErrServiceAuth is returned for what only a logged in user can do, like
+// Login, Logout and WhoAmI, when a service auth mode is configured.
+var ErrServiceAuth = errors.New("a service auth mode is configured")
+
+// serviceToken is an access token from the client credentials grant. It's
+// only kept in memory, as each run can cheaply fetch another.
+type serviceToken struct {
+	token     string
+	issuedAt  int64
+	expiresAt int64 // 0 when the provider didn't say
+}
+
+// usable reports whether the token can still be sent, allowing the same
+// minute of clock skew as the token stores do.
+func (t serviceToken) usable() bool {
+	return t.token != "" && (t.expiresAt == 0 || time.Now().Unix() < t.expiresAt-60)
+}
+
+// Mode is the auth mode in use, one of the config AuthMode constants.
+func (m *Manager) Mode() string {
+	if m.config.AuthMode == "" {
+		return appconfig.AuthModeUser
+	}
+	return m.config.AuthMode
+}
+
+func (m *Manager) serviceMode() bool {
+	return m.Mode() != appconfig.AuthModeUser
+}
+
+// notForService is the error for user operations in a service mode.
+func (m *Manager) notForService(what string) error {
+	return fmt.Errorf("%w: auth_mode is %s, which %s", ErrServiceAuth, m.Mode(), what)
+}
+
+// CredentialSource says where a service mode's secret is read from, the
+// environment variable or the file, without revealing it. The error says
+// what to set if there is no secret.
+func (m *Manager) CredentialSource() (string, error) {
+	_, source, err := m.serviceSecret()
+	return source, err
+}
+
+// serviceSecret returns the client secret or API key and where it came
+// from.
+func (m *Manager) serviceSecret() (secret, source string, err error) {
+	switch m.Mode() {
+	case appconfig.AuthModeClientCredentials:
+		return readSecret(ClientSecretEnv, m.config.ClientSecretFile, "client_secret_file")
+	case appconfig.AuthModeAPIKey:
+		return readSecret(APIKeyEnv, m.config.APIKeyFile, "api_key_file")
+	}
+	return "", "", fmt.Errorf("auth_mode %s has no secret", m.Mode())
+}
+
+// readSecret reads a secret from the environment variable, or failing that
+// from the file the setting names. Surrounding whitespace, like the
+// newline editors add, is dropped.
+func readSecret(env, file, setting string) (secret, source string, err error) {
+	if secret := strings.TrimSpace(os.Getenv(env)); secret != "" {
+		return secret, "$" + env, nil
+	}
+	if file == "" {
+		return "", "", fmt.Errorf("no secret: set %s or %s", env, setting)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", fmt.Errorf("reading %s: %w", setting, err)
+	}
+	if secret = strings.TrimSpace(string(data)); secret == "" {
+		return "", "", fmt.Errorf("%s %s is empty", setting, file)
+	}
+	return secret, file, nil
+}
+
+// serviceAccessToken returns the token to send in a service mode. The API
+// key is sent as it is; a client credentials token is fetched when there
+// is none, when it's due for renewal, or when the API rejected it. If
+// renewing early fails, the current token is used while it lasts.
+func (m *Manager) serviceAccessToken(ctx context.Context, rejected string) (string, error) {
+	if m.Mode() == appconfig.AuthModeAPIKey {
+		key, source, err := m.serviceSecret()
+		if err != nil {
+			return "", err
+		}
+		if rejected != "" && key == rejected {
+			return "", fmt.Errorf("the API key from %s was rejected", source)
+		}
+		return key, nil
+	}
+
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	current := m.service
+	valid := current.usable() && current.token != rejected
+	if valid && (current.expiresAt == 0 || !renewalDue(current.issuedAt, current.expiresAt)) {
+		return current.token, nil
+	}
+
+	start := time.Now()
+	resp, err := m.clientCredentials(ctx)
+	if err != nil {
+		if valid {
+			slog.Warn("renewing service token early failed, using the current one", logging.KeyError, err)
+			return current.token, nil
+		}
+		return "", err
+	}
+	slog.Info("fetched service token", "client_id", m.config.ServiceClientID,
+		"expires_in", resp.ExpiresIn, logging.KeyDuration, time.Since(start))
+
+	now := time.Now().Unix()
+	m.service = serviceToken{token: resp.AccessToken, issuedAt: now}
+	if resp.ExpiresIn > 0 {
+		m.service.expiresAt = now + int64(resp.ExpiresIn)
+	}
+	return m.service.token, nil
+}
+
+// clientCredentials runs the OAuth client credentials grant (RFC 6749
+// section 4.4), authenticating the client with HTTP Basic auth, which
+// every provider has to support.
+func (m *Manager) clientCredentials(ctx context.Context) (*TokenResponse, error) {
+	secret, _, err := m.serviceSecret()
+	if err != nil {
+		return nil, err
+	}
+	if m.config.ServiceClientID == "" {
+		return nil, fmt.Errorf("auth_mode is %s but service_client_id isn't set", m.Mode())
+	}
+	if err := m.config.Resolve(ctx, m.client); err != nil {
+		return nil, fmt.Errorf("discovering OIDC endpoints: %w", err)
+	}
+	if m.config.TokenURL == "" {
+		return nil, fmt.Errorf("no token endpoint configured")
+	}
+
+	data := url.Values{"grant_type": {"client_credentials"}}
+	if len(m.config.ServiceScopes) > 0 {
+		data.Set("scope", strings.Join(m.config.ServiceScopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// RFC 6749 section 2.3.1 form-encodes the credentials first
+	req.SetBasicAuth(url.QueryEscape(m.config.ServiceClientID), url.QueryEscape(secret))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting service token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client credentials grant failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result TokenResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+	return &result, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "github.com/martinjt/claude-history-cli/internal/config"
+)
+
+// tokenEndpoint serves client credentials grants for client "ci" with
+// secret "s3cret", issuing tokens numbered from 1.
+func tokenEndpoint(t *testing.T, expiresIn int) (*httptest.Server, *int) {
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" {
+			t.Errorf("grant_type = %q", r.Form.Get("grant_type"))
+		}
+		if r.Form.Get("scope") != "history/write history/read" {
+			t.Errorf("scope = %q", r.Form.Get("scope"))
+		}
+		if id, secret, _ := r.BasicAuth(); id != "ci" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		issued++
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: fmt.Sprintf("service-%d", issued), ExpiresIn: expiresIn})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func clientCredentialsManager(tokenURL string) *Manager {
+	return NewManager(&Config{
+		AuthMode:        appconfig.AuthModeClientCredentials,
+		ServiceClientID: "ci",
+		ServiceScopes:   []string{"history/write", "history/read"},
+		TokenURL:        tokenURL,
+	})
+}
+
+func TestClientCredentials(t *testing.T) {
+	t.Setenv(ClientSecretEnv, "s3cret")
+	server, issued := tokenEndpoint(t, 3600)
+	manager := clientCredentialsManager(server.URL)
+	ctx := context.Background()
+
+	token, err := manager.GetValidToken(ctx)
+	if err != nil || token != "service-1" {
+		t.Fatalf("GetValidToken = %q, %v", token, err)
+	}
+	if token, _ := manager.GetValidToken(ctx); token != "service-1" || *issued != 1 {
+		t.Errorf("expected the token to be reused, got %q after %d grants", token, *issued)
+	}
+
+	if token, err := manager.ForceRefresh(ctx, "service-1"); err != nil || token != "service-2" {
+		t.Errorf("ForceRefresh = %q, %v", token, err)
+	}
+	if token, _ := manager.ForceRefresh(ctx, "service-1"); token != "service-2" || *issued != 2 {
+		t.Errorf("expected an already replaced token to be reused, got %q after %d grants", token, *issued)
+	}
+
+	if source, err := manager.CredentialSource(); err != nil || source != "$"+ClientSecretEnv {
+		t.Errorf("CredentialSource = %q, %v", source, err)
+	}
+	if name := manager.TokenStoreName(); name != "unavailable" {
+		t.Errorf("expected no token store to be opened, got %s", name)
+	}
+}
+
+func TestClientCredentials_RenewsBeforeExpiry(t *testing.T) {
+	t.Setenv(ClientSecretEnv, "s3cret")
+	server, issued := tokenEndpoint(t, 1200)
+	manager := clientCredentialsManager(server.URL)
+
+	manager.GetValidToken(context.Background())
+	// Still usable, but within renewBefore of expiry
+	manager.service.issuedAt -= 1000
+	manager.service.expiresAt -= 1000
+
+	if token, _ := manager.GetValidToken(context.Background()); token != "service-2" || *issued != 2 {
+		t.Errorf("expected the token to be renewed, got %q after %d grants", token, *issued)
+	}
+}
+
+func TestClientCredentials_SecretFile(t *testing.T) {
+	t.Setenv(ClientSecretEnv, "")
+	server, _ := tokenEndpoint(t, 3600)
+	manager := clientCredentialsManager(server.URL)
+
+	file := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(file, []byte("s3cret\n"), 0600)
+	manager.config.ClientSecretFile = file
+
+	if token, err := manager.GetValidToken(context.Background()); err != nil || token != "service-1" {
+		t.Errorf("GetValidToken = %q, %v", token, err)
+	}
+	if source, _ := manager.CredentialSource(); source != file {
+		t.Errorf("CredentialSource = %q, want %s", source, file)
+	}
+}
+
+func TestClientCredentials_Rejected(t *testing.T) {
+	t.Setenv(ClientSecretEnv, "wrong")
+	server, _ := tokenEndpoint(t, 3600)
+
+	_, err := clientCredentialsManager(server.URL).GetValidToken(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("expected the grant to fail, got %v", err)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Setenv(APIKeyEnv, "")
+	manager := NewManager(&Config{AuthMode: appconfig.AuthModeAPIKey})
+	ctx := context.Background()
+
+	if manager.IsAuthenticated() {
+		t.Error("expected no key to mean not authenticated")
+	}
+	if _, err := manager.GetValidToken(ctx); err == nil || !strings.Contains(err.Error(), APIKeyEnv) {
+		t.Errorf("expected the error to name %s, got %v", APIKeyEnv, err)
+	}
+
+	t.Setenv(APIKeyEnv, "chs_key")
+	if token, err := manager.GetValidToken(ctx); err != nil || token != "chs_key" {
+		t.Errorf("GetValidToken = %q, %v", token, err)
+	}
+	if _, err := manager.ForceRefresh(ctx, "chs_key"); err == nil {
+		t.Error("expected a rejected API key to be an error")
+	}
+}
+
+func TestServiceMode_NoUserOperations(t *testing.T) {
+	t.Setenv(APIKeyEnv, "chs_key")
+	manager := NewManager(&Config{AuthMode: appconfig.AuthModeAPIKey})
+	ctx := context.Background()
+
+	if err := manager.Login(ctx, LoginOptions{}); !errors.Is(err, ErrServiceAuth) {
+		t.Errorf("Login error = %v, want ErrServiceAuth", err)
+	}
+	if err := manager.Logout(ctx); !errors.Is(err, ErrServiceAuth) {
+		t.Errorf("Logout error = %v, want ErrServiceAuth", err)
+	}
+	if _, err := manager.WhoAmI(ctx); !errors.Is(err, ErrServiceAuth) {
+		t.Errorf("WhoAmI error = %v, want ErrServiceAuth", err)
+	}
+}
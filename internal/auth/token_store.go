@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/config"
 )
 
 // TokenStore defines the interface for storing and retrieving tokens
@@ -15,144 +19,207 @@ type TokenStore interface {
 	Clear() error
 }
 
-// NewTokenStore creates a token store with automatic fallback
-// Tries keychain first, falls back to encrypted file storage if unavailable
-func NewTokenStore() TokenStore {
-	// Try keychain store first
-	keychainStore := NewKeychainStore()
-
-	// Test if keychain is available by trying to get a non-existent key
-	// This will fail gracefully if DBus is unavailable
-	_, err := keychainStore.GetAccessToken()
-
-	// If error contains "dbus" or "session bus", keychain is unavailable
-	if err != nil && (strings.Contains(err.Error(), "dbus") ||
-	                  strings.Contains(err.Error(), "session bus") ||
-	                  strings.Contains(err.Error(), "keyring") ||
-	                  strings.Contains(err.Error(), "Secret Service")) {
-		// Fallback to file storage
-		return &FallbackStore{
-			primary:   nil, // keychain unavailable
-			secondary: NewFileStore(),
-			usingFile: true,
-		}
-	}
+var (
+	// ErrNoTokens means the store works but holds no tokens, so the user
+	// needs to log in.
+	ErrNoTokens = errors.New("no tokens stored")
+	// ErrStoreUnavailable means the store itself can't be reached, like a
+	// keychain with no Secret Service running to answer.
+	ErrStoreUnavailable = errors.New("token store unavailable")
+	// ErrNoSecret means the store holds no secret by that name.
+	ErrNoSecret = errors.New("no secret stored")
+)
 
-	// Keychain is available, use it with file backup
-	return &FallbackStore{
-		primary:   keychainStore,
-		secondary: NewFileStore(),
-		usingFile: false,
-	}
+// SecretStore is implemented by token stores that can keep other secrets
+// for the profile alongside its tokens, like the content encryption keys.
+// Logging out clears the tokens but leaves these.
+type SecretStore interface {
+	SaveSecret(name string, data []byte) error
+	// GetSecret returns ErrNoSecret if nothing is stored under name
+	GetSecret(name string) ([]byte, error)
+	DeleteSecret(name string) error
 }
 
-// FallbackStore tries keychain first, falls back to file storage
-type FallbackStore struct {
-	primary   TokenStore // keychain (may be nil if unavailable)
-	secondary TokenStore // file storage
-	usingFile bool       // true if keychain is unavailable
+// cachingStore is implemented by token stores that cache what they read.
+// Invalidate drops the cache, so the store reads tokens another process
+// saved since.
+type cachingStore interface {
+	Invalidate()
 }
 
-func (fs *FallbackStore) SaveTokens(accessToken string, resp *TokenResponse) error {
-	// If keychain is available, try it first
-	if fs.primary != nil {
-		err := fs.primary.SaveTokens(accessToken, resp)
-		if err == nil {
-			// Success! Also save to file as backup
-			_ = fs.secondary.SaveTokens(accessToken, resp)
-			return nil
-		}
+// StoreOptions choose a token store and how it keeps tokens.
+type StoreOptions struct {
+	// Backend is a token_store setting, like keychain; empty means auto
+	Backend string
+	// Namespace keeps each profile's tokens apart; the default profile
+	// uses "", which is where tokens were always stored
+	Namespace string
+	// FileEncryption is the token_file_encryption setting
+	FileEncryption string
+	// Helper is the credential_helper command for the helper store
+	Helper string
+}
 
-		// Keychain failed, check if it's a DBus error
-		if strings.Contains(err.Error(), "dbus") ||
-		   strings.Contains(err.Error(), "session bus") {
-			// Keychain no longer available, switch to file-only mode
-			fs.primary = nil
-			fs.usingFile = true
-		}
+// NewTokenStore opens the token store opts name.
+func NewTokenStore(opts StoreOptions) (TokenStore, error) {
+	switch opts.Backend {
+	case config.TokenStoreAuto, "":
+		return autoTokenStore(opts), nil
+	case config.TokenStoreKeychain:
+		return NewKeychainStore(opts.Namespace), nil
+	case config.TokenStoreFile:
+		return NewFileStore(opts.Namespace, opts.FileEncryption), nil
+	case config.TokenStoreMemory:
+		return NewMemoryStore(), nil
+	case config.TokenStoreHelper:
+		return NewHelperStore(opts.Helper, opts.Namespace)
 	}
-
-	// Use file storage (either fallback or primary if keychain unavailable)
-	return fs.secondary.SaveTokens(accessToken, resp)
+	return nil, fmt.Errorf("unknown token store %q", opts.Backend)
 }
 
-func (fs *FallbackStore) GetAccessToken() (string, error) {
-	// Try primary (keychain) if available
-	if fs.primary != nil {
-		token, err := fs.primary.GetAccessToken()
-		if err == nil {
-			return token, nil
-		}
+// autoTokenStore uses the keychain if it answers and the encrypted file
+// if it doesn't. Only one of them holds the tokens.
+func autoTokenStore(opts StoreOptions) TokenStore {
+	keychain := NewKeychainStore(opts.Namespace)
+	file := NewFileStore(opts.Namespace, opts.FileEncryption)
 
-		// Check for DBus errors
-		if strings.Contains(err.Error(), "dbus") ||
-		   strings.Contains(err.Error(), "session bus") {
-			fs.primary = nil
-			fs.usingFile = true
-		}
+	_, err := keychain.GetAccessToken()
+	if errors.Is(err, ErrStoreUnavailable) {
+		return file
 	}
 
-	// Fallback to secondary (file)
-	return fs.secondary.GetAccessToken()
-}
-
-func (fs *FallbackStore) GetTokenMeta() (*TokenMeta, error) {
-	if fs.primary != nil {
-		meta, err := fs.primary.GetTokenMeta()
-		if err == nil {
-			return meta, nil
-		}
-
-		if strings.Contains(err.Error(), "dbus") ||
-		   strings.Contains(err.Error(), "session bus") {
-			fs.primary = nil
-			fs.usingFile = true
+	// Earlier versions also kept a copy in the file. Move tokens that are
+	// only there into the keychain, and don't leave the copy behind.
+	if _, fileErr := file.GetAccessToken(); fileErr == nil {
+		if errors.Is(err, ErrNoTokens) {
+			if err := CopyTokens(file, keychain); err != nil {
+				return file
+			}
 		}
+		_ = file.Clear()
 	}
-
-	return fs.secondary.GetTokenMeta()
+	return keychain
 }
 
-func (fs *FallbackStore) IsTokenExpired() bool {
-	if fs.primary != nil && !fs.primary.IsTokenExpired() {
-		return false
+// StoreName names the backend a store keeps tokens in, as token_store
+// would.
+func StoreName(store TokenStore) string {
+	switch store.(type) {
+	case *KeychainStore:
+		return config.TokenStoreKeychain
+	case *FileStore:
+		return config.TokenStoreFile
+	case *MemoryStore:
+		return config.TokenStoreMemory
+	case *HelperStore:
+		return config.TokenStoreHelper
+	case unavailableStore:
+		return "unavailable"
 	}
-	return fs.secondary.IsTokenExpired()
+	return fmt.Sprintf("%T", store)
 }
 
-func (fs *FallbackStore) GetRefreshToken() (string, error) {
-	if fs.primary != nil {
-		token, err := fs.primary.GetRefreshToken()
-		if err == nil {
-			return token, nil
-		}
+// CopyTokens saves the tokens held by one store in another. The access
+// token keeps its expiry, and an already expired one stays expired so the
+// next use refreshes it.
+func CopyTokens(from, to TokenStore) error {
+	accessToken, err := from.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	meta, err := from.GetTokenMeta()
+	if err != nil {
+		return err
+	}
 
-		if strings.Contains(err.Error(), "dbus") ||
-		   strings.Contains(err.Error(), "session bus") {
-			fs.primary = nil
-			fs.usingFile = true
-		}
+	resp := &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: meta.RefreshToken,
+		IDToken:      meta.IDToken,
+		ExpiresIn:    int(meta.ExpiresAt - time.Now().Unix()),
+	}
+	if err := to.SaveTokens(accessToken, resp); err != nil {
+		return err
 	}
+	return nil
+}
 
-	return fs.secondary.GetRefreshToken()
+// unavailableStore stands in for a store that couldn't be opened, so the
+// reason surfaces the first time tokens are needed.
+type unavailableStore struct {
+	err error
 }
 
-func (fs *FallbackStore) Clear() error {
-	var errs []error
+func (s unavailableStore) SaveTokens(string, *TokenResponse) error { return s.err }
+func (s unavailableStore) GetAccessToken() (string, error)         { return "", s.err }
+func (s unavailableStore) GetTokenMeta() (*TokenMeta, error)       { return nil, s.err }
+func (s unavailableStore) IsTokenExpired() bool                    { return true }
+func (s unavailableStore) GetRefreshToken() (string, error)        { return "", s.err }
+func (s unavailableStore) Clear() error                            { return s.err }
+
+// MoveTokens copies the tokens from one store to another, checks they
+// arrived, then removes them from the first store. It reports false if the
+// first store held none.
+func MoveTokens(from, to TokenStore) (bool, error) {
+	accessToken, err := from.GetAccessToken()
+	if errors.Is(err, ErrNoTokens) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-	if fs.primary != nil {
-		if err := fs.primary.Clear(); err != nil {
-			errs = append(errs, fmt.Errorf("clearing keychain: %w", err))
-		}
+	if err := CopyTokens(from, to); err != nil {
+		return false, err
+	}
+	if stored, err := to.GetAccessToken(); err != nil {
+		return false, fmt.Errorf("reading tokens back from the new store: %w", err)
+	} else if stored != accessToken {
+		return false, fmt.Errorf("the new store returned different tokens than were saved")
 	}
 
-	if err := fs.secondary.Clear(); err != nil {
-		errs = append(errs, fmt.Errorf("clearing file store: %w", err))
+	if err := from.Clear(); err != nil {
+		return true, fmt.Errorf("removing tokens from the old store: %w", err)
 	}
+	return true, nil
+}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("errors clearing tokens: %v", errs)
+// MoveSecrets moves the named secrets from one store to another like
+// MoveTokens does the tokens, and reports how many it moved. A store that
+// can't keep secrets has none to move, but can't take any either.
+func MoveSecrets(from, to TokenStore, names []string) (int, error) {
+	src, ok := from.(SecretStore)
+	if !ok {
+		return 0, nil
 	}
 
-	return nil
+	moved := 0
+	for _, name := range names {
+		data, err := src.GetSecret(name)
+		if errors.Is(err, ErrNoSecret) {
+			continue
+		}
+		if err != nil {
+			return moved, fmt.Errorf("reading secret %s: %w", name, err)
+		}
+
+		dst, ok := to.(SecretStore)
+		if !ok {
+			return moved, fmt.Errorf("the %s token store can't keep secret %s", StoreName(to), name)
+		}
+		if err := dst.SaveSecret(name, data); err != nil {
+			return moved, fmt.Errorf("saving secret %s: %w", name, err)
+		}
+		if stored, err := dst.GetSecret(name); err != nil {
+			return moved, fmt.Errorf("reading secret %s back from the new store: %w", name, err)
+		} else if !bytes.Equal(stored, data) {
+			return moved, fmt.Errorf("the new store returned a different secret %s than was saved", name)
+		}
+
+		moved++
+		if err := src.DeleteSecret(name); err != nil {
+			return moved, fmt.Errorf("removing secret %s from the old store: %w", name, err)
+		}
+	}
+	return moved, nil
 }
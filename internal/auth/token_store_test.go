@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestNewTokenStore(t *testing.T) {
+	for backend, want := range map[string]string{
+		"keychain": "keychain",
+		"file":     "file",
+		"memory":   "memory",
+	} {
+		store, err := NewTokenStore(StoreOptions{Backend: backend, Namespace: "work"})
+		if err != nil {
+			t.Fatalf("NewTokenStore(%q): %v", backend, err)
+		}
+		if got := StoreName(store); got != want {
+			t.Errorf("NewTokenStore(%q) is a %s store", backend, got)
+		}
+	}
+
+	if _, err := NewTokenStore(StoreOptions{Backend: "vault"}); err == nil {
+		t.Error("expected an unknown store to be rejected")
+	}
+	if _, err := openTokenStore(&Config{TokenStore: "vault"}).GetAccessToken(); !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("expected a bad setting to fail on use, got %v", err)
+	}
+}
+
+func TestFileStore_NoTokens(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewFileStore("", "")
+
+	if _, err := store.GetAccessToken(); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("expected ErrNoTokens from an empty file store, got %v", err)
+	}
+	if err := store.SaveTokens("access", &TokenResponse{RefreshToken: "refresh", ExpiresIn: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.GetAccessToken(); err != nil || token != "access" {
+		t.Errorf("GetAccessToken = %q, %v", token, err)
+	}
+}
+
+func TestKeychainError(t *testing.T) {
+	if err := keychainError("getting", keyring.ErrNotFound); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("missing entry: %v", err)
+	}
+	noBus := fmt.Errorf("failed to open dbus connection: no session bus")
+	if err := keychainError("getting", noBus); !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("no session bus: %v", err)
+	}
+	if err := keychainError("saving", keyring.ErrSetDataTooBig); errors.Is(err, ErrStoreUnavailable) || errors.Is(err, ErrNoTokens) {
+		t.Errorf("data too big: %v", err)
+	}
+}
+
+func TestMoveSecrets(t *testing.T) {
+	from, to := NewMemoryStore(), testHelperStore(t, "work")
+	from.SaveSecret("content-keys", []byte(`{"version":1}`))
+
+	moved, err := MoveSecrets(from, to, []string{"content-keys", "absent"})
+	if moved != 1 || err != nil {
+		t.Fatalf("MoveSecrets = %d, %v", moved, err)
+	}
+	if _, err := from.GetSecret("content-keys"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("expected the old store to be emptied, got %v", err)
+	}
+	if data, err := to.GetSecret("content-keys"); err != nil || string(data) != `{"version":1}` {
+		t.Errorf("secret in the new store = %q, %v", data, err)
+	}
+
+	// Stores without secrets have nothing to give, and nowhere to put them
+	if moved, err := MoveSecrets(unavailableStore{err: ErrStoreUnavailable}, to, []string{"content-keys"}); moved != 0 || err != nil {
+		t.Errorf("moving from a store without secrets = %d, %v", moved, err)
+	}
+	if _, err := MoveSecrets(to, unavailableStore{err: ErrStoreUnavailable}, []string{"content-keys"}); err == nil {
+		t.Error("expected moving into a store without secrets to fail")
+	}
+}
+
+func TestMoveTokens(t *testing.T) {
+	from, to := NewMemoryStore(), NewMemoryStore()
+
+	if moved, err := MoveTokens(from, to); moved || err != nil {
+		t.Fatalf("moving from an empty store: %v, %v", moved, err)
+	}
+
+	from.SaveTokens("access", &TokenResponse{RefreshToken: "refresh", IDToken: "id", ExpiresIn: 3600})
+	moved, err := MoveTokens(from, to)
+	if !moved || err != nil {
+		t.Fatalf("MoveTokens: %v, %v", moved, err)
+	}
+
+	if _, err := from.GetAccessToken(); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("expected the old store to be emptied, got %v", err)
+	}
+	meta, err := to.GetTokenMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.RefreshToken != "refresh" || meta.IDToken != "id" {
+		t.Errorf("unexpected tokens in the new store: %+v", meta)
+	}
+	if remaining := time.Until(time.Unix(meta.ExpiresAt, 0)); remaining < 59*time.Minute {
+		t.Errorf("expected the expiry to carry over, %s left", remaining)
+	}
+}
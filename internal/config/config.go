@@ -5,21 +5,117 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/martinjt/claude-history-cli/internal/redact"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	APIEndpoint     string   `yaml:"api_endpoint"`
-	MachineID       string   `yaml:"machine_id"`
-	ClaudeDataDir   string   `yaml:"claude_data_dir"`
-	ExcludePatterns []string `yaml:"exclude_patterns"`
-	SyncInterval    int      `yaml:"sync_interval_minutes"`
-	CognitoRegion   string   `yaml:"cognito_region"`
-	CognitoPoolID   string   `yaml:"cognito_pool_id"`
-	CognitoClientID string   `yaml:"cognito_client_id"`
-	CognitoDomain   string   `yaml:"cognito_domain"`
+	APIEndpoint       string   `yaml:"api_endpoint"`
+	MachineID         string   `yaml:"machine_id"`
+	ClaudeDataDir     string   `yaml:"claude_data_dir"`
+	ClaudeDataDirs    []string `yaml:"claude_data_dirs"`
+	ExcludePatterns   []string `yaml:"exclude_patterns"`
+	SyncInterval      int      `yaml:"sync_interval_minutes"`
+	ResolveGitInfo    bool     `yaml:"resolve_git_info"`
+	DeletionPolicy    string   `yaml:"deletion_policy"`
+	CleanupPeriodDays int      `yaml:"cleanup_period_days"`
+	SearchIndex       bool     `yaml:"search_index"`
+	CognitoRegion     string   `yaml:"cognito_region"`
+	CognitoPoolID     string   `yaml:"cognito_pool_id"`
+	CognitoClientID   string   `yaml:"cognito_client_id"`
+	CognitoDomain     string   `yaml:"cognito_domain"`
+
+	// Any OpenID Connect provider can be used instead of Cognito: set the
+	// issuer and the endpoints are discovered from it
+	OIDCIssuer   string `yaml:"oidc_issuer"`
+	OIDCClientID string `yaml:"oidc_client_id"`
+
+	// RedirectPorts are the loopback ports registered with the provider
+	// for the login callback. Empty means any free port.
+	RedirectPorts []int `yaml:"redirect_ports"`
+
+	// TokenStore is where login tokens are kept, one of the TokenStore
+	// constants
+	TokenStore string `yaml:"token_store"`
+	// TokenFileEncryption is how the file token store's key is made, one
+	// of the TokenFileEncryption constants
+	TokenFileEncryption string `yaml:"token_file_encryption"`
+	// CredentialHelper is the command the helper token store runs
+	CredentialHelper string `yaml:"credential_helper"`
+
+	// AuthMode is how requests are authenticated, one of the AuthMode
+	// constants. The service modes need no login, for CI and shared
+	// machines: ServiceClientID and ServiceScopes are the client for the
+	// client_credentials grant, with its secret in ClientSecretFile unless
+	// the environment has it, and APIKeyFile holds the key for api_key.
+	AuthMode         string   `yaml:"auth_mode"`
+	ServiceClientID  string   `yaml:"service_client_id"`
+	ServiceScopes    []string `yaml:"service_scopes"`
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	APIKeyFile       string   `yaml:"api_key_file"`
+
+	// EncryptContent seals message content and project paths with the
+	// profile's content key before upload, so the server can't read them
+	EncryptContent bool `yaml:"encrypt_content"`
+
+	// Named profiles for syncing to more than one account, and the routes
+	// that pick a profile for each session
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+	Routes         []Route            `yaml:"routes"`
+
+	// Settings a per-project file may also change, see ProjectKeys
+	SyncEnabled bool          `yaml:"sync_enabled"`
+	Redact      []redact.Rule `yaml:"redact"`
+
+	layers  []layer
+	sources map[string]Source
 }
 
+// Deletion policies control what happens on the server when a session file
+// is deleted locally. Sessions that aged out of Claude Code's retention
+// window (CleanupPeriodDays) are always kept remotely.
+const (
+	DeletionPolicyKeep      = "keep"
+	DeletionPolicyPropagate = "propagate"
+)
+
+// Token stores hold the tokens from logging in. Auto uses the system
+// keychain when one is reachable and the encrypted file otherwise; memory
+// keeps them for the life of the process only; helper hands them to the
+// credential_helper command, like one for a password manager.
+const (
+	TokenStoreAuto     = "auto"
+	TokenStoreKeychain = "keychain"
+	TokenStoreFile     = "file"
+	TokenStoreMemory   = "memory"
+	TokenStoreHelper   = "helper"
+)
+
+// TokenStores lists the valid token_store values.
+var TokenStores = []string{TokenStoreAuto, TokenStoreKeychain, TokenStoreFile, TokenStoreMemory, TokenStoreHelper}
+
+// Auth modes: user logs a person in through the browser or a device code
+// and keeps their tokens in the token store. The service modes, for CI and
+// shared machines, skip the token store: client_credentials fetches tokens
+// for a service client with its secret, and api_key sends a static key.
+const (
+	AuthModeUser              = "user"
+	AuthModeClientCredentials = "client_credentials"
+	AuthModeAPIKey            = "api_key"
+)
+
+// AuthModes lists the valid auth_mode values.
+var AuthModes = []string{AuthModeUser, AuthModeClientCredentials, AuthModeAPIKey}
+
+// The file token store encrypts with a random key kept in a key file
+// beside it, or with a key stretched from a passphrase, which protects the
+// tokens from someone who copies the whole directory too.
+const (
+	TokenFileEncryptionKeyfile    = "keyfile"
+	TokenFileEncryptionPassphrase = "passphrase"
+)
+
 func DefaultConfigDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -40,35 +136,77 @@ func DefaultClaudeDataDir() string {
 	return filepath.Join(home, ".claude", "projects")
 }
 
+// DataDirs returns every directory that should be scanned for conversations:
+// claude_data_dir, any extra claude_data_dirs, and the projects directory
+// under each CLAUDE_CONFIG_DIR entry. Duplicates are removed, keeping the
+// first occurrence.
+func (c *Config) DataDirs() []string {
+	candidates := []string{c.ClaudeDataDir}
+	candidates = append(candidates, c.ClaudeDataDirs...)
+
+	if env := os.Getenv("CLAUDE_CONFIG_DIR"); env != "" {
+		for _, dir := range filepath.SplitList(env) {
+			if dir != "" {
+				candidates = append(candidates, filepath.Join(dir, "projects"))
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, dir := range candidates {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// Load reads the system and user config files and applies
+// CLAUDE_HISTORY_SYNC_* environment variables on top.
 func Load() (*Config, error) {
-	return LoadFrom(DefaultConfigPath())
+	return LoadWith(DefaultLoadOptions())
 }
 
+// LoadFrom reads a single config file on top of the defaults. Unknown
+// keys are ignored; Check reports them.
 func LoadFrom(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	l, err := fileLayer(path, LayerUser)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return DefaultConfig(), nil
-		}
-		return nil, fmt.Errorf("reading config file: %w", err)
+		return nil, err
 	}
-
-	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("parsing config file: %w", err)
+	var layers []layer
+	if l != nil {
+		layers = append(layers, *l)
 	}
-
-	return cfg, nil
+	return build(layers)
 }
 
 func DefaultConfig() *Config {
 	hostname, _ := os.Hostname()
 	return &Config{
-		APIEndpoint:     "https://claude-history-mcp.devrel.hny.wtf",
-		MachineID:       hostname,
-		ClaudeDataDir:   DefaultClaudeDataDir(),
-		ExcludePatterns: []string{},
-		SyncInterval:    5,
+		APIEndpoint:         "https://claude-history-mcp.devrel.hny.wtf",
+		MachineID:           hostname,
+		ClaudeDataDir:       DefaultClaudeDataDir(),
+		ExcludePatterns:     []string{},
+		SyncInterval:        5,
+		DeletionPolicy:      DeletionPolicyKeep,
+		CleanupPeriodDays:   30,
+		SearchIndex:         true,
+		SyncEnabled:         true,
+		Redact:              []redact.Rule{},
+		Profiles:            map[string]Profile{},
+		Routes:              []Route{},
+		RedirectPorts:       []int{3000},
+		TokenStore:          TokenStoreAuto,
+		TokenFileEncryption: TokenFileEncryptionKeyfile,
+		AuthMode:            AuthModeUser,
 		// Production Cognito configuration - hardcoded for SaaS
 		CognitoRegion:   "eu-west-1",
 		CognitoPoolID:   "eu-west-1_CmpHruSh7",
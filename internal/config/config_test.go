@@ -86,3 +86,28 @@ func TestSaveTo_CreatesDirectory(t *testing.T) {
 		t.Fatalf("config file not created: %v", err)
 	}
 }
+
+func TestDataDirs(t *testing.T) {
+	t.Setenv("CLAUDE_CONFIG_DIR", "/work/claude"+string(os.PathListSeparator)+"/home/me/.claude")
+
+	cfg := &Config{
+		ClaudeDataDir:  "/home/me/.claude/projects",
+		ClaudeDataDirs: []string{"/mnt/devcontainer/.claude/projects", "/home/me/.claude/projects/"},
+	}
+
+	dirs := cfg.DataDirs()
+	expected := []string{
+		"/home/me/.claude/projects",
+		"/mnt/devcontainer/.claude/projects",
+		"/work/claude/projects",
+	}
+
+	if len(dirs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, dirs)
+	}
+	for i := range expected {
+		if dirs[i] != expected[i] {
+			t.Errorf("dirs[%d] = %s, want %s", i, dirs[i], expected[i])
+		}
+	}
+}
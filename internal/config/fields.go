@@ -0,0 +1,337 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Field is a single setting, described by its yaml tag on Config.
+type Field struct {
+	Key   string
+	Kind  reflect.Kind // String, Int, Bool or Slice
+	typ   reflect.Type
+	index int
+}
+
+// Fields lists every setting in Config in declaration order.
+func Fields() []Field {
+	t := reflect.TypeOf(Config{})
+	fields := make([]Field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, Field{Key: key, Kind: t.Field(i).Type.Kind(), typ: t.Field(i).Type, index: i})
+	}
+	return fields
+}
+
+// LookupField finds the setting with the given key.
+func LookupField(key string) (Field, error) {
+	var keys []string
+	for _, f := range Fields() {
+		if f.Key == key {
+			return f, nil
+		}
+		keys = append(keys, f.Key)
+	}
+	if suggestion := closestKey(key, keys); suggestion != "" {
+		return Field{}, fmt.Errorf("unknown config key %q (did you mean %q?)", key, suggestion)
+	}
+	return Field{}, fmt.Errorf("unknown config key %q", key)
+}
+
+// Get returns the value of a setting.
+func (c *Config) Get(key string) (interface{}, error) {
+	f, err := LookupField(key)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(c).Elem().Field(f.index).Interface(), nil
+}
+
+// Set changes a setting to a value returned by Field.Parse.
+func (c *Config) Set(key string, value interface{}) error {
+	f, err := LookupField(key)
+	if err != nil {
+		return err
+	}
+	field := reflect.ValueOf(c).Elem().Field(f.index)
+	v := reflect.ValueOf(value)
+	if !v.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("%s: expected %s, got %T", key, field.Type(), value)
+	}
+	field.Set(v)
+	return nil
+}
+
+// FormatValue renders a setting for display; lists are comma-separated.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case []int:
+		parts := make([]string, len(v))
+		for i, n := range v {
+			parts[i] = strconv.Itoa(n)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Parse converts command-line arguments into a value for the setting.
+// Lists take one argument per entry, and no arguments for an empty list.
+// Maps and lists of structured values, like profiles and redact rules, can
+// only be set in a file.
+func (f Field) Parse(args []string) (interface{}, error) {
+	if f.Kind == reflect.Map || f.Kind == reflect.Slice && !f.plainList() {
+		return nil, fmt.Errorf("%s can only be set in a config file", f.Key)
+	}
+	if f.Kind == reflect.Slice && f.typ.Elem().Kind() == reflect.Int {
+		values := []int{}
+		for _, arg := range args {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: entries must be whole numbers, got %q", f.Key, arg)
+			}
+			values = append(values, n)
+		}
+		return values, nil
+	}
+	if f.Kind == reflect.Slice {
+		values := []string{}
+		for _, arg := range args {
+			if arg == "" {
+				return nil, fmt.Errorf("%s: entries can't be empty", f.Key)
+			}
+			values = append(values, arg)
+		}
+		return values, nil
+	}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s takes a single value", f.Key)
+	}
+	switch f.Kind {
+	case reflect.Int:
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number, got %q", f.Key, args[0])
+		}
+		return n, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, got %q", f.Key, args[0])
+		}
+		return b, nil
+	default:
+		return args[0], nil
+	}
+}
+
+// plainList reports whether the setting is a list of strings or numbers,
+// which can be given on the command line.
+func (f Field) plainList() bool {
+	kind := f.typ.Elem().Kind()
+	return kind == reflect.String || kind == reflect.Int
+}
+
+// SetInFile sets one key in the config file, leaving the rest of the file,
+// including comments, as it was. The file is created if needed.
+func SetInFile(path, key string, value interface{}) error {
+	doc, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := setInMapping(doc.Content[0], key, value); err != nil {
+		return err
+	}
+	return writeDocument(path, doc)
+}
+
+// SetProfileInFile sets one of a named profile's own settings in the
+// config file, under profiles.<profile>, like SetInFile does at the top
+// level.
+func SetProfileInFile(path, profile, key string, value interface{}) error {
+	doc, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+
+	mapping := doc.Content[0]
+	for _, name := range []string{"profiles", profile} {
+		i := mappingIndex(mapping, name)
+		if i < 0 {
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name},
+				&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			i = len(mapping.Content) - 2
+		}
+		next := mapping.Content[i+1]
+		if next.Kind == yaml.ScalarNode && next.Tag == "!!null" {
+			next.Kind, next.Tag = yaml.MappingNode, "!!map"
+		}
+		if next.Kind != yaml.MappingNode {
+			return fmt.Errorf("parsing config file: expected %s to be a mapping", name)
+		}
+		mapping = next
+	}
+
+	if err := setInMapping(mapping, key, value); err != nil {
+		return err
+	}
+	return writeDocument(path, doc)
+}
+
+// setInMapping sets key in a YAML mapping, keeping the comments of a value
+// it replaces.
+func setInMapping(mapping *yaml.Node, key string, value interface{}) error {
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return fmt.Errorf("encoding %s: %w", key, err)
+	}
+
+	if i := mappingIndex(mapping, key); i >= 0 {
+		// Keep comments attached to the old value
+		valueNode.HeadComment = mapping.Content[i+1].HeadComment
+		valueNode.LineComment = mapping.Content[i+1].LineComment
+		mapping.Content[i+1] = &valueNode
+	} else {
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			&valueNode)
+	}
+	return nil
+}
+
+// UnsetInFile removes a key from the config file so the default applies
+// again. It reports whether the key was there.
+func UnsetInFile(path, key string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return false, err
+	}
+
+	root := doc.Content[0]
+	i := mappingIndex(root, key)
+	if i < 0 {
+		return false, nil
+	}
+	root.Content = append(root.Content[:i], root.Content[i+2:]...)
+
+	return true, writeDocument(path, doc)
+}
+
+// readDocument parses a config file into a YAML document whose root is a
+// mapping. A missing or empty file gives an empty mapping.
+func readDocument(path string) (*yaml.Node, error) {
+	empty := &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return empty, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return empty, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parsing config file: expected a mapping of settings at the top level")
+	}
+	return &doc, nil
+}
+
+func writeDocument(path string, doc *yaml.Node) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+	data := buf.Bytes()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	return nil
+}
+
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// closestKey suggests the key a typo was probably meant to be.
+func closestKey(key string, keys []string) string {
+	best, bestDist := "", 4
+	sort.Strings(keys)
+	for _, k := range keys {
+		// A truncated key, like "sync_interval", is a good guess too
+		if strings.HasPrefix(k, key) && len(key) >= 4 {
+			return k
+		}
+		if d := editDistance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	f, err := LookupField("sync_interval_minutes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Kind != reflect.Int {
+		t.Errorf("expected int kind, got %s", f.Kind)
+	}
+	for _, f := range Fields() {
+		if f.Key == "" || f.Key == "layers" || f.Key == "sources" {
+			t.Errorf("unexpected field %+v", f)
+		}
+	}
+	if _, err := LookupField("redact"); err != nil {
+		t.Error("expected redact to be a setting")
+	}
+
+	_, err = LookupField("sync_interval")
+	if err == nil || !strings.Contains(err.Error(), `did you mean "sync_interval_minutes"`) {
+		t.Errorf("expected suggestion for truncated key, got %v", err)
+	}
+	_, err = LookupField("deletion_polcy")
+	if err == nil || !strings.Contains(err.Error(), `did you mean "deletion_policy"`) {
+		t.Errorf("expected suggestion for typo, got %v", err)
+	}
+}
+
+func TestFieldParse(t *testing.T) {
+	tests := []struct {
+		key     string
+		args    []string
+		want    interface{}
+		wantErr bool
+	}{
+		{"sync_interval_minutes", []string{"15"}, 15, false},
+		{"sync_interval_minutes", []string{"soon"}, nil, true},
+		{"search_index", []string{"false"}, false, false},
+		{"search_index", []string{"maybe"}, nil, true},
+		{"machine_id", []string{"laptop"}, "laptop", false},
+		{"machine_id", []string{"a", "b"}, nil, true},
+		{"exclude_patterns", []string{"*tmp*", "scratch"}, []string{"*tmp*", "scratch"}, false},
+		{"exclude_patterns", nil, []string{}, false},
+		{"exclude_patterns", []string{""}, nil, true},
+		{"redirect_ports", []string{"8400", "8401"}, []int{8400, 8401}, false},
+		{"redirect_ports", nil, []int{}, false},
+		{"redirect_ports", []string{"http"}, nil, true},
+		{"redact", []string{"sk-.*"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		f, err := LookupField(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Parse(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s %v: unexpected error %v", tt.key, tt.args, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %v = %#v, want %#v", tt.key, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.Set("sync_interval_minutes", 20); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SyncInterval != 20 {
+		t.Errorf("expected 20, got %d", cfg.SyncInterval)
+	}
+	if v, _ := cfg.Get("sync_interval_minutes"); v != 20 {
+		t.Errorf("expected Get to return 20, got %v", v)
+	}
+	if err := cfg.Set("sync_interval_minutes", "20"); err == nil {
+		t.Error("expected error for wrong value type")
+	}
+}
+
+func TestSetInFile_KeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := "# Where to sync\napi_endpoint: https://example.com # staging\nexclude_patterns:\n  - '*tmp*'\n"
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetInFile(path, "api_endpoint", "https://prod.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetInFile(path, "sync_interval_minutes", 15); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, want := range []string{"# Where to sync", "api_endpoint: https://prod.example.com # staging", "- '*tmp*'", "sync_interval_minutes: 15"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIEndpoint != "https://prod.example.com" || cfg.SyncInterval != 15 {
+		t.Errorf("unexpected config after set: %+v", cfg)
+	}
+
+	removed, err := UnsetInFile(path, "sync_interval_minutes")
+	if err != nil || !removed {
+		t.Fatalf("expected key removed, got %v, %v", removed, err)
+	}
+	if cfg, _ := LoadFrom(path); cfg.SyncInterval != 5 {
+		t.Errorf("expected default interval after unset, got %d", cfg.SyncInterval)
+	}
+	if removed, _ := UnsetInFile(path, "sync_interval_minutes"); removed {
+		t.Error("expected second unset to be a no-op")
+	}
+}
+
+func TestSetInFile_NewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "config.yaml")
+	if err := SetInFile(path, "machine_id", "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected 0600, got %v", info.Mode().Perm())
+	}
+	if removed, err := UnsetInFile(filepath.Join(t.TempDir(), "missing.yaml"), "machine_id"); err != nil || removed {
+		t.Errorf("expected no-op for missing file, got %v, %v", removed, err)
+	}
+}
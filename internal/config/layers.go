@@ -0,0 +1,356 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Layers a setting can come from, lowest precedence first.
+const (
+	LayerDefault = "default"
+	LayerSystem  = "system"
+	LayerUser    = "user"
+	LayerProject = "project"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+const (
+	// SystemConfigPath is the machine-wide config file, read before the
+	// user's own.
+	SystemConfigPath = "/etc/claude-history-sync/config.yaml"
+
+	// ProjectConfigName is the per-project file, found by walking up from
+	// a session's working directory.
+	ProjectConfigName = ".claude-history-sync.yaml"
+
+	// EnvPrefix starts the environment variable for each setting, e.g.
+	// CLAUDE_HISTORY_SYNC_API_ENDPOINT.
+	EnvPrefix = "CLAUDE_HISTORY_SYNC_"
+)
+
+// ProjectKeys are the settings a project file may change. Project files
+// come with the repository, so they can only make syncing more private:
+// opt out, or redact more. Anything else, like the endpoint, would let a
+// cloned repository redirect where conversations go.
+var ProjectKeys = []string{"sync_enabled", "redact"}
+
+// Source records where a setting's value came from.
+type Source struct {
+	Layer string
+	Path  string // config file, for file layers
+	Name  string // variable or flag, for LayerEnv and LayerFlag
+}
+
+func (s Source) String() string {
+	switch {
+	case s.Path != "":
+		return s.Layer + " " + s.Path
+	case s.Name != "":
+		return s.Layer + " " + s.Name
+	default:
+		return s.Layer
+	}
+}
+
+// Setting is a value one layer gave a setting.
+type Setting struct {
+	Source Source
+	Value  interface{}
+}
+
+type layer struct {
+	source Source
+	values map[string]Setting
+}
+
+// LoadOptions say where each layer comes from.
+type LoadOptions struct {
+	SystemPath string
+	UserPath   string
+	Environ    []string // KEY=value pairs, as from os.Environ
+	Flags      []string // key=value pairs from the command line
+}
+
+// DefaultLoadOptions reads the standard files and the process environment.
+func DefaultLoadOptions() LoadOptions {
+	return LoadOptions{
+		SystemPath: SystemConfigPath,
+		UserPath:   DefaultConfigPath(),
+		Environ:    os.Environ(),
+	}
+}
+
+// LoadWith builds the config from defaults, the system file, the user
+// file, the environment and flags, each overriding the one before. Lists
+// are replaced as a whole, except redact rules, which add up so a later
+// layer can't drop an earlier one's redactions. Profiles are merged by
+// name, so the system file can define a company profile and the user file
+// a personal one. Project files apply per session, through ForDir.
+func LoadWith(opts LoadOptions) (*Config, error) {
+	var layers []layer
+	for _, f := range []struct{ path, layer string }{
+		{opts.SystemPath, LayerSystem},
+		{opts.UserPath, LayerUser},
+	} {
+		if f.path == "" {
+			continue
+		}
+		l, err := fileLayer(f.path, f.layer)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			layers = append(layers, *l)
+		}
+	}
+
+	env, err := envLayer(opts.Environ)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := flagLayer(opts.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return build(append(layers, env, flags))
+}
+
+// ForDir returns the config for sessions run in dir: the nearest project
+// file in dir or above it is layered in below the environment and flags.
+// Without a project file the config is returned as is.
+func (c *Config) ForDir(dir string) (*Config, error) {
+	path := FindProjectConfig(dir)
+	if path == "" {
+		return c, nil
+	}
+
+	project, err := fileLayer(path, LayerProject)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []layer
+	inserted := false
+	for _, l := range c.layers {
+		if !inserted && (l.source.Layer == LayerEnv || l.source.Layer == LayerFlag) {
+			layers = append(layers, *project)
+			inserted = true
+		}
+		layers = append(layers, l)
+	}
+	if !inserted {
+		layers = append(layers, *project)
+	}
+	return build(layers)
+}
+
+// FindProjectConfig walks up from dir looking for a project file. It
+// returns "" if there is none.
+func FindProjectConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	for {
+		path := filepath.Join(dir, ProjectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Source reports which layer the setting's value came from.
+func (c *Config) Source(key string) Source {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return Source{Layer: LayerDefault}
+}
+
+// Explain lists every value given to a setting, lowest precedence first,
+// starting with the default.
+func (c *Config) Explain(key string) ([]Setting, error) {
+	def, err := DefaultConfig().Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := []Setting{{Source: Source{Layer: LayerDefault}, Value: def}}
+	for _, l := range c.layers {
+		if s, ok := l.values[key]; ok {
+			settings = append(settings, s)
+		}
+	}
+	return settings, nil
+}
+
+// Layers lists the sources that contributed to the config.
+func (c *Config) Layers() []Source {
+	var sources []Source
+	for _, l := range c.layers {
+		sources = append(sources, l.source)
+	}
+	return sources
+}
+
+func build(layers []layer) (*Config, error) {
+	cfg := DefaultConfig()
+	cfg.layers = layers
+	cfg.sources = make(map[string]Source)
+
+	for _, l := range layers {
+		for _, f := range Fields() {
+			s, ok := l.values[f.Key]
+			if !ok {
+				continue
+			}
+			value := s.Value
+			current, _ := cfg.Get(f.Key)
+			switch {
+			case f.appends():
+				value = reflect.AppendSlice(reflect.ValueOf(current), reflect.ValueOf(value)).Interface()
+			case f.Kind == reflect.Map:
+				merged := reflect.MakeMap(f.typ)
+				for _, m := range []reflect.Value{reflect.ValueOf(current), reflect.ValueOf(value)} {
+					iter := m.MapRange()
+					for iter.Next() {
+						merged.SetMapIndex(iter.Key(), iter.Value())
+					}
+				}
+				value = merged.Interface()
+			}
+			if err := cfg.Set(f.Key, value); err != nil {
+				return nil, err
+			}
+			cfg.sources[f.Key] = s.Source
+		}
+	}
+	return cfg, nil
+}
+
+// fileLayer reads a config file into a layer, or returns nil if the file
+// doesn't exist. Keys that aren't settings, or that the layer may not set,
+// are skipped; Check reports them.
+func fileLayer(path, layerName string) (*layer, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	source := Source{Layer: layerName, Path: path}
+	l := &layer{source: source, values: make(map[string]Setting)}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		f, err := LookupField(key)
+		if err != nil || !allowedIn(layerName, key) {
+			continue
+		}
+		value, err := f.decode(root.Content[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %s: %w", path, root.Content[i+1].Line, key, err)
+		}
+		l.values[key] = Setting{Source: source, Value: value}
+	}
+	return l, nil
+}
+
+// envLayer reads CLAUDE_HISTORY_SYNC_* variables. Lists are
+// comma-separated. Variables that don't name a setting are ignored, since
+// the prefix isn't ours alone.
+func envLayer(environ []string) (layer, error) {
+	l := layer{source: Source{Layer: LayerEnv}, values: make(map[string]Setting)}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		f, err := LookupField(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)))
+		if err != nil {
+			continue
+		}
+		v, err := f.Parse(splitValue(f, value))
+		if err != nil {
+			return layer{}, fmt.Errorf("%s: %w", name, err)
+		}
+		l.values[f.Key] = Setting{Source: Source{Layer: LayerEnv, Name: name}, Value: v}
+	}
+	return l, nil
+}
+
+// flagLayer reads key=value overrides given on the command line.
+func flagLayer(flags []string) (layer, error) {
+	l := layer{source: Source{Layer: LayerFlag}, values: make(map[string]Setting)}
+	for _, kv := range flags {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return layer{}, fmt.Errorf("invalid --set %q: expected key=value", kv)
+		}
+		f, err := LookupField(key)
+		if err != nil {
+			return layer{}, err
+		}
+		v, err := f.Parse(splitValue(f, value))
+		if err != nil {
+			return layer{}, err
+		}
+		l.values[key] = Setting{Source: Source{Layer: LayerFlag, Name: "--set " + key}, Value: v}
+	}
+	return l, nil
+}
+
+// splitValue turns a single string into arguments for Field.Parse,
+// splitting lists on commas.
+func splitValue(f Field, value string) []string {
+	if f.Kind != reflect.Slice {
+		return []string{value}
+	}
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func allowedIn(layerName, key string) bool {
+	if layerName != LayerProject {
+		return true
+	}
+	for _, k := range ProjectKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) decode(node *yaml.Node) (interface{}, error) {
+	v := reflect.New(f.typ)
+	if err := node.Decode(v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// appends reports whether layers add to the setting rather than replace it.
+func (f Field) appends() bool {
+	return f.Key == "redact"
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadWith_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "etc", "config.yaml")
+	user := filepath.Join(dir, "home", "config.yaml")
+	writeFile(t, system, `api_endpoint: https://system.example.com
+machine_id: system-host
+sync_interval_minutes: 30
+redact:
+  - pattern: "corp-[0-9]+"
+`)
+	writeFile(t, user, `machine_id: laptop
+sync_interval_minutes: 10
+exclude_patterns: ["*tmp*"]
+redact:
+  - pattern: "sk-[a-z]+"
+`)
+
+	cfg, err := LoadWith(LoadOptions{
+		SystemPath: system,
+		UserPath:   user,
+		Environ: []string{
+			"CLAUDE_HISTORY_SYNC_SYNC_INTERVAL_MINUTES=15",
+			"CLAUDE_HISTORY_SYNC_EXCLUDE_PATTERNS=a, b",
+			"CLAUDE_HISTORY_SYNC_UNRELATED=1",
+			"HOME=/home/me",
+		},
+		Flags: []string{"machine_id=ci"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.APIEndpoint != "https://system.example.com" || cfg.Source("api_endpoint").Layer != LayerSystem {
+		t.Errorf("expected endpoint from system file, got %s from %v", cfg.APIEndpoint, cfg.Source("api_endpoint"))
+	}
+	if cfg.SyncInterval != 15 || cfg.Source("sync_interval_minutes").Name != "CLAUDE_HISTORY_SYNC_SYNC_INTERVAL_MINUTES" {
+		t.Errorf("expected interval from env, got %d from %v", cfg.SyncInterval, cfg.Source("sync_interval_minutes"))
+	}
+	if cfg.MachineID != "ci" || cfg.Source("machine_id").Layer != LayerFlag {
+		t.Errorf("expected machine ID from flag, got %s from %v", cfg.MachineID, cfg.Source("machine_id"))
+	}
+	if len(cfg.ExcludePatterns) != 2 || cfg.ExcludePatterns[1] != "b" {
+		t.Errorf("expected env list to replace the file's, got %v", cfg.ExcludePatterns)
+	}
+	if len(cfg.Redact) != 2 {
+		t.Errorf("expected redact rules from both files, got %v", cfg.Redact)
+	}
+	if cfg.Source("cognito_region").Layer != LayerDefault {
+		t.Errorf("expected default source, got %v", cfg.Source("cognito_region"))
+	}
+
+	settings, err := cfg.Explain("sync_interval_minutes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layers []string
+	for _, s := range settings {
+		layers = append(layers, s.Source.Layer)
+	}
+	if got := fmt.Sprint(layers); got != "[default system user env]" {
+		t.Errorf("unexpected explain chain %s", got)
+	}
+}
+
+func TestLoadWith_Errors(t *testing.T) {
+	if _, err := LoadWith(LoadOptions{Environ: []string{"CLAUDE_HISTORY_SYNC_SYNC_INTERVAL_MINUTES=soon"}}); err == nil {
+		t.Error("expected error for invalid env value")
+	}
+	if _, err := LoadWith(LoadOptions{Flags: []string{"sync_interval=5"}}); err == nil {
+		t.Error("expected error for unknown flag key")
+	}
+	if _, err := LoadWith(LoadOptions{Flags: []string{"machine_id"}}); err == nil {
+		t.Error("expected error for flag without a value")
+	}
+}
+
+func TestForDir(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	writeFile(t, filepath.Join(repo, ProjectConfigName), `sync_enabled: false
+api_endpoint: https://evil.example.com
+redact:
+  - pattern: "internal-[0-9]+"
+    replacement: "[ticket]"
+`)
+	sub := filepath.Join(repo, "pkg", "deep")
+	os.MkdirAll(sub, 0700)
+
+	if got := FindProjectConfig(sub); got != filepath.Join(repo, ProjectConfigName) {
+		t.Errorf("expected project file found from subdirectory, got %q", got)
+	}
+
+	base, err := LoadWith(LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := base.ForDir(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SyncEnabled || cfg.Source("sync_enabled").Layer != LayerProject {
+		t.Errorf("expected project to opt out, got %v from %v", cfg.SyncEnabled, cfg.Source("sync_enabled"))
+	}
+	if cfg.APIEndpoint != DefaultConfig().APIEndpoint {
+		t.Errorf("expected project file not to change the endpoint, got %s", cfg.APIEndpoint)
+	}
+	if len(cfg.Redact) != 1 || cfg.Redact[0].Replacement != "[ticket]" {
+		t.Errorf("expected project redact rules, got %v", cfg.Redact)
+	}
+	if !base.SyncEnabled {
+		t.Error("expected ForDir to leave the base config alone")
+	}
+
+	// The environment still wins over the project file
+	withEnv, err := LoadWith(LoadOptions{Environ: []string{"CLAUDE_HISTORY_SYNC_SYNC_ENABLED=true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := withEnv.ForDir(sub); !cfg.SyncEnabled {
+		t.Error("expected env to override the project file")
+	}
+
+	if cfg, _ := base.ForDir(filepath.Join(dir, "elsewhere")); cfg != base {
+		t.Error("expected config unchanged without a project file")
+	}
+}
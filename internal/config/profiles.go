@@ -0,0 +1,221 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfileName is the profile made of the top-level settings.
+const DefaultProfileName = "default"
+
+// Profile is an account to sync to: an endpoint and the Cognito or OIDC
+// settings to log in with. Settings a profile leaves empty come from the
+// top level.
+type Profile struct {
+	Name            string `yaml:"-"`
+	APIEndpoint     string `yaml:"api_endpoint,omitempty"`
+	MachineID       string `yaml:"machine_id,omitempty"`
+	CognitoRegion   string `yaml:"cognito_region,omitempty"`
+	CognitoPoolID   string `yaml:"cognito_pool_id,omitempty"`
+	CognitoClientID string `yaml:"cognito_client_id,omitempty"`
+	CognitoDomain   string `yaml:"cognito_domain,omitempty"`
+	OIDCIssuer      string `yaml:"oidc_issuer,omitempty"`
+	OIDCClientID    string `yaml:"oidc_client_id,omitempty"`
+	RedirectPorts   []int  `yaml:"redirect_ports,omitempty"`
+
+	// A profile can use a service account, like one per CI pipeline
+	AuthMode         string   `yaml:"auth_mode,omitempty"`
+	ServiceClientID  string   `yaml:"service_client_id,omitempty"`
+	ServiceScopes    []string `yaml:"service_scopes,omitempty"`
+	ClientSecretFile string   `yaml:"client_secret_file,omitempty"`
+	APIKeyFile       string   `yaml:"api_key_file,omitempty"`
+
+	// TokenStore, TokenFileEncryption and CredentialHelper are the
+	// machine-wide token storage settings, which profiles share
+	TokenStore          string `yaml:"-"`
+	TokenFileEncryption string `yaml:"-"`
+	CredentialHelper    string `yaml:"-"`
+
+	// EncryptContent seals the profile's uploads with its own key. Unset,
+	// it takes the top-level setting; EncryptsContent gives the result.
+	EncryptContent *bool `yaml:"encrypt_content,omitempty"`
+}
+
+// EncryptsContent reports whether encrypt_content is on for the profile.
+func (p *Profile) EncryptsContent() bool {
+	return p.EncryptContent != nil && *p.EncryptContent
+}
+
+// TokenNamespace keeps the profile's stored tokens apart from other
+// profiles'. The default profile uses "", so existing logins still work.
+func (p *Profile) TokenNamespace() string {
+	if p.Name == DefaultProfileName {
+		return ""
+	}
+	return p.Name
+}
+
+// Route sends sessions run under a directory to a profile.
+type Route struct {
+	Path    string `yaml:"path"`
+	Profile string `yaml:"profile"`
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ProfileNames lists the default profile and every named profile, sorted.
+func (c *Config) ProfileNames() []string {
+	names := []string{DefaultProfileName}
+	for name := range c.Profiles {
+		if name != DefaultProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Profile returns the settings for a profile, filling in whatever it
+// doesn't set from the top level. An empty name means the default profile,
+// or default_profile if that is set.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok && name != DefaultProfileName {
+		return nil, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	p.Name = name
+	for _, f := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&p.APIEndpoint, c.APIEndpoint},
+		{&p.MachineID, c.MachineID},
+		{&p.CognitoRegion, c.CognitoRegion},
+		{&p.CognitoPoolID, c.CognitoPoolID},
+		{&p.CognitoClientID, c.CognitoClientID},
+		{&p.CognitoDomain, c.CognitoDomain},
+		{&p.OIDCIssuer, c.OIDCIssuer},
+		{&p.OIDCClientID, c.OIDCClientID},
+		{&p.AuthMode, c.AuthMode},
+		{&p.ServiceClientID, c.ServiceClientID},
+		{&p.ClientSecretFile, c.ClientSecretFile},
+		{&p.APIKeyFile, c.APIKeyFile},
+	} {
+		if *f.value == "" {
+			*f.value = f.fallback
+		}
+	}
+	if p.RedirectPorts == nil {
+		p.RedirectPorts = c.RedirectPorts
+	}
+	if p.ServiceScopes == nil {
+		p.ServiceScopes = c.ServiceScopes
+	}
+	p.TokenStore = c.TokenStore
+	p.TokenFileEncryption = c.TokenFileEncryption
+	p.CredentialHelper = c.CredentialHelper
+	if p.EncryptContent == nil {
+		encrypt := c.EncryptContent
+		p.EncryptContent = &encrypt
+	}
+	return &p, nil
+}
+
+// RouteProfile returns the profile of the first route whose path contains
+// dir, or "" if none does.
+func (c *Config) RouteProfile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	for _, r := range c.Routes {
+		path := filepath.Clean(expandHome(r.Path))
+		if dir == path || strings.HasPrefix(dir, path+string(filepath.Separator)) {
+			return r.Profile
+		}
+	}
+	return ""
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// validateProfiles checks profile names, each profile's own settings, and
+// that routes and default_profile name profiles that exist.
+func (c *Config) validateProfiles() []Problem {
+	var problems []Problem
+	add := func(key string, format string, args ...interface{}) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	exists := func(name string) bool {
+		_, ok := c.Profiles[name]
+		return ok || name == DefaultProfileName
+	}
+
+	for _, name := range c.ProfileNames()[1:] {
+		if !profileNamePattern.MatchString(name) {
+			add("profiles", "%q: names may only contain letters, digits, - and _", name)
+			continue
+		}
+		p, _ := c.Profile(name)
+		if msg := checkEndpoint(p.APIEndpoint); msg != "" {
+			add("profiles", "%s: api_endpoint %s", name, msg)
+		}
+		for _, port := range p.RedirectPorts {
+			if port < 1 || port > 65535 {
+				add("profiles", "%s: redirect_ports: %d is not a valid port", name, port)
+			}
+		}
+		if p.OIDCIssuer != "" {
+			if msg := checkIssuer(p.OIDCIssuer); msg != "" {
+				add("profiles", "%s: oidc_issuer %s", name, msg)
+			}
+			if p.OIDCClientID == "" {
+				add("profiles", "%s: oidc_client_id must be set with oidc_issuer", name)
+			}
+		} else if strings.Contains(p.CognitoDomain, "/") {
+			add("profiles", "%s: cognito_domain must be a host name without a scheme or path, got %q", name, p.CognitoDomain)
+		}
+		if msg := checkAuthMode(p.AuthMode, p.ServiceClientID); msg != "" {
+			add("profiles", "%s: %s", name, msg)
+		}
+	}
+
+	if c.DefaultProfile != "" && !exists(c.DefaultProfile) {
+		add("default_profile", "unknown profile %q", c.DefaultProfile)
+	}
+
+	for i, r := range c.Routes {
+		switch {
+		case r.Path == "":
+			add("routes", "route %d: path must not be empty", i+1)
+		case r.Profile == "":
+			add("routes", "route %d (%s): profile must not be empty", i+1, r.Path)
+		case !exists(r.Profile):
+			add("routes", "route %d (%s): unknown profile %q", i+1, r.Path, r.Profile)
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "etc", "config.yaml")
+	user := filepath.Join(dir, "home", "config.yaml")
+	writeFile(t, system, `api_endpoint: https://personal.example.com
+machine_id: laptop
+cognito_region: us-east-1
+profiles:
+  work:
+    api_endpoint: https://work.example.com
+    cognito_client_id: work-client
+`)
+	writeFile(t, user, `profiles:
+  oss:
+    api_endpoint: https://oss.example.com
+`)
+
+	cfg, err := LoadWith(LoadOptions{SystemPath: system, UserPath: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Profiles from both files are kept
+	if got := strings.Join(cfg.ProfileNames(), ","); got != "default,oss,work" {
+		t.Errorf("ProfileNames() = %q, want default,oss,work", got)
+	}
+
+	def, err := cfg.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Name != DefaultProfileName || def.APIEndpoint != "https://personal.example.com" {
+		t.Errorf("default profile = %+v", def)
+	}
+	if def.TokenNamespace() != "" {
+		t.Errorf("default TokenNamespace() = %q, want empty", def.TokenNamespace())
+	}
+
+	work, err := cfg.Profile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.APIEndpoint != "https://work.example.com" || work.CognitoClientID != "work-client" {
+		t.Errorf("work profile = %+v", work)
+	}
+	// Unset fields come from the top level
+	if work.MachineID != "laptop" || work.CognitoRegion != "us-east-1" {
+		t.Errorf("work profile didn't inherit top-level settings: %+v", work)
+	}
+	if work.TokenNamespace() != "work" {
+		t.Errorf("work TokenNamespace() = %q, want work", work.TokenNamespace())
+	}
+
+	if _, err := cfg.Profile("missing"); err == nil {
+		t.Error("Profile(missing) succeeded, want error")
+	}
+
+	cfg.DefaultProfile = "oss"
+	if p, _ := cfg.Profile(""); p.Name != "oss" {
+		t.Errorf("Profile(\"\") with default_profile = %q, want oss", p.Name)
+	}
+}
+
+func TestProfile_EncryptContent(t *testing.T) {
+	// Only work has a content key, so only work turns encryption on
+	user := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, user, `api_endpoint: https://personal.example.com
+profiles:
+  work: # the day job
+    api_endpoint: https://work.example.com
+  oss:
+    api_endpoint: https://oss.example.com
+`)
+	if err := SetProfileInFile(user, "work", "encrypt_content", true); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWith(LoadOptions{UserPath: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"default": false, "work": true, "oss": false} {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.EncryptsContent() != want {
+			t.Errorf("%s: EncryptsContent() = %v, want %v", name, p.EncryptsContent(), want)
+		}
+	}
+	if work, _ := cfg.Profile("work"); work.APIEndpoint != "https://work.example.com" {
+		t.Errorf("expected work's other settings kept, got %+v", work)
+	}
+
+	// The top level is the fallback for profiles that don't say
+	cfg.EncryptContent = true
+	if oss, _ := cfg.Profile("oss"); !oss.EncryptsContent() {
+		t.Error("expected oss to inherit the top-level encrypt_content")
+	}
+	cfg.Profiles["oss"] = Profile{EncryptContent: new(bool)}
+	if oss, _ := cfg.Profile("oss"); oss.EncryptsContent() {
+		t.Error("expected oss's own encrypt_content: false to win")
+	}
+}
+
+func TestSetProfileInFile_NewProfile(t *testing.T) {
+	user := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, user, "machine_id: laptop\nprofiles:\n")
+	if err := SetProfileInFile(user, "work", "encrypt_content", true); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadWith(LoadOptions{UserPath: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work, err := cfg.Profile("work"); err != nil || !work.EncryptsContent() || work.MachineID != "laptop" {
+		t.Errorf("work profile = %+v, %v", work, err)
+	}
+}
+
+func TestRouteProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Routes = []Route{
+		{Path: "/src/work/secret", Profile: "secret"},
+		{Path: "/src/work/", Profile: "work"},
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/src/work", "work"},
+		{"/src/work/api", "work"},
+		{"/src/work/secret/x", "secret"},
+		{"/src/workshop", ""},
+		{"/home/me", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.RouteProfile(tt.dir); got != tt.want {
+			t.Errorf("RouteProfile(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Profiles = map[string]Profile{
+		"work":    {APIEndpoint: "https://work.example.com"},
+		"bad one": {},
+		"broken":  {APIEndpoint: "not a url", CognitoDomain: "https://auth.example.com"},
+	}
+	cfg.DefaultProfile = "nope"
+	cfg.Routes = []Route{
+		{Path: "/src/work", Profile: "work"},
+		{Path: "/src/x", Profile: "ghost"},
+		{Path: "", Profile: "work"},
+	}
+
+	var got []string
+	for _, p := range cfg.validateProfiles() {
+		got = append(got, p.String())
+	}
+	joined := strings.Join(got, "\n")
+
+	for _, want := range []string{
+		`"bad one"`,
+		"broken: api_endpoint",
+		"broken: cognito_domain",
+		`default_profile: unknown profile "nope"`,
+		`route 2 (/src/x): unknown profile "ghost"`,
+		"route 3: path must not be empty",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("problems missing %q:\n%s", want, joined)
+		}
+	}
+	if len(got) != 6 {
+		t.Errorf("got %d problems, want 6:\n%s", len(got), joined)
+	}
+}
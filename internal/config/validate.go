@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/redact"
+	"gopkg.in/yaml.v3"
+)
+
+// Check reads a config file for the given layer strictly, reporting keys
+// that aren't settings, values of the wrong type and keys the layer may
+// not set. Loading skips all of these, so this is how they get noticed.
+// Only a file that can't be read or parsed at all is an error.
+func Check(path, layerName string) ([]Problem, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, f := range Fields() {
+		keys = append(keys, f.Key)
+	}
+
+	source := Source{Layer: layerName, Path: path}
+	var problems []Problem
+	add := func(key string, line int, format string, args ...interface{}) {
+		message := fmt.Sprintf("line %d: ", line) + fmt.Sprintf(format, args...)
+		problems = append(problems, Problem{Key: key, Message: message, Source: source})
+	}
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valueNode := root.Content[i], root.Content[i+1]
+		key := keyNode.Value
+
+		f, err := LookupField(key)
+		if err != nil {
+			if suggestion := closestKey(key, keys); suggestion != "" {
+				add(key, keyNode.Line, "unknown key (did you mean %q?)", suggestion)
+			} else {
+				add(key, keyNode.Line, "unknown key")
+			}
+			continue
+		}
+		if !allowedIn(layerName, key) {
+			add(key, keyNode.Line, "can't be set in a project file (only %s)", strings.Join(ProjectKeys, ", "))
+			continue
+		}
+		for _, msg := range strictDecode(f, valueNode) {
+			add(key, valueNode.Line, "%s", msg)
+		}
+	}
+	return problems, nil
+}
+
+var linePrefix = regexp.MustCompile(`^line \d+: `)
+
+// strictDecode decodes a value node as the setting's type, rejecting
+// unknown fields in structured values such as redact rules.
+func strictDecode(f Field, node *yaml.Node) []string {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	err = dec.Decode(reflect.New(f.typ).Interface())
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return []string{err.Error()}
+	}
+	// Line numbers are relative to the re-encoded value, so drop them
+	var msgs []string
+	for _, msg := range typeErr.Errors {
+		msgs = append(msgs, linePrefix.ReplaceAllString(msg, ""))
+	}
+	return msgs
+}
+
+// Problem is something wrong with a setting. Warnings are worth knowing
+// about but don't stop a sync from working.
+type Problem struct {
+	Key     string
+	Message string
+	Warning bool
+	Source  Source
+}
+
+func (p Problem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", p.Key, p.Message)
+}
+
+// Validate checks the settings for values that would make syncing fail
+// or behave unexpectedly.
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	add := func(key string, warning bool, format string, args ...interface{}) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...), Warning: warning})
+	}
+
+	if msg := checkEndpoint(c.APIEndpoint); msg != "" {
+		add("api_endpoint", false, "%s", msg)
+	} else if u, _ := url.Parse(c.APIEndpoint); u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		add("api_endpoint", true, "uses plain http, so conversations are sent unencrypted")
+	}
+
+	if strings.TrimSpace(c.MachineID) == "" {
+		add("machine_id", false, "must not be empty")
+	}
+
+	if c.ClaudeDataDir == "" {
+		add("claude_data_dir", false, "must not be empty")
+	} else {
+		problems = append(problems, checkDir("claude_data_dir", c.ClaudeDataDir)...)
+	}
+	for _, dir := range c.ClaudeDataDirs {
+		if dir == "" {
+			add("claude_data_dirs", false, "entries must not be empty")
+			continue
+		}
+		problems = append(problems, checkDir("claude_data_dirs", dir)...)
+	}
+
+	for _, pattern := range c.ExcludePatterns {
+		if pattern == "" {
+			// An empty pattern is a substring of every path
+			add("exclude_patterns", false, "empty pattern would exclude every session")
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			add("exclude_patterns", false, "invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	if c.SyncInterval < 1 {
+		add("sync_interval_minutes", false, "must be at least 1, got %d", c.SyncInterval)
+	}
+
+	if c.DeletionPolicy != DeletionPolicyKeep && c.DeletionPolicy != DeletionPolicyPropagate {
+		add("deletion_policy", false, "must be %q or %q, got %q", DeletionPolicyKeep, DeletionPolicyPropagate, c.DeletionPolicy)
+	}
+
+	if c.CleanupPeriodDays < 1 {
+		add("cleanup_period_days", false, "must be at least 1, got %d", c.CleanupPeriodDays)
+	}
+
+	for _, rule := range c.Redact {
+		if _, err := redact.New([]redact.Rule{rule}); err != nil {
+			add("redact", false, "%v", err)
+		}
+	}
+
+	// An OIDC issuer replaces the Cognito settings, which then go unused
+	if c.OIDCIssuer != "" {
+		if msg := checkIssuer(c.OIDCIssuer); msg != "" {
+			add("oidc_issuer", false, "%s", msg)
+		}
+		if c.OIDCClientID == "" {
+			add("oidc_client_id", false, "must be set with oidc_issuer")
+		}
+	} else {
+		if c.CognitoRegion == "" {
+			add("cognito_region", false, "must not be empty")
+		}
+		if c.CognitoPoolID == "" {
+			add("cognito_pool_id", false, "must not be empty")
+		} else if c.CognitoRegion != "" && !strings.HasPrefix(c.CognitoPoolID, c.CognitoRegion+"_") {
+			add("cognito_pool_id", true, "%q doesn't belong to region %q", c.CognitoPoolID, c.CognitoRegion)
+		}
+		if c.CognitoClientID == "" {
+			add("cognito_client_id", false, "must not be empty")
+		}
+		if c.CognitoDomain == "" {
+			add("cognito_domain", false, "must not be empty")
+		} else if strings.Contains(c.CognitoDomain, "/") {
+			add("cognito_domain", false, "must be a host name without a scheme or path, got %q", c.CognitoDomain)
+		}
+	}
+
+	for _, port := range c.RedirectPorts {
+		if port < 1 || port > 65535 {
+			add("redirect_ports", false, "%d is not a valid port", port)
+		}
+	}
+
+	if !slices.Contains(TokenStores, c.TokenStore) {
+		add("token_store", false, "must be one of %s, got %q", strings.Join(TokenStores, ", "), c.TokenStore)
+	} else if c.TokenStore == TokenStoreHelper && strings.TrimSpace(c.CredentialHelper) == "" {
+		add("credential_helper", false, "must be set when token_store is %q", TokenStoreHelper)
+	}
+
+	if c.TokenFileEncryption != TokenFileEncryptionKeyfile && c.TokenFileEncryption != TokenFileEncryptionPassphrase {
+		add("token_file_encryption", false, "must be %q or %q, got %q", TokenFileEncryptionKeyfile, TokenFileEncryptionPassphrase, c.TokenFileEncryption)
+	}
+
+	if msg := checkAuthMode(c.AuthMode, c.ServiceClientID); msg != "" {
+		add("auth_mode", false, "%s", msg)
+	}
+
+	problems = append(problems, c.validateProfiles()...)
+
+	for i := range problems {
+		problems[i].Source = c.Source(problems[i].Key)
+	}
+	return problems
+}
+
+// checkAuthMode describes what is wrong with an auth mode and the client it
+// needs, or returns "" if nothing is. Secrets aren't checked, as they may
+// only be in the environment where the mode is used.
+func checkAuthMode(mode, clientID string) string {
+	if !slices.Contains(AuthModes, mode) {
+		return fmt.Sprintf("auth_mode must be one of %s, got %q", strings.Join(AuthModes, ", "), mode)
+	}
+	if mode == AuthModeClientCredentials && clientID == "" {
+		return fmt.Sprintf("service_client_id must be set when auth_mode is %q", AuthModeClientCredentials)
+	}
+	return ""
+}
+
+// checkEndpoint describes what is wrong with an API endpoint, or returns
+// "" if nothing is.
+func checkEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return fmt.Sprintf("must be an http or https URL, got %q", endpoint)
+	}
+	return ""
+}
+
+// checkIssuer describes what is wrong with an OIDC issuer, or returns ""
+// if nothing is. Tokens come from the issuer, so it must use https unless
+// it's a local test provider.
+func checkIssuer(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	if u.Host == "" || u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		return fmt.Sprintf("must be an https URL, got %q", issuer)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Sprintf("must not have a query or fragment, got %q", issuer)
+	}
+	return ""
+}
+
+func checkDir(key, dir string) []Problem {
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		return []Problem{{Key: key, Message: fmt.Sprintf("%s does not exist", dir), Warning: true}}
+	case err != nil:
+		return []Problem{{Key: key, Message: err.Error()}}
+	case !info.IsDir():
+		return []Problem{{Key: key, Message: fmt.Sprintf("%s is not a directory", dir)}}
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/martinjt/claude-history-cli/internal/redact"
+)
+
+func problemKeys(problems []Problem, warnings bool) []string {
+	var keys []string
+	for _, p := range problems {
+		if p.Warning == warnings {
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = dir
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected defaults to be valid, got %v", problems)
+	}
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0600)
+
+	cfg.APIEndpoint = "example.com"
+	cfg.ClaudeDataDirs = []string{file, filepath.Join(dir, "missing")}
+	cfg.ExcludePatterns = []string{"[", ""}
+	cfg.SyncInterval = 0
+	cfg.DeletionPolicy = "delete"
+	cfg.CognitoDomain = "https://auth.example.com"
+	cfg.Redact = []redact.Rule{{Pattern: "("}}
+
+	errs := strings.Join(problemKeys(cfg.Validate(), false), ",")
+	if errs != "api_endpoint,claude_data_dirs,exclude_patterns,exclude_patterns,sync_interval_minutes,deletion_policy,redact,cognito_domain" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+	if warnings := strings.Join(problemKeys(cfg.Validate(), true), ","); warnings != "claude_data_dirs" {
+		t.Errorf("unexpected warnings: %s", warnings)
+	}
+
+	cfg = DefaultConfig()
+	cfg.ClaudeDataDir = dir
+	cfg.APIEndpoint = "http://localhost:8080"
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected plain http to be fine for localhost, got %v", problems)
+	}
+	cfg.APIEndpoint = "http://history.example.com"
+	if warnings := problemKeys(cfg.Validate(), true); len(warnings) != 1 || warnings[0] != "api_endpoint" {
+		t.Errorf("expected plain http warning, got %v", warnings)
+	}
+}
+
+func TestValidate_OIDC(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = t.TempDir()
+	cfg.CognitoDomain = "" // unused once an issuer is set
+	cfg.OIDCIssuer = "https://sso.example.com/realms/dev"
+	cfg.OIDCClientID = "cli"
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected OIDC config to be valid, got %v", problems)
+	}
+
+	cfg.OIDCIssuer = "http://localhost:8080/realms/dev"
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected plain http to be fine for a local issuer, got %v", problems)
+	}
+
+	cfg.OIDCIssuer = "http://sso.example.com"
+	cfg.OIDCClientID = ""
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "oidc_issuer,oidc_client_id" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+}
+
+func TestLoadFrom_IgnoresUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("sync_interval: 10\nmachine_id: laptop\n"), 0600)
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("expected LoadFrom to stay lenient, got %v", err)
+	}
+	if cfg.MachineID != "laptop" || cfg.SyncInterval != 5 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `machine_id: laptop
+exclude_pattern:
+  - tmp
+search_index: maybe
+redact:
+  - patern: "sk-.*"
+`
+	os.WriteFile(path, []byte(content), 0600)
+
+	problems, err := Check(path, LayerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := make(map[string]string)
+	for _, p := range problems {
+		byKey[p.Key] = p.Message
+		if p.Source.Path != path || p.Source.Layer != LayerUser {
+			t.Errorf("unexpected source %v", p.Source)
+		}
+	}
+	if len(byKey) != 3 {
+		t.Errorf("expected three problems, got %v", byKey)
+	}
+	if msg := byKey["exclude_pattern"]; msg != `line 2: unknown key (did you mean "exclude_patterns"?)` {
+		t.Errorf("unexpected unknown key problem: %q", msg)
+	}
+	if msg := byKey["search_index"]; !strings.HasPrefix(msg, "line 4: ") || !strings.Contains(msg, "maybe") {
+		t.Errorf("unexpected type problem: %q", msg)
+	}
+	if msg := byKey["redact"]; !strings.Contains(msg, "patern") {
+		t.Errorf("expected unknown field in redact rule, got %q", msg)
+	}
+}
+
+func TestCheck_ProjectKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProjectConfigName)
+	os.WriteFile(path, []byte("sync_enabled: false\napi_endpoint: https://evil.example.com\n"), 0600)
+
+	problems, err := Check(path, LayerProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Key != "api_endpoint" {
+		t.Errorf("expected api_endpoint to be rejected in a project file, got %v", problems)
+	}
+}
+
+func TestValidate_TokenStore(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = t.TempDir()
+	cfg.CredentialHelper = "pass-helper"
+	for _, store := range TokenStores {
+		cfg.TokenStore = store
+		if problems := cfg.Validate(); len(problems) != 0 {
+			t.Errorf("expected token_store %s to be valid, got %v", store, problems)
+		}
+	}
+
+	cfg.TokenStore = "vault"
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "token_store" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+}
+
+func TestValidate_TokenFileEncryption(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = t.TempDir()
+	cfg.TokenFileEncryption = TokenFileEncryptionPassphrase
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected passphrase to be valid, got %v", problems)
+	}
+
+	cfg.TokenFileEncryption = "rot13"
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "token_file_encryption" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+}
+
+func TestValidate_CredentialHelper(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = t.TempDir()
+	cfg.TokenStore = TokenStoreHelper
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "credential_helper" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+
+	cfg.CredentialHelper = "pass-helper --store claude"
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected helper config to be valid, got %v", problems)
+	}
+}
+
+func TestValidate_AuthMode(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClaudeDataDir = t.TempDir()
+	cfg.AuthMode = AuthModeAPIKey
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected api_key to be valid, got %v", problems)
+	}
+
+	cfg.AuthMode = AuthModeClientCredentials
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "auth_mode" {
+		t.Errorf("expected a missing service_client_id to be reported, got %s", errs)
+	}
+	cfg.ServiceClientID = "ci-client"
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("expected client_credentials to be valid, got %v", problems)
+	}
+
+	cfg.AuthMode = "password"
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "auth_mode" {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+
+	cfg.AuthMode, cfg.ServiceClientID = AuthModeUser, ""
+	cfg.Profiles = map[string]Profile{"ci": {AuthMode: AuthModeClientCredentials}}
+	if errs := strings.Join(problemKeys(cfg.Validate(), false), ","); errs != "profiles" {
+		t.Errorf("expected the ci profile's missing client to be reported, got %s", errs)
+	}
+}
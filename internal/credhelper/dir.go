@@ -0,0 +1,117 @@
+package credhelper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DirHelper is the reference credential helper. It keeps each account's
+// tokens and secrets as JSON files under Dir, unencrypted, so it's for
+// trying the protocol out and testing rather than real use.
+type DirHelper struct {
+	Dir string
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Serve runs one operation, reading the request from in and writing any
+// response to out.
+func (h *DirHelper) Serve(op string, in io.Reader, out io.Writer) error {
+	var req Request
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		return fmt.Errorf("reading request: %w", err)
+	}
+	if req.Version != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", req.Version)
+	}
+	// The names become file names, so keep them to one path element
+	if !namePattern.MatchString(req.Service) || !namePattern.MatchString(req.Account) || req.Service[0] == '.' || req.Account[0] == '.' {
+		return fmt.Errorf("invalid service %q or account %q", req.Service, req.Account)
+	}
+	path := filepath.Join(h.Dir, req.Service, req.Account+".json")
+
+	switch op {
+	case OpGetSecret, OpStoreSecret, OpEraseSecret:
+		if req.Secret == nil || !namePattern.MatchString(req.Secret.Name) || req.Secret.Name[0] == '.' {
+			return fmt.Errorf("%s request has no valid secret name", op)
+		}
+		secretPath := filepath.Join(h.Dir, req.Service, "secrets", req.Account, req.Secret.Name+".json")
+		return h.serveSecret(op, secretPath, req.Secret, out)
+
+	case OpGet:
+		var resp Response
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err := json.Unmarshal(data, &resp.Tokens); err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return json.NewEncoder(out).Encode(resp)
+
+	case OpStore:
+		if req.Tokens == nil {
+			return fmt.Errorf("store request has no tokens")
+		}
+		data, err := json.Marshal(req.Tokens)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, data)
+
+	case OpErase:
+		return removeFile(path)
+	}
+	return fmt.Errorf("unknown operation %q (expected get, store, erase, get-secret, store-secret or erase-secret)", op)
+}
+
+func (h *DirHelper) serveSecret(op, path string, secret *Secret, out io.Writer) error {
+	switch op {
+	case OpGetSecret:
+		var resp Response
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err := json.Unmarshal(data, &resp.Secret); err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return json.NewEncoder(out).Encode(resp)
+
+	case OpStoreSecret:
+		if len(secret.Data) == 0 {
+			return fmt.Errorf("store-secret request has no data")
+		}
+		data, err := json.Marshal(secret)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, data)
+	}
+	return removeFile(path)
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package credhelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serve(t *testing.T, h *DirHelper, op string, req Request) (Response, error) {
+	t.Helper()
+	in, _ := json.Marshal(req)
+	var out bytes.Buffer
+	err := h.Serve(op, bytes.NewReader(in), &out)
+	var resp Response
+	if err == nil && (op == OpGet || op == OpGetSecret) {
+		if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+			t.Fatalf("parsing response %q: %v", out.String(), err)
+		}
+	}
+	return resp, err
+}
+
+func TestDirHelper(t *testing.T) {
+	h := &DirHelper{Dir: t.TempDir()}
+	req := Request{Version: ProtocolVersion, Service: Service, Account: "work"}
+
+	if resp, err := serve(t, h, OpGet, req); err != nil || resp.Tokens != nil {
+		t.Fatalf("get before store = %+v, %v", resp, err)
+	}
+
+	store := req
+	store.Tokens = &Tokens{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: 1700000000}
+	if _, err := serve(t, h, OpStore, store); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(h.Dir, Service, "work.json"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file: %v, %v", info, err)
+	}
+
+	resp, err := serve(t, h, OpGet, req)
+	if err != nil || resp.Tokens == nil || *resp.Tokens != *store.Tokens {
+		t.Fatalf("get after store = %+v, %v", resp.Tokens, err)
+	}
+
+	// Other accounts are kept apart
+	other := req
+	other.Account = "default"
+	if resp, err := serve(t, h, OpGet, other); err != nil || resp.Tokens != nil {
+		t.Errorf("get for another account = %+v, %v", resp, err)
+	}
+
+	if _, err := serve(t, h, OpErase, req); err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	if resp, err := serve(t, h, OpGet, req); err != nil || resp.Tokens != nil {
+		t.Errorf("get after erase = %+v, %v", resp, err)
+	}
+	if _, err := serve(t, h, OpErase, req); err != nil {
+		t.Errorf("erasing nothing: %v", err)
+	}
+}
+
+func TestDirHelper_Secrets(t *testing.T) {
+	h := &DirHelper{Dir: t.TempDir()}
+	req := Request{Version: ProtocolVersion, Service: Service, Account: "work", Secret: &Secret{Name: "content-keys"}}
+
+	if resp, err := serve(t, h, OpGetSecret, req); err != nil || resp.Secret != nil {
+		t.Fatalf("get-secret before store = %+v, %v", resp, err)
+	}
+
+	store := req
+	store.Secret = &Secret{Name: "content-keys", Data: []byte("keyring")}
+	if _, err := serve(t, h, OpStoreSecret, store); err != nil {
+		t.Fatalf("store-secret: %v", err)
+	}
+	resp, err := serve(t, h, OpGetSecret, req)
+	if err != nil || resp.Secret == nil || string(resp.Secret.Data) != "keyring" {
+		t.Fatalf("get-secret after store = %+v, %v", resp.Secret, err)
+	}
+
+	// Erasing the tokens leaves the secrets alone
+	if _, err := serve(t, h, OpErase, req); err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	if resp, err := serve(t, h, OpGetSecret, req); err != nil || resp.Secret == nil {
+		t.Errorf("get-secret after erase = %+v, %v", resp, err)
+	}
+
+	if _, err := serve(t, h, OpEraseSecret, req); err != nil {
+		t.Fatalf("erase-secret: %v", err)
+	}
+	if resp, err := serve(t, h, OpGetSecret, req); err != nil || resp.Secret != nil {
+		t.Errorf("get-secret after erase-secret = %+v, %v", resp, err)
+	}
+}
+
+func TestDirHelper_Rejects(t *testing.T) {
+	h := &DirHelper{Dir: t.TempDir()}
+	for name, tc := range map[string]struct {
+		op  string
+		req Request
+		err string
+	}{
+		"version":          {OpGet, Request{Version: 2, Service: Service, Account: "default"}, "version 2"},
+		"traversal":        {OpGet, Request{Version: 1, Service: Service, Account: "../x"}, "invalid"},
+		"dot":              {OpGet, Request{Version: 1, Service: "..", Account: "default"}, "invalid"},
+		"no tokens":        {OpStore, Request{Version: 1, Service: Service, Account: "default"}, "no tokens"},
+		"no secret":        {OpGetSecret, Request{Version: 1, Service: Service, Account: "default"}, "no valid secret name"},
+		"secret traversal": {OpEraseSecret, Request{Version: 1, Service: Service, Account: "default", Secret: &Secret{Name: "../x"}}, "no valid secret name"},
+		"operation":        {"list", Request{Version: 1, Service: Service, Account: "default"}, "unknown operation"},
+	} {
+		if _, err := serve(t, h, tc.op, tc.req); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected %q error, got %v", name, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package credhelper defines the protocol between claude-history-sync and
+// an external credential helper, a program that keeps login tokens in a
+// password manager or secrets service, and implements a reference helper
+// that keeps them in a directory.
+//
+// The helper is run once per operation with the operation as its last
+// argument: get, store or erase for the tokens, and get-secret,
+// store-secret or erase-secret for other secrets of the account. It reads
+// a JSON Request on stdin. For the gets it writes a JSON Response on
+// stdout; for the rest anything it writes is ignored. Exiting non-zero is
+// an error, and whatever it wrote to stderr is shown to the user. See
+// docs/credential-helpers.md.
+package credhelper
+
+// ProtocolVersion is the version of the protocol sent in each request.
+// Helpers should reject versions they don't know.
+const ProtocolVersion = 1
+
+// Operations a helper is run with.
+const (
+	OpGet   = "get"
+	OpStore = "store"
+	OpErase = "erase"
+
+	OpGetSecret   = "get-secret"
+	OpStoreSecret = "store-secret"
+	OpEraseSecret = "erase-secret"
+)
+
+// Request is what the helper reads on stdin.
+type Request struct {
+	Version int `json:"version"`
+	// Service is always "claude-history-sync", so a helper can serve
+	// other programs too
+	Service string `json:"service"`
+	// Account names the profile the tokens belong to: "default" or the
+	// profile name
+	Account string `json:"account"`
+	// Tokens are the tokens to keep, for store only
+	Tokens *Tokens `json:"tokens,omitempty"`
+	// Secret names the secret for the secret operations, and holds its
+	// data for store-secret
+	Secret *Secret `json:"secret,omitempty"`
+}
+
+// Response is what the helper writes on stdout for get and get-secret. No
+// tokens or secret, or no output at all, means none is stored.
+type Response struct {
+	Tokens *Tokens `json:"tokens,omitempty"`
+	Secret *Secret `json:"secret,omitempty"`
+}
+
+// Secret is a secret kept for the account besides its tokens, like the
+// keys that encrypt its uploads.
+type Secret struct {
+	Name string `json:"name"`
+	// Data is base64 in JSON; omitted when naming a secret to get or
+	// erase
+	Data []byte `json:"data,omitempty"`
+}
+
+// Tokens are the tokens from a login. Times are Unix seconds.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"`
+	IssuedAt     int64  `json:"issued_at,omitempty"`
+}
+
+// Service is the service name sent in every request.
+const Service = "claude-history-sync"
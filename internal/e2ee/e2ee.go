@@ -0,0 +1,176 @@
+// Package e2ee seals conversation content on this machine before it's
+// uploaded, so the sync server only ever holds ciphertext for it.
+//
+// Values are sealed with XChaCha20-Poly1305 under a 256-bit key derived
+// from a recovery phrase. The nonce is derived from the key, the value and
+// where the value goes, so the same value in the same place always seals
+// to the same text: that keeps the server's conversation hashes stable,
+// which sync compares to skip unchanged sessions. What it gives away is
+// only that two sealed values in the same place are equal. Where a value
+// goes, its session and field, is also authenticated, so the server can't
+// move ciphertext from one message to another.
+package e2ee
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Prefix starts every sealed value, followed by the ID of the key that
+// sealed it, a colon, and the nonce and ciphertext in unpadded base64url.
+const Prefix = "e2ee:v1:"
+
+// RecoveryPhraseEnv supplies the recovery phrase to machines that don't
+// keep the content keys, like CI runners using a service account.
+const RecoveryPhraseEnv = "CLAUDE_HISTORY_SYNC_RECOVERY_PHRASE"
+
+// KeySize is the size of a content key.
+const KeySize = chacha20poly1305.KeySize
+
+// ErrUnknownKey means a value was sealed with a key the keyring doesn't
+// hold, like one from before a rotation that wasn't recovered here.
+var ErrUnknownKey = errors.New("sealed with an unknown key")
+
+// Recovery phrases are 160 random bits, so keys can be derived from them
+// with a fixed salt: there is nothing to gain from precomputing guesses.
+// Argon2id still makes each guess cost 64 MiB.
+const (
+	phraseBytes  = 20
+	phraseSalt   = "claude-history-sync e2ee v1"
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+)
+
+var phraseEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryPhrase returns a new random recovery phrase, in groups of
+// four characters to make it easier to copy down.
+func NewRecoveryPhrase() (string, error) {
+	b := make([]byte, phraseBytes)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("generating recovery phrase: %w", err)
+	}
+	encoded := phraseEncoding.EncodeToString(b)
+	var groups []string
+	for len(encoded) > 0 {
+		n := min(4, len(encoded))
+		groups = append(groups, encoded[:n])
+		encoded = encoded[n:]
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// KeyFromPhrase derives the content key for a recovery phrase. Case,
+// spaces and dashes don't matter.
+func KeyFromPhrase(phrase string) (*Key, error) {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(phrase))
+	if b, err := phraseEncoding.DecodeString(normalized); err != nil || len(b) != phraseBytes {
+		return nil, fmt.Errorf("not a recovery phrase: expected %d groups of letters and digits", (phraseBytes*8/5+3)/4)
+	}
+	secret := argon2.IDKey([]byte(normalized), []byte(phraseSalt), argonTime, argonMemory, argonThreads, KeySize)
+	return NewKey(secret)
+}
+
+// Key seals values for upload. A nil *Key leaves them as they are, so
+// callers don't need to check whether encryption is on.
+type Key struct {
+	// ID names the key in the values it seals. It's derived from the key
+	// and reveals nothing about it.
+	ID string
+
+	secret   []byte
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// NewKey makes a key from KeySize secret bytes.
+func NewKey(secret []byte) (*Key, error) {
+	if len(secret) != KeySize {
+		return nil, fmt.Errorf("content key must be %d bytes, got %d", KeySize, len(secret))
+	}
+	sub := func(info string) []byte {
+		b := make([]byte, KeySize)
+		// HKDF only fails past 255 hashes of output
+		io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), b)
+		return b
+	}
+
+	aead, err := chacha20poly1305.NewX(sub("claude-history-sync e2ee v1 encryption"))
+	if err != nil {
+		return nil, err
+	}
+	id := sub("claude-history-sync e2ee v1 key id")
+	return &Key{
+		ID:       hex.EncodeToString(id[:4]),
+		secret:   append([]byte(nil), secret...),
+		aead:     aead,
+		nonceKey: sub("claude-history-sync e2ee v1 nonce"),
+	}, nil
+}
+
+// location is what a value is bound to: the session and field it's in,
+// each length-prefixed so different pairs can't run together.
+func location(sessionID, field string) []byte {
+	var b []byte
+	for _, s := range []string{sessionID, field} {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// Seal seals a value for the field of a session, like "projectPath" or
+// MessageField(uuid). Empty values stay empty.
+func (k *Key) Seal(sessionID, field, value string) string {
+	if k == nil || value == "" {
+		return value
+	}
+	loc := location(sessionID, field)
+
+	mac := hmac.New(sha256.New, k.nonceKey)
+	mac.Write(loc)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:chacha20poly1305.NonceSizeX]
+
+	sealed := k.aead.Seal(append([]byte(nil), nonce...), nonce, []byte(value), loc)
+	return Prefix + k.ID + ":" + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Fields sealed besides message content: the paths and remote that name
+// the project a session was in. They're named as in the sync request.
+const (
+	FieldProjectPath = "projectPath"
+	FieldCWD         = "cwd"
+	FieldSourceDir   = "sourceDir"
+	FieldGitRemote   = "gitRemote"
+)
+
+// MessageField is the field a message's content is sealed as.
+func MessageField(uuid string) string {
+	return "message/" + uuid
+}
+
+// IsSealed reports whether a value was sealed.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
@@ -0,0 +1,110 @@
+package e2ee
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T, fill byte) *Key {
+	t.Helper()
+	k, err := NewKey(bytes.Repeat([]byte{fill}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKey(t, 1)
+	kr := NewKeyring()
+	kr.Add(k, true)
+
+	sealed := k.Seal("s1", MessageField("u1"), "fix the flaky test")
+	if !IsSealed(sealed) || strings.Contains(sealed, "flaky") {
+		t.Fatalf("value not sealed: %s", sealed)
+	}
+	if again := k.Seal("s1", MessageField("u1"), "fix the flaky test"); again != sealed {
+		t.Error("expected sealing to be deterministic, so hashes stay stable")
+	}
+	if other := k.Seal("s1", MessageField("u2"), "fix the flaky test"); other == sealed {
+		t.Error("expected the same text in another message to seal differently")
+	}
+
+	opened, err := kr.Open("s1", MessageField("u1"), sealed)
+	if err != nil || opened != "fix the flaky test" {
+		t.Errorf("Open = %q, %v", opened, err)
+	}
+	if _, err := kr.Open("s1", MessageField("u2"), sealed); err == nil {
+		t.Error("expected a value moved to another message not to open")
+	}
+	if _, err := kr.Open("s2", MessageField("u1"), sealed); err == nil {
+		t.Error("expected a value moved to another session not to open")
+	}
+}
+
+func TestSeal_NilKeyAndEmptyValues(t *testing.T) {
+	var k *Key
+	if got := k.Seal("s1", FieldProjectPath, "/src/app"); got != "/src/app" {
+		t.Errorf("nil key sealed the value: %s", got)
+	}
+	if got := testKey(t, 1).Seal("s1", FieldCWD, ""); got != "" {
+		t.Errorf("empty value sealed: %s", got)
+	}
+	if got, err := NewKeyring().Open("s1", FieldProjectPath, "/src/app"); err != nil || got != "/src/app" {
+		t.Errorf("expected unsealed values to pass through, got %q, %v", got, err)
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, current := testKey(t, 1), testKey(t, 2)
+	kr := NewKeyring()
+	kr.Add(old, false)
+	kr.Add(current, true)
+	if kr.Current() != current || kr.Len() != 2 {
+		t.Fatalf("current = %v with %d keys", kr.Current().ID, kr.Len())
+	}
+
+	data, err := kr.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKeyring(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Current().ID != current.ID {
+		t.Errorf("current key after parsing = %s, want %s", parsed.Current().ID, current.ID)
+	}
+	if got, err := parsed.Open("s1", FieldProjectPath, old.Seal("s1", FieldProjectPath, "/src/app")); err != nil || got != "/src/app" {
+		t.Errorf("expected values sealed with the old key to open, got %q, %v", got, err)
+	}
+
+	only := NewKeyring()
+	only.Add(current, true)
+	if _, err := only.Open("s1", FieldProjectPath, old.Seal("s1", FieldProjectPath, "/src/app")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyFromPhrase(t *testing.T) {
+	phrase, err := NewRecoveryPhrase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := KeyFromPhrase(phrase)
+	if err != nil {
+		t.Fatalf("KeyFromPhrase(%s): %v", phrase, err)
+	}
+
+	// As it might be typed back in
+	retyped := strings.ToLower(strings.ReplaceAll(phrase, "-", " "))
+	if again, err := KeyFromPhrase(retyped); err != nil || again.ID != k.ID {
+		t.Errorf("expected %q to give the same key: %v", retyped, err)
+	}
+
+	if _, err := KeyFromPhrase("correct horse battery staple"); err == nil {
+		t.Error("expected a made-up phrase to be rejected")
+	}
+}
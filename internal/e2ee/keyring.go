@@ -0,0 +1,135 @@
+package e2ee
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Keyring holds a profile's content keys: the current one, which seals new
+// uploads, and the ones it replaced, which still open what they sealed.
+type Keyring struct {
+	current string
+	keys    map[string]*Key
+	order   []string // oldest first, as they were added
+}
+
+// keyringVersion is the version of the stored keyring format.
+const keyringVersion = 1
+
+type storedKeyring struct {
+	Version int         `json:"version"`
+	Current string      `json:"current"`
+	Keys    []storedKey `json:"keys"`
+}
+
+type storedKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// NewKeyring returns an empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*Key)}
+}
+
+// ParseKeyring reads a keyring stored with Marshal.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var stored storedKeyring
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("parsing content keys: %w", err)
+	}
+	if stored.Version != keyringVersion {
+		return nil, fmt.Errorf("unsupported content key format %d", stored.Version)
+	}
+
+	kr := NewKeyring()
+	for _, sk := range stored.Keys {
+		secret, err := base64.StdEncoding.DecodeString(sk.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("parsing content key %s: %w", sk.ID, err)
+		}
+		k, err := NewKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("parsing content key %s: %w", sk.ID, err)
+		}
+		if k.ID != sk.ID {
+			return nil, fmt.Errorf("content key %s is damaged", sk.ID)
+		}
+		kr.Add(k, false)
+	}
+	if _, ok := kr.keys[stored.Current]; !ok {
+		return nil, fmt.Errorf("current content key %s is missing", stored.Current)
+	}
+	kr.current = stored.Current
+	return kr, nil
+}
+
+// Marshal encodes the keyring for a token store. The result holds the
+// keys themselves, so it must be kept as secret as they are.
+func (kr *Keyring) Marshal() ([]byte, error) {
+	stored := storedKeyring{Version: keyringVersion, Current: kr.current}
+	for _, id := range kr.order {
+		stored.Keys = append(stored.Keys, storedKey{
+			ID:     id,
+			Secret: base64.StdEncoding.EncodeToString(kr.keys[id].secret),
+		})
+	}
+	return json.Marshal(stored)
+}
+
+// Add adds a key, making it the current one if current is set or the
+// keyring was empty. Adding a key it already holds just updates current.
+func (kr *Keyring) Add(k *Key, current bool) {
+	if _, ok := kr.keys[k.ID]; !ok {
+		kr.keys[k.ID] = k
+		kr.order = append(kr.order, k.ID)
+	}
+	if current || kr.current == "" {
+		kr.current = k.ID
+	}
+}
+
+// Current is the key new uploads are sealed with, or nil for an empty
+// keyring.
+func (kr *Keyring) Current() *Key {
+	return kr.keys[kr.current]
+}
+
+// Len is how many keys the keyring holds.
+func (kr *Keyring) Len() int {
+	return len(kr.keys)
+}
+
+// Open opens a value sealed for the field of a session with any key in
+// the keyring. Values that aren't sealed, like those uploaded before
+// encryption was turned on, are returned as they are, even by a nil
+// keyring.
+func (kr *Keyring) Open(sessionID, field, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	var k *Key
+	if kr != nil {
+		k, ok = kr.keys[id]
+	}
+	if k == nil {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext, location(sessionID, field))
+	if err != nil {
+		return "", fmt.Errorf("opening %s of session %s: sealed value was altered or belongs elsewhere", field, sessionID)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Formats supported by Write.
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+)
+
+// Extension returns the file extension used for a format.
+func Extension(format string) string {
+	switch format {
+	case FormatHTML:
+		return ".html"
+	case FormatJSON:
+		return ".json"
+	default:
+		return ".md"
+	}
+}
+
+// Write renders transcripts in the given format. Several transcripts are
+// written as one document.
+func Write(w io.Writer, format string, transcripts []*Transcript) error {
+	switch format {
+	case FormatMarkdown, "markdown":
+		return WriteMarkdown(w, transcripts)
+	case FormatHTML:
+		return WriteHTML(w, transcripts)
+	case FormatJSON:
+		return WriteJSON(w, transcripts)
+	default:
+		return fmt.Errorf("unknown format %q (expected md, html or json)", format)
+	}
+}
+
+func WriteJSON(w io.Writer, transcripts []*Transcript) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Sessions []*Transcript `json:"sessions"`
+	}{transcripts})
+}
+
+// formatTimestamp renders an RFC 3339 timestamp in a readable UTC form,
+// falling back to the raw value.
+func formatTimestamp(ts string) string {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ts
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// prettyInput indents a tool input for display.
+func prettyInput(input json.RawMessage) string {
+	if len(input) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(input, &v); err != nil {
+		return string(input)
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return string(input)
+	}
+	return string(out)
+}
+
+func roleTitle(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case RoleTool:
+		return "Tool result"
+	default:
+		return role
+	}
+}
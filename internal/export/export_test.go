@@ -0,0 +1,304 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func testSession() *sync.Session {
+	return &sync.Session{
+		File: sync.FileInfo{SessionID: "s1", ProjectPath: "/-work-app"},
+		Metadata: &sync.SessionMetadata{
+			CWD:      "/work/app",
+			Version:  "1.0.50",
+			Branches: []sync.BranchSpan{{Branch: "main"}, {Branch: "fix-retry"}},
+		},
+		Messages: []sync.Message{
+			{UUID: "u1", Role: "user", Timestamp: "2025-01-06T10:00:00Z", Content: "Why does <Retry> loop?"},
+			{UUID: "a1", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:00:05Z", ResponseID: "msg_1",
+				Blocks: []sync.ContentBlock{{Type: "thinking", Text: "hmm"}}},
+			{UUID: "a2", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:00:06Z", ResponseID: "msg_1",
+				Blocks: []sync.ContentBlock{{Type: "text", Text: "Let me look:\n```go\nfor {}\n```"}}},
+			{UUID: "a3", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:00:07Z", ResponseID: "msg_1",
+				Blocks: []sync.ContentBlock{{Type: "tool_use", ID: "t1", Name: "Bash", Input: json.RawMessage(`{"command":"grep -r Retry ."}`)}}},
+			{UUID: "u2", Role: "user", Timestamp: "2025-01-06T10:00:08Z",
+				Blocks: []sync.ContentBlock{{Type: "tool_result", ID: "t1", Text: "retry.go: for {}", IsError: true}}},
+			{UUID: "a4", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:00:09Z", ResponseID: "msg_2",
+				Blocks: []sync.ContentBlock{{Type: "text", Text: "Found it."}}},
+		},
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tr := Normalize(testSession())
+
+	if tr.Project != "/work/app" {
+		t.Errorf("expected project from cwd, got %s", tr.Project)
+	}
+	if strings.Join(tr.GitBranches, ",") != "main,fix-retry" {
+		t.Errorf("unexpected branches: %v", tr.GitBranches)
+	}
+	if tr.StartedAt != "2025-01-06T10:00:00Z" || tr.EndedAt != "2025-01-06T10:00:09Z" {
+		t.Errorf("unexpected time range: %s - %s", tr.StartedAt, tr.EndedAt)
+	}
+
+	// u1, merged msg_1 (a1-a3), a4; the tool result record is folded in
+	if len(tr.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(tr.Entries), tr.Entries)
+	}
+
+	merged := tr.Entries[1]
+	if merged.UUID != "a1" || !strings.Contains(merged.Text, "Let me look") {
+		t.Errorf("expected merged assistant entry, got %+v", merged)
+	}
+	if len(merged.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(merged.ToolCalls))
+	}
+	call := merged.ToolCalls[0]
+	if call.Name != "Bash" || call.Result != "retry.go: for {}" || !call.IsError {
+		t.Errorf("expected tool result attached to call, got %+v", call)
+	}
+}
+
+func TestNormalize_OrphanToolResults(t *testing.T) {
+	// A later batch of a followed session: the call was in an earlier batch
+	session := &sync.Session{
+		File: sync.FileInfo{SessionID: "s1"},
+		Messages: []sync.Message{
+			{UUID: "u2", Role: "user", Timestamp: "2025-01-06T10:00:08Z",
+				Blocks: []sync.ContentBlock{{Type: "tool_result", ID: "t1", Text: "ok"}}},
+			{UUID: "a4", Role: "assistant", Timestamp: "2025-01-06T10:00:09Z", ResponseID: "msg_2",
+				Blocks: []sync.ContentBlock{{Type: "text", Text: "Done."}}},
+		},
+	}
+
+	tr := Normalize(session)
+	if len(tr.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(tr.Entries), tr.Entries)
+	}
+	orphan := tr.Entries[0]
+	if orphan.Role != RoleTool || len(orphan.ToolCalls) != 1 || orphan.ToolCalls[0].Result != "ok" {
+		t.Errorf("expected tool result entry, got %+v", orphan)
+	}
+
+	// Results whose call is present are still folded into it
+	if tr := Normalize(testSession()); len(tr.Entries) != 3 {
+		t.Errorf("expected no extra entries for matched results, got %d", len(tr.Entries))
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatMarkdown, []*Transcript{Normalize(testSession())}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# Session s1",
+		"- **Branches:** main → fix-retry",
+		"## Assistant (claude-opus)",
+		"_2025-01-06 10:00:05 UTC_",
+		"```go\nfor {}\n```",
+		"<summary>Tool call: Bash (error)</summary>",
+		"\"command\": \"grep -r Retry .\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected markdown to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMarkdown_EscapesToolName(t *testing.T) {
+	var b strings.Builder
+	writeMarkdownToolCall(&b, &ToolCall{Name: "</summary><script>x</script>"})
+	if out := b.String(); strings.Contains(out, "<script>") || !strings.Contains(out, "&lt;/summary&gt;&lt;script&gt;") {
+		t.Errorf("expected the tool name escaped:\n%s", out)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatHTML, []*Transcript{Normalize(testSession())}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>Session s1</title>",
+		"Why does &lt;Retry&gt; loop?",
+		`<pre><code class="language-go">for {}</code></pre>`,
+		`<details class="error">`,
+		"<summary>Tool call: Bash (error)</summary>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(out, "<Retry>") {
+		t.Error("expected message text to be escaped")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, []*Transcript{Normalize(testSession())}); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Sessions []Transcript `json:"sessions"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(decoded.Sessions) != 1 || decoded.Sessions[0].Entries[1].ToolCalls[0].ID != "t1" {
+		t.Errorf("unexpected JSON export: %s", buf.String())
+	}
+}
+
+func TestWriteTerminal(t *testing.T) {
+	session := testSession()
+	session.Messages[0].Content = "Why does the retry helper loop forever when the server keeps returning errors?"
+	session.Messages[4].Blocks[0].Text = "retry.go: for {}\nretry.go: return nil\nretry_test.go: t.Skip()"
+	transcripts := []*Transcript{Normalize(session)}
+
+	var buf bytes.Buffer
+	if err := WriteTerminal(&buf, transcripts, TerminalOptions{Width: 40}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"Session s1\n",
+		"── User · 2025-01-06 10:00:00 UTC ──────\n",
+		"Why does the retry helper loop forever\nwhen the server keeps returning errors?\n",
+		"  │ for {}\n",
+		`  ▸ Bash  {"command":"grep -r Retry ."}`,
+		"  ⎿ error: retry.go: for {} … +2 lines\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Error("expected no colour codes when Color is off")
+	}
+	for _, l := range strings.Split(out, "\n") {
+		// Headings and code are never wrapped
+		if n := len([]rune(l)); n > 40 && !strings.HasPrefix(l, "──") && !strings.HasPrefix(l, "  │") {
+			t.Errorf("line exceeds width (%d): %q", n, l)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteTerminal(&buf, transcripts, TerminalOptions{Expand: true, Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	if !strings.Contains(out, "    retry_test.go: t.Skip()\n") {
+		t.Errorf("expected expanded tool result:\n%s", out)
+	}
+	if !strings.Contains(out, ansiCyan) {
+		t.Error("expected colour codes when Color is on")
+	}
+}
+
+func TestWriteTerminal_EscapesControlCharacters(t *testing.T) {
+	transcript := &Transcript{SessionID: "s1", Entries: []Entry{{
+		Role: "assistant",
+		Text: "title\x1b]0;pwned\x07 here\r\n",
+		ToolCalls: []ToolCall{{
+			Name:   "WebFetch",
+			Input:  json.RawMessage(`{"url":"https://example.com/\u001b[2J"}`),
+			Result: "page\x1b]52;c;Y3VybCBldmlsLnNoIHwgc2g=\a\ttail\u009b31m",
+		}},
+	}}}
+
+	for _, expand := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteTerminal(&buf, []*Transcript{transcript}, TerminalOptions{Color: true, Expand: expand}); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+
+		// Only the renderer's own colour codes may reach the terminal
+		stripped := out
+		for _, code := range []string{ansiReset, ansiBold, ansiDim, ansiRed, ansiGreen, ansiYellow, ansiCyan} {
+			stripped = strings.ReplaceAll(stripped, code, "")
+		}
+		if i := strings.IndexFunc(stripped, isControl); i >= 0 {
+			t.Errorf("expand=%v: control character %q reached the output:\n%q", expand, stripped[i], out)
+		}
+		for _, want := range []string{"title␛]0;pwned␇ here", "␛]52;c;", "\ttail<U+009B>31m"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expand=%v: expected %q made visible in:\n%q", expand, want, out)
+			}
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := wrap("one two three four\n  - five six seven\n\nsupercalifragilistic", 10)
+	want := []string{"one two", "three four", "  - five", "  six", "  seven", "", "supercalifragilistic"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("wrap = %q, want %q", got, want)
+	}
+}
+
+func TestWrite_UnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "pdf", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestSplitFences(t *testing.T) {
+	segments := splitFences("intro\n````md\n```inner```\n````\noutro\n```\nunterminated")
+
+	if len(segments) != 4 {
+		t.Fatalf("expected 4 segments, got %d: %+v", len(segments), segments)
+	}
+	if !segments[1].Code || segments[1].Lang != "md" || segments[1].Text != "```inner```" {
+		t.Errorf("unexpected code segment: %+v", segments[1])
+	}
+	if !segments[3].Code || segments[3].Text != "unterminated" {
+		t.Errorf("expected unterminated fence to render as code, got %+v", segments[3])
+	}
+}
+
+func TestNormalizeRemote_OpensSealedValues(t *testing.T) {
+	key, err := e2ee.NewKey(bytes.Repeat([]byte{7}, e2ee.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &api.ConversationResponse{
+		SessionID:   "s1",
+		ProjectPath: key.Seal("s1", e2ee.FieldProjectPath, "/-work-app"),
+		Messages: []api.Message{
+			{UUID: "u1", Role: "user", Timestamp: "2025-01-06T10:00:00Z", Content: key.Seal("s1", e2ee.MessageField("u1"), "why the retry loop?")},
+			{UUID: "a1", Role: "assistant", Timestamp: "2025-01-06T10:00:05Z", Content: "uploaded before encryption"},
+		},
+		Metadata: &api.SessionMetadata{CWD: key.Seal("s1", e2ee.FieldCWD, "/work/app"), ClaudeCodeVersion: "1.0.50"},
+	}
+
+	keys := e2ee.NewKeyring()
+	keys.Add(key, true)
+	tr, err := NormalizeRemote(conv, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Project != "/work/app" || len(tr.Entries) != 2 || tr.Entries[0].Text != "why the retry loop?" || tr.Entries[1].Text != "uploaded before encryption" {
+		t.Errorf("unexpected transcript: %+v", tr)
+	}
+
+	if _, err := NormalizeRemote(conv, nil); !errors.Is(err, e2ee.ErrUnknownKey) || !strings.Contains(err.Error(), "encryption recover") {
+		t.Errorf("expected a missing key to say how to recover it, got %v", err)
+	}
+}
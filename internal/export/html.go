@@ -0,0 +1,120 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// segment is a run of prose or a fenced code block within message text.
+type segment struct {
+	Code bool
+	Lang string
+	Text string
+}
+
+// splitFences separates fenced code blocks from the surrounding prose so
+// they can be rendered as <pre> blocks.
+func splitFences(text string) []segment {
+	var segments []segment
+	var current []string
+	fence := ""
+	lang := ""
+
+	flush := func(code bool) {
+		body := strings.Join(current, "\n")
+		if code || strings.TrimSpace(body) != "" {
+			segments = append(segments, segment{Code: code, Lang: lang, Text: strings.Trim(body, "\n")})
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && strings.HasPrefix(trimmed, "```"):
+			flush(false)
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+			lang = strings.TrimSpace(strings.TrimLeft(trimmed, "`"))
+		case fence != "" && trimmed == fence:
+			flush(true)
+			fence, lang = "", ""
+		default:
+			current = append(current, line)
+		}
+	}
+	// An unterminated fence still renders as code
+	flush(fence != "")
+
+	return segments
+}
+
+var htmlFuncs = template.FuncMap{
+	"segments":  splitFences,
+	"timestamp": formatTimestamp,
+	"input":     prettyInput,
+	"role":      roleTitle,
+	"join":      strings.Join,
+}
+
+var htmlTemplate = template.Must(template.New("export").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{if eq (len .) 1}}Session {{(index . 0).SessionID}}{{else}}{{len .}} sessions{{end}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 960px; margin: 2rem auto; padding: 0 1rem; color: #1f2328; line-height: 1.5; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1rem; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.25rem 1rem; }
+dt { font-weight: 600; }
+dd { margin: 0; }
+.entry { border: 1px solid #d0d7de; border-radius: 6px; margin: 1rem 0; padding: 0.75rem 1rem; }
+.entry.user { background: #f6f8fa; }
+.meta { color: #656d76; font-size: 0.85rem; margin-bottom: 0.5rem; }
+.prose { white-space: pre-wrap; }
+pre { background: #f6f8fa; border-radius: 6px; padding: 0.75rem; overflow-x: auto; }
+.entry.user pre { background: #eaeef2; }
+details { margin-top: 0.5rem; }
+summary { cursor: pointer; color: #0969da; }
+.error summary { color: #cf222e; }
+</style>
+</head>
+<body>
+{{range .}}
+<section class="session">
+<header>
+<h1>Session {{.SessionID}}</h1>
+<dl>
+<dt>Project</dt><dd><code>{{.Project}}</code></dd>
+{{if .GitBranches}}<dt>Branches</dt><dd>{{join .GitBranches " → "}}</dd>{{end}}
+{{if .Models}}<dt>Models</dt><dd>{{join .Models ", "}}</dd>{{end}}
+{{if .StartedAt}}<dt>Started</dt><dd>{{timestamp .StartedAt}}</dd><dt>Ended</dt><dd>{{timestamp .EndedAt}}</dd>{{end}}
+{{if .ClaudeCodeVersion}}<dt>Claude Code</dt><dd>{{.ClaudeCodeVersion}}</dd>{{end}}
+</dl>
+</header>
+{{range .Entries}}
+<article class="entry {{.Role}}" id="{{.UUID}}">
+<div class="meta"><strong>{{role .Role}}</strong>{{if .Model}} · {{.Model}}{{end}} · {{timestamp .Timestamp}}</div>
+{{range segments .Text}}{{if .Code}}<pre><code{{if .Lang}} class="language-{{.Lang}}"{{end}}>{{.Text}}</code></pre>
+{{else}}<div class="prose">{{.Text}}</div>
+{{end}}{{end}}
+{{range .ToolCalls}}<details{{if .IsError}} class="error"{{end}}>
+<summary>Tool call: {{.Name}}{{if .IsError}} (error){{end}}</summary>
+{{with input .Input}}<pre><code class="language-json">{{.}}</code></pre>{{end}}
+{{if .Result}}<p>Result:</p>
+<pre><code>{{.Result}}</code></pre>{{end}}
+</details>
+{{end}}
+</article>
+{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders transcripts as a single self-contained HTML page. Tool
+// calls are collapsed into <details> elements.
+func WriteHTML(w io.Writer, transcripts []*Transcript) error {
+	return htmlTemplate.Execute(w, transcripts)
+}
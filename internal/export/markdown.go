@@ -0,0 +1,86 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+func WriteMarkdown(w io.Writer, transcripts []*Transcript) error {
+	var b strings.Builder
+
+	for i, t := range transcripts {
+		if i > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		writeMarkdownTranscript(&b, t)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTranscript(b *strings.Builder, t *Transcript) {
+	fmt.Fprintf(b, "# Session %s\n\n", t.SessionID)
+	fmt.Fprintf(b, "- **Project:** `%s`\n", t.Project)
+	if len(t.GitBranches) > 0 {
+		fmt.Fprintf(b, "- **Branches:** %s\n", strings.Join(t.GitBranches, " → "))
+	}
+	if len(t.Models) > 0 {
+		fmt.Fprintf(b, "- **Models:** %s\n", strings.Join(t.Models, ", "))
+	}
+	if t.StartedAt != "" {
+		fmt.Fprintf(b, "- **Started:** %s\n", formatTimestamp(t.StartedAt))
+		fmt.Fprintf(b, "- **Ended:** %s\n", formatTimestamp(t.EndedAt))
+	}
+	if t.ClaudeCodeVersion != "" {
+		fmt.Fprintf(b, "- **Claude Code:** %s\n", t.ClaudeCodeVersion)
+	}
+
+	for _, e := range t.Entries {
+		heading := roleTitle(e.Role)
+		if e.Model != "" {
+			heading += " (" + e.Model + ")"
+		}
+		fmt.Fprintf(b, "\n## %s\n\n", heading)
+		fmt.Fprintf(b, "_%s_\n\n", formatTimestamp(e.Timestamp))
+
+		if e.Text != "" {
+			b.WriteString(e.Text)
+			b.WriteString("\n")
+		}
+
+		for _, call := range e.ToolCalls {
+			writeMarkdownToolCall(b, &call)
+		}
+	}
+}
+
+func writeMarkdownToolCall(b *strings.Builder, call *ToolCall) {
+	// The summary is raw HTML in Markdown, so the name must be escaped
+	summary := "Tool call: " + html.EscapeString(call.Name)
+	if call.IsError {
+		summary += " (error)"
+	}
+
+	fmt.Fprintf(b, "\n<details>\n<summary>%s</summary>\n\n", summary)
+	if input := prettyInput(call.Input); input != "" {
+		writeFence(b, "json", input)
+	}
+	if call.Result != "" {
+		b.WriteString("\nResult:\n\n")
+		writeFence(b, "", call.Result)
+	}
+	b.WriteString("\n</details>\n")
+}
+
+// writeFence writes a fenced code block whose fence is longer than any run
+// of backticks inside the content.
+func writeFence(b *strings.Builder, lang, content string) {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// NormalizeRemote converts a conversation fetched from the server into a
+// transcript, opening anything sealed with keys, which may be nil when
+// encryption was never set up here.
+func NormalizeRemote(conv *api.ConversationResponse, keys *e2ee.Keyring) (*Transcript, error) {
+	id := conv.SessionID
+	open := func(field, value string) (string, error) {
+		plain, err := keys.Open(id, field, value)
+		if errors.Is(err, e2ee.ErrUnknownKey) {
+			return "", fmt.Errorf("session %s is encrypted with %w; run 'claude-history-sync encryption recover' with its recovery phrase", id, err)
+		}
+		return plain, err
+	}
+
+	project, err := open(e2ee.FieldProjectPath, conv.ProjectPath)
+	if err != nil {
+		return nil, err
+	}
+	session := &sync.Session{
+		File:     sync.FileInfo{SessionID: id, ProjectPath: project},
+		Messages: make([]sync.Message, len(conv.Messages)),
+		Metadata: &sync.SessionMetadata{},
+	}
+	for i, m := range conv.Messages {
+		content, err := open(e2ee.MessageField(m.UUID), m.Content)
+		if err != nil {
+			return nil, err
+		}
+		session.Messages[i] = sync.Message{
+			UUID:      m.UUID,
+			Timestamp: m.Timestamp,
+			Role:      m.Role,
+			Content:   content,
+			Model:     m.Model,
+		}
+	}
+
+	if meta := conv.Metadata; meta != nil {
+		if session.File.SourceDir, err = open(e2ee.FieldSourceDir, meta.SourceDir); err != nil {
+			return nil, err
+		}
+		if session.Metadata.CWD, err = open(e2ee.FieldCWD, meta.CWD); err != nil {
+			return nil, err
+		}
+		if session.Metadata.GitRemote, err = open(e2ee.FieldGitRemote, meta.GitRemote); err != nil {
+			return nil, err
+		}
+		session.Metadata.Version = meta.ClaudeCodeVersion
+		session.Metadata.UserType = meta.UserType
+		session.Metadata.GitCommit = meta.GitCommit
+		for _, b := range meta.GitBranches {
+			session.Metadata.Branches = append(session.Metadata.Branches, sync.BranchSpan{
+				Branch:    b.Branch,
+				FirstSeen: b.FirstSeen,
+				LastSeen:  b.LastSeen,
+			})
+		}
+	}
+	return Normalize(session), nil
+}
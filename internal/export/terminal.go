@@ -0,0 +1,287 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used by the terminal renderer.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// TerminalOptions controls how transcripts are rendered for a terminal.
+type TerminalOptions struct {
+	Width  int  // wrap prose at this many columns; 0 disables wrapping
+	Color  bool // use ANSI colours
+	Expand bool // show tool inputs and results in full instead of a summary
+}
+
+// WriteTerminal renders transcripts for reading in a terminal. Prose is
+// word wrapped, code blocks are left as they are and tool calls are
+// collapsed to a one line summary unless opts.Expand is set.
+func WriteTerminal(w io.Writer, transcripts []*Transcript, opts TerminalOptions) error {
+	tw := &terminalWriter{opts: opts}
+
+	for i, t := range transcripts {
+		if i > 0 {
+			tw.line("")
+		}
+		tw.header(t)
+		for j := range t.Entries {
+			tw.entry(&t.Entries[j])
+		}
+	}
+
+	_, err := io.WriteString(w, tw.b.String())
+	return err
+}
+
+// WriteTerminalEntries renders entries without a session header. It is
+// used for entries appended while following a live session.
+func WriteTerminalEntries(w io.Writer, entries []Entry, opts TerminalOptions) error {
+	tw := &terminalWriter{opts: opts}
+	for i := range entries {
+		tw.entry(&entries[i])
+	}
+
+	_, err := io.WriteString(w, tw.b.String())
+	return err
+}
+
+type terminalWriter struct {
+	b    strings.Builder
+	opts TerminalOptions
+}
+
+func (tw *terminalWriter) style(codes, text string) string {
+	if !tw.opts.Color || text == "" {
+		return text
+	}
+	return codes + text + ansiReset
+}
+
+func (tw *terminalWriter) line(text string) {
+	tw.b.WriteString(text)
+	tw.b.WriteString("\n")
+}
+
+func (tw *terminalWriter) header(t *Transcript) {
+	tw.line(tw.style(ansiBold, "Session "+terminalSafe(t.SessionID)))
+
+	field := func(name, value string) {
+		if value != "" {
+			tw.line(tw.style(ansiDim, fmt.Sprintf("  %-12s", name)) + terminalSafe(value))
+		}
+	}
+	field("Project", t.Project)
+	field("Branches", strings.Join(t.GitBranches, " → "))
+	field("Models", strings.Join(t.Models, ", "))
+	if t.StartedAt != "" {
+		field("Started", formatTimestamp(t.StartedAt))
+		field("Ended", formatTimestamp(t.EndedAt))
+	}
+	field("Claude Code", t.ClaudeCodeVersion)
+}
+
+func roleColor(role string) string {
+	switch role {
+	case "user":
+		return ansiCyan
+	case "assistant":
+		return ansiGreen
+	default:
+		return ansiYellow
+	}
+}
+
+func (tw *terminalWriter) entry(e *Entry) {
+	title := roleTitle(e.Role)
+	if e.Model != "" {
+		title += " (" + terminalSafe(e.Model) + ")"
+	}
+	meta := " · " + formatTimestamp(e.Timestamp)
+
+	rule := "── "
+	if width := tw.opts.Width; width > 0 {
+		used := utf8.RuneCountInString(rule+title+meta) + 1
+		if used < width {
+			meta += " " + strings.Repeat("─", width-used)
+		}
+	}
+
+	tw.line("")
+	tw.line(tw.style(ansiDim, rule) + tw.style(ansiBold+roleColor(e.Role), title) + tw.style(ansiDim, meta))
+
+	for _, seg := range splitFences(terminalSafe(e.Text)) {
+		if seg.Code {
+			for _, l := range strings.Split(seg.Text, "\n") {
+				tw.line(tw.style(ansiDim, "  │ ") + l)
+			}
+			continue
+		}
+		for _, l := range wrap(seg.Text, tw.opts.Width) {
+			tw.line(l)
+		}
+	}
+
+	for i := range e.ToolCalls {
+		tw.toolCall(&e.ToolCalls[i])
+	}
+}
+
+func (tw *terminalWriter) toolCall(call *ToolCall) {
+	// Tool result entries carry results without the call that produced them
+	if name := terminalSafe(call.Name); name != "" {
+		if tw.opts.Expand {
+			tw.line(tw.style(ansiYellow, "  ▸ "+name))
+			tw.indented(terminalSafe(prettyInput(call.Input)), "    ")
+		} else {
+			summary := "  ▸ " + name
+			if input := terminalSafe(compactInput(call.Input)); input != "" {
+				summary += "  " + input
+			}
+			tw.line(tw.style(ansiYellow, truncateRunes(summary, tw.opts.Width)))
+		}
+	}
+
+	if call.Result == "" && !call.IsError {
+		return
+	}
+
+	color := ansiDim
+	prefix := "  ⎿ "
+	if call.IsError {
+		color = ansiRed
+		prefix = "  ⎿ error: "
+	}
+
+	result := terminalSafe(call.Result)
+	if tw.opts.Expand {
+		tw.line(tw.style(color, strings.TrimRight(prefix, " ")))
+		tw.indented(result, "    ")
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
+	summary := prefix + strings.TrimSpace(lines[0])
+	if more := len(lines) - 1; more > 0 {
+		suffix := fmt.Sprintf(" … +%d lines", more)
+		if more == 1 {
+			suffix = " … +1 line"
+		}
+		summary = truncateRunes(summary, tw.opts.Width-utf8.RuneCountInString(suffix)) + suffix
+	} else {
+		summary = truncateRunes(summary, tw.opts.Width)
+	}
+	tw.line(tw.style(color, summary))
+}
+
+func (tw *terminalWriter) indented(text, indent string) {
+	if text == "" {
+		return
+	}
+	for _, l := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		tw.line(indent + l)
+	}
+}
+
+// terminalSafe makes control characters in session text visible, so that
+// escape sequences in a message or tool output, like a fetched page or a
+// build log, can't retitle the terminal, write to the clipboard or hide
+// text. Newlines and tabs are kept, and so are Windows line endings.
+func terminalSafe(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.IndexFunc(text, isControl) < 0 {
+		return text
+	}
+
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case !isControl(r):
+			b.WriteRune(r)
+		case r < 0x20:
+			// The Control Pictures block has a symbol for each, like ␛
+			b.WriteRune(0x2400 + r)
+		case r == 0x7f:
+			b.WriteRune('␡')
+		default:
+			fmt.Fprintf(&b, "<U+%04X>", r)
+		}
+	}
+	return b.String()
+}
+
+// isControl reports whether r is a C0 or C1 control character other than
+// a newline or tab.
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\n' && r != '\t') || (r >= 0x7f && r < 0xa0)
+}
+
+// wrap word wraps text to width columns. Each line keeps its leading
+// indentation, which is repeated on the lines it wraps onto. Words longer
+// than the width are left whole.
+func wrap(text string, width int) []string {
+	lines := strings.Split(text, "\n")
+	if width <= 0 {
+		return lines
+	}
+
+	var out []string
+	for _, l := range lines {
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		words := strings.Fields(l)
+		if len(words) == 0 {
+			out = append(out, "")
+			continue
+		}
+
+		current := indent + words[0]
+		n := utf8.RuneCountInString(current)
+		for _, word := range words[1:] {
+			wn := utf8.RuneCountInString(word)
+			if n+1+wn > width {
+				out = append(out, current)
+				current = indent + word
+				n = utf8.RuneCountInString(current)
+				continue
+			}
+			current += " " + word
+			n += 1 + wn
+		}
+		out = append(out, current)
+	}
+	return out
+}
+
+func compactInput(input json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, input); err != nil {
+		return strings.Join(strings.Fields(string(input)), " ")
+	}
+	return b.String()
+}
+
+// truncateRunes shortens text to at most width characters, marking the cut
+// with an ellipsis. A width of zero or less leaves text unchanged.
+func truncateRunes(text string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	if width == 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
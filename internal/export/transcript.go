@@ -0,0 +1,192 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// Transcript is the normalized, renderer-neutral form of a session. It is
+// also the schema of the JSON export format.
+type Transcript struct {
+	SessionID         string   `json:"session_id"`
+	Project           string   `json:"project"`
+	SourceDir         string   `json:"source_dir,omitempty"`
+	ClaudeCodeVersion string   `json:"claude_code_version,omitempty"`
+	GitBranches       []string `json:"git_branches,omitempty"`
+	StartedAt         string   `json:"started_at,omitempty"`
+	EndedAt           string   `json:"ended_at,omitempty"`
+	Models            []string `json:"models,omitempty"`
+	Entries           []Entry  `json:"entries"`
+}
+
+// Entry is one turn of the conversation. Assistant responses that Claude
+// Code split over several records are merged back into one entry, and tool
+// results are attached to the tool call that produced them.
+type Entry struct {
+	UUID      string     `json:"uuid"`
+	Timestamp string     `json:"timestamp"`
+	Role      string     `json:"role"`
+	Model     string     `json:"model,omitempty"`
+	Text      string     `json:"text,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// RoleTool marks an entry holding tool results whose calls aren't part of
+// the transcript.
+const RoleTool = "tool"
+
+type ToolCall struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input,omitempty"`
+	Result  string          `json:"result,omitempty"`
+	IsError bool            `json:"is_error,omitempty"`
+}
+
+// Normalize converts a parsed session into a Transcript.
+func Normalize(session *sync.Session) *Transcript {
+	t := &Transcript{
+		SessionID: session.File.SessionID,
+		Project:   session.Project(),
+		SourceDir: session.File.SourceDir,
+	}
+
+	if meta := session.Metadata; meta != nil {
+		t.ClaudeCodeVersion = meta.Version
+		for _, b := range meta.Branches {
+			t.GitBranches = append(t.GitBranches, b.Branch)
+		}
+	}
+
+	// Tool results arrive in later user records; collect them by tool use
+	// ID and attach them to their calls once all entries are built.
+	results := make(map[string]*ToolCall)
+	calls := make(map[string]bool)
+	models := make(map[string]bool)
+	lastResponseID := ""
+
+	for i := range session.Messages {
+		msg := &session.Messages[i]
+
+		if t.StartedAt == "" {
+			t.StartedAt = msg.Timestamp
+		}
+		t.EndedAt = msg.Timestamp
+		if msg.Model != "" && !models[msg.Model] {
+			models[msg.Model] = true
+			t.Models = append(t.Models, msg.Model)
+		}
+
+		if collectResults(msg, results) {
+			// Results for calls outside this set of messages (a later batch
+			// when following a live session) get an entry of their own
+			if orphans := orphanResults(msg, calls); len(orphans) > 0 {
+				t.Entries = append(t.Entries, Entry{
+					UUID:      msg.UUID,
+					Timestamp: msg.Timestamp,
+					Role:      RoleTool,
+					ToolCalls: orphans,
+				})
+				lastResponseID = ""
+			}
+			continue
+		}
+
+		var entry *Entry
+		if msg.ResponseID != "" && msg.ResponseID == lastResponseID && len(t.Entries) > 0 {
+			entry = &t.Entries[len(t.Entries)-1]
+		} else {
+			t.Entries = append(t.Entries, Entry{
+				UUID:      msg.UUID,
+				Timestamp: msg.Timestamp,
+				Role:      msg.Role,
+				Model:     msg.Model,
+			})
+			entry = &t.Entries[len(t.Entries)-1]
+		}
+		lastResponseID = msg.ResponseID
+
+		appendContent(entry, msg)
+		for _, call := range entry.ToolCalls {
+			calls[call.ID] = true
+		}
+	}
+
+	// Drop entries left empty (thinking-only records, for example) and
+	// attach tool results to their calls
+	entries := t.Entries[:0]
+	for _, entry := range t.Entries {
+		if entry.Text == "" && len(entry.ToolCalls) == 0 {
+			continue
+		}
+		for j := range entry.ToolCalls {
+			call := &entry.ToolCalls[j]
+			if result, ok := results[call.ID]; ok {
+				call.Result = result.Result
+				call.IsError = result.IsError
+			}
+		}
+		entries = append(entries, entry)
+	}
+	t.Entries = entries
+
+	return t
+}
+
+// collectResults records the tool results carried by a message. It reports
+// whether the message held nothing but tool results, in which case it
+// doesn't get an entry of its own.
+func collectResults(msg *sync.Message, results map[string]*ToolCall) bool {
+	if len(msg.Blocks) == 0 {
+		return false
+	}
+
+	onlyResults := true
+	for _, b := range msg.Blocks {
+		if b.Type != "tool_result" {
+			onlyResults = false
+			continue
+		}
+		results[b.ID] = &ToolCall{ID: b.ID, Result: b.Text, IsError: b.IsError}
+	}
+	return onlyResults
+}
+
+func orphanResults(msg *sync.Message, calls map[string]bool) []ToolCall {
+	var orphans []ToolCall
+	for _, b := range msg.Blocks {
+		if b.Type == "tool_result" && !calls[b.ID] {
+			orphans = append(orphans, ToolCall{ID: b.ID, Result: b.Text, IsError: b.IsError})
+		}
+	}
+	return orphans
+}
+
+func appendContent(entry *Entry, msg *sync.Message) {
+	if len(msg.Blocks) == 0 {
+		entry.Text = joinText(entry.Text, msg.Content)
+		return
+	}
+
+	for _, b := range msg.Blocks {
+		switch b.Type {
+		case "text":
+			entry.Text = joinText(entry.Text, b.Text)
+		case "tool_use":
+			entry.ToolCalls = append(entry.ToolCalls, ToolCall{ID: b.ID, Name: b.Name, Input: b.Input})
+		}
+	}
+}
+
+func joinText(existing, text string) string {
+	text = strings.TrimSpace(text)
+	if existing == "" {
+		return text
+	}
+	if text == "" {
+		return existing
+	}
+	return existing + "\n\n" + text
+}
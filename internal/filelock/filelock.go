@@ -0,0 +1,106 @@
+// Package filelock implements the lock files processes use to take turns
+// at something, like refreshing tokens or updating a sync state file.
+// Creating a file that must not exist works the same on every platform,
+// unlike flock.
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often a process waiting for a lock checks whether
+// it has been released.
+const pollInterval = 100 * time.Millisecond
+
+// Acquire takes an exclusive lock by creating path, waiting for another
+// holder to release it until ctx is done. A lock file not touched for
+// staleAge is taken to be left over from a process that crashed holding
+// it, and is taken over; while the lock is held its time is kept fresh, so
+// a holder that runs longer than staleAge isn't mistaken for one. The
+// returned function releases the lock.
+func Acquire(ctx context.Context, path string, staleAge time.Duration) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating lock directory: %w", err)
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return hold(path, staleAge), nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating lock file: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleAge {
+			// Whoever held it is gone; clear it and race for it again
+			if removeStale(path, info) {
+				slog.Warn("removed stale lock", "path", path)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// removeStale removes the lock file at path if it is still the stale one
+// described by stale. Another waiter may have removed that already and
+// taken the lock with a fresh file, so rather than remove whatever is at
+// path, it moves the file aside, which only one process can do, and puts
+// it back if it turns out to be a different file.
+func removeStale(path string, stale os.FileInfo) bool {
+	aside := fmt.Sprintf("%s.%d.%d.stale", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, aside); err != nil {
+		return false
+	}
+	defer os.Remove(aside)
+
+	// A new file can reuse the inode, but not the old time
+	moved, err := os.Stat(aside)
+	if err == nil && os.SameFile(moved, stale) && moved.ModTime().Equal(stale.ModTime()) {
+		return true
+	}
+	// Linking fails if yet another process has created the lock since
+	os.Link(aside, path)
+	return false
+}
+
+// hold keeps the lock at path fresh until the returned function releases
+// it.
+func hold(path string, staleAge time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(staleAge / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,76 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+
+	release, err := Acquire(context.Background(), path, time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a held lock to block, got %v", err)
+	}
+
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected release to remove the lock file, got %v", err)
+	}
+}
+
+func TestAcquire_KeepsLongHoldFresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+	staleAge := 400 * time.Millisecond
+
+	release, err := Acquire(context.Background(), path, staleAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Held for well past staleAge, the lock must still not be taken over
+	ctx, cancel := context.WithTimeout(context.Background(), 3*staleAge)
+	defer cancel()
+	if _, err := Acquire(ctx, path, staleAge); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a lock still held to block, got %v", err)
+	}
+}
+
+func TestRemoveStale_LeavesFreshLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+	old := time.Now().Add(-time.Hour)
+	os.WriteFile(path, []byte("1\n"), 0600)
+	os.Chtimes(path, old, old)
+	stale, _ := os.Stat(path)
+
+	// Another waiter saw the same stale file, removed it and took the lock
+	os.Remove(path)
+	os.WriteFile(path, []byte("2\n"), 0600)
+	if removeStale(path, stale) {
+		t.Error("expected the fresh lock not to be taken for the stale one")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "2\n" {
+		t.Fatalf("expected the fresh lock left in place, got %q, %v", data, err)
+	}
+
+	// The fresh lock goes stale in turn, and is removed
+	os.Chtimes(path, old, old)
+	stale, _ = os.Stat(path)
+	if !removeStale(path, stale) {
+		t.Error("expected the stale lock to be removed")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+		t.Errorf("expected nothing left behind, got %d files", len(entries))
+	}
+}
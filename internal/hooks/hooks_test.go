@@ -0,0 +1,220 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadInput(t *testing.T) {
+	in, err := ReadInput(strings.NewReader(`{"session_id":"abc","transcript_path":"/home/u/.claude/projects/-w/abc.jsonl","hook_event_name":"Stop","stop_hook_active":false}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if in.SessionID != "abc" || in.HookEventName != "Stop" || !strings.HasSuffix(in.TranscriptPath, "abc.jsonl") {
+		t.Errorf("unexpected input: %+v", in)
+	}
+
+	if _, err := ReadInput(strings.NewReader(`{"session_id":"abc"}`)); err == nil {
+		t.Error("expected error without transcript_path")
+	}
+	if _, err := ReadInput(strings.NewReader(`not json`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if got := Command("/usr/local/bin/claude-history-sync"); got != "/usr/local/bin/claude-history-sync hook" {
+		t.Errorf("unexpected command: %s", got)
+	}
+	if got := Command("/Users/Jo O'Neil/bin/claude-history-sync"); got != `'/Users/Jo O'\''Neil/bin/claude-history-sync' hook` {
+		t.Errorf("unexpected quoted command: %s", got)
+	}
+	if !IsSyncHook(Command("/Users/Jo O'Neil/bin/claude-history-sync")) {
+		t.Error("expected quoted command to be recognised")
+	}
+	if IsSyncHook("claude-history-sync sync") || IsSyncHook("./notify hook") {
+		t.Error("unexpected match for unrelated commands")
+	}
+}
+
+func readSettings(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("invalid settings JSON: %v\n%s", err, data)
+	}
+	return settings
+}
+
+func commands(settings map[string]interface{}, event string) []string {
+	var out []string
+	hooks, _ := settings["hooks"].(map[string]interface{})
+	groups, _ := hooks[event].([]interface{})
+	for _, g := range groups {
+		entries, _ := g.(map[string]interface{})["hooks"].([]interface{})
+		for _, e := range entries {
+			out = append(out, e.(map[string]interface{})["command"].(string))
+		}
+	}
+	return out
+}
+
+func TestInstall_NewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".claude", "settings.json")
+
+	changed, err := Install(path, "/bin/claude-history-sync hook")
+	if err != nil || !changed {
+		t.Fatalf("expected change, got %v, %v", changed, err)
+	}
+
+	settings := readSettings(t, path)
+	for _, event := range Events {
+		if got := commands(settings, event); len(got) != 1 || got[0] != "/bin/claude-history-sync hook" {
+			t.Errorf("%s: unexpected hooks %v", event, got)
+		}
+	}
+
+	changed, err = Install(path, "/bin/claude-history-sync hook")
+	if err != nil || changed {
+		t.Errorf("expected second install to be a no-op, got %v, %v", changed, err)
+	}
+}
+
+func TestInstall_KeepsExistingSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	existing := `{
+  "model": "opus",
+  "cleanupPeriodDays": 90,
+  "hooks": {
+    "Stop": [
+      {"hooks": [{"type": "command", "command": "say done"}, {"type": "command", "command": "/old/path/claude-history-sync hook"}]}
+    ],
+    "PreToolUse": [
+      {"matcher": "Bash", "hooks": [{"type": "command", "command": "./check-bash"}]}
+    ]
+  }
+}`
+	if err := os.WriteFile(path, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Install(path, "/new/claude-history-sync hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := readSettings(t, path)
+	if settings["model"] != "opus" || settings["cleanupPeriodDays"] != float64(90) {
+		t.Errorf("expected other settings to be kept, got %v", settings)
+	}
+	if got := strings.Join(commands(settings, "Stop"), ","); got != "say done,/new/claude-history-sync hook" {
+		t.Errorf("expected old sync hook replaced and others kept, got %s", got)
+	}
+	if got := commands(settings, "PreToolUse"); len(got) != 1 || got[0] != "./check-bash" {
+		t.Errorf("expected unrelated hooks kept, got %v", got)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected file mode to be kept, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if backup, err := os.ReadFile(path + ".bak"); err != nil || string(backup) != existing {
+		t.Errorf("expected backup of the previous settings: %v", err)
+	}
+
+	changed, err := Uninstall(path, "/new/claude-history-sync hook")
+	if err != nil || !changed {
+		t.Fatalf("expected uninstall to change the file, got %v, %v", changed, err)
+	}
+	settings = readSettings(t, path)
+	if got := commands(settings, "Stop"); len(got) != 1 || got[0] != "say done" {
+		t.Errorf("expected only the sync hook removed, got %v", got)
+	}
+	hooks := settings["hooks"].(map[string]interface{})
+	if _, ok := hooks["SessionEnd"]; ok {
+		t.Error("expected events left empty to be removed")
+	}
+}
+
+func TestInstall_KeepsLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	existing := `{
+  "permissions": {
+    "allow": [
+      "Bash(npm test)"
+    ]
+  },
+  "model": "opus",
+  "hooks": {
+    "Stop": [
+      {
+        "matcher": "",
+        "hooks": [
+          {
+            "type": "command",
+            "command": "make lint && notify-send done < /dev/null"
+          }
+        ]
+      }
+    ]
+  },
+  "cleanupPeriodDays": 90
+}
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Install(path, "/bin/claude-history-sync hook"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Uninstall(path, "/bin/claude-history-sync hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys stay in order and commands aren't escaped, so nothing else moves
+	if data, _ := os.ReadFile(path); string(data) != existing {
+		t.Errorf("expected install and uninstall to leave the file as it was, got:\n%s", data)
+	}
+}
+
+func TestUninstall_RenamedExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if _, err := Install(path, "/opt/chs hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := Uninstall(path, "/opt/chs hook")
+	if err != nil || !changed {
+		t.Fatalf("expected uninstall to change the file, got %v, %v", changed, err)
+	}
+	if settings := readSettings(t, path); settings["hooks"] != nil {
+		t.Errorf("expected empty hooks to be removed, got %v", settings["hooks"])
+	}
+}
+
+func TestInstall_InvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte(`{"hooks": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Install(path, "claude-history-sync hook"); err == nil {
+		t.Error("expected error for invalid settings")
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"hooks": ` {
+		t.Error("expected invalid settings to be left untouched")
+	}
+}
+
+func TestUninstall_MissingFile(t *testing.T) {
+	changed, err := Uninstall(filepath.Join(t.TempDir(), "settings.json"), "claude-history-sync hook")
+	if err != nil || changed {
+		t.Errorf("expected no-op, got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,43 @@
+// Package hooks integrates with Claude Code's hook system: it parses the
+// event JSON Claude Code passes to hook commands and installs the sync hook
+// into Claude Code's settings.json.
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Events the sync hook is installed for. Stop fires after every response,
+// SessionEnd when a session closes and PreCompact before the transcript is
+// compacted.
+var Events = []string{"Stop", "SessionEnd", "PreCompact"}
+
+// Input is the subset of the hook event JSON that the sync hook uses.
+type Input struct {
+	SessionID      string `json:"session_id"`
+	TranscriptPath string `json:"transcript_path"`
+	HookEventName  string `json:"hook_event_name"`
+	CWD            string `json:"cwd"`
+}
+
+// maxInputSize bounds how much of stdin is read; hook events are small.
+const maxInputSize = 1 << 20
+
+func ReadInput(r io.Reader) (*Input, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxInputSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading hook input: %w", err)
+	}
+
+	var in Input
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("parsing hook input: %w", err)
+	}
+	if in.TranscriptPath == "" {
+		return nil, fmt.Errorf("hook input has no transcript_path")
+	}
+
+	return &in, nil
+}
@@ -0,0 +1,281 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookTimeout is the timeout, in seconds, Claude Code is given for the
+// hook command. The command enforces its own, shorter budget.
+const hookTimeout = 30
+
+// SettingsPath returns Claude Code's user settings file, honouring
+// CLAUDE_CONFIG_DIR. Only the first entry of a list is used, since that is
+// where Claude Code itself reads settings from.
+func SettingsPath() string {
+	if dirs := filepath.SplitList(os.Getenv("CLAUDE_CONFIG_DIR")); len(dirs) > 0 && dirs[0] != "" {
+		return filepath.Join(dirs[0], "settings.json")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".claude", "settings.json")
+	}
+	return filepath.Join(home, ".claude", "settings.json")
+}
+
+// Command builds the hook command line for an executable path.
+func Command(executable string) string {
+	return shellQuote(executable) + " hook"
+}
+
+// IsSyncHook reports whether a hook command runs this tool's hook
+// subcommand, whatever path it was installed from.
+func IsSyncHook(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || fields[len(fields)-1] != "hook" {
+		return false
+	}
+	return strings.Contains(command, "claude-history-sync")
+}
+
+// Install adds command as a hook for each of Events in the settings file at
+// path, creating the file if needed. Existing hooks and settings are kept;
+// an older sync hook (from a different install path, say) is replaced. It
+// reports whether the file changed.
+func Install(path, command string) (bool, error) {
+	settings, err := load(path)
+	if err != nil {
+		return false, err
+	}
+
+	hooks, _ := settings.get("hooks").(*object)
+	if hooks == nil {
+		hooks = newObject()
+	}
+
+	changed := false
+	for _, event := range Events {
+		groups, _ := hooks.get(event).([]interface{})
+		groups, removed := removeHooks(groups, func(c string) bool {
+			return IsSyncHook(c) && c != command
+		})
+		if present(groups, command) {
+			if removed {
+				hooks.set(event, groups)
+				changed = true
+			}
+			continue
+		}
+
+		entry := newObject()
+		entry.set("type", "command")
+		entry.set("command", command)
+		entry.set("timeout", hookTimeout)
+		group := newObject()
+		group.set("hooks", []interface{}{entry})
+		hooks.set(event, append(groups, group))
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	settings.set("hooks", hooks)
+	return true, save(path, settings)
+}
+
+// Uninstall removes every sync hook, and any hook running command, from
+// the settings file, leaving other hooks in place. It reports whether the
+// file changed.
+func Uninstall(path, command string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	settings, err := load(path)
+	if err != nil {
+		return false, err
+	}
+
+	hooks, _ := settings.get("hooks").(*object)
+	if hooks == nil {
+		return false, nil
+	}
+	changed := false
+	for _, event := range append([]string(nil), hooks.keys...) {
+		groups, _ := hooks.get(event).([]interface{})
+		groups, removed := removeHooks(groups, func(c string) bool {
+			return IsSyncHook(c) || c == command
+		})
+		if !removed {
+			continue
+		}
+		changed = true
+		if len(groups) == 0 {
+			hooks.delete(event)
+		} else {
+			hooks.set(event, groups)
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if hooks.len() == 0 {
+		settings.delete("hooks")
+	}
+	return true, save(path, settings)
+}
+
+// present reports whether command is already configured in a group.
+func present(groups []interface{}, command string) bool {
+	for _, g := range groups {
+		group, ok := g.(*object)
+		if !ok {
+			continue
+		}
+		entries, _ := group.get("hooks").([]interface{})
+		for _, e := range entries {
+			if entry, ok := e.(*object); ok && entry.get("command") == command {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeHooks drops the hooks whose command matches, then any groups left
+// without hooks. Groups without matching hooks are left untouched.
+func removeHooks(groups []interface{}, match func(command string) bool) ([]interface{}, bool) {
+	removed := false
+	var out []interface{}
+
+	for _, g := range groups {
+		group, ok := g.(*object)
+		if !ok {
+			out = append(out, g)
+			continue
+		}
+		entries, _ := group.get("hooks").([]interface{})
+
+		var kept []interface{}
+		for _, e := range entries {
+			var command string
+			if entry, ok := e.(*object); ok {
+				command, _ = entry.get("command").(string)
+			}
+			if match(command) {
+				removed = true
+				continue
+			}
+			kept = append(kept, e)
+		}
+
+		if len(kept) == len(entries) {
+			out = append(out, g)
+			continue
+		}
+		if len(kept) > 0 {
+			group.set("hooks", kept)
+			out = append(out, group)
+		}
+	}
+
+	return out, removed
+}
+
+// load reads the settings file, keeping its keys in order so that saving
+// it back only changes the hooks.
+func load(path string) (*object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newObject(), nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return newObject(), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // Keep numbers exactly as written
+	value, err := decodeValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	settings, ok := value.(*object)
+	if !ok {
+		return nil, fmt.Errorf("parsing %s: expected a JSON object", path)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("parsing %s: unexpected data after the settings", path)
+	}
+	return settings, nil
+}
+
+// save writes settings back atomically, keeping a backup of the previous
+// file alongside it. A symlinked settings file (kept in a dotfiles
+// repository, say) is written through rather than replaced.
+func save(path string, settings *object) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(settings); err != nil {
+		return fmt.Errorf("encoding settings: %w", err)
+	}
+	data := buf.Bytes()
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		previous, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := os.WriteFile(path+".bak", previous, mode); err != nil {
+			return fmt.Errorf("writing backup: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating settings directory: %w", err)
+	}
+
+	// Atomic write: write to temp file then rename
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, mode); err != nil {
+		return fmt.Errorf("writing temp settings file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming settings file: %w", err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes a path for the shell Claude Code runs hook commands in,
+// leaving ordinary paths as they are.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-+:@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
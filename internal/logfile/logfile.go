@@ -0,0 +1,71 @@
+// Package logfile manages the size-rotated log files written by scheduled
+// runs.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Rotation defaults: a log is rotated once it passes 5 MB, and three old
+// logs are kept.
+const (
+	DefaultMaxSize = 5 << 20
+	DefaultKeep    = 3
+)
+
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".claude-history-sync/sync.log"
+	}
+	return filepath.Join(home, ".claude-history-sync", "sync.log")
+}
+
+// Open opens the log at path for appending, creating it and its directory
+// if needed. If the log has grown past maxSize it is rotated first: path
+// becomes path.1, path.1 becomes path.2 and so on, keeping at most keep old
+// logs. Rotation only happens here, so a single run never splits across
+// files.
+func Open(path string, maxSize int64, keep int) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() > maxSize {
+		if err := rotate(path, keep); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	return f, nil
+}
+
+func rotate(path string, keep int) error {
+	if keep <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing log file: %w", err)
+		}
+		return nil
+	}
+
+	// Drop the oldest, then shift the rest up by one
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, keep)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing old log file: %w", err)
+	}
+	for i := keep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotating log file: %w", err)
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	return nil
+}
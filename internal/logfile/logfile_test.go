@@ -0,0 +1,70 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpen_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "sync.log")
+
+	write := func(text string) {
+		t.Helper()
+		f, err := Open(path, 10, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+
+	write("run 1 is long\n") // creates the file; now over the limit
+	write("run 2 is long\n") // rotates run 1 to .1
+	write("run 3 is long\n") // rotates run 1 to .2, run 2 to .1
+	write("run 4 is long\n") // run 1 is dropped
+
+	if got := read(path); got != "run 4 is long\n" {
+		t.Errorf("unexpected current log: %q", got)
+	}
+	if got := read(path + ".1"); got != "run 3 is long\n" {
+		t.Errorf("unexpected .1 log: %q", got)
+	}
+	if got := read(path + ".2"); got != "run 2 is long\n" {
+		t.Errorf("unexpected .2 log: %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected no more than 2 old logs")
+	}
+}
+
+func TestOpen_AppendsBelowLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.log")
+
+	for i := 0; i < 3; i++ {
+		f, err := Open(path, 1024, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("run\n")
+		f.Close()
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "run\n") != 3 {
+		t.Errorf("expected 3 appended runs, got %q", data)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("expected no rotation below the size limit")
+	}
+}
@@ -0,0 +1,102 @@
+// Package logging sets up the structured log written alongside the CLI's
+// output: how much of it there is, how it's formatted and where it goes.
+// Packages log through log/slog's default logger, using the keys below for
+// the same things so records from one run can be filtered and joined up.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/logfile"
+	"golang.org/x/term"
+)
+
+// Keys shared by records across packages.
+const (
+	KeyProfile  = "profile"
+	KeySession  = "session_id"
+	KeyProject  = "project"
+	KeyMessages = "messages"
+	KeyBytes    = "bytes"
+	KeyDuration = "duration"
+	KeyError    = "error"
+)
+
+// Formats a log can be written in.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options choose the log. The zero value logs warnings and errors as text
+// on stderr when it's a terminal, and everything from info up otherwise.
+type Options struct {
+	// Level is debug, info, warn or error. Empty means info for a log
+	// file or a stderr that isn't a terminal, like under cron or
+	// systemd, and warn for a terminal, where the output says the rest.
+	Level string
+	// Format is text or json; empty means text
+	Format string
+	// File is a log file, rotated by size like scheduled runs' logs;
+	// empty means stderr
+	File string
+}
+
+// Setup installs the logger opts describe as slog's default. A log file
+// stays open until the process exits.
+func Setup(opts Options) error {
+	var out io.Writer = stderr{}
+	toFile := !term.IsTerminal(int(os.Stderr.Fd()))
+	if opts.File != "" {
+		f, err := logfile.Open(opts.File, logfile.DefaultMaxSize, logfile.DefaultKeep)
+		if err != nil {
+			return err
+		}
+		out, toFile = f, true
+	}
+
+	level := slog.LevelWarn
+	if toFile {
+		level = slog.LevelInfo
+	}
+	if opts.Level != "" {
+		if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", opts.Level)
+		}
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: durationString}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case FormatText, "":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", opts.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// durationString writes durations as the text handler does, like 1.5s,
+// rather than the JSON handler's nanoseconds.
+func durationString(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		a.Value = slog.StringValue(a.Value.Duration().String())
+	}
+	return a
+}
+
+// stderr writes to whatever os.Stderr is at the time, so the log follows
+// it when sync --log-file points it at a file.
+type stderr struct{}
+
+func (stderr) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func restoreDefault(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+}
+
+func TestSetup_JSONFile(t *testing.T) {
+	restoreDefault(t)
+	path := filepath.Join(t.TempDir(), "logs", "sync.log")
+	if err := Setup(Options{Format: FormatJSON, File: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	slog.Debug("not at the default level")
+	slog.Info("session synced", KeySession, "s1", KeyProject, "/src/app", KeyBytes, 2048, KeyDuration, 1500*time.Millisecond)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected one record at the default info level, got:\n%s", data)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(lines[0], &record); err != nil {
+		t.Fatalf("record isn't JSON: %v\n%s", err, lines[0])
+	}
+	if record["msg"] != "session synced" || record[KeySession] != "s1" || record[KeyProject] != "/src/app" || record[KeyBytes] != float64(2048) || record[KeyDuration] != "1.5s" {
+		t.Errorf("unexpected record: %s", lines[0])
+	}
+}
+
+func TestSetup_Level(t *testing.T) {
+	restoreDefault(t)
+	path := filepath.Join(t.TempDir(), "sync.log")
+	if err := Setup(Options{Level: "debug", File: path}); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("scanning", "path", "/src")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "level=DEBUG msg=scanning path=/src") {
+		t.Errorf("expected a text debug record, got %q", data)
+	}
+}
+
+func TestSetup_Invalid(t *testing.T) {
+	restoreDefault(t)
+	if err := Setup(Options{Level: "loud"}); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+	if err := Setup(Options{Format: "xml"}); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
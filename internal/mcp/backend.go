@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/export"
+	"github.com/martinjt/claude-history-cli/internal/search"
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// Session sources reported in SessionSummary.
+const (
+	SourceLocal  = "local"
+	SourceRemote = "remote"
+)
+
+// Backend answers the queries behind the MCP tools.
+type Backend interface {
+	Search(ctx context.Context, q search.Query) ([]search.Hit, error)
+	ListSessions(ctx context.Context, opts ListOptions) ([]SessionSummary, error)
+	GetSession(ctx context.Context, id string) (*export.Transcript, error)
+}
+
+type ListOptions struct {
+	Project string // substring of the session's project path
+	Since   time.Time
+	Limit   int
+}
+
+// SessionSummary is one entry of list_sessions. Remote sessions only carry
+// what the server's conversation list returns: their ID and last update.
+type SessionSummary struct {
+	SessionID string `json:"session_id"`
+	Source    string `json:"source"`
+	Project   string `json:"project,omitempty"`
+	StartedAt string `json:"started_at,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+	Messages  int    `json:"messages,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// RemoteLister lists and fetches the conversations stored on the sync
+// server. *api.Client satisfies it.
+type RemoteLister interface {
+	GetConversations(ctx context.Context) (*api.ConversationsListResponse, error)
+	GetConversation(ctx context.Context, sessionID string) (*api.ConversationResponse, error)
+}
+
+// LocalBackend serves the conversation files in the local data directories
+// and the on-disk search index. If Remote is set, list_sessions also
+// includes sessions that were synced from other machines, and get_session
+// fetches those from the server.
+type LocalBackend struct {
+	DataDirs        []string
+	ExcludePatterns []string
+	IndexPath       string
+	Remote          RemoteLister
+	// Keys open sessions fetched from the server that were sealed with
+	// encrypt_content; nil if there are none here
+	Keys *e2ee.Keyring
+}
+
+func (b *LocalBackend) scan() ([]sync.FileInfo, error) {
+	files, err := sync.ScanDirs(b.DataDirs, b.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("scanning files: %w", err)
+	}
+	return files, nil
+}
+
+func (b *LocalBackend) Search(ctx context.Context, q search.Query) ([]search.Hit, error) {
+	files, err := b.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := search.Load(b.IndexPath)
+	if err != nil {
+		idx = search.New() // Rebuild a corrupt index rather than failing
+	}
+
+	// Catch up with anything written since the last sync. Saving is best
+	// effort; the next search or sync retries it.
+	if result := idx.Update(files); result.Changed() {
+		_ = idx.Save(b.IndexPath)
+	}
+
+	return idx.Search(q), nil
+}
+
+func (b *LocalBackend) ListSessions(ctx context.Context, opts ListOptions) ([]SessionSummary, error) {
+	files, err := b.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first, so only as many files as the limit needs are read
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime > files[j].ModTime
+	})
+
+	var summaries []SessionSummary
+	local := make(map[string]bool, len(files))
+	for _, file := range files {
+		local[file.SessionID] = true
+		if opts.Limit > 0 && len(summaries) >= opts.Limit {
+			continue
+		}
+		if !opts.Since.IsZero() && time.Unix(file.ModTime, 0).Before(opts.Since) {
+			continue
+		}
+
+		session, err := sync.ReadSession(file)
+		if err != nil {
+			continue
+		}
+		t := export.Normalize(session)
+		if opts.Project != "" && !strings.Contains(strings.ToLower(t.Project), strings.ToLower(opts.Project)) {
+			continue
+		}
+		if len(t.Entries) == 0 {
+			continue
+		}
+
+		summaries = append(summaries, SessionSummary{
+			SessionID: file.SessionID,
+			Source:    SourceLocal,
+			Project:   t.Project,
+			StartedAt: t.StartedAt,
+			UpdatedAt: time.Unix(file.ModTime, 0).UTC().Format(time.RFC3339),
+			Messages:  len(t.Entries),
+			Title:     title(t),
+		})
+	}
+
+	// Remote sessions have no project, so a project filter excludes them
+	if b.Remote != nil && opts.Project == "" {
+		remote, err := b.remoteSessions(ctx, local, opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, remote...)
+		sort.SliceStable(summaries, func(i, j int) bool {
+			return summaries[i].UpdatedAt > summaries[j].UpdatedAt
+		})
+		if opts.Limit > 0 && len(summaries) > opts.Limit {
+			summaries = summaries[:opts.Limit]
+		}
+	}
+
+	return summaries, nil
+}
+
+func (b *LocalBackend) remoteSessions(ctx context.Context, local map[string]bool, since time.Time) ([]SessionSummary, error) {
+	resp, err := b.Remote.GetConversations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing remote conversations: %w", err)
+	}
+
+	var summaries []SessionSummary
+	for _, conv := range resp.Conversations {
+		if local[conv.SessionID] {
+			continue
+		}
+		if !since.IsZero() {
+			if date, err := time.Parse(time.RFC3339, conv.Date); err == nil && date.Before(since) {
+				continue
+			}
+		}
+		summaries = append(summaries, SessionSummary{
+			SessionID: conv.SessionID,
+			Source:    SourceRemote,
+			UpdatedAt: conv.Date,
+		})
+	}
+	return summaries, nil
+}
+
+func (b *LocalBackend) GetSession(ctx context.Context, id string) (*export.Transcript, error) {
+	files, err := b.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := sync.FindSession(files, id)
+	if errors.Is(err, sync.ErrNoSession) && b.Remote != nil {
+		return b.remoteSession(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := sync.ReadSession(file)
+	if err != nil {
+		return nil, err
+	}
+	return export.Normalize(session), nil
+}
+
+// remoteSession fetches a session that isn't on this machine from the
+// server. Remote IDs have to be given in full.
+func (b *LocalBackend) remoteSession(ctx context.Context, id string) (*export.Transcript, error) {
+	conv, err := b.Remote.GetConversation(ctx, id)
+	var httpErr *api.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w matching %q here or on the server", sync.ErrNoSession, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching remote conversation: %w", err)
+	}
+	return export.NormalizeRemote(conv, b.Keys)
+}
+
+// title is the opening user prompt of a transcript, shortened to one line.
+func title(t *export.Transcript) string {
+	const maxLen = 120
+
+	for _, e := range t.Entries {
+		if e.Role != "user" || e.Text == "" {
+			continue
+		}
+		text := strings.Join(strings.Fields(e.Text), " ")
+		if runes := []rune(text); len(runes) > maxLen {
+			text = string(runes[:maxLen-1]) + "…"
+		}
+		return text
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/api"
+	"github.com/martinjt/claude-history-cli/internal/search"
+)
+
+type fakeRemote struct {
+	conversations []api.Conversation
+	stored        map[string]*api.ConversationResponse
+}
+
+func (f *fakeRemote) GetConversations(ctx context.Context) (*api.ConversationsListResponse, error) {
+	return &api.ConversationsListResponse{Conversations: f.conversations, Total: len(f.conversations)}, nil
+}
+
+func (f *fakeRemote) GetConversation(ctx context.Context, sessionID string) (*api.ConversationResponse, error) {
+	if conv, ok := f.stored[sessionID]; ok {
+		return conv, nil
+	}
+	return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Body: "not found"}
+}
+
+func writeSession(t *testing.T, dir, project, id, cwd, prompt string, modTime time.Time) {
+	t.Helper()
+	projectDir := filepath.Join(dir, project)
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(projectDir, id+".jsonl")
+	content := `{"uuid":"` + id + `-u","timestamp":"2025-01-06T10:00:00Z","type":"user","cwd":"` + cwd + `","message":{"role":"user","content":"` + prompt + `"}}
+{"uuid":"` + id + `-a","timestamp":"2025-01-06T10:00:05Z","type":"assistant","message":{"role":"assistant","content":"Done."}}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	writeSession(t, dir, "-work-app", "aaa111", "/work/app", "fix the retry loop", now.Add(-2*time.Hour))
+	writeSession(t, dir, "-work-api", "bbb222", "/work/api", "add pagination", now.Add(-1*time.Hour))
+
+	remote := &fakeRemote{conversations: []api.Conversation{
+		{SessionID: "aaa111", Date: now.UTC().Format(time.RFC3339)}, // also local
+		{SessionID: "ccc333", Date: now.Add(-90 * time.Minute).UTC().Format(time.RFC3339)},
+	}}
+	b := &LocalBackend{
+		DataDirs:  []string{dir},
+		IndexPath: filepath.Join(t.TempDir(), "index.gob"),
+		Remote:    remote,
+	}
+	ctx := context.Background()
+
+	sessions, err := b.ListSessions(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.SessionID+":"+s.Source)
+	}
+	// Newest first, with the remote-only session slotted in by date
+	if len(ids) != 3 || ids[0] != "bbb222:local" || ids[1] != "ccc333:remote" || ids[2] != "aaa111:local" {
+		t.Errorf("unexpected sessions: %v", ids)
+	}
+	if sessions[0].Title != "add pagination" || sessions[0].Project != "/work/api" || sessions[0].Messages != 2 {
+		t.Errorf("unexpected summary: %+v", sessions[0])
+	}
+
+	sessions, err = b.ListSessions(ctx, ListOptions{Project: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "aaa111" {
+		t.Errorf("expected only the app session, got %+v", sessions)
+	}
+
+	sessions, err = b.ListSessions(ctx, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "bbb222" {
+		t.Errorf("expected newest session only, got %+v", sessions)
+	}
+
+	transcript, err := b.GetSession(ctx, "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcript.SessionID != "aaa111" || len(transcript.Entries) != 2 {
+		t.Errorf("unexpected transcript: %+v", transcript)
+	}
+
+	hits, err := b.Search(ctx, search.ParseQuery("pagination"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Doc.SessionID != "bbb222" {
+		t.Errorf("unexpected hits: %+v", hits)
+	}
+	if _, err := os.Stat(b.IndexPath); err != nil {
+		t.Errorf("expected search index to be saved: %v", err)
+	}
+}
+
+func TestLocalBackend_RemoteSession(t *testing.T) {
+	dir := t.TempDir()
+	writeSession(t, dir, "-work-app", "aaa111", "/work/app", "fix the retry loop", time.Now())
+
+	remote := &fakeRemote{
+		conversations: []api.Conversation{{SessionID: "ccc333", Date: time.Now().UTC().Format(time.RFC3339)}},
+		stored: map[string]*api.ConversationResponse{
+			"ccc333": {
+				SessionID:   "ccc333",
+				ProjectPath: "/laptop/app",
+				Messages: []api.Message{
+					{UUID: "r1", Timestamp: "2025-01-06T09:00:00Z", Role: "user", Content: "bump the go version"},
+					{UUID: "r2", Timestamp: "2025-01-06T09:00:04Z", Role: "assistant", Content: "Bumped.", Model: "claude-sonnet"},
+				},
+				Metadata: &api.SessionMetadata{CWD: "/laptop/app/cmd"},
+			},
+		},
+	}
+	c := startServer(t, &LocalBackend{
+		DataDirs:  []string{dir},
+		IndexPath: filepath.Join(t.TempDir(), "index.gob"),
+		Remote:    remote,
+	})
+
+	var listed struct {
+		Sessions []SessionSummary `json:"sessions"`
+	}
+	c.callTool("list_sessions", map[string]interface{}{}, &listed)
+	var remoteID string
+	for _, s := range listed.Sessions {
+		if s.Source == SourceRemote {
+			remoteID = s.SessionID
+		}
+	}
+	if remoteID != "ccc333" {
+		t.Fatalf("expected the remote session to be listed, got %+v", listed.Sessions)
+	}
+
+	var overview sessionOverview
+	if isError, text := c.callTool("get_session", map[string]interface{}{"session_id": remoteID}, &overview); isError {
+		t.Fatalf("get_session on a listed remote session failed: %s", text)
+	}
+	if overview.Project != "/laptop/app/cmd" || overview.Messages != 2 {
+		t.Errorf("unexpected overview: %+v", overview)
+	}
+
+	var page messagesPage
+	c.callTool("get_session_messages", map[string]interface{}{"session_id": remoteID}, &page)
+	if page.Total != 2 || page.Messages[0].Text != "bump the go version" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	if isError, _ := c.callTool("get_session", map[string]interface{}{"session_id": "zzz999"}, nil); !isError {
+		t.Error("expected an unknown session to be an error")
+	}
+}
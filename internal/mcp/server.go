@@ -0,0 +1,179 @@
+// Package mcp implements a Model Context Protocol server that exposes
+// conversation history as tools. It speaks newline-delimited JSON-RPC 2.0
+// over a reader and writer, normally the process's stdin and stdout.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const serverName = "claude-history-sync"
+
+const instructions = "Use these tools to recall earlier Claude Code conversations: " +
+	"search_history finds messages by keyword, list_sessions shows recent sessions, " +
+	"get_session and get_session_messages read a session found by either."
+
+type Server struct {
+	backend Backend
+	version string
+	tools   map[string]*tool
+	list    []Tool
+}
+
+func NewServer(backend Backend, version string) *Server {
+	s := &Server{
+		backend: backend,
+		version: version,
+		tools:   make(map[string]*tool),
+	}
+	for _, t := range tools() {
+		s.tools[t.Name] = t
+		s.list = append(s.list, t.Tool)
+	}
+	return s
+}
+
+// Serve reads requests from r and writes responses to w until r is
+// exhausted or ctx is cancelled. Requests are handled one at a time.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if resp := s.handleLine(ctx, line); resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return fmt.Errorf("writing response: %w", err)
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading request: %w", err)
+		}
+	}
+}
+
+// handleLine processes one message and returns the response to send, or
+// nil for notifications and blank lines.
+func (s *Server) handleLine(ctx context.Context, line []byte) *response {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), &rpcError{Code: codeParseError, Message: "parse error: " + err.Error()})
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.isNotification() {
+			return nil
+		}
+		return errorResponse(req.ID, &rpcError{Code: codeInvalidRequest, Message: "invalid request"})
+	}
+
+	result, rpcErr := s.dispatch(ctx, &req)
+	if req.isNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *Server) dispatch(ctx context.Context, req *request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var params initializeParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return &initializeResult{
+			ProtocolVersion: negotiateVersion(params.ProtocolVersion),
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      serverInfo{Name: serverName, Version: s.version},
+			Instructions:    instructions,
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return &toolsListResult{Tools: s.list}, nil
+	case "tools/call":
+		var params toolCallParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		t, ok := s.tools[params.Name]
+		if !ok {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		return s.callTool(ctx, t, params.Arguments), nil
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+// callTool runs a tool. Failures are reported to the model as a tool
+// result with isError set rather than as protocol errors, so it can see
+// what went wrong and try again.
+func (s *Server) callTool(ctx context.Context, t *tool, args json.RawMessage) *toolCallResult {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	out, err := t.call(ctx, s.backend, args)
+	if err != nil {
+		return &toolCallResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+
+	text, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return &toolCallResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	return &toolCallResult{Content: []content{{Type: "text", Text: string(text)}}}
+}
+
+func negotiateVersion(requested string) string {
+	for _, v := range supportedVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return supportedVersions[0]
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) *rpcError {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func errorResponse(id json.RawMessage, err *rpcError) *response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", ID: id, Error: err}
+}
@@ -0,0 +1,293 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/export"
+	"github.com/martinjt/claude-history-cli/internal/search"
+)
+
+type fakeBackend struct {
+	lastQuery search.Query
+	lastList  ListOptions
+}
+
+func (f *fakeBackend) Search(ctx context.Context, q search.Query) ([]search.Hit, error) {
+	f.lastQuery = q
+	return []search.Hit{{
+		Doc:     search.Doc{SessionID: "s1", UUID: "u1", Role: "user", Project: "/work/app", Timestamp: "2025-01-06T10:00:00Z"},
+		Score:   1.5,
+		Snippet: "fix the [retry] loop",
+	}}, nil
+}
+
+func (f *fakeBackend) ListSessions(ctx context.Context, opts ListOptions) ([]SessionSummary, error) {
+	f.lastList = opts
+	return []SessionSummary{{SessionID: "s1", Source: SourceLocal, UpdatedAt: "2025-01-06T10:00:00Z"}}, nil
+}
+
+func (f *fakeBackend) GetSession(ctx context.Context, id string) (*export.Transcript, error) {
+	if id != "s1" {
+		return nil, fmt.Errorf("no session matching %q", id)
+	}
+	t := &export.Transcript{SessionID: "s1", Project: "/work/app"}
+	for i := 0; i < 5; i++ {
+		t.Entries = append(t.Entries, export.Entry{
+			UUID: fmt.Sprintf("m%d", i),
+			Role: "assistant",
+			Text: fmt.Sprintf("message %d", i),
+			ToolCalls: []export.ToolCall{
+				{ID: "t", Name: "Bash", Input: json.RawMessage(`{"command":"ls"}`), Result: "a.go"},
+			},
+		})
+	}
+	return t, nil
+}
+
+// client drives a Server over pipes the way an MCP host would over stdio.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func startServer(t *testing.T, backend Backend) *client {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, r: bufio.NewReader(outR), done: make(chan error, 1)}
+
+	go func() {
+		err := NewServer(backend, "test").Serve(context.Background(), inR, outW)
+		outW.Close()
+		c.done <- err
+	}()
+
+	t.Cleanup(func() {
+		inW.Close()
+		select {
+		case err := <-c.done:
+			if err != nil {
+				t.Errorf("Serve returned error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("server did not stop after stdin closed")
+		}
+	})
+
+	return c
+}
+
+func (c *client) send(line string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.w, line+"\n"); err != nil {
+		c.t.Fatalf("writing request: %v", err)
+	}
+}
+
+func (c *client) receive() response {
+	c.t.Helper()
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatalf("reading response: %v", err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		c.t.Fatalf("invalid response %s: %v", line, err)
+	}
+	return resp
+}
+
+// call sends a request and decodes the result into out.
+func (c *client) call(method string, params interface{}, out interface{}) *rpcError {
+	c.t.Helper()
+	c.nextID++
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	data, _ := json.Marshal(req)
+	c.send(string(data))
+
+	resp := c.receive()
+	if string(resp.ID) != fmt.Sprint(c.nextID) {
+		c.t.Fatalf("response ID %s doesn't match request %d", resp.ID, c.nextID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out != nil {
+		data, _ := json.Marshal(resp.Result)
+		if err := json.Unmarshal(data, out); err != nil {
+			c.t.Fatalf("decoding result: %v", err)
+		}
+	}
+	return nil
+}
+
+// callTool calls a tool and decodes the JSON text it returns into out.
+func (c *client) callTool(name string, args interface{}, out interface{}) (isError bool, text string) {
+	c.t.Helper()
+	var result toolCallResult
+	if err := c.call("tools/call", map[string]interface{}{"name": name, "arguments": args}, &result); err != nil {
+		c.t.Fatalf("tools/call %s: %v", name, err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Type != "text" {
+		c.t.Fatalf("expected one text content block, got %+v", result.Content)
+	}
+	text = result.Content[0].Text
+	if !result.IsError && out != nil {
+		if err := json.Unmarshal([]byte(text), out); err != nil {
+			c.t.Fatalf("decoding tool output %s: %v", text, err)
+		}
+	}
+	return result.IsError, text
+}
+
+func TestServer_Handshake(t *testing.T) {
+	c := startServer(t, &fakeBackend{})
+
+	var init initializeResult
+	if err := c.call("initialize", map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "test", "version": "1"},
+	}, &init); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if init.ProtocolVersion != "2024-11-05" {
+		t.Errorf("expected requested version to be accepted, got %s", init.ProtocolVersion)
+	}
+	if init.ServerInfo.Name != serverName || init.Capabilities["tools"] == nil {
+		t.Errorf("unexpected initialize result: %+v", init)
+	}
+
+	// Notifications get no response, so the next line read is the ping's
+	c.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if err := c.call("ping", nil, nil); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	var list toolsListResult
+	if err := c.call("tools/list", nil, &list); err != nil {
+		t.Fatalf("tools/list: %v", err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		var schema map[string]interface{}
+		if err := json.Unmarshal(tool.InputSchema, &schema); err != nil || schema["type"] != "object" {
+			t.Errorf("tool %s has an invalid input schema: %v", tool.Name, err)
+		}
+	}
+	if got := strings.Join(names, ","); got != "search_history,list_sessions,get_session,get_session_messages" {
+		t.Errorf("unexpected tools: %s", got)
+	}
+}
+
+func TestServer_UnknownVersionGetsLatest(t *testing.T) {
+	c := startServer(t, &fakeBackend{})
+
+	var init initializeResult
+	if err := c.call("initialize", map[string]interface{}{"protocolVersion": "1999-01-01"}, &init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ProtocolVersion != supportedVersions[0] {
+		t.Errorf("expected %s, got %s", supportedVersions[0], init.ProtocolVersion)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	c := startServer(t, &fakeBackend{})
+
+	c.send(`{not json`)
+	if resp := c.receive(); resp.Error == nil || resp.Error.Code != codeParseError || string(resp.ID) != "null" {
+		t.Errorf("expected parse error with null ID, got %+v", resp)
+	}
+
+	c.send(`{"jsonrpc":"1.0","id":7,"method":"ping"}`)
+	if resp := c.receive(); resp.Error == nil || resp.Error.Code != codeInvalidRequest || string(resp.ID) != "7" {
+		t.Errorf("expected invalid request error, got %+v", resp)
+	}
+
+	if err := c.call("resources/list", nil, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	if err := c.call("tools/call", map[string]interface{}{"name": "rm_rf"}, nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected invalid params for unknown tool, got %v", err)
+	}
+
+	// Tool failures are results the model can read, not protocol errors
+	isError, text := c.callTool("get_session", map[string]interface{}{"session_id": "nope"}, nil)
+	if !isError || !strings.Contains(text, "no session matching") {
+		t.Errorf("expected tool error result, got isError=%v text=%q", isError, text)
+	}
+	isError, _ = c.callTool("search_history", map[string]interface{}{"query": "  "}, nil)
+	if !isError {
+		t.Error("expected error for empty query")
+	}
+	isError, _ = c.callTool("list_sessions", map[string]interface{}{"since": "last tuesday"}, nil)
+	if !isError {
+		t.Error("expected error for invalid date")
+	}
+}
+
+func TestServer_Tools(t *testing.T) {
+	backend := &fakeBackend{}
+	c := startServer(t, backend)
+
+	var found struct {
+		Results []searchResult `json:"results"`
+	}
+	c.callTool("search_history", map[string]interface{}{"query": `retry "exponential backoff"`, "project": "app", "limit": 1000}, &found)
+	if len(found.Results) != 1 || found.Results[0].Snippet != "fix the [retry] loop" {
+		t.Errorf("unexpected search results: %+v", found)
+	}
+	q := backend.lastQuery
+	if len(q.Terms) != 1 || len(q.Phrases) != 1 || q.Project != "app" || q.Limit != maxLimit {
+		t.Errorf("query not passed through: %+v", q)
+	}
+
+	var listed struct {
+		Sessions []SessionSummary `json:"sessions"`
+	}
+	c.callTool("list_sessions", map[string]interface{}{"since": "2025-01-01"}, &listed)
+	if len(listed.Sessions) != 1 || backend.lastList.Limit != defaultListLimit || backend.lastList.Since.IsZero() {
+		t.Errorf("unexpected list: %+v (options %+v)", listed, backend.lastList)
+	}
+
+	var overview sessionOverview
+	c.callTool("get_session", map[string]interface{}{"session_id": "s1"}, &overview)
+	if overview.Messages != 5 || overview.ToolCalls != 5 {
+		t.Errorf("unexpected overview: %+v", overview)
+	}
+
+	var page messagesPage
+	c.callTool("get_session_messages", map[string]interface{}{"session_id": "s1", "offset": 3, "limit": 10}, &page)
+	if page.Total != 5 || len(page.Messages) != 2 || page.Messages[0].UUID != "m3" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if call := page.Messages[0].ToolCalls[0]; call.Name != "Bash" || call.Result != "" || len(call.Input) != 0 {
+		t.Errorf("expected tool details to be left out, got %+v", call)
+	}
+
+	c.callTool("get_session_messages", map[string]interface{}{"session_id": "s1", "include_tool_details": true}, &page)
+	if call := page.Messages[0].ToolCalls[0]; call.Result != "a.go" {
+		t.Errorf("expected tool details, got %+v", call)
+	}
+
+	c.callTool("get_session_messages", map[string]interface{}{"session_id": "s1", "offset": 50}, &page)
+	if len(page.Messages) != 0 {
+		t.Errorf("expected empty page past the end, got %d messages", len(page.Messages))
+	}
+}
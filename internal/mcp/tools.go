@@ -0,0 +1,326 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/export"
+	"github.com/martinjt/claude-history-cli/internal/search"
+)
+
+// Defaults and caps for the tools' limit arguments.
+const (
+	defaultSearchLimit   = 10
+	defaultListLimit     = 20
+	defaultMessagesLimit = 20
+	maxLimit             = 200
+)
+
+type tool struct {
+	Tool
+	call func(ctx context.Context, b Backend, args json.RawMessage) (interface{}, error)
+}
+
+// tools returns the tool set in the order tools/list reports it.
+func tools() []*tool {
+	return []*tool{
+		{
+			Tool: Tool{
+				Name: "search_history",
+				Description: "Full-text search over past Claude Code conversations. Every word must match; " +
+					`wrap words in double quotes to match an exact phrase. Returns matching messages with a snippet, ` +
+					"best match first.",
+				InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "Words to search for; use \"double quotes\" for phrases"},
+    "project": {"type": "string", "description": "Only sessions whose project path contains this text"},
+    "role": {"type": "string", "enum": ["user", "assistant"], "description": "Only messages from this role"},
+    "since": {"type": "string", "description": "Only messages at or after this date (YYYY-MM-DD or RFC 3339)"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 200, "description": "Maximum results (default 10)"}
+  },
+  "required": ["query"]
+}`),
+			},
+			call: callSearchHistory,
+		},
+		{
+			Tool: Tool{
+				Name:        "list_sessions",
+				Description: "List past Claude Code sessions, most recently active first, with their project and opening prompt.",
+				InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "project": {"type": "string", "description": "Only sessions whose project path contains this text"},
+    "since": {"type": "string", "description": "Only sessions active at or after this date (YYYY-MM-DD or RFC 3339)"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 200, "description": "Maximum sessions (default 20)"}
+  }
+}`),
+			},
+			call: callListSessions,
+		},
+		{
+			Tool: Tool{
+				Name:        "get_session",
+				Description: "Get an overview of one session: project, git branches, models, time range and message count.",
+				InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "session_id": {"type": "string", "description": "Session ID or a unique prefix of one"}
+  },
+  "required": ["session_id"]
+}`),
+			},
+			call: callGetSession,
+		},
+		{
+			Tool: Tool{
+				Name: "get_session_messages",
+				Description: "Read the messages of one session in order, a page at a time. Tool calls are listed by name; " +
+					"set include_tool_details to also get their inputs and results.",
+				InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "session_id": {"type": "string", "description": "Session ID or a unique prefix of one"},
+    "offset": {"type": "integer", "minimum": 0, "description": "Index of the first message to return (default 0)"},
+    "limit": {"type": "integer", "minimum": 1, "maximum": 200, "description": "Maximum messages (default 20)"},
+    "include_tool_details": {"type": "boolean", "description": "Include tool call inputs and results"}
+  },
+  "required": ["session_id"]
+}`),
+			},
+			call: callGetSessionMessages,
+		},
+	}
+}
+
+type searchHistoryArgs struct {
+	Query   string `json:"query"`
+	Project string `json:"project"`
+	Role    string `json:"role"`
+	Since   string `json:"since"`
+	Limit   int    `json:"limit"`
+}
+
+type searchResult struct {
+	SessionID string  `json:"session_id"`
+	UUID      string  `json:"uuid"`
+	Timestamp string  `json:"timestamp"`
+	Role      string  `json:"role"`
+	Model     string  `json:"model,omitempty"`
+	Project   string  `json:"project"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+}
+
+func callSearchHistory(ctx context.Context, b Backend, raw json.RawMessage) (interface{}, error) {
+	var args searchHistoryArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+
+	q := search.ParseQuery(args.Query)
+	if len(q.Terms) == 0 && len(q.Phrases) == 0 {
+		return nil, fmt.Errorf("query must contain at least one word")
+	}
+	q.Project = args.Project
+	q.Role = args.Role
+	q.Limit = clampLimit(args.Limit, defaultSearchLimit)
+
+	var err error
+	if q.Since, err = parseDate(args.Since); err != nil {
+		return nil, err
+	}
+
+	hits, err := b.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]searchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, searchResult{
+			SessionID: hit.Doc.SessionID,
+			UUID:      hit.Doc.UUID,
+			Timestamp: hit.Doc.Timestamp,
+			Role:      hit.Doc.Role,
+			Model:     hit.Doc.Model,
+			Project:   hit.Doc.Project,
+			Snippet:   hit.Snippet,
+			Score:     hit.Score,
+		})
+	}
+	return map[string]interface{}{"results": results}, nil
+}
+
+type listSessionsArgs struct {
+	Project string `json:"project"`
+	Since   string `json:"since"`
+	Limit   int    `json:"limit"`
+}
+
+func callListSessions(ctx context.Context, b Backend, raw json.RawMessage) (interface{}, error) {
+	var args listSessionsArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+
+	since, err := parseDate(args.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := b.ListSessions(ctx, ListOptions{
+		Project: args.Project,
+		Since:   since,
+		Limit:   clampLimit(args.Limit, defaultListLimit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []SessionSummary{}
+	}
+	return map[string]interface{}{"sessions": sessions}, nil
+}
+
+type getSessionArgs struct {
+	SessionID string `json:"session_id"`
+}
+
+type sessionOverview struct {
+	SessionID         string   `json:"session_id"`
+	Project           string   `json:"project"`
+	ClaudeCodeVersion string   `json:"claude_code_version,omitempty"`
+	GitBranches       []string `json:"git_branches,omitempty"`
+	Models            []string `json:"models,omitempty"`
+	StartedAt         string   `json:"started_at,omitempty"`
+	EndedAt           string   `json:"ended_at,omitempty"`
+	Messages          int      `json:"messages"`
+	ToolCalls         int      `json:"tool_calls"`
+	Title             string   `json:"title,omitempty"`
+}
+
+func callGetSession(ctx context.Context, b Backend, raw json.RawMessage) (interface{}, error) {
+	var args getSessionArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.SessionID == "" {
+		return nil, fmt.Errorf("session_id is required")
+	}
+
+	t, err := b.GetSession(ctx, args.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	overview := &sessionOverview{
+		SessionID:         t.SessionID,
+		Project:           t.Project,
+		ClaudeCodeVersion: t.ClaudeCodeVersion,
+		GitBranches:       t.GitBranches,
+		Models:            t.Models,
+		StartedAt:         t.StartedAt,
+		EndedAt:           t.EndedAt,
+		Messages:          len(t.Entries),
+		Title:             title(t),
+	}
+	for _, e := range t.Entries {
+		overview.ToolCalls += len(e.ToolCalls)
+	}
+	return overview, nil
+}
+
+type getSessionMessagesArgs struct {
+	SessionID          string `json:"session_id"`
+	Offset             int    `json:"offset"`
+	Limit              int    `json:"limit"`
+	IncludeToolDetails bool   `json:"include_tool_details"`
+}
+
+type messagesPage struct {
+	SessionID string         `json:"session_id"`
+	Total     int            `json:"total"`
+	Offset    int            `json:"offset"`
+	Messages  []export.Entry `json:"messages"`
+}
+
+func callGetSessionMessages(ctx context.Context, b Backend, raw json.RawMessage) (interface{}, error) {
+	var args getSessionMessagesArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.SessionID == "" {
+		return nil, fmt.Errorf("session_id is required")
+	}
+	if args.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+
+	t, err := b.GetSession(ctx, args.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &messagesPage{
+		SessionID: t.SessionID,
+		Total:     len(t.Entries),
+		Offset:    args.Offset,
+		Messages:  []export.Entry{},
+	}
+	if args.Offset >= len(t.Entries) {
+		return page, nil
+	}
+
+	end := args.Offset + clampLimit(args.Limit, defaultMessagesLimit)
+	if end > len(t.Entries) {
+		end = len(t.Entries)
+	}
+
+	for _, e := range t.Entries[args.Offset:end] {
+		if !args.IncludeToolDetails {
+			calls := make([]export.ToolCall, len(e.ToolCalls))
+			for i, call := range e.ToolCalls {
+				calls[i] = export.ToolCall{ID: call.ID, Name: call.Name, IsError: call.IsError}
+			}
+			e.ToolCalls = calls
+		}
+		page.Messages = append(page.Messages, e)
+	}
+	return page, nil
+}
+
+func decodeArgs(raw json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func clampLimit(limit, def int) int {
+	if limit <= 0 {
+		return def
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// parseDate accepts a date (YYYY-MM-DD, local time) or an RFC 3339
+// timestamp. An empty value is the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or RFC 3339)", value)
+}
@@ -0,0 +1,58 @@
+// Package redact replaces sensitive text in conversations before they are
+// uploaded.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultReplacement is used for rules that don't set their own.
+const DefaultReplacement = "[REDACTED]"
+
+// Rule replaces every match of a regular expression. The replacement may
+// refer to capture groups as $1 or ${name}.
+type Rule struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// Redactor applies a set of rules in order.
+type Redactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+// New compiles the rules. A nil Redactor, returned for no rules, leaves
+// text unchanged.
+func New(rules []Rule) (*Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &Redactor{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", rule.Pattern, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = DefaultReplacement
+		}
+		r.patterns = append(r.patterns, re)
+		r.replacements = append(r.replacements, replacement)
+	}
+	return r, nil
+}
+
+// String returns s with every rule applied.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for i, re := range r.patterns {
+		s = re.ReplaceAllString(s, r.replacements[i])
+	}
+	return s
+}
@@ -0,0 +1,34 @@
+package redact
+
+import "testing"
+
+func TestRedactor(t *testing.T) {
+	r, err := New([]Rule{
+		{Pattern: `sk-[A-Za-z0-9]{8,}`},
+		{Pattern: `(password=)\S+`, Replacement: "${1}***"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.String("key sk-abcdef123456 and password=hunter2 here")
+	if want := "key [REDACTED] and password=*** here"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNew_NoRules(t *testing.T) {
+	r, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String("unchanged"); got != "unchanged" {
+		t.Errorf("expected nil redactor to leave text alone, got %q", got)
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New([]Rule{{Pattern: "("}}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,146 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// cronMarker tags the crontab line this package manages.
+const cronMarker = "# claude-history-sync schedule"
+
+// CronSchedule converts an interval into the five crontab time fields.
+// Cron counts from the top of each hour or day, so only intervals that
+// divide one evenly keep a steady gap; it rejects the rest rather than
+// run on a different schedule than asked for.
+func CronSchedule(interval time.Duration) (string, error) {
+	minutes := int(interval / time.Minute)
+	switch {
+	case minutes < 60 && 60%minutes == 0:
+		return fmt.Sprintf("*/%d * * * *", minutes), nil
+	case minutes == 60:
+		return "0 * * * *", nil
+	case minutes%60 == 0 && minutes < 24*60 && 24%(minutes/60) == 0:
+		return fmt.Sprintf("0 */%d * * *", minutes/60), nil
+	case minutes == 24*60:
+		return "0 0 * * *", nil
+	}
+	return "", fmt.Errorf("cron can't run every %d minutes; use an interval that divides an hour or a day evenly, like 30 or 120, or schedule with systemd", minutes)
+}
+
+// CronLine renders the crontab entry. Cron runs jobs with a minimal PATH,
+// so the current one is passed along. Cron has no way to catch up on runs
+// missed while the machine was off; the next run syncs everything anyway.
+func CronLine(opts Options) (string, error) {
+	schedule, err := CronSchedule(opts.Interval)
+	if err != nil {
+		return "", err
+	}
+	command := fmt.Sprintf("PATH=%s %s sync --log-file %s",
+		shellQuote(opts.Path),
+		shellQuote(opts.Executable),
+		shellQuote(opts.LogFile))
+
+	// Cron turns unescaped percent signs into newlines
+	command = strings.ReplaceAll(command, "%", `\%`)
+
+	return schedule + " " + command + " " + cronMarker, nil
+}
+
+// isSyncCronLine matches our entry, and the plain "claude-history-sync
+// sync" line that scripts/install.sh used to add.
+func isSyncCronLine(line string) bool {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return false
+	}
+	return strings.Contains(line, cronMarker) || strings.Contains(line, "claude-history-sync sync")
+}
+
+func (m *Manager) crontab() (string, error) {
+	out, err := m.run("", "crontab", "-l")
+	if err != nil {
+		// crontab -l fails when the user has no crontab yet, and there is
+		// nothing to read if cron isn't installed at all
+		if strings.Contains(err.Error(), "no crontab") || errors.Is(err, exec.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+func (m *Manager) cronLine() (string, error) {
+	tab, err := m.crontab()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(tab, "\n") {
+		if isSyncCronLine(line) {
+			return line, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *Manager) cronInstalled() (bool, error) {
+	line, err := m.cronLine()
+	return line != "", err
+}
+
+// writeCrontab replaces the sync entry, keeping every other line.
+func (m *Manager) writeCrontab(entry string) error {
+	tab, err := m.crontab()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(tab, "\n"), "\n") {
+		if line == "" && len(lines) == 0 {
+			continue
+		}
+		if !isSyncCronLine(line) {
+			lines = append(lines, line)
+		}
+	}
+	if entry != "" {
+		lines = append(lines, entry)
+	}
+
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if content == strings.TrimLeft(tab, "\n") {
+		return nil
+	}
+
+	if content == "" {
+		// An empty stdin would leave crontab waiting on some systems
+		_, err = m.run("", "crontab", "-r")
+		return err
+	}
+	_, err = m.run(content, "crontab", "-")
+	return err
+}
+
+func (m *Manager) uninstallCron() error {
+	installed, err := m.cronInstalled()
+	if err != nil || !installed {
+		return err
+	}
+	return m.writeCrontab("")
+}
+
+// shellQuote quotes a value for /bin/sh, leaving ordinary paths as they
+// are.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-+:@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,171 @@
+// Package schedule installs periodic syncs as a systemd user timer, or as a
+// crontab entry where systemd isn't available.
+package schedule
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Backends.
+const (
+	BackendAuto    = "auto"
+	BackendSystemd = "systemd"
+	BackendCron    = "cron"
+)
+
+// Options describe the scheduled job.
+type Options struct {
+	Executable string        // absolute path of the binary to run
+	Interval   time.Duration // time between runs
+	LogFile    string        // where runs write their output
+	Path       string        // PATH for the job, which cron and systemd don't inherit
+}
+
+// Status describes an installed schedule.
+type Status struct {
+	Backend   string // BackendSystemd, BackendCron or "" when not installed
+	Schedule  string // timer interval or crontab schedule
+	Active    bool
+	NextRun   string
+	LastRun   string
+	LastExit  *int   // exit code of the last run, if known
+	LastError string // failure reported by the scheduler, if any
+}
+
+// Manager installs and inspects the schedule. Commands are run through run
+// so tests can stub them out.
+type Manager struct {
+	unitDir string
+	run     func(stdin string, name string, args ...string) (string, error)
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		unitDir: defaultUnitDir(),
+		run:     runCommand,
+	}
+}
+
+func runCommand(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return string(out), fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return string(out), fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// Resolve picks the backend to use for "auto": a systemd user instance on
+// Linux if one is running, cron otherwise.
+func (m *Manager) Resolve(backend string) (string, error) {
+	switch backend {
+	case BackendSystemd, BackendCron:
+		return backend, nil
+	case "", BackendAuto:
+		if runtime.GOOS == "linux" {
+			if _, err := m.run("", "systemctl", "--user", "show-environment"); err == nil {
+				return BackendSystemd, nil
+			}
+		}
+		return BackendCron, nil
+	default:
+		return "", fmt.Errorf("unknown scheduler %q (expected auto, systemd or cron)", backend)
+	}
+}
+
+// Install sets up the schedule with the given backend, replacing any
+// existing one from either backend so only one is ever active.
+func (m *Manager) Install(backend string, opts Options) error {
+	if opts.Interval < time.Minute {
+		return fmt.Errorf("sync interval must be at least a minute, got %s", opts.Interval)
+	}
+
+	switch backend {
+	case BackendSystemd:
+		if err := m.uninstallCron(); err != nil {
+			return err
+		}
+		return m.installSystemd(opts)
+	case BackendCron:
+		// Check cron can run it before removing the timer
+		line, err := CronLine(opts)
+		if err != nil {
+			return err
+		}
+		if m.systemdInstalled() {
+			if err := m.uninstallSystemd(); err != nil {
+				return err
+			}
+		}
+		return m.writeCrontab(line)
+	default:
+		return fmt.Errorf("unknown scheduler %q", backend)
+	}
+}
+
+// Uninstall removes the schedule from whichever backends have it. It
+// reports whether anything was removed.
+func (m *Manager) Uninstall() (bool, error) {
+	removed := false
+
+	if m.systemdInstalled() {
+		if err := m.uninstallSystemd(); err != nil {
+			return removed, err
+		}
+		removed = true
+	}
+
+	installed, err := m.cronInstalled()
+	if err != nil {
+		return removed, err
+	}
+	if installed {
+		if err := m.uninstallCron(); err != nil {
+			return removed, err
+		}
+		removed = true
+	}
+
+	return removed, nil
+}
+
+// Status reports the installed schedule, if any.
+func (m *Manager) Status() (*Status, error) {
+	if m.systemdInstalled() {
+		return m.systemdStatus()
+	}
+
+	line, err := m.cronLine()
+	if err != nil {
+		return nil, err
+	}
+	if line != "" {
+		status := &Status{Backend: BackendCron, Active: true}
+		if fields := strings.Fields(line); len(fields) >= 5 {
+			status.Schedule = strings.Join(fields[:5], " ")
+		}
+		return status, nil
+	}
+
+	return &Status{}, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
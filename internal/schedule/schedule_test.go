@@ -0,0 +1,261 @@
+package schedule
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSystem records commands and plays the part of systemctl and crontab.
+type fakeSystem struct {
+	commands []string
+	crontab  string
+	systemd  bool
+	show     map[string]string
+}
+
+func (f *fakeSystem) run(stdin string, name string, args ...string) (string, error) {
+	cmd := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	f.commands = append(f.commands, cmd)
+
+	switch {
+	case cmd == "crontab -l":
+		if f.crontab == "" {
+			return "", errors.New("crontab -l: exit status 1: no crontab for user")
+		}
+		return f.crontab, nil
+	case cmd == "crontab -":
+		f.crontab = stdin
+	case cmd == "crontab -r":
+		f.crontab = ""
+	case strings.HasPrefix(cmd, "systemctl"):
+		if !f.systemd {
+			return "", errors.New("systemctl: exit status 1: Failed to connect to bus")
+		}
+		if strings.Contains(cmd, " show ") {
+			for unit, out := range f.show {
+				if strings.Contains(cmd, unit) {
+					return out, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+func newTestManager(t *testing.T, sys *fakeSystem) *Manager {
+	return &Manager{unitDir: t.TempDir(), run: sys.run}
+}
+
+var testOptions = Options{
+	Executable: "/usr/local/bin/claude-history-sync",
+	Interval:   5 * time.Minute,
+	LogFile:    "/home/jo/.claude-history-sync/sync.log",
+	Path:       "/usr/local/bin:/usr/bin:/bin",
+}
+
+func TestTimerSpan(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute:  "5min",
+		90 * time.Minute: "90min",
+		48 * time.Hour:   "2880min",
+	}
+	for interval, want := range tests {
+		if got := TimerSpan(interval); got != want {
+			t.Errorf("TimerSpan(%s) = %s, want %s", interval, got, want)
+		}
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute: "*/5 * * * *",
+		time.Hour:       "0 * * * *",
+		3 * time.Hour:   "0 */3 * * *",
+		24 * time.Hour:  "0 0 * * *",
+	}
+	for interval, want := range tests {
+		if got, err := CronSchedule(interval); err != nil || got != want {
+			t.Errorf("CronSchedule(%s) = %s, %v, want %s", interval, got, err, want)
+		}
+	}
+
+	// These would silently run on a different schedule
+	for _, interval := range []time.Duration{45 * time.Minute, 90 * time.Minute, 150 * time.Minute, 5 * time.Hour, 48 * time.Hour} {
+		if got, err := CronSchedule(interval); err == nil {
+			t.Errorf("CronSchedule(%s) = %s, expected an error", interval, got)
+		}
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	opts := testOptions
+	opts.Executable = "/home/jo/my tools/claude-history-sync"
+
+	service, timer := SystemdUnits(opts)
+
+	for _, want := range []string{
+		`ExecStart="/home/jo/my tools/claude-history-sync" sync --log-file /home/jo/.claude-history-sync/sync.log`,
+		"Environment=PATH=/usr/local/bin:/usr/bin:/bin",
+		"Type=oneshot",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("expected service to contain %q:\n%s", want, service)
+		}
+	}
+	for _, want := range []string{"OnBootSec=5min", "OnUnitActiveSec=5min", "WantedBy=timers.target"} {
+		if !strings.Contains(timer, want) {
+			t.Errorf("expected timer to contain %q:\n%s", want, timer)
+		}
+	}
+}
+
+func TestCronLine(t *testing.T) {
+	opts := testOptions
+	opts.LogFile = "/tmp/100%/sync.log"
+
+	line, err := CronLine(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `*/5 * * * * PATH=/usr/local/bin:/usr/bin:/bin /usr/local/bin/claude-history-sync sync --log-file '/tmp/100\%/sync.log' ` + cronMarker
+	if line != want {
+		t.Errorf("CronLine =\n%s\nwant\n%s", line, want)
+	}
+}
+
+func TestInstall_Systemd(t *testing.T) {
+	sys := &fakeSystem{systemd: true}
+	m := newTestManager(t, sys)
+
+	if err := m.Install(BackendSystemd, testOptions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, path := range []string{m.servicePath(), m.timerPath()} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected unit file %s: %v", filepath.Base(path), err)
+		}
+	}
+	joined := strings.Join(sys.commands, "\n")
+	for _, want := range []string{"systemctl --user daemon-reload", "systemctl --user enable claude-history-sync.timer", "systemctl --user restart claude-history-sync.timer"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected command %q, got:\n%s", want, joined)
+		}
+	}
+
+	sys.show = map[string]string{
+		"claude-history-sync.timer":   "ActiveState=active\nNextElapseUSecRealtime=Mon 2025-01-06 10:05:00 UTC\nLastTriggerUSec=Mon 2025-01-06 10:00:00 UTC\n",
+		"claude-history-sync.service": "ExecMainStatus=1\nExecMainExitTimestamp=Mon 2025-01-06 10:00:03 UTC\nResult=exit-code\n",
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Backend != BackendSystemd || !status.Active || status.Schedule != "every 5min" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.LastExit == nil || *status.LastExit != 1 || status.LastError != "exit-code" {
+		t.Errorf("expected last exit code 1, got %+v", status)
+	}
+
+	removed, err := m.Uninstall()
+	if err != nil || !removed {
+		t.Fatalf("expected uninstall, got %v, %v", removed, err)
+	}
+	if _, err := os.Stat(m.timerPath()); !os.IsNotExist(err) {
+		t.Error("expected timer unit to be removed")
+	}
+}
+
+func TestInstall_Cron(t *testing.T) {
+	sys := &fakeSystem{crontab: "0 3 * * * backup.sh\n*/5 * * * * /usr/local/bin/claude-history-sync sync >> ~/.claude-history-sync/sync.log 2>&1\n"}
+	m := newTestManager(t, sys)
+
+	if backend, err := m.Resolve(BackendAuto); err != nil || backend != BackendCron {
+		t.Fatalf("expected cron without systemd, got %s, %v", backend, err)
+	}
+
+	if err := m.Install(BackendCron, testOptions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(sys.crontab), "\n")
+	if len(lines) != 2 || lines[0] != "0 3 * * * backup.sh" || !strings.HasSuffix(lines[1], cronMarker) {
+		t.Errorf("expected the old sync line replaced and others kept, got:\n%s", sys.crontab)
+	}
+
+	// Installing again doesn't rewrite an unchanged crontab
+	before := len(sys.commands)
+	if err := m.Install(BackendCron, testOptions); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range sys.commands[before:] {
+		if cmd == "crontab -" {
+			t.Error("expected no rewrite of an unchanged crontab")
+		}
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Backend != BackendCron || status.Schedule != "*/5 * * * *" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if removed, err := m.Uninstall(); err != nil || !removed {
+		t.Fatalf("expected uninstall, got %v, %v", removed, err)
+	}
+	if sys.crontab != "0 3 * * * backup.sh\n" {
+		t.Errorf("expected only the sync line removed, got %q", sys.crontab)
+	}
+}
+
+func TestInstall_RejectsShortInterval(t *testing.T) {
+	m := newTestManager(t, &fakeSystem{})
+	opts := testOptions
+	opts.Interval = 0
+
+	if err := m.Install(BackendCron, opts); err == nil {
+		t.Error("expected error for zero interval")
+	}
+}
+
+func TestInstall_CronRejectsUnevenInterval(t *testing.T) {
+	sys := &fakeSystem{systemd: true}
+	m := newTestManager(t, sys)
+	if err := m.Install(BackendSystemd, testOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions
+	opts.Interval = 90 * time.Minute
+	if err := m.Install(BackendCron, opts); err == nil || !strings.Contains(err.Error(), "every 90 minutes") {
+		t.Errorf("expected cron to refuse 90 minutes, got %v", err)
+	}
+	if !m.systemdInstalled() || sys.crontab != "" {
+		t.Error("expected the refused install to leave the timer in place")
+	}
+}
+
+func TestRecordRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-run.json")
+
+	if status, err := LastRun(path); err != nil || status != nil {
+		t.Fatalf("expected no status before the first run, got %+v, %v", status, err)
+	}
+
+	if err := RecordRun(path, time.Now(), errors.New("not authenticated")); err != nil {
+		t.Fatal(err)
+	}
+	status, err := LastRun(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ExitCode != 1 || status.Error != "not authenticated" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunStatus records the outcome of the most recent sync. Scheduled runs
+// write it so `schedule status` can report the last exit code under cron,
+// which keeps no record of its own.
+type RunStatus struct {
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	ExitCode   int    `json:"exit_code"`
+	Error      string `json:"error,omitempty"`
+}
+
+func DefaultStatusPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".claude-history-sync/last-run.json"
+	}
+	return filepath.Join(home, ".claude-history-sync", "last-run.json")
+}
+
+// RecordRun saves the outcome of a run that started at start.
+func RecordRun(path string, start time.Time, runErr error) error {
+	status := RunStatus{
+		StartedAt:  start.UTC().Format(time.RFC3339),
+		FinishedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if runErr != nil {
+		status.ExitCode = 1
+		status.Error = runErr.Error()
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling run status: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating status directory: %w", err)
+	}
+
+	// Atomic write: write to temp file then rename
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("writing temp status file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming status file: %w", err)
+	}
+	return nil
+}
+
+// LastRun loads the recorded outcome of the last run, or nil if no run
+// has been recorded.
+func LastRun(path string) (*RunStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading run status: %w", err)
+	}
+
+	var status RunStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("parsing run status: %w", err)
+	}
+	return &status, nil
+}
@@ -0,0 +1,192 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unitName = "claude-history-sync"
+
+func defaultUnitDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".config", "systemd", "user")
+	}
+	return filepath.Join(home, ".config", "systemd", "user")
+}
+
+func (m *Manager) servicePath() string {
+	return filepath.Join(m.unitDir, unitName+".service")
+}
+
+func (m *Manager) timerPath() string {
+	return filepath.Join(m.unitDir, unitName+".timer")
+}
+
+func (m *Manager) systemdInstalled() bool {
+	return fileExists(m.timerPath())
+}
+
+// TimerSpan converts an interval into a systemd time span, like 90min.
+// Timers counting from the last run can take any interval, unlike
+// calendar expressions, which restart their count every hour or day.
+func TimerSpan(interval time.Duration) string {
+	return fmt.Sprintf("%dmin", int(interval/time.Minute))
+}
+
+// SystemdUnits renders the service and timer units. The timer fires an
+// interval after boot, or at once if it's started later than that, and
+// then an interval after each run.
+func SystemdUnits(opts Options) (service, timer string) {
+	service = fmt.Sprintf(`[Unit]
+Description=Sync Claude Code conversation history
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s sync --log-file %s
+Environment=%s
+Nice=10
+`, systemdQuote(opts.Executable), systemdQuote(opts.LogFile), systemdQuote("PATH="+opts.Path))
+
+	timer = fmt.Sprintf(`[Unit]
+Description=Sync Claude Code conversation history periodically
+
+[Timer]
+OnBootSec=%[1]s
+OnUnitActiveSec=%[1]s
+RandomizedDelaySec=30
+
+[Install]
+WantedBy=timers.target
+`, TimerSpan(opts.Interval))
+
+	return service, timer
+}
+
+// systemdQuote quotes a value for a unit file when it contains spaces or
+// quotes, escaping specifier percent signs.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func (m *Manager) installSystemd(opts Options) error {
+	if err := os.MkdirAll(m.unitDir, 0755); err != nil {
+		return fmt.Errorf("creating unit directory: %w", err)
+	}
+
+	service, timer := SystemdUnits(opts)
+	if err := os.WriteFile(m.servicePath(), []byte(service), 0644); err != nil {
+		return fmt.Errorf("writing service unit: %w", err)
+	}
+	if err := os.WriteFile(m.timerPath(), []byte(timer), 0644); err != nil {
+		return fmt.Errorf("writing timer unit: %w", err)
+	}
+
+	if _, err := m.run("", "systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	// Restart so an existing timer picks up a changed interval
+	if _, err := m.run("", "systemctl", "--user", "enable", unitName+".timer"); err != nil {
+		return err
+	}
+	if _, err := m.run("", "systemctl", "--user", "restart", unitName+".timer"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) uninstallSystemd() error {
+	// Disabling a timer that isn't loaded any more is fine
+	m.run("", "systemctl", "--user", "disable", "--now", unitName+".timer")
+
+	for _, path := range []string{m.timerPath(), m.servicePath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", path, err)
+		}
+	}
+
+	_, err := m.run("", "systemctl", "--user", "daemon-reload")
+	return err
+}
+
+func (m *Manager) systemdStatus() (*Status, error) {
+	timer, err := m.showUnit(unitName+".timer", "ActiveState", "NextElapseUSecRealtime", "LastTriggerUSec")
+	if err != nil {
+		return nil, err
+	}
+	service, err := m.showUnit(unitName+".service", "ExecMainStatus", "ExecMainExitTimestamp", "Result")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Backend:  BackendSystemd,
+		Schedule: timerSchedule(m.timerPath()),
+		Active:   timer["ActiveState"] == "active",
+		NextRun:  timer["NextElapseUSecRealtime"],
+		LastRun:  timer["LastTriggerUSec"],
+	}
+
+	// A service that has never run reports an empty exit timestamp
+	if service["ExecMainExitTimestamp"] != "" {
+		if code, err := strconv.Atoi(service["ExecMainStatus"]); err == nil {
+			status.LastExit = &code
+		}
+	}
+	if result := service["Result"]; result != "" && result != "success" {
+		status.LastError = result
+	}
+
+	return status, nil
+}
+
+func (m *Manager) showUnit(unit string, properties ...string) (map[string]string, error) {
+	args := []string{"--user", "show", unit}
+	for _, p := range properties {
+		args = append(args, "-p", p)
+	}
+
+	out, err := m.run("", "systemctl", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values, nil
+}
+
+// timerSchedule reads the interval back from the timer unit. Units
+// installed by earlier versions have an OnCalendar expression instead.
+func timerSchedule(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "OnUnitActiveSec="); ok {
+			return "every " + value
+		}
+		if value, ok := strings.CutPrefix(line, "OnCalendar="); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// indexVersion is bumped whenever the on-disk layout or tokenizer changes;
+// an index with a different version is discarded and rebuilt.
+const indexVersion = 1
+
+// Doc is one indexed message.
+type Doc struct {
+	SessionID string
+	UUID      string
+	Project   string
+	Role      string
+	Model     string
+	Timestamp string
+	Text      string
+	Length    int
+	Deleted   bool
+}
+
+// Posting lists the positions of a term within one document.
+type Posting struct {
+	Doc       int
+	Positions []int
+}
+
+type fileSig struct {
+	Path    string
+	ModTime int64
+	Size    int64
+}
+
+// Index is an inverted index over local conversation messages. It is kept
+// on disk and updated incrementally: only session files whose path, size
+// or modification time changed since the last update are re-read.
+type Index struct {
+	Version  int
+	Docs     []Doc
+	Postings map[string][]Posting
+	Files    map[string]fileSig
+	TotalLen int
+	LiveDocs int
+}
+
+// UpdateResult summarises what an Update call changed.
+type UpdateResult struct {
+	Indexed int
+	Removed int
+	Skipped int
+	Failed  []error
+}
+
+func (r UpdateResult) Changed() bool {
+	return r.Indexed > 0 || r.Removed > 0
+}
+
+func DefaultIndexPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".claude-history-sync/search-index.gob"
+	}
+	return filepath.Join(home, ".claude-history-sync", "search-index.gob")
+}
+
+func New() *Index {
+	return &Index{
+		Version:  indexVersion,
+		Postings: make(map[string][]Posting),
+		Files:    make(map[string]fileSig),
+	}
+}
+
+// Load reads an index from disk. A missing or outdated index yields an
+// empty one so the next Update rebuilds it.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New(), nil
+		}
+		return nil, fmt.Errorf("opening search index: %w", err)
+	}
+	defer f.Close()
+
+	var idx Index
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("decoding search index: %w", err)
+	}
+
+	if idx.Version != indexVersion {
+		return New(), nil
+	}
+	if idx.Postings == nil {
+		idx.Postings = make(map[string][]Posting)
+	}
+	if idx.Files == nil {
+		idx.Files = make(map[string]fileSig)
+	}
+
+	return &idx, nil
+}
+
+func (idx *Index) Save(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating index directory: %w", err)
+	}
+
+	// Atomic write: write to a temp file of our own then rename, as sync,
+	// search and the MCP server may all save at once
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp index file: %w", err)
+	}
+	tmpPath := f.Name()
+
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("encoding search index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing temp index file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming index file: %w", err)
+	}
+
+	return nil
+}
+
+// Update brings the index in line with a full scan of the data directories.
+// Changed files are re-indexed and sessions missing from files are dropped.
+// Files that can't be read are reported in Failed and retried next time.
+func (idx *Index) Update(files []sync.FileInfo) UpdateResult {
+	var result UpdateResult
+	present := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		present[file.SessionID] = true
+
+		sig := fileSig{Path: file.Path, ModTime: file.ModTime, Size: file.Size}
+		if existing, ok := idx.Files[file.SessionID]; ok && existing == sig {
+			result.Skipped++
+			continue
+		}
+
+		session, err := sync.ReadSession(file)
+		if err != nil {
+			result.Failed = append(result.Failed, err)
+			continue
+		}
+
+		idx.removeSession(file.SessionID)
+		idx.addSession(session)
+		idx.Files[file.SessionID] = sig
+		result.Indexed++
+	}
+
+	for sessionID := range idx.Files {
+		if !present[sessionID] {
+			idx.removeSession(sessionID)
+			delete(idx.Files, sessionID)
+			result.Removed++
+		}
+	}
+
+	// Rebuild once tombstones make up a quarter of the documents
+	if deleted := len(idx.Docs) - idx.LiveDocs; deleted > 0 && deleted*4 > len(idx.Docs) {
+		idx.compact()
+	}
+
+	return result
+}
+
+func (idx *Index) addSession(session *sync.Session) {
+	project := session.Project()
+
+	for _, msg := range session.Messages {
+		text := messageText(&msg)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		idx.addDoc(Doc{
+			SessionID: session.File.SessionID,
+			UUID:      msg.UUID,
+			Project:   project,
+			Role:      msg.Role,
+			Model:     msg.Model,
+			Timestamp: msg.Timestamp,
+			Text:      text,
+		})
+	}
+}
+
+func (idx *Index) addDoc(doc Doc) {
+	id := len(idx.Docs)
+	tokens := tokenize(doc.Text)
+	doc.Length = len(tokens)
+
+	positions := make(map[string][]int)
+	for pos, tok := range tokens {
+		positions[tok.term] = append(positions[tok.term], pos)
+	}
+	for term, pos := range positions {
+		idx.Postings[term] = append(idx.Postings[term], Posting{Doc: id, Positions: pos})
+	}
+
+	idx.Docs = append(idx.Docs, doc)
+	idx.TotalLen += doc.Length
+	idx.LiveDocs++
+}
+
+// removeSession tombstones a session's documents. Their postings stay in
+// place until the next compaction.
+func (idx *Index) removeSession(sessionID string) {
+	for i := range idx.Docs {
+		doc := &idx.Docs[i]
+		if doc.SessionID == sessionID && !doc.Deleted {
+			doc.Deleted = true
+			idx.TotalLen -= doc.Length
+			idx.LiveDocs--
+		}
+	}
+}
+
+func (idx *Index) compact() {
+	docs := idx.Docs
+	idx.Docs = nil
+	idx.Postings = make(map[string][]Posting)
+	idx.TotalLen = 0
+	idx.LiveDocs = 0
+
+	for _, doc := range docs {
+		if !doc.Deleted {
+			idx.addDoc(doc)
+		}
+	}
+}
+
+// messageText is the searchable text of a message: all of its text blocks,
+// or the plain content for messages without structured content. Tool
+// inputs and results are left out to keep the index small.
+func messageText(msg *sync.Message) string {
+	var parts []string
+	for _, b := range msg.Blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return msg.Content
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,207 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func writeSession(t *testing.T, dir, sessionID, content string) sync.FileInfo {
+	t.Helper()
+	path := filepath.Join(dir, sessionID+".jsonl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sync.FileInfo{
+		Path:        path,
+		SessionID:   sessionID,
+		ProjectPath: "/" + filepath.Base(dir),
+		ModTime:     info.ModTime().UnixNano(),
+		Size:        info.Size(),
+	}
+}
+
+const kafkaSession = `{"uuid":"k1","timestamp":"2025-01-06T10:00:00Z","type":"user","cwd":"/work/payments","message":{"role":"user","content":"The Kafka consumer keeps failing, can we fix the retry bug?"}}
+{"uuid":"k2","timestamp":"2025-01-06T10:01:00Z","type":"assistant","message":{"role":"assistant","model":"claude-opus","content":[{"type":"text","text":"The retry loop never backs off."},{"type":"text","text":"I'll add exponential backoff to the Kafka retry handler."}]}}
+`
+
+const otherSession = `{"uuid":"o1","timestamp":"2025-02-01T10:00:00Z","type":"user","cwd":"/work/web","message":{"role":"user","content":"Add a retry button to the bug report form"}}
+{"uuid":"o2","timestamp":"2025-02-01T10:01:00Z","type":"assistant","message":{"role":"assistant","model":"claude-sonnet","content":[{"type":"text","text":"Done, the form now has a retry button."}]}}
+`
+
+func buildIndex(t *testing.T) (*Index, []sync.FileInfo) {
+	t.Helper()
+	dir := t.TempDir()
+	files := []sync.FileInfo{
+		writeSession(t, dir, "kafka", kafkaSession),
+		writeSession(t, dir, "other", otherSession),
+	}
+
+	idx := New()
+	result := idx.Update(files)
+	if result.Indexed != 2 || len(result.Failed) != 0 {
+		t.Fatalf("unexpected update result: %+v", result)
+	}
+	return idx, files
+}
+
+func TestSearch_RanksAndRequiresAllTerms(t *testing.T) {
+	idx, _ := buildIndex(t)
+
+	hits := idx.Search(ParseQuery("kafka retry"))
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(hits))
+	}
+	for _, h := range hits {
+		if h.Doc.SessionID != "kafka" {
+			t.Errorf("expected only kafka session hits, got %s", h.Doc.SessionID)
+		}
+	}
+
+	// "retry" appears in every document so it carries almost no weight;
+	// with one "kafka" each, length normalisation favours the shorter k1
+	if hits[0].Doc.UUID != "k1" || hits[0].Score <= hits[1].Score {
+		t.Errorf("expected k1 to rank first, got %s (%.3f vs %.3f)", hits[0].Doc.UUID, hits[0].Score, hits[1].Score)
+	}
+	if !strings.Contains(hits[0].Snippet, "[Kafka]") {
+		t.Errorf("expected highlighted snippet, got %q", hits[0].Snippet)
+	}
+
+	if hits := idx.Search(ParseQuery("kafka nonexistentterm")); len(hits) != 0 {
+		t.Errorf("expected no hits when a term is missing, got %d", len(hits))
+	}
+}
+
+func TestSearch_Phrase(t *testing.T) {
+	idx, _ := buildIndex(t)
+
+	hits := idx.Search(ParseQuery(`"retry button"`))
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 phrase hits, got %d", len(hits))
+	}
+
+	hits = idx.Search(ParseQuery(`"button retry"`))
+	if len(hits) != 0 {
+		t.Errorf("expected reversed phrase not to match, got %d", len(hits))
+	}
+}
+
+func TestSearch_Filters(t *testing.T) {
+	idx, _ := buildIndex(t)
+
+	q := ParseQuery("retry")
+	q.Project = "payments"
+	q.Role = "assistant"
+	hits := idx.Search(q)
+	if len(hits) != 1 || hits[0].Doc.UUID != "k2" {
+		t.Fatalf("expected only k2, got %+v", hits)
+	}
+	if hits[0].Doc.Project != "/work/payments" {
+		t.Errorf("expected project from cwd, got %s", hits[0].Doc.Project)
+	}
+
+	q = ParseQuery("retry")
+	q.Since = time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	q.Model = "sonnet"
+	hits = idx.Search(q)
+	if len(hits) != 1 || hits[0].Doc.UUID != "o2" {
+		t.Fatalf("expected only o2, got %+v", hits)
+	}
+}
+
+func TestUpdate_Incremental(t *testing.T) {
+	idx, files := buildIndex(t)
+
+	result := idx.Update(files)
+	if result.Changed() || result.Skipped != 2 {
+		t.Errorf("expected unchanged files to be skipped, got %+v", result)
+	}
+
+	// Rewrite one session and drop the other
+	updated := writeSession(t, filepath.Dir(files[0].Path), "kafka",
+		`{"uuid":"k9","timestamp":"2025-03-01T10:00:00Z","type":"user","message":{"role":"user","content":"Zookeeper migration"}}`+"\n")
+	updated.ModTime++
+
+	result = idx.Update([]sync.FileInfo{updated})
+	if result.Indexed != 1 || result.Removed != 1 {
+		t.Errorf("expected 1 indexed and 1 removed, got %+v", result)
+	}
+
+	if hits := idx.Search(ParseQuery("kafka")); len(hits) != 0 {
+		t.Errorf("expected stale documents to be gone, got %d hits", len(hits))
+	}
+	if hits := idx.Search(ParseQuery("zookeeper")); len(hits) != 1 {
+		t.Errorf("expected new document to be found, got %d hits", len(hits))
+	}
+	if idx.LiveDocs != 1 || len(idx.Docs) != 1 {
+		t.Errorf("expected compaction to leave 1 document, got live=%d total=%d", idx.LiveDocs, len(idx.Docs))
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	idx, _ := buildIndex(t)
+	path := filepath.Join(t.TempDir(), "index", "search-index.gob")
+
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("saving index: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading index: %v", err)
+	}
+	if hits := loaded.Search(ParseQuery("kafka")); len(hits) != 2 {
+		t.Errorf("expected 2 hits after reload, got %d", len(hits))
+	}
+
+	empty, err := Load(filepath.Join(t.TempDir(), "missing.gob"))
+	if err != nil || empty.LiveDocs != 0 {
+		t.Errorf("expected empty index for missing file, got %v, %v", empty, err)
+	}
+}
+
+func TestSave_Concurrent(t *testing.T) {
+	idx, _ := buildIndex(t)
+	path := filepath.Join(t.TempDir(), "search-index.gob")
+
+	// sync, search and the MCP server can save at the same time
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- idx.Save(path) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("saving index: %v", err)
+		}
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading index: %v", err)
+	}
+	if hits := loaded.Search(ParseQuery("kafka")); len(hits) != 2 {
+		t.Errorf("expected 2 hits after concurrent saves, got %d", len(hits))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the index left behind, got %d files", len(entries))
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q := ParseQuery(`fix "retry bug" Kafka "single"`)
+
+	if strings.Join(q.Terms, ",") != "fix,kafka,single" {
+		t.Errorf("unexpected terms: %v", q.Terms)
+	}
+	if len(q.Phrases) != 1 || strings.Join(q.Phrases[0], " ") != "retry bug" {
+		t.Errorf("unexpected phrases: %v", q.Phrases)
+	}
+}
@@ -0,0 +1,297 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Query is a parsed search. Every term and phrase must match; matching
+// documents are ranked by BM25 over all terms, phrase words included.
+type Query struct {
+	Terms   []string
+	Phrases [][]string
+
+	Project string // substring of the session's project path
+	Role    string
+	Model   string // substring of the model name
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+type Hit struct {
+	Doc     Doc
+	Score   float64
+	Snippet string
+}
+
+// ParseQuery splits a query string into bare terms and "quoted phrases".
+func ParseQuery(text string) Query {
+	var q Query
+
+	for i, part := range strings.Split(text, `"`) {
+		words := terms(part)
+		if i%2 == 1 && len(words) > 1 {
+			q.Phrases = append(q.Phrases, words)
+			continue
+		}
+		q.Terms = append(q.Terms, words...)
+	}
+
+	return q
+}
+
+func (q *Query) empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+func (q *Query) allTerms() []string {
+	seen := make(map[string]bool)
+	var all []string
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			all = append(all, t)
+		}
+	}
+	for _, t := range q.Terms {
+		add(t)
+	}
+	for _, p := range q.Phrases {
+		for _, t := range p {
+			add(t)
+		}
+	}
+	return all
+}
+
+// Search returns the best matching messages, highest score first.
+func (idx *Index) Search(q Query) []Hit {
+	if q.empty() || idx.LiveDocs == 0 {
+		return nil
+	}
+
+	queryTerms := q.allTerms()
+	postings := make(map[string]map[int]Posting, len(queryTerms))
+	for _, term := range queryTerms {
+		byDoc := make(map[int]Posting)
+		for _, p := range idx.Postings[term] {
+			if !idx.Docs[p.Doc].Deleted {
+				byDoc[p.Doc] = p
+			}
+		}
+		if len(byDoc) == 0 {
+			return nil // a required term matches nothing
+		}
+		postings[term] = byDoc
+	}
+
+	// Candidates are the documents containing the rarest term
+	rarest := queryTerms[0]
+	for _, term := range queryTerms[1:] {
+		if len(postings[term]) < len(postings[rarest]) {
+			rarest = term
+		}
+	}
+
+	avgLen := float64(idx.TotalLen) / float64(idx.LiveDocs)
+	var hits []Hit
+
+	for docID := range postings[rarest] {
+		doc := &idx.Docs[docID]
+		if !q.matchesFilters(doc) || !hasAllTerms(postings, queryTerms, docID) {
+			continue
+		}
+		if !hasPhrases(postings, q.Phrases, docID) {
+			continue
+		}
+
+		score := 0.0
+		for _, term := range queryTerms {
+			tf := float64(len(postings[term][docID].Positions))
+			df := float64(len(postings[term]))
+			idf := math.Log(1 + (float64(idx.LiveDocs)-df+0.5)/(df+0.5))
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(doc.Length)/avgLen)
+			score += idf * tf * (bm25K1 + 1) / norm
+		}
+
+		hits = append(hits, Hit{Doc: *doc, Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Doc.Timestamp > hits[j].Doc.Timestamp
+	})
+
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = snippet(hits[i].Doc.Text, queryTerms)
+	}
+
+	return hits
+}
+
+func (q *Query) matchesFilters(doc *Doc) bool {
+	if q.Project != "" && !strings.Contains(strings.ToLower(doc.Project), strings.ToLower(q.Project)) {
+		return false
+	}
+	if q.Role != "" && !strings.EqualFold(doc.Role, q.Role) {
+		return false
+	}
+	if q.Model != "" && !strings.Contains(strings.ToLower(doc.Model), strings.ToLower(q.Model)) {
+		return false
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		ts, err := time.Parse(time.RFC3339Nano, doc.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !q.Since.IsZero() && ts.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !ts.Before(q.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAllTerms(postings map[string]map[int]Posting, queryTerms []string, docID int) bool {
+	for _, term := range queryTerms {
+		if _, ok := postings[term][docID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPhrases(postings map[string]map[int]Posting, phrases [][]string, docID int) bool {
+	for _, phrase := range phrases {
+		if !hasPhrase(postings, phrase, docID) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPhrase checks that the phrase words occur at consecutive positions.
+func hasPhrase(postings map[string]map[int]Posting, phrase []string, docID int) bool {
+	next := make([]map[int]bool, len(phrase))
+	for i, term := range phrase[1:] {
+		next[i+1] = make(map[int]bool)
+		for _, pos := range postings[term][docID].Positions {
+			next[i+1][pos] = true
+		}
+	}
+
+	for _, start := range postings[phrase[0]][docID].Positions {
+		matched := true
+		for i := 1; i < len(phrase); i++ {
+			if !next[i][start+i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet returns a window of text around the first query term, with
+// matches wrapped in [brackets].
+func snippet(text string, queryTerms []string) string {
+	const radius = 80
+
+	want := make(map[string]bool, len(queryTerms))
+	for _, t := range queryTerms {
+		want[t] = true
+	}
+
+	tokens := tokenize(text)
+	first := -1
+	for i, tok := range tokens {
+		if want[tok.term] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return collapseSpace(truncate(text, 2*radius))
+	}
+
+	start := tokens[first].start - radius
+	if start < 0 {
+		start = 0
+	}
+	end := tokens[first].end + radius
+	if end > len(text) {
+		end = len(text)
+	}
+	// Don't cut through words or multi-byte characters
+	for start > 0 && !isBoundary(text, start) {
+		start--
+	}
+	for end < len(text) && !isBoundary(text, end) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	last := start
+	for _, tok := range tokens {
+		if tok.start < start || tok.end > end || !want[tok.term] {
+			continue
+		}
+		b.WriteString(text[last:tok.start])
+		b.WriteString("[" + text[tok.start:tok.end] + "]")
+		last = tok.end
+	}
+	b.WriteString(text[last:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return collapseSpace(b.String())
+}
+
+func isBoundary(text string, i int) bool {
+	c := text[i]
+	return c == ' ' || c == '\n' || c == '\t'
+}
+
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	cut := n
+	for cut > 0 && !isBoundary(text, cut) {
+		cut--
+	}
+	if cut == 0 {
+		// No whitespace to break on; back up to a character boundary
+		for cut = n; cut > 0 && !utf8.RuneStart(text[cut]); cut-- {
+		}
+	}
+	return text[:cut] + "…"
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
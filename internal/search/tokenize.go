@@ -0,0 +1,43 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	term  string
+	start int // byte offset of the token in the source text
+	end   int
+}
+
+// tokenize splits text into lower-cased runs of letters and digits.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+
+	return tokens
+}
+
+func terms(text string) []string {
+	tokens := tokenize(text)
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = t.term
+	}
+	return out
+}
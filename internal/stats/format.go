@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var valueColumns = []string{
+	"sessions", "messages", "input_tokens", "output_tokens",
+	"cache_creation_tokens", "cache_read_tokens", "tool_calls", "duration",
+}
+
+func rowValues(r *Row, formatDuration func(time.Duration) string) []string {
+	return []string{
+		strconv.Itoa(r.Sessions),
+		strconv.Itoa(r.Messages),
+		strconv.Itoa(r.InputTokens),
+		strconv.Itoa(r.OutputTokens),
+		strconv.Itoa(r.CacheCreationTokens),
+		strconv.Itoa(r.CacheReadTokens),
+		strconv.Itoa(r.ToolCalls),
+		formatDuration(r.Duration),
+	}
+}
+
+func groupValues(r *Row, groupBy []string) []string {
+	values := make([]string, len(groupBy))
+	for i, g := range groupBy {
+		values[i] = r.Group[g]
+	}
+	return values
+}
+
+// Write renders rows in the given format: "table", "csv" or "json".
+func Write(w io.Writer, format string, groupBy []string, rows []Row) error {
+	switch format {
+	case "", "table":
+		return WriteTable(w, groupBy, rows)
+	case "csv":
+		return WriteCSV(w, groupBy, rows)
+	case "json":
+		return WriteJSON(w, rows)
+	default:
+		return fmt.Errorf("unknown format %q (expected table, csv or json)", format)
+	}
+}
+
+func WriteTable(w io.Writer, groupBy []string, rows []Row) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := append(upper(groupBy), upper(valueColumns)...)
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	for i := range rows {
+		values := append(groupValues(&rows[i], groupBy), rowValues(&rows[i], shortDuration)...)
+		fmt.Fprintln(tw, strings.Join(values, "\t")+"\t")
+	}
+
+	return tw.Flush()
+}
+
+func WriteCSV(w io.Writer, groupBy []string, rows []Row) error {
+	cw := csv.NewWriter(w)
+
+	header := append(append([]string{}, groupBy...), valueColumns...)
+	header[len(header)-1] = "duration_seconds"
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for i := range rows {
+		values := append(groupValues(&rows[i], groupBy), rowValues(&rows[i], seconds)...)
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func WriteJSON(w io.Writer, rows []Row) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+func upper(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = strings.ToUpper(strings.ReplaceAll(n, "_", " "))
+	}
+	return out
+}
+
+func shortDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
@@ -0,0 +1,237 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+// Dimensions that rows can be grouped by.
+const (
+	GroupDay     = "day"
+	GroupWeek    = "week"
+	GroupProject = "project"
+	GroupModel   = "model"
+	GroupMachine = "machine"
+)
+
+var validGroups = map[string]bool{
+	GroupDay:     true,
+	GroupWeek:    true,
+	GroupProject: true,
+	GroupModel:   true,
+	GroupMachine: true,
+}
+
+type Options struct {
+	GroupBy   []string
+	Since     time.Time // zero means no lower bound
+	Until     time.Time // zero means no upper bound
+	MachineID string
+	// Machines names the machine each data directory's sessions ran on.
+	// Sessions from other directories, like a devcontainer's bind-mounted
+	// home, are grouped under their directory, and those with none under
+	// MachineID.
+	Machines map[string]string
+	Location *time.Location // for day/week buckets; defaults to time.Local
+}
+
+// Row is the aggregate for one combination of group values.
+type Row struct {
+	Group               map[string]string `json:"group"`
+	Sessions            int               `json:"sessions"`
+	Messages            int               `json:"messages"`
+	InputTokens         int               `json:"input_tokens"`
+	OutputTokens        int               `json:"output_tokens"`
+	CacheCreationTokens int               `json:"cache_creation_tokens"`
+	CacheReadTokens     int               `json:"cache_read_tokens"`
+	ToolCalls           int               `json:"tool_calls"`
+	Duration            time.Duration     `json:"-"`
+	DurationSeconds     int64             `json:"duration_seconds"`
+
+	keys []string
+}
+
+// TotalTokens is the sum of all token counts, including cache tokens.
+func (r *Row) TotalTokens() int {
+	return r.InputTokens + r.OutputTokens + r.CacheCreationTokens + r.CacheReadTokens
+}
+
+// span is the activity window of one session within one row.
+type span struct {
+	first, last time.Time
+}
+
+type bucket struct {
+	row      *Row
+	sessions map[string]*span
+}
+
+// Aggregator accumulates per-group statistics over parsed sessions.
+type Aggregator struct {
+	opts    Options
+	buckets map[string]*bucket
+}
+
+func New(opts Options) (*Aggregator, error) {
+	for _, g := range opts.GroupBy {
+		if !validGroups[g] {
+			return nil, fmt.Errorf("unknown group %q (expected day, week, project, model or machine)", g)
+		}
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+
+	return &Aggregator{
+		opts:    opts,
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// Add folds one session into the aggregate. Messages outside the
+// Since/Until window are ignored. Claude Code splits one API response
+// into several records that all repeat the response's usage, so usage is
+// counted once per response ID.
+func (a *Aggregator) Add(session *sync.Session) {
+	seenResponses := make(map[string]bool)
+
+	for i := range session.Messages {
+		msg := &session.Messages[i]
+
+		ts, err := time.Parse(time.RFC3339Nano, msg.Timestamp)
+		hasTime := err == nil
+		if hasTime && !a.inRange(ts) {
+			continue
+		}
+		if !hasTime && (!a.opts.Since.IsZero() || !a.opts.Until.IsZero()) {
+			continue
+		}
+
+		keys := a.keysFor(session, msg, ts, hasTime)
+		b := a.bucketFor(keys)
+		b.row.Messages++
+		b.row.ToolCalls += msg.ToolCalls()
+
+		countUsage := msg.ResponseID == "" || !seenResponses[msg.ResponseID]
+		if msg.ResponseID != "" {
+			seenResponses[msg.ResponseID] = true
+		}
+		if countUsage {
+			b.row.InputTokens += msg.Usage.InputTokens
+			b.row.OutputTokens += msg.Usage.OutputTokens
+			b.row.CacheCreationTokens += msg.Usage.CacheCreationInputTokens
+			b.row.CacheReadTokens += msg.Usage.CacheReadInputTokens
+		}
+
+		sp, ok := b.sessions[session.File.SessionID]
+		if !ok {
+			sp = &span{}
+			b.sessions[session.File.SessionID] = sp
+		}
+		if hasTime {
+			if sp.first.IsZero() || ts.Before(sp.first) {
+				sp.first = ts
+			}
+			if ts.After(sp.last) {
+				sp.last = ts
+			}
+		}
+	}
+}
+
+// Rows returns the aggregated rows sorted by their group values.
+func (a *Aggregator) Rows() []Row {
+	rows := make([]Row, 0, len(a.buckets))
+	for _, b := range a.buckets {
+		row := *b.row
+		row.Sessions = len(b.sessions)
+		for _, sp := range b.sessions {
+			row.Duration += sp.last.Sub(sp.first)
+		}
+		row.DurationSeconds = int64(row.Duration / time.Second)
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		for k := range rows[i].keys {
+			if rows[i].keys[k] != rows[j].keys[k] {
+				return rows[i].keys[k] < rows[j].keys[k]
+			}
+		}
+		return false
+	})
+
+	return rows
+}
+
+func (a *Aggregator) inRange(ts time.Time) bool {
+	if !a.opts.Since.IsZero() && ts.Before(a.opts.Since) {
+		return false
+	}
+	if !a.opts.Until.IsZero() && !ts.Before(a.opts.Until) {
+		return false
+	}
+	return true
+}
+
+func (a *Aggregator) keysFor(session *sync.Session, msg *sync.Message, ts time.Time, hasTime bool) []string {
+	keys := make([]string, len(a.opts.GroupBy))
+	for i, g := range a.opts.GroupBy {
+		switch g {
+		case GroupDay:
+			keys[i] = "unknown"
+			if hasTime {
+				keys[i] = ts.In(a.opts.Location).Format("2006-01-02")
+			}
+		case GroupWeek:
+			keys[i] = "unknown"
+			if hasTime {
+				year, week := ts.In(a.opts.Location).ISOWeek()
+				keys[i] = fmt.Sprintf("%d-W%02d", year, week)
+			}
+		case GroupProject:
+			keys[i] = session.Project()
+		case GroupModel:
+			keys[i] = msg.Model
+			if keys[i] == "" {
+				keys[i] = "-"
+			}
+		case GroupMachine:
+			keys[i] = a.machine(session.File.SourceDir)
+		}
+	}
+	return keys
+}
+
+func (a *Aggregator) machine(sourceDir string) string {
+	if name, ok := a.opts.Machines[sourceDir]; ok {
+		return name
+	}
+	if sourceDir != "" {
+		return sourceDir
+	}
+	return a.opts.MachineID
+}
+
+func (a *Aggregator) bucketFor(keys []string) *bucket {
+	id := strings.Join(keys, "\x00")
+	if b, ok := a.buckets[id]; ok {
+		return b
+	}
+
+	group := make(map[string]string, len(keys))
+	for i, g := range a.opts.GroupBy {
+		group[g] = keys[i]
+	}
+
+	b := &bucket{
+		row:      &Row{Group: group, keys: keys},
+		sessions: make(map[string]*span),
+	}
+	a.buckets[id] = b
+	return b
+}
@@ -0,0 +1,175 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/sync"
+)
+
+func testSession() *sync.Session {
+	usage := sync.Usage{InputTokens: 10, OutputTokens: 20, CacheCreationInputTokens: 100, CacheReadInputTokens: 1000}
+	return &sync.Session{
+		File:     sync.FileInfo{SessionID: "s1", ProjectPath: "/-work-app"},
+		Metadata: &sync.SessionMetadata{CWD: "/work/app"},
+		Messages: []sync.Message{
+			{UUID: "1", Role: "user", Timestamp: "2025-01-06T10:00:00Z"},
+			// One API response split across two records with repeated usage
+			{UUID: "2", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:01:00Z", ResponseID: "msg_a", Usage: usage,
+				Blocks: []sync.ContentBlock{{Type: "text", Text: "Looking"}}},
+			{UUID: "3", Role: "assistant", Model: "claude-opus", Timestamp: "2025-01-06T10:01:01Z", ResponseID: "msg_a", Usage: usage,
+				Blocks: []sync.ContentBlock{{Type: "tool_use", Name: "Bash", ID: "t1"}}},
+			{UUID: "4", Role: "user", Timestamp: "2025-01-06T10:02:00Z"},
+			{UUID: "5", Role: "assistant", Model: "claude-sonnet", Timestamp: "2025-01-07T09:00:00Z", ResponseID: "msg_b",
+				Usage: sync.Usage{InputTokens: 1, OutputTokens: 2}},
+		},
+	}
+}
+
+func TestAggregator_ByProject(t *testing.T) {
+	agg, err := New(Options{GroupBy: []string{GroupProject}, Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.Add(testSession())
+
+	rows := agg.Rows()
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+
+	r := rows[0]
+	if r.Group[GroupProject] != "/work/app" {
+		t.Errorf("expected project from cwd, got %s", r.Group[GroupProject])
+	}
+	if r.Sessions != 1 || r.Messages != 5 {
+		t.Errorf("expected 1 session and 5 messages, got %d and %d", r.Sessions, r.Messages)
+	}
+	if r.InputTokens != 11 || r.OutputTokens != 22 {
+		t.Errorf("expected usage counted once per response, got input=%d output=%d", r.InputTokens, r.OutputTokens)
+	}
+	if r.CacheCreationTokens != 100 || r.CacheReadTokens != 1000 {
+		t.Errorf("unexpected cache tokens: %d/%d", r.CacheCreationTokens, r.CacheReadTokens)
+	}
+	if r.ToolCalls != 1 {
+		t.Errorf("expected 1 tool call, got %d", r.ToolCalls)
+	}
+	if r.Duration != 23*time.Hour {
+		t.Errorf("expected 23h duration, got %s", r.Duration)
+	}
+}
+
+func TestAggregator_ByDayAndModel(t *testing.T) {
+	agg, err := New(Options{GroupBy: []string{GroupDay, GroupModel}, Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.Add(testSession())
+
+	rows := agg.Rows()
+	got := make([]string, len(rows))
+	for i, r := range rows {
+		got[i] = r.Group[GroupDay] + "/" + r.Group[GroupModel]
+	}
+	expected := []string{"2025-01-06/-", "2025-01-06/claude-opus", "2025-01-07/claude-sonnet"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected rows %v, got %v", expected, got)
+	}
+
+	// Duration only covers the session's activity within each row
+	if rows[1].Duration != time.Second {
+		t.Errorf("expected 1s duration for opus row, got %s", rows[1].Duration)
+	}
+}
+
+func TestAggregator_TimeWindow(t *testing.T) {
+	agg, err := New(Options{
+		GroupBy:  []string{GroupWeek},
+		Since:    time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC),
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.Add(testSession())
+
+	rows := agg.Rows()
+	if len(rows) != 1 || rows[0].Messages != 1 {
+		t.Fatalf("expected only the message on 2025-01-07, got %+v", rows)
+	}
+	if rows[0].Group[GroupWeek] != "2025-W02" {
+		t.Errorf("expected ISO week 2025-W02, got %s", rows[0].Group[GroupWeek])
+	}
+}
+
+func TestAdd_GroupsByMachine(t *testing.T) {
+	agg, _ := New(Options{
+		GroupBy:   []string{GroupMachine},
+		MachineID: "laptop",
+		Machines:  map[string]string{"/home/jo/.claude/projects": "laptop"},
+	})
+	for _, dir := range []string{"/home/jo/.claude/projects", "/mnt/devcontainer/.claude/projects", ""} {
+		session := testSession()
+		session.File.SourceDir = dir
+		agg.Add(session)
+	}
+
+	got := map[string]int{}
+	for _, row := range agg.Rows() {
+		got[row.Group[GroupMachine]] = row.Messages
+	}
+	if len(got) != 2 || got["laptop"] != 10 || got["/mnt/devcontainer/.claude/projects"] != 5 {
+		t.Errorf("expected the devcontainer's sessions apart from this machine's, got %v", got)
+	}
+}
+
+func TestNew_RejectsUnknownGroup(t *testing.T) {
+	if _, err := New(Options{GroupBy: []string{"colour"}}); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
+
+func TestWrite_Formats(t *testing.T) {
+	agg, _ := New(Options{GroupBy: []string{GroupMachine}, MachineID: "laptop"})
+	agg.Add(testSession())
+	rows := agg.Rows()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "csv", []string{GroupMachine}, rows); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "machine,sessions,messages,input_tokens,output_tokens,cache_creation_tokens,cache_read_tokens,tool_calls,duration_seconds" {
+		t.Errorf("unexpected CSV header: %s", lines[0])
+	}
+	if lines[1] != "laptop,1,5,11,22,100,1000,1,82800" {
+		t.Errorf("unexpected CSV row: %s", lines[1])
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "json", []string{GroupMachine}, rows); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if decoded[0]["duration_seconds"].(float64) != 82800 {
+		t.Errorf("unexpected JSON row: %v", decoded[0])
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "table", []string{GroupMachine}, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "laptop") || !strings.Contains(buf.String(), "23h0m0s") {
+		t.Errorf("unexpected table output:\n%s", buf.String())
+	}
+
+	if err := Write(&buf, "xml", nil, rows); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
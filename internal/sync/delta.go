@@ -4,7 +4,11 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
 )
 
 type Message struct {
@@ -15,6 +19,43 @@ type Message struct {
 	Model     string `json:"model,omitempty"`
 	Type      string `json:"type,omitempty"`
 	Tokens    int    `json:"tokens,omitempty"`
+
+	// The fields below are only filled from Claude Code records and are
+	// excluded from JSON so they don't change the server-compatible hash.
+	ResponseID string         `json:"-"` // API message ID, shared by records split from one response
+	Usage      Usage          `json:"-"`
+	Blocks     []ContentBlock `json:"-"`
+}
+
+// Usage holds the token counts Claude Code records for an API response.
+type Usage struct {
+	InputTokens              int
+	OutputTokens             int
+	CacheCreationInputTokens int
+	CacheReadInputTokens     int
+}
+
+// ContentBlock is one entry of a structured message content array. Text
+// holds the text of text and thinking blocks and the text of tool results;
+// Name and ID identify tool calls (ID is the tool_use_id for results).
+type ContentBlock struct {
+	Type    string
+	Text    string
+	Name    string
+	ID      string
+	Input   json.RawMessage
+	IsError bool
+}
+
+// ToolCalls counts the tool_use blocks in the message.
+func (m *Message) ToolCalls() int {
+	count := 0
+	for _, b := range m.Blocks {
+		if b.Type == "tool_use" {
+			count++
+		}
+	}
+	return count
 }
 
 // ClaudeCodeMessage represents the actual format from Claude Code conversation files
@@ -23,6 +64,10 @@ type ClaudeCodeMessage struct {
 	Timestamp string                 `json:"timestamp"`
 	Type      string                 `json:"type"`
 	Message   map[string]interface{} `json:"message"`
+	CWD       string                 `json:"cwd,omitempty"`
+	GitBranch string                 `json:"gitBranch,omitempty"`
+	Version   string                 `json:"version,omitempty"`
+	UserType  string                 `json:"userType,omitempty"`
 }
 
 // ToMessage converts ClaudeCodeMessage to our simplified Message format
@@ -55,6 +100,9 @@ func (ccm *ClaudeCodeMessage) ToMessage() *Message {
 						textParts = append(textParts, text)
 					}
 				}
+				if block, ok := parseContentBlock(itemMap); ok {
+					msg.Blocks = append(msg.Blocks, block)
+				}
 			}
 		}
 		if len(textParts) > 0 {
@@ -67,77 +115,171 @@ func (ccm *ClaudeCodeMessage) ToMessage() *Message {
 		msg.Model = model
 	}
 
+	if id, ok := ccm.Message["id"].(string); ok {
+		msg.ResponseID = id
+	}
+	if usage, ok := ccm.Message["usage"].(map[string]interface{}); ok {
+		msg.Usage = Usage{
+			InputTokens:              intField(usage, "input_tokens"),
+			OutputTokens:             intField(usage, "output_tokens"),
+			CacheCreationInputTokens: intField(usage, "cache_creation_input_tokens"),
+			CacheReadInputTokens:     intField(usage, "cache_read_input_tokens"),
+		}
+	}
+
 	return msg
 }
 
+func parseContentBlock(item map[string]interface{}) (ContentBlock, bool) {
+	blockType, _ := item["type"].(string)
+	block := ContentBlock{Type: blockType}
+
+	switch blockType {
+	case "text":
+		block.Text, _ = item["text"].(string)
+	case "thinking":
+		block.Text, _ = item["thinking"].(string)
+	case "tool_use":
+		block.Name, _ = item["name"].(string)
+		block.ID, _ = item["id"].(string)
+		if input, ok := item["input"]; ok {
+			block.Input, _ = json.Marshal(input)
+		}
+	case "tool_result":
+		block.ID, _ = item["tool_use_id"].(string)
+		block.Text = flattenText(item["content"])
+		block.IsError, _ = item["is_error"].(bool)
+	default:
+		return block, false
+	}
+
+	return block, true
+}
+
+// flattenText returns the text of a tool result, whose content is either a
+// plain string or an array of text blocks.
+func flattenText(content interface{}) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+
+	var parts []string
+	if items, ok := content.([]interface{}); ok {
+		for _, item := range items {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				if text, ok := itemMap["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func intField(m map[string]interface{}, key string) int {
+	if v, ok := m[key].(float64); ok {
+		return int(v)
+	}
+	return 0
+}
+
 type Delta struct {
 	SessionID   string
 	ProjectPath string
 	Messages    []Message
 	NewLastUUID string
+	Metadata    *SessionMetadata
 }
 
 func CalculateDelta(file FileInfo, lastSyncedUUID string) (*Delta, error) {
-	f, err := os.Open(file.Path)
+	meta := &SessionMetadata{SourceDir: file.SourceDir}
+	allMessages, err := readMessages(file.Path, meta.observe)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find new messages after lastSyncedUUID
+	newMessages := extractNewMessages(allMessages, lastSyncedUUID)
+	if lastSyncedUUID != "" && len(newMessages) > 0 && len(newMessages) == len(allMessages) {
+		slog.Warn("last synced message not found, syncing the whole session again",
+			logging.KeySession, file.SessionID, logging.KeyProject, file.ProjectPath, logging.KeyMessages, len(allMessages))
+	}
+
+	if len(newMessages) == 0 {
+		return nil, nil // No new messages
+	}
+
+	lastMsg := newMessages[len(newMessages)-1]
+
+	return &Delta{
+		SessionID:   file.SessionID,
+		ProjectPath: file.ProjectPath,
+		Messages:    newMessages,
+		NewLastUUID: lastMsg.UUID,
+		Metadata:    meta,
+	}, nil
+}
+
+// readMessages parses a conversation file into messages. If observe is
+// non-nil it is called for every record in Claude Code format, including
+// records that don't carry a message, so callers can pick up session-level
+// fields such as cwd and gitBranch.
+func readMessages(path string, observe func(*ClaudeCodeMessage)) ([]Message, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("opening file %s: %w", file.Path, err)
+		return nil, fmt.Errorf("opening file %s: %w", path, err)
 	}
 	defer f.Close()
 
-	var allMessages []Message
+	var messages []Message
 	scanner := bufio.NewScanner(f)
 	// Increase buffer size for large messages (up to 10MB per line for images/tool results)
 	buf := make([]byte, 0, 10*1024*1024)
 	scanner.Buffer(buf, 10*1024*1024)
 
 	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		// Try parsing as Claude Code format first
-		var ccMsg ClaudeCodeMessage
-		if err := json.Unmarshal(line, &ccMsg); err == nil {
-			if msg := ccMsg.ToMessage(); msg != nil && msg.UUID != "" && msg.Role != "" {
-				allMessages = append(allMessages, *msg)
-				continue
-			}
+		if msg := parseLine(scanner.Bytes(), observe); msg != nil {
+			messages = append(messages, *msg)
 		}
+	}
 
-		// Fall back to legacy format for backwards compatibility
-		var msg Message
-		if err := json.Unmarshal(line, &msg); err != nil {
-			// Skip malformed lines
-			continue
-		}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning file %s: %w", path, err)
+	}
 
-		if msg.UUID == "" || msg.Role == "" {
-			continue
-		}
+	return messages, nil
+}
 
-		allMessages = append(allMessages, msg)
+// parseLine parses one line of a conversation file, returning nil for
+// blank, malformed and non-message lines.
+func parseLine(line []byte, observe func(*ClaudeCodeMessage)) *Message {
+	if len(line) == 0 {
+		return nil
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scanning file %s: %w", file.Path, err)
+	// Try parsing as Claude Code format first
+	var ccMsg ClaudeCodeMessage
+	if err := json.Unmarshal(line, &ccMsg); err == nil {
+		if observe != nil {
+			observe(&ccMsg)
+		}
+		if msg := ccMsg.ToMessage(); msg != nil && msg.UUID != "" && msg.Role != "" {
+			return msg
+		}
 	}
 
-	// Find new messages after lastSyncedUUID
-	newMessages := extractNewMessages(allMessages, lastSyncedUUID)
-
-	if len(newMessages) == 0 {
-		return nil, nil // No new messages
+	// Fall back to legacy format for backwards compatibility
+	var msg Message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		// Skip malformed lines
+		return nil
 	}
 
-	lastMsg := newMessages[len(newMessages)-1]
+	if msg.UUID == "" || msg.Role == "" {
+		return nil
+	}
 
-	return &Delta{
-		SessionID:   file.SessionID,
-		ProjectPath: file.ProjectPath,
-		Messages:    newMessages,
-		NewLastUUID: lastMsg.UUID,
-	}, nil
+	return &msg
 }
 
 func extractNewMessages(messages []Message, lastSyncedUUID string) []Message {
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Follower reads a conversation file incrementally as Claude Code appends
+// to it. Each call to Next returns the messages from lines completed since
+// the previous call; a trailing partial line is held back until its newline
+// arrives.
+type Follower struct {
+	file    FileInfo
+	offset  int64
+	partial []byte
+	meta    *SessionMetadata
+}
+
+func NewFollower(file FileInfo) *Follower {
+	return &Follower{
+		file: file,
+		meta: &SessionMetadata{SourceDir: file.SourceDir},
+	}
+}
+
+// Next returns newly appended messages. If the file shrank since the last
+// call it was truncated or replaced, so reading restarts from the beginning
+// and reset is true.
+func (f *Follower) Next() (messages []Message, reset bool, err error) {
+	fh, err := os.Open(f.file.Path)
+	if err != nil {
+		return nil, false, fmt.Errorf("opening file %s: %w", f.file.Path, err)
+	}
+	defer fh.Close()
+
+	info, err := fh.Stat()
+	if err != nil {
+		return nil, false, fmt.Errorf("stat file %s: %w", f.file.Path, err)
+	}
+	if info.Size() < f.offset {
+		f.offset = 0
+		f.partial = nil
+		f.meta = &SessionMetadata{SourceDir: f.file.SourceDir}
+		reset = true
+	}
+	if info.Size() == f.offset {
+		return nil, reset, nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(fh, f.offset, info.Size()-f.offset))
+	if err != nil {
+		return nil, reset, fmt.Errorf("reading file %s: %w", f.file.Path, err)
+	}
+	f.offset += int64(len(data))
+
+	data = append(f.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		f.partial = data
+		return nil, reset, nil
+	}
+	f.partial = append([]byte(nil), data[end+1:]...)
+
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		if msg := parseLine(line, f.meta.observe); msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+
+	return messages, reset, nil
+}
+
+// Metadata returns the session metadata observed in the lines read so far.
+func (f *Follower) Metadata() *SessionMetadata {
+	return f.meta
+}
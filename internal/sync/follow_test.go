@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollower_ReadsAppendedLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s1.jsonl")
+
+	line1 := `{"uuid":"u1","timestamp":"2025-01-06T10:00:00Z","type":"user","cwd":"/work/app","message":{"role":"user","content":"hello"}}` + "\n"
+	line2 := `{"uuid":"a1","timestamp":"2025-01-06T10:00:01Z","type":"assistant","message":{"role":"assistant","content":"hi"}}` + "\n"
+	line3 := `{"uuid":"u2","timestamp":"2025-01-06T10:00:02Z","type":"user","message":{"role":"user","content":"bye"}}` + "\n"
+
+	// The third line is only half written
+	if err := os.WriteFile(path, []byte(line1+line2+line3[:20]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFollower(FileInfo{Path: path, SessionID: "s1"})
+
+	messages, reset, err := f.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reset || len(messages) != 2 {
+		t.Fatalf("expected 2 messages without reset, got %d (reset=%v)", len(messages), reset)
+	}
+	if f.Metadata().CWD != "/work/app" {
+		t.Errorf("expected cwd from observed records, got %q", f.Metadata().CWD)
+	}
+
+	messages, _, err = f.Next()
+	if err != nil || len(messages) != 0 {
+		t.Fatalf("expected no messages before the line completes, got %d (%v)", len(messages), err)
+	}
+
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.WriteString(line3[20:])
+	fh.Close()
+
+	messages, _, err = f.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 || messages[0].UUID != "u2" {
+		t.Fatalf("expected completed line u2, got %+v", messages)
+	}
+
+	// Replacing the file with a shorter one restarts from the beginning
+	if err := os.WriteFile(path, []byte(line2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	messages, reset, err = f.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reset || len(messages) != 1 || messages[0].UUID != "a1" {
+		t.Fatalf("expected reset with message a1, got %+v (reset=%v)", messages, reset)
+	}
+}
@@ -1,12 +1,13 @@
 package sync
 
 import (
-	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
+
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/redact"
 )
 
 // CalculateContentHash calculates SHA-256 hash of conversation content.
@@ -21,50 +22,16 @@ func CalculateContentHash(content string) string {
 
 // CalculateFileHash calculates the hash for a conversation file.
 // It reads the file, converts it to the same JSONL format as the server,
-// and calculates the hash.
-func CalculateFileHash(file FileInfo) (string, error) {
-	f, err := os.Open(file.Path)
+// and calculates the hash. Message content is redacted and then sealed
+// with k first, and the project path sealed, as they are before upload,
+// so the hash matches what the server has; r and k may be nil.
+func CalculateFileHash(file FileInfo, r *redact.Redactor, k *e2ee.Key) (string, error) {
+	messages, err := readMessages(file.Path, nil)
 	if err != nil {
-		return "", fmt.Errorf("opening file %s: %w", file.Path, err)
+		return "", err
 	}
-	defer f.Close()
-
-	// Read all messages
-	var messages []Message
-	scanner := bufio.NewScanner(f)
-	buf := make([]byte, 0, 10*1024*1024)
-	scanner.Buffer(buf, 10*1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		// Try parsing as Claude Code format first
-		var ccMsg ClaudeCodeMessage
-		if err := json.Unmarshal(line, &ccMsg); err == nil {
-			if msg := ccMsg.ToMessage(); msg != nil && msg.UUID != "" && msg.Role != "" {
-				messages = append(messages, *msg)
-				continue
-			}
-		}
-
-		// Fall back to legacy format
-		var msg Message
-		if err := json.Unmarshal(line, &msg); err != nil {
-			continue
-		}
-
-		if msg.UUID == "" || msg.Role == "" {
-			continue
-		}
-
-		messages = append(messages, msg)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("scanning file %s: %w", file.Path, err)
+	for i := range messages {
+		messages[i].Content = k.Seal(file.SessionID, e2ee.MessageField(messages[i].UUID), r.String(messages[i].Content))
 	}
 
 	if len(messages) == 0 {
@@ -76,7 +43,7 @@ func CalculateFileHash(file FileInfo) (string, error) {
 	metadata := map[string]interface{}{
 		"sessionId":    file.SessionID,
 		"userId":       "",  // Will be set by server
-		"projectPath":  file.ProjectPath,
+		"projectPath":  k.Seal(file.SessionID, e2ee.FieldProjectPath, file.ProjectPath),
 		"timestamp":    messages[0].Timestamp,
 		"startTime":    messages[0].Timestamp,
 		"endTime":      messages[len(messages)-1].Timestamp,
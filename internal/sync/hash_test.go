@@ -1,8 +1,14 @@
 package sync
 
 import (
+	"bytes"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/martinjt/claude-history-cli/internal/e2ee"
+	"github.com/martinjt/claude-history-cli/internal/redact"
 )
 
 func TestCalculateContentHash(t *testing.T) {
@@ -187,3 +193,57 @@ func createTestJSONL() string {
 
 	return jsonl
 }
+
+func TestCalculateFileHash_Redacted(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) FileInfo {
+		path := filepath.Join(dir, name)
+		line := `{"uuid":"m1","timestamp":"2024-01-01T00:00:00Z","type":"user","message":{"role":"user","content":"` + content + `"}}` + "\n"
+		if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return FileInfo{Path: path, SessionID: "s", ProjectPath: "/p"}
+	}
+
+	r, err := redact.New([]redact.Rule{{Pattern: `sk-[a-z]+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := CalculateFileHash(write("raw.jsonl", "key sk-secret"), r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted, err := CalculateFileHash(write("redacted.jsonl", "key [REDACTED]"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != redacted {
+		t.Error("expected hash of redacted content to match what is uploaded")
+	}
+}
+
+func TestCalculateFileHash_Sealed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.jsonl")
+	line := `{"uuid":"m1","timestamp":"2024-01-01T00:00:00Z","type":"user","message":{"role":"user","content":"hello"}}` + "\n"
+	if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file := FileInfo{Path: path, SessionID: "s", ProjectPath: "/p"}
+
+	k, err := e2ee.NewKey(bytes.Repeat([]byte{1}, e2ee.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := CalculateFileHash(file, nil, nil)
+	sealed, err := CalculateFileHash(file, nil, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == plain {
+		t.Error("expected the hash to cover the sealed content the server receives")
+	}
+	if again, _ := CalculateFileHash(file, nil, k); again != sealed {
+		t.Error("expected the sealed hash to be stable, so unchanged sessions are skipped")
+	}
+}
@@ -1,25 +1,68 @@
 package sync
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/martinjt/claude-history-cli/internal/logging"
 )
 
 type FileInfo struct {
 	Path        string
 	ProjectPath string
 	SessionID   string
+	SourceDir   string
 	ModTime     int64
 	Size        int64
 }
 
+// ScanDirs scans several data directories and merges the results. A session
+// that appears in more than one directory (for example a home directory that
+// is also bind-mounted into a devcontainer) is reported once, using the most
+// recently modified copy.
+func ScanDirs(baseDirs []string, excludePatterns []string) ([]FileInfo, error) {
+	var files []FileInfo
+	index := make(map[string]int)
+
+	for _, dir := range baseDirs {
+		found, err := ScanForJSONL(dir, excludePatterns)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", dir, err)
+		}
+
+		for _, file := range found {
+			i, seen := index[file.SessionID]
+			if !seen {
+				index[file.SessionID] = len(files)
+				files = append(files, file)
+				continue
+			}
+			if isNewerCopy(file, files[i]) {
+				files[i] = file
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func isNewerCopy(candidate, existing FileInfo) bool {
+	if candidate.ModTime != existing.ModTime {
+		return candidate.ModTime > existing.ModTime
+	}
+	return candidate.Size > existing.Size
+}
+
 func ScanForJSONL(baseDir string, excludePatterns []string) ([]FileInfo, error) {
 	var files []FileInfo
 
 	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			// Skip directories we can't read
+			slog.Debug("skipping unreadable path", "path", path, logging.KeyError, err)
 			if info != nil && info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -38,21 +81,11 @@ func ScanForJSONL(baseDir string, excludePatterns []string) ([]FileInfo, error)
 			return nil
 		}
 
-		if isExcluded(path, excludePatterns) {
+		if IsExcluded(path, excludePatterns) {
 			return nil
 		}
 
-		relPath, _ := filepath.Rel(baseDir, path)
-		projectPath := extractProjectPath(relPath)
-		sessionID := extractSessionID(info.Name())
-
-		files = append(files, FileInfo{
-			Path:        path,
-			ProjectPath: projectPath,
-			SessionID:   sessionID,
-			ModTime:     info.ModTime().Unix(),
-			Size:        info.Size(),
-		})
+		files = append(files, newFileInfo(baseDir, path, info))
 
 		return nil
 	})
@@ -60,6 +93,41 @@ func ScanForJSONL(baseDir string, excludePatterns []string) ([]FileInfo, error)
 	return files, err
 }
 
+// FileInfoFor describes a single conversation file, as ScanDirs would have
+// reported it. The file is attributed to the first data directory that
+// contains it; a file outside all of them is attributed to the directory
+// two levels up, matching the <data dir>/<project>/<session>.jsonl layout.
+func FileInfoFor(baseDirs []string, path string) (FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if info.IsDir() {
+		return FileInfo{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	for _, dir := range baseDirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return newFileInfo(dir, path, info), nil
+		}
+	}
+
+	return newFileInfo(filepath.Dir(filepath.Dir(path)), path, info), nil
+}
+
+func newFileInfo(baseDir, path string, info os.FileInfo) FileInfo {
+	relPath, _ := filepath.Rel(baseDir, path)
+
+	return FileInfo{
+		Path:        path,
+		ProjectPath: extractProjectPath(relPath),
+		SessionID:   extractSessionID(info.Name()),
+		SourceDir:   baseDir,
+		ModTime:     info.ModTime().Unix(),
+		Size:        info.Size(),
+	}
+}
+
 func extractProjectPath(relPath string) string {
 	dir := filepath.Dir(relPath)
 	if dir == "." {
@@ -73,7 +141,8 @@ func extractSessionID(filename string) string {
 	return strings.TrimSuffix(filename, ".jsonl")
 }
 
-func isExcluded(path string, patterns []string) bool {
+// IsExcluded reports whether a file matches one of the exclude patterns.
+func IsExcluded(path string, patterns []string) bool {
 	for _, pattern := range patterns {
 		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
 			return true
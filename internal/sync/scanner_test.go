@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestScanForJSONL(t *testing.T) {
@@ -92,3 +93,91 @@ func TestExtractSessionID(t *testing.T) {
 		}
 	}
 }
+
+func TestScanDirs_DedupesAcrossDirs(t *testing.T) {
+	home := t.TempDir()
+	container := t.TempDir()
+
+	for _, dir := range []string{home, container} {
+		if err := os.MkdirAll(filepath.Join(dir, "proj"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldPath := filepath.Join(home, "proj", "shared.jsonl")
+	newPath := filepath.Join(container, "proj", "shared.jsonl")
+	if err := os.WriteFile(oldPath, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte("{}\n{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "proj", "only-home.jsonl"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(oldPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ScanDirs([]string{home, container, filepath.Join(home, "missing")}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 unique sessions, got %d", len(files))
+	}
+
+	for _, f := range files {
+		switch f.SessionID {
+		case "shared":
+			if f.Path != newPath {
+				t.Errorf("expected newest copy %s, got %s", newPath, f.Path)
+			}
+			if f.SourceDir != container {
+				t.Errorf("expected source dir %s, got %s", container, f.SourceDir)
+			}
+		case "only-home":
+			if f.SourceDir != home {
+				t.Errorf("expected source dir %s, got %s", home, f.SourceDir)
+			}
+		default:
+			t.Errorf("unexpected session %s", f.SessionID)
+		}
+	}
+}
+
+func TestFileInfoFor(t *testing.T) {
+	dataDir := t.TempDir()
+	projectDir := filepath.Join(dataDir, "-work-app")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(projectDir, "abc123.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := FileInfoFor([]string{t.TempDir(), dataDir}, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.SessionID != "abc123" || file.ProjectPath != "/-work-app" || file.SourceDir != dataDir || file.Size != 3 {
+		t.Errorf("unexpected file info: %+v", file)
+	}
+
+	// Outside every data directory the layout is assumed
+	file, err = FileInfoFor(nil, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.SourceDir != dataDir || file.ProjectPath != "/-work-app" {
+		t.Errorf("unexpected file info outside data dirs: %+v", file)
+	}
+
+	if _, err := FileInfoFor(nil, filepath.Join(projectDir, "missing.jsonl")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoSession means no session file matches the ID asked for.
+var ErrNoSession = errors.New("no session")
+
+// Session is a fully parsed conversation file. It is used by the local
+// commands that look at whole sessions rather than sync deltas.
+type Session struct {
+	File     FileInfo
+	Messages []Message
+	Metadata *SessionMetadata
+}
+
+func ReadSession(file FileInfo) (*Session, error) {
+	meta := &SessionMetadata{SourceDir: file.SourceDir}
+	messages, err := readMessages(file.Path, meta.observe)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		File:     file,
+		Messages: messages,
+		Metadata: meta,
+	}, nil
+}
+
+// Project returns the working directory the session ran in when Claude Code
+// recorded it, falling back to the project path derived from the file
+// location.
+func (s *Session) Project() string {
+	if s.Metadata != nil && s.Metadata.CWD != "" {
+		return s.Metadata.CWD
+	}
+	return s.File.ProjectPath
+}
+
+// FindSession resolves a session ID or unique prefix of one. An exact match
+// always wins; a prefix shared by several sessions is an error listing them.
+func FindSession(files []FileInfo, id string) (FileInfo, error) {
+	var matches []FileInfo
+	for _, file := range files {
+		if file.SessionID == id {
+			return file, nil
+		}
+		if id != "" && len(file.SessionID) > len(id) && strings.HasPrefix(file.SessionID, id) {
+			matches = append(matches, file)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return FileInfo{}, fmt.Errorf("%w matching %q", ErrNoSession, id)
+	case 1:
+		return matches[0], nil
+	}
+
+	const maxListed = 5
+	var list strings.Builder
+	for i, m := range matches {
+		if i == maxListed {
+			fmt.Fprintf(&list, ", and %d more", len(matches)-maxListed)
+			break
+		}
+		if i > 0 {
+			list.WriteString(", ")
+		}
+		list.WriteString(m.SessionID)
+	}
+	return FileInfo{}, fmt.Errorf("session ID %q is ambiguous: matches %s", id, list.String())
+}
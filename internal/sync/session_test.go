@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSession_ParsesUsageAndBlocks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s1.jsonl")
+
+	content := `{"uuid":"u1","timestamp":"2025-01-06T10:00:00Z","type":"user","cwd":"/work/app","message":{"role":"user","content":"List files"}}
+{"uuid":"a1","timestamp":"2025-01-06T10:00:05Z","type":"assistant","message":{"id":"msg_1","role":"assistant","model":"claude-opus","content":[{"type":"text","text":"Sure"},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}],"usage":{"input_tokens":12,"output_tokens":34,"cache_creation_input_tokens":56,"cache_read_input_tokens":78}}}
+{"uuid":"u2","timestamp":"2025-01-06T10:00:06Z","type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"a.go\nb.go"}]}]}}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := ReadSession(FileInfo{Path: path, SessionID: "s1", ProjectPath: "/-work-app"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(session.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(session.Messages))
+	}
+	if session.Project() != "/work/app" {
+		t.Errorf("expected project /work/app, got %s", session.Project())
+	}
+
+	assistant := session.Messages[1]
+	if assistant.ResponseID != "msg_1" {
+		t.Errorf("expected response ID msg_1, got %s", assistant.ResponseID)
+	}
+	if assistant.Usage != (Usage{12, 34, 56, 78}) {
+		t.Errorf("unexpected usage: %+v", assistant.Usage)
+	}
+	if assistant.ToolCalls() != 1 || assistant.Blocks[1].Name != "Bash" {
+		t.Errorf("expected one Bash tool call, got %+v", assistant.Blocks)
+	}
+	if string(assistant.Blocks[1].Input) != `{"command":"ls"}` {
+		t.Errorf("unexpected tool input: %s", assistant.Blocks[1].Input)
+	}
+
+	result := session.Messages[2].Blocks
+	if len(result) != 1 || result[0].Type != "tool_result" || result[0].ID != "toolu_1" || result[0].Text != "a.go\nb.go" {
+		t.Errorf("unexpected tool result blocks: %+v", result)
+	}
+
+	// Parsed-only fields must not leak into the hashed JSON form
+	data, err := json.Marshal(assistant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Usage", "Blocks", "ResponseID"} {
+		if strings.Contains(string(data), field) {
+			t.Errorf("expected %s to be excluded from JSON: %s", field, data)
+		}
+	}
+}
+
+func TestFindSession(t *testing.T) {
+	files := []FileInfo{
+		{SessionID: "abc123"},
+		{SessionID: "abc456"},
+		{SessionID: "abc"},
+		{SessionID: "def789"},
+	}
+
+	tests := []struct {
+		id      string
+		want    string
+		wantErr string
+	}{
+		{id: "def", want: "def789"},
+		{id: "abc4", want: "abc456"},
+		{id: "abc", want: "abc"}, // exact match beats prefix matches
+		{id: "ab", wantErr: "ambiguous"},
+		{id: "xyz", wantErr: "no session"},
+		{id: "", wantErr: "no session"},
+	}
+
+	for _, tt := range tests {
+		file, err := FindSession(files, tt.id)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("FindSession(%q): expected error containing %q, got %v", tt.id, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FindSession(%q): unexpected error: %v", tt.id, err)
+			continue
+		}
+		if file.SessionID != tt.want {
+			t.Errorf("FindSession(%q) = %s, want %s", tt.id, file.SessionID, tt.want)
+		}
+	}
+}
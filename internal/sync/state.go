@@ -1,11 +1,14 @@
 package sync
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/martinjt/claude-history-cli/internal/filelock"
 )
 
 type SyncState struct {
@@ -17,6 +20,27 @@ type SessionState struct {
 	LastSyncedUUID string `json:"last_synced_uuid"`
 	LastSyncAt     string `json:"last_sync_at"`
 	MessageCount   int    `json:"message_count"`
+	Path           string `json:"path,omitempty"`
+	SourceDir      string `json:"source_dir,omitempty"`
+	ModTime        int64  `json:"mod_time,omitempty"`
+}
+
+// VanishReason explains why a tracked session file is no longer on disk.
+type VanishReason string
+
+const (
+	// VanishDeleted means the file disappeared while it was still inside
+	// Claude Code's retention window, so someone removed it on purpose.
+	VanishDeleted VanishReason = "deleted"
+	// VanishExpired means the file was last modified longer ago than the
+	// retention window and was most likely removed by Claude Code's cleanup.
+	VanishExpired VanishReason = "expired"
+)
+
+type VanishedSession struct {
+	SessionID string
+	Path      string
+	Reason    VanishReason
 }
 
 func DefaultStatePath() string {
@@ -27,6 +51,32 @@ func DefaultStatePath() string {
 	return filepath.Join(home, ".claude-history-sync", "state.json")
 }
 
+// ProfileStatePath returns the state file for a profile. The default
+// profile keeps the original state.json; others get state-<name>.json.
+func ProfileStatePath(profile string) string {
+	if profile == "" || profile == "default" {
+		return DefaultStatePath()
+	}
+	return filepath.Join(filepath.Dir(DefaultStatePath()), "state-"+profile+".json")
+}
+
+// stateLockStale is how long a state lock can go untouched before it's
+// taken to be left by a crashed process. Holders keep it fresh, so this
+// only bounds how long a crash blocks the next sync.
+const stateLockStale = time.Minute
+
+// LockState takes the lock on the state file at path, waiting for another
+// sync or hook to finish with it until ctx is done. Hold it from loading
+// the state until it is saved, so runs don't undo each other's progress.
+// The returned function releases it.
+func LockState(ctx context.Context, path string) (func(), error) {
+	release, err := filelock.Acquire(ctx, path+".lock", stateLockStale)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for another sync to finish: %w", err)
+	}
+	return release, nil
+}
+
 func LoadState(path string) (*SyncState, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -63,9 +113,18 @@ func (s *SyncState) Save(path string) error {
 		return fmt.Errorf("creating state directory: %w", err)
 	}
 
-	// Atomic write: write to temp file then rename
-	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+	// Atomic write: write to a temp file of our own then rename
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp state file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("writing temp state file: %w", err)
 	}
 
@@ -85,9 +144,71 @@ func (s *SyncState) GetLastSyncedUUID(sessionID string) string {
 }
 
 func (s *SyncState) UpdateSession(sessionID, lastUUID string, messageCount int) {
-	s.Sessions[sessionID] = SessionState{
-		LastSyncedUUID: lastUUID,
-		LastSyncAt:     time.Now().UTC().Format(time.RFC3339),
-		MessageCount:   messageCount,
+	session := s.Sessions[sessionID]
+	session.LastSyncedUUID = lastUUID
+	session.LastSyncAt = time.Now().UTC().Format(time.RFC3339)
+	session.MessageCount = messageCount
+	s.Sessions[sessionID] = session
+}
+
+// TrackFile records where a session lives on disk so that a later run can
+// notice when the file goes away.
+func (s *SyncState) TrackFile(file FileInfo) {
+	session := s.Sessions[file.SessionID]
+	session.Path = file.Path
+	session.SourceDir = file.SourceDir
+	session.ModTime = file.ModTime
+	s.Sessions[file.SessionID] = session
+}
+
+// FindVanished returns tracked sessions whose files no longer exist. Files
+// last modified before now-retention are reported as expired, anything
+// newer as deleted; a non-positive retention means nothing ages out.
+// Sessions in a data directory that is itself missing (an unmounted
+// volume, say) are left alone, as are entries recorded before file paths
+// were tracked.
+func (s *SyncState) FindVanished(now time.Time, retention time.Duration) []VanishedSession {
+	var vanished []VanishedSession
+	cutoff := now.Add(-retention).Unix()
+
+	for id, session := range s.Sessions {
+		if session.Path == "" {
+			continue
+		}
+		if session.SourceDir != "" {
+			if _, err := os.Stat(session.SourceDir); err != nil {
+				continue
+			}
+		}
+		if _, err := os.Stat(session.Path); !os.IsNotExist(err) {
+			continue
+		}
+
+		reason := VanishDeleted
+		if retention > 0 && session.ModTime < cutoff {
+			reason = VanishExpired
+		}
+		vanished = append(vanished, VanishedSession{
+			SessionID: id,
+			Path:      session.Path,
+			Reason:    reason,
+		})
+	}
+
+	return vanished
+}
+
+// ResetProgress forgets how far each session was synced, so the next sync
+// uploads every message again, like after the content key changes. Where
+// the files are is still tracked.
+func (s *SyncState) ResetProgress() {
+	for id, session := range s.Sessions {
+		session.LastSyncedUUID = ""
+		session.MessageCount = 0
+		s.Sessions[id] = session
 	}
 }
+
+func (s *SyncState) RemoveSession(sessionID string) {
+	delete(s.Sessions, sessionID)
+}
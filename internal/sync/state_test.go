@@ -1,8 +1,13 @@
 package sync
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"path/filepath"
+	gosync "sync"
 	"testing"
+	"time"
 )
 
 func TestSyncState_SaveAndLoad(t *testing.T) {
@@ -38,6 +43,48 @@ func TestSyncState_SaveAndLoad(t *testing.T) {
 	}
 }
 
+func TestLockState_NoLostUpdates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	// Each writer stands in for a sync or hook run updating one session
+	var wg gosync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := LockState(context.Background(), path)
+			if err != nil {
+				t.Errorf("LockState: %v", err)
+				return
+			}
+			defer release()
+			state, err := LoadState(path)
+			if err != nil {
+				t.Errorf("LoadState: %v", err)
+				return
+			}
+			state.UpdateSession(fmt.Sprintf("session-%d", i), "uuid", 1)
+			if err := state.Save(path); err != nil {
+				t.Errorf("Save: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Sessions) != 8 {
+		t.Errorf("expected every run's session to survive, got %d", len(state.Sessions))
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the state file to be left, got %v", entries)
+	}
+}
+
 func TestSyncState_LoadNonExistent(t *testing.T) {
 	state, err := LoadState("/nonexistent/path/state.json")
 	if err != nil {
@@ -85,3 +132,103 @@ func TestSyncState_UpdateSession(t *testing.T) {
 		t.Errorf("expected message count 5, got %d", sess.MessageCount)
 	}
 }
+
+func TestSyncState_UpdateSession_KeepsFileInfo(t *testing.T) {
+	state := &SyncState{
+		Sessions: make(map[string]SessionState),
+	}
+
+	state.TrackFile(FileInfo{SessionID: "session-1", Path: "/data/p/session-1.jsonl", SourceDir: "/data", ModTime: 100})
+	state.UpdateSession("session-1", "uuid-new", 5)
+
+	sess := state.Sessions["session-1"]
+	if sess.Path != "/data/p/session-1.jsonl" || sess.ModTime != 100 {
+		t.Errorf("expected file info to survive update, got %+v", sess)
+	}
+	if sess.LastSyncedUUID != "uuid-new" {
+		t.Errorf("expected uuid-new, got %s", sess.LastSyncedUUID)
+	}
+}
+
+func TestSyncState_ResetProgress(t *testing.T) {
+	state := &SyncState{
+		Sessions: make(map[string]SessionState),
+	}
+
+	state.TrackFile(FileInfo{SessionID: "session-1", Path: "/data/p/session-1.jsonl", SourceDir: "/data", ModTime: 100})
+	state.UpdateSession("session-1", "uuid-new", 5)
+	state.ResetProgress()
+
+	sess := state.Sessions["session-1"]
+	if sess.LastSyncedUUID != "" || sess.MessageCount != 0 {
+		t.Errorf("expected progress to be forgotten, got %+v", sess)
+	}
+	if sess.Path != "/data/p/session-1.jsonl" {
+		t.Errorf("expected the file to stay tracked, got %+v", sess)
+	}
+}
+
+func TestSyncState_FindVanished(t *testing.T) {
+	dataDir := t.TempDir()
+	present := filepath.Join(dataDir, "present.jsonl")
+	if err := os.WriteFile(present, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	retention := 30 * 24 * time.Hour
+	recent := now.Add(-time.Hour).Unix()
+	old := now.Add(-60 * 24 * time.Hour).Unix()
+
+	state := &SyncState{
+		Sessions: map[string]SessionState{
+			"present":   {Path: present, SourceDir: dataDir, ModTime: recent},
+			"deleted":   {Path: filepath.Join(dataDir, "deleted.jsonl"), SourceDir: dataDir, ModTime: recent},
+			"expired":   {Path: filepath.Join(dataDir, "expired.jsonl"), SourceDir: dataDir, ModTime: old},
+			"unmounted": {Path: "/nonexistent/data/x.jsonl", SourceDir: "/nonexistent/data", ModTime: recent},
+			"legacy":    {LastSyncedUUID: "uuid-1"},
+		},
+	}
+
+	vanished := state.FindVanished(now, retention)
+	reasons := make(map[string]VanishReason)
+	for _, v := range vanished {
+		reasons[v.SessionID] = v.Reason
+	}
+
+	if len(reasons) != 2 {
+		t.Fatalf("expected 2 vanished sessions, got %v", reasons)
+	}
+	if reasons["deleted"] != VanishDeleted {
+		t.Errorf("expected deleted session to be reported as deleted, got %q", reasons["deleted"])
+	}
+	if reasons["expired"] != VanishExpired {
+		t.Errorf("expected old session to be reported as expired, got %q", reasons["expired"])
+	}
+
+	// With retention disabled nothing ages out
+	for _, v := range state.FindVanished(now, 0) {
+		if v.Reason != VanishDeleted {
+			t.Errorf("expected %s to be reported as deleted without retention, got %q", v.SessionID, v.Reason)
+		}
+	}
+
+	state.RemoveSession("deleted")
+	if _, ok := state.Sessions["deleted"]; ok {
+		t.Error("expected session to be removed")
+	}
+}
+
+func TestProfileStatePath(t *testing.T) {
+	def := DefaultStatePath()
+	if got := ProfileStatePath(""); got != def {
+		t.Errorf("ProfileStatePath(\"\") = %q, want %q", got, def)
+	}
+	if got := ProfileStatePath("default"); got != def {
+		t.Errorf("ProfileStatePath(default) = %q, want %q", got, def)
+	}
+	want := filepath.Join(filepath.Dir(def), "state-work.json")
+	if got := ProfileStatePath("work"); got != want {
+		t.Errorf("ProfileStatePath(work) = %q, want %q", got, want)
+	}
+}
@@ -285,12 +285,13 @@ setup_cron() {
     print_success "Authentication successful! Ready for automatic syncing."
     echo ""
     print_info "You can set up automatic syncing to run every 5 minutes."
-    print_info "The cron job will call '${BINARY_NAME} sync' which:"
+    print_info "A systemd user timer (or cron job where systemd isn't available)"
+    print_info "will call '${BINARY_NAME} sync' which:"
     print_info "  - Scans your Claude conversation directory"
     print_info "  - Uploads new messages to the MCP server"
     print_info "  - Uses your stored authentication tokens"
     echo ""
-    print_warning "This will add a cron job to your crontab."
+    print_warning "This will add a systemd user timer or a cron job."
     echo ""
 
     read -p "Setup automatic sync? (Y/n) " -n 1 -r </dev/tty
@@ -304,20 +305,16 @@ setup_cron() {
         return
     fi
 
-    # Add cron job
-    CRON_LINE="*/5 * * * * ${INSTALL_DIR}/${BINARY_NAME} sync >> ${CONFIG_DIR}/sync.log 2>&1"
-
-    # Check if cron entry already exists
-    if crontab -l 2>/dev/null | grep -q "${BINARY_NAME} sync"; then
-        print_warning "Cron job already exists"
-    else
-        (crontab -l 2>/dev/null; echo "$CRON_LINE") | crontab -
+    if "${INSTALL_DIR}/${BINARY_NAME}" schedule install; then
         echo ""
-        print_success "Automatic sync configured (every 5 minutes)"
-        print_info "Logs will be written to: ${CONFIG_DIR}/sync.log"
+        print_success "Automatic sync configured"
         echo ""
-        print_info "To view sync logs:"
+        print_info "To check on scheduled syncs:"
+        print_info "  ${BINARY_NAME} schedule status"
         print_info "  tail -f ${CONFIG_DIR}/sync.log"
+    else
+        print_warning "Could not set up automatic sync"
+        print_info "You can retry later with: ${BINARY_NAME} schedule install"
     fi
 }
 
@@ -339,7 +336,7 @@ show_completion() {
     print_info "Logs: ${CONFIG_DIR}/sync.log"
     echo ""
 
-    if crontab -l 2>/dev/null | grep -q "${BINARY_NAME} sync"; then
+    if "${INSTALL_DIR}/${BINARY_NAME}" schedule status 2>/dev/null | grep -q "^Scheduler: .*(active)"; then
         print_success "Automatic sync is enabled (every 5 minutes)"
     else
         print_info "Manual sync: Run '${BINARY_NAME} sync' when needed"
@@ -381,7 +378,7 @@ main() {
         echo ""
         print_info "After authenticating, you can:"
         print_info "  - Manually sync: ${BINARY_NAME} sync"
-        print_info "  - Setup cron: Run this installer again or manually add cron job"
+        print_info "  - Schedule syncs: ${BINARY_NAME} schedule install"
         echo ""
 
         # Still show partial completion info